@@ -1,5 +1,11 @@
 package types
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 type ConnectorCreateOptions struct {
 	Name string
 	Cost int32
@@ -8,6 +14,17 @@ type ConnectorCreateOptions struct {
 type SiteConfig struct {
 	Spec SiteConfigSpec
 	UID  string
+	// Images has the images the router and the controller were created
+	// from at init or upgrade, by component, the proxies run the router's
+	Images map[string]SiteImage `json:",omitempty"`
+}
+
+// SiteImage identifies an image of the site, its id tells when a container
+// runs another image of the same name
+type SiteImage struct {
+	Name    string
+	ID      string
+	Version string
 }
 
 type SiteConfigSpec struct {
@@ -25,6 +42,142 @@ type SiteConfigSpec struct {
 	Replicas              int32
 	TraceLog              bool
 	ContainerEngineDriver string
+	// ContainerEngineEndpoint and the TLS material locate the engine, the
+	// driver and endpoint are detected at init when not given
+	ContainerEngineEndpoint  string
+	ContainerEngineTLSCACert string
+	ContainerEngineTLSCert   string
+	ContainerEngineTLSKey    string
+	// ContainerEnginePluginDir holds the driver plugins, the built-in
+	// drivers are used when empty
+	ContainerEnginePluginDir string
+	// ContainerEngineDriverRPC runs the driver out of process, it is the
+	// driver's unix:// socket or command line
+	ContainerEngineDriverRPC string
+	ImagePullPolicy          string
+	RegistryAuthFile         string
+	RegistryUser             string
+	// RegistryPassword is not stored with the site config, the resolved
+	// credentials are kept in a separate file only readable by the owner
+	RegistryPassword string `json:"-"`
+	// NetworkName is the container network of the site, skupper-network
+	// when empty, NetworkSubnet its subnet in CIDR notation, picked by the
+	// engine when empty
+	NetworkName   string
+	NetworkSubnet string
+	// TransportImage and ControllerImage are the images of the site,
+	// QDROUTERD_IMAGE, SKUPPER_CONTROLLER_IMAGE or the defaults when empty
+	TransportImage  string
+	ControllerImage string
+	// IngressHosts are the addresses other hosts reach the site at, the
+	// connecting sites try them in order. The inter-router and edge
+	// listeners are published on the host when given, the inter-router
+	// one on IngressPort, 55671 when zero.
+	IngressHosts []string
+	IngressPort  int
+	// Force replaces an existing site and Reconcile updates it to the
+	// spec, keeping its identity, CAs, connections and services. Neither
+	// is stored with the site config.
+	Force     bool `json:"-"`
+	Reconcile bool `json:"-"`
+}
+
+// RouterUpgradeOptions has the images to upgrade the site to, the ones of
+// RouterCreate when empty
+type RouterUpgradeOptions struct {
+	TransportImage  string
+	ControllerImage string
+	ImagePullPolicy string
+}
+
+// ConnectorTokenCreateOptions has the addresses the token points at, the
+// site's ingress when empty. An EdgeOnly token has no inter-router
+// endpoint, only edge sites connect with it. A token with an Expiry or
+// Uses is refused to the sites that did not connect with it before it
+// expired or was used by as many sites.
+type ConnectorTokenCreateOptions struct {
+	IngressHosts []string
+	IngressPort  int
+	EdgeOnly     bool
+	Expiry       time.Duration
+	Uses         int
+}
+
+// IssuedToken is the record a site keeps of a connection token it issued,
+// the name is the subject of the token's client certificate. A zero Expiry
+// or Uses is no limit.
+type IssuedToken struct {
+	Name    string
+	Created time.Time
+	Expiry  time.Time
+	Uses    int
+	Revoked bool
+}
+
+// TokenRedemption is a site that connected with a token, by the container
+// id of its router
+type TokenRedemption struct {
+	Site string
+	Time time.Time
+}
+
+// Token states
+const (
+	TokenActive  string = "active"
+	TokenExpired string = "expired"
+	TokenUsed    string = "used"
+	TokenRevoked string = "revoked"
+)
+
+type TokenInspectResponse struct {
+	Token       IssuedToken
+	Redemptions []TokenRedemption
+	Status      string
+}
+
+// TokenServeOptions has the endpoint a site claims a token from and the
+// token it is handed. The Host is the one in the claim URL, the site's
+// first ingress host or the host name when empty, and the Password is
+// generated when empty.
+type TokenServeOptions struct {
+	Host     string
+	Port     int
+	Password string
+	Timeout  time.Duration
+	Token    ConnectorTokenCreateOptions
+}
+
+// TokenClaim is what a site needs to claim a served token, the URL's path is
+// the fingerprint of the endpoint's certificate
+type TokenClaim struct {
+	URL      string
+	Password string
+}
+
+// CertRotateOptions selects the credentials to issue again, all of the
+// site's when none is given, and the CAs to replace, the credentials they
+// issued are issued again as well. With an Overlap the previous CAs stay
+// trusted and keep issuing the site's credentials until the rotation is
+// completed, so the sites connected with earlier tokens have time to get
+// new ones. The rotation is not completed when the overlap ends, the site's
+// status tells it is overdue.
+type CertRotateOptions struct {
+	Credentials []string
+	CAs         []string
+	Overlap     time.Duration
+	Complete    bool
+}
+
+type CertRotateResponse struct {
+	// Rotated has the CAs and the credentials issued again
+	Rotated []string
+	// OverlapEnds is when the rotation should be completed, zero when the
+	// previous CAs are no longer trusted
+	OverlapEnds time.Time
+	// StaleTokens stop working once the previous CA is no longer trusted,
+	// the Sites that connected with them need new tokens
+	StaleTokens []string
+	Sites       []string
 }
 
 type ServiceInterfaceCreateOptions struct {
@@ -35,11 +188,23 @@ type ServiceInterfaceCreateOptions struct {
 	Headless   bool
 }
 
+type ComponentLogsOptions struct {
+	Follow     bool
+	Since      string
+	Tail       string
+	Timestamps bool
+}
+
 type RouterInspectResponse struct {
 	Status            RouterStatusSpec
 	TransportVersion  string
 	ControllerVersion string
 	ExposedServices   int
+	// VersionSkew lists the components not running the site's images
+	VersionSkew []string
+	// OverdueRotations lists the CAs whose rotation overlapped past its end
+	// without being completed
+	OverdueRotations []string
 }
 
 type ConnectorInspectResponse struct {
@@ -50,24 +215,34 @@ type ConnectorInspectResponse struct {
 type RouterStatusSpec struct {
 	Mode           string                  `json:"mode,omitempty"`
 	State          string                  `json:"state,omitempty"`
+	Health         string                  `json:"health,omitempty"`
 	ConnectedSites TransportConnectedSites `json:"connectedSites,omitempty"`
 	BindingsCount  int                     `json:"bindingsCount,omitempty"`
 }
 
 type VanClientInterface interface {
-	ConnectorCreate(secretFile string, options ConnectorCreateOptions) (string, error)
-	ConnectorInspect(name string) (*ConnectorInspectResponse, error)
-	ConnectorList() ([]*Connector, error)
-	ConnectorRemove(name string) error
-	ConnectorTokenCreate(subject string, secretFile string) error
-	RouterCreate(options SiteConfigSpec) error
-	RouterInspect() (*RouterInspectResponse, error)
-	RouterRemove() []error
-	ServiceInterfaceBind(service *ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error
-	ServiceInterfaceCreate(service *ServiceInterface) error
-	ServiceInterfaceInspect(address string) (*ServiceInterface, error)
-	ServiceInterfaceList() ([]ServiceInterface, error)
-	ServiceInterfaceRemove(address string) error
-	ServiceInterfaceUnbind(targetType string, targetName string, address string, deleteIfNoTargets bool) error
-	SiteConfigInspect(name string) (*SiteConfig, error)
+	ComponentLogs(ctx context.Context, component string, address string, options ComponentLogsOptions, stdout io.Writer, stderr io.Writer) error
+	ConnectorCreate(ctx context.Context, secretFile string, options ConnectorCreateOptions) (string, error)
+	ConnectorInspect(ctx context.Context, name string) (*ConnectorInspectResponse, error)
+	ConnectorClaim(ctx context.Context, claim TokenClaim, options ConnectorCreateOptions) (string, error)
+	ConnectorList(ctx context.Context) ([]*Connector, error)
+	ConnectorRemove(ctx context.Context, name string) error
+	ConnectorTokenCreate(ctx context.Context, subject string, secretFile string, options ConnectorTokenCreateOptions) (string, error)
+	RotateCerts(ctx context.Context, options CertRotateOptions) (*CertRotateResponse, error)
+	RouterCreate(ctx context.Context, options SiteConfigSpec) error
+	RouterInspect(ctx context.Context) (*RouterInspectResponse, error)
+	RouterRemove(ctx context.Context) []error
+	RouterUpdate(ctx context.Context, options SiteConfigSpec) (bool, error)
+	RouterUpgrade(ctx context.Context, options RouterUpgradeOptions) error
+	ServiceInterfaceBind(ctx context.Context, service *ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error
+	ServiceInterfaceCreate(ctx context.Context, service *ServiceInterface) error
+	ServiceInterfaceInspect(ctx context.Context, address string) (*ServiceInterface, error)
+	ServiceInterfaceList(ctx context.Context) ([]ServiceInterface, error)
+	ServiceInterfaceRemove(ctx context.Context, address string) error
+	ServiceInterfaceUnbind(ctx context.Context, targetType string, targetName string, address string, deleteIfNoTargets bool) error
+	ServiceInterfaceUpdate(ctx context.Context, service *ServiceInterface) error
+	SiteConfigInspect(ctx context.Context, name string) (*SiteConfig, error)
+	TokenList(ctx context.Context) ([]*TokenInspectResponse, error)
+	TokenRevoke(ctx context.Context, name string) error
+	TokenServe(ctx context.Context, options TokenServeOptions, ready func(claim TokenClaim)) (string, error)
 }
@@ -17,6 +17,7 @@ package types
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/docker/go-connections/nat"
 )
@@ -37,6 +38,7 @@ const (
 	SaslConfigPath
 	ServicesPath
 	SitesPath
+	TokensPath
 )
 
 var skupperPaths = map[Path]string{
@@ -48,6 +50,7 @@ var skupperPaths = map[Path]string{
 	SaslConfigPath:   "sasl-config",
 	ServicesPath:     "services",
 	SitesPath:        "sites",
+	TokensPath:       "tokens",
 }
 
 func GetSkupperPath(p Path) string {
@@ -75,6 +78,7 @@ const (
 	TransportSaslConfig     string = "skupper-sasl-config"
 	TransportNetworkName    string = "skupper-network"
 	TransportConfigFile     string = "qdrouterd.json"
+	TransportCommand        string = "qdrouterd"
 )
 
 var TransportPrometheusAnnotations = map[string]string{
@@ -92,6 +96,14 @@ const (
 	ControllerContainerName string = "service-controller"
 	ControllerConfigPath    string = "/etc/messaging/"
 	ControllerPluginPath    string = "/etc/plugins"
+	ControllerRegistryAuth  string = "/etc/registry/auth.json"
+	ControllerCommand       string = "/go/src/app/controller"
+	ControllerHostCommand   string = "skupper-exp-controller"
+)
+
+// Registry constants
+const (
+	RegistryAuthFile string = "registry-auth.json"
 )
 
 // Skupper qualifiers
@@ -99,6 +111,16 @@ const (
 	BaseQualifier    string = "skupper.io"
 	TokenGeneratedBy string = BaseQualifier + "/generated-by"
 	TokenCost        string = BaseQualifier + "/cost"
+	TokenExpiry      string = BaseQualifier + "/expiry"
+	TokenUses        string = BaseQualifier + "/uses"
+	ComponentLabel   string = BaseQualifier + "/component"
+	AddressLabel     string = BaseQualifier + "/address"
+	SiteIdLabel      string = BaseQualifier + "/site-id"
+)
+
+// Proxy constants
+const (
+	ProxyComponentName string = "proxy"
 )
 
 // Console constants
@@ -133,6 +155,13 @@ const (
 	InterRouterProfile      string = "skupper-internal"
 )
 
+// Token claim constants
+const (
+	ClaimDefaultPort    int           = 8081
+	ClaimDefaultTimeout time.Duration = 10 * time.Minute
+	ClaimMaxAttempts    int           = 3
+)
+
 // Controller Service Interface constants
 const (
 	ServiceSyncAddress = "mc/$skupper-service-sync"
@@ -143,6 +172,7 @@ const (
 // RouterSpec is the specification of VAN network with router, controller and assembly
 type RouterSpec struct {
 	Name           string          `json:"name,omitempty"`
+	Network        string          `json:"network,omitempty"`
 	AuthMode       ConsoleAuthMode `json:"authMode,omitempty"`
 	Transport      DeploymentSpec  `json:"transport,omitempty"`
 	Controller     DeploymentSpec  `json:"controller,omitempty"`
@@ -155,10 +185,12 @@ type RouterSpec struct {
 // DeploymentSpec for the VAN router or controller components to run within a cluster
 type DeploymentSpec struct {
 	Image        string            `json:"image,omitempty"`
+	Cmd          []string          `json:"cmd,omitempty"`
 	LivenessPort int32             `json:"livenessPort,omitempty"`
 	Labels       map[string]string `json:"labels,omitempty"`
 	EnvVar       map[string]string `json:"envVar,omitempty"`
 	Ports        nat.PortSet       `json:"ports,omitempty"`
+	PortBindings nat.PortMap       `json:"portBindings,omitempty"`
 	Volumes      []string          `json:"volumes,omitempty"`
 	Mounts       map[string]string `json:"mounts,omitempty"`
 }
@@ -0,0 +1,402 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+	"github.com/skupperproject/skupper/pkg/certs"
+)
+
+// internalCA issues the site's internal credential and its tokens
+const internalCA = "skupper-internal-ca"
+
+// caRotation is kept with the previous CA while a rotation overlaps
+type caRotation struct {
+	Started     time.Time
+	OverlapEnds time.Time
+}
+
+// previousCA returns the dir of the CA a rotation replaced, it only exists
+// while the rotation overlaps
+func previousCA(name string) string {
+	return name + "-previous"
+}
+
+func getCARotation(name string) (*caRotation, error) {
+	data, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/" + previousCA(name) + "/rotation.json")
+	if err != nil {
+		return nil, err
+	}
+	rotation := &caRotation{}
+	err = json.Unmarshal(data, rotation)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse rotation of %s: %w", name, err)
+	}
+	return rotation, nil
+}
+
+// overdueRotations returns the CAs whose rotation is not completed at the
+// end of its overlap
+func overdueRotations(now time.Time) []string {
+	overdue := []string{}
+	entries, _ := ioutil.ReadDir(types.GetSkupperPath(types.CertsPath))
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), previousCA("")) {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), previousCA(""))
+		if rotation, err := getCARotation(name); err == nil && now.After(rotation.OverlapEnds) {
+			overdue = append(overdue, name)
+		}
+	}
+	return overdue
+}
+
+// issuingCA returns the CA the site's credentials are issued by, the
+// previous one while a rotation overlaps as the remote sites only trust it
+func issuingCA(name string) string {
+	if certExists(previousCA(name)) {
+		return previousCA(name)
+	}
+	return name
+}
+
+// trustedCAs returns the certificates of the CA, and of the previous one
+// while a rotation overlaps
+func trustedCAs(name string) []byte {
+	trusted, _ := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/" + name + "/tls.crt")
+	if previous, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/" + previousCA(name) + "/tls.crt"); err == nil {
+		trusted = append(append(trusted, '\n'), previous...)
+	}
+	return bytes.TrimSpace(trusted)
+}
+
+// RotateCerts issues the selected credentials and CAs of the site again and
+// restarts the router, the controller and, when the internal credential
+// changed, the proxies. A CA is replaced right away, or the previous one
+// stays trusted and keeps issuing the site's credentials for the overlap,
+// until a rotation with Complete. The tokens issued by a replaced internal
+// CA are revoked when it is no longer trusted, they are reported along with
+// the sites that connected with them.
+func (cli *VanClient) RotateCerts(ctx context.Context, options types.CertRotateOptions) (*types.CertRotateResponse, error) {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to intialize client: %w", err)
+	}
+
+	van, err := cli.GetRouterSpecFromOpts(ctx, sc.Spec, sc.UID)
+	if err != nil {
+		return nil, err
+	}
+	completing, err := checkRotation(van, options)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &types.CertRotateResponse{}
+	now := time.Now().UTC()
+	replaced := map[string]bool{}
+	for _, ca := range options.CAs {
+		replaced[ca] = true
+		response.Rotated = append(response.Rotated, ca)
+	}
+	for _, ca := range completing {
+		replaced[ca] = true
+	}
+	selected := map[string]bool{}
+	for _, name := range options.Credentials {
+		selected[name] = true
+	}
+	all := len(options.CAs) == 0 && len(options.Credentials) == 0 && !options.Complete
+	reissued := []types.Credential{}
+	for _, cred := range van.Credentials {
+		if all || selected[cred.Name] || (replaced[cred.CA] && options.Overlap == 0) {
+			reissued = append(reissued, cred)
+			response.Rotated = append(response.Rotated, cred.Name)
+		}
+	}
+
+	// the tokens stop working once the site's certificate is issued by the
+	// new CA
+	revoked := []string{}
+	if replaced[internalCA] {
+		before := now
+		if rotation, err := getCARotation(internalCA); err == nil {
+			before = rotation.Started
+		}
+		response.StaleTokens, response.Sites, err = cli.staleTokens(ctx, before)
+		if err != nil {
+			return nil, err
+		}
+		if options.Overlap == 0 {
+			revoked = response.StaleTokens
+		}
+	}
+	if options.Overlap > 0 {
+		response.OverlapEnds = now.Add(options.Overlap)
+	}
+
+	transport, err := cli.CeDriver.ContainerInspect(ctx, types.TransportDeploymentName)
+	if err != nil {
+		return nil, containerError("transport", err)
+	}
+	controller, err := cli.CeDriver.ContainerInspect(ctx, types.ControllerDeploymentName)
+	if err != nil {
+		return nil, containerError("controller", err)
+	}
+
+	tx := &siteTransaction{}
+	err = cli.rotateSiteCerts(ctx, tx, van, options, completing, reissued, revoked, now, transport, controller)
+	if err != nil {
+		return nil, tx.rollback(err)
+	}
+	tx.commit()
+
+	// the proxies connect to the router with the internal credential
+	internal := replaced[internalCA]
+	for _, cred := range reissued {
+		internal = internal || cred.Name == types.InterRouterProfile
+	}
+	if internal {
+		err = cli.restartProxies(ctx)
+		if err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+// checkRotation refuses the CAs and credentials the site does not have, and
+// a CA rotation while another one of the CA overlaps. It returns the CAs
+// whose rotation is completed.
+func checkRotation(van *types.RouterSpec, options types.CertRotateOptions) ([]string, error) {
+	cas := []string{}
+	for _, ca := range van.CertAuthoritys {
+		cas = append(cas, ca.Name)
+	}
+	creds := []string{}
+	for _, cred := range van.Credentials {
+		creds = append(creds, cred.Name)
+	}
+	if options.Overlap < 0 {
+		return nil, fmt.Errorf("--overlap cannot be negative")
+	}
+	if options.Overlap > 0 && len(options.CAs) == 0 {
+		return nil, fmt.Errorf("--overlap only valid with --ca")
+	}
+	if options.Complete {
+		if len(options.CAs) > 0 || len(options.Credentials) > 0 || options.Overlap > 0 {
+			return nil, fmt.Errorf("--complete cannot be combined with other rotations")
+		}
+		completing := []string{}
+		for _, ca := range cas {
+			if certExists(previousCA(ca)) {
+				completing = append(completing, ca)
+			}
+		}
+		if len(completing) == 0 {
+			return nil, fmt.Errorf("No CA rotation to complete")
+		}
+		return completing, nil
+	}
+	for _, ca := range options.CAs {
+		if !containsString(cas, ca) {
+			return nil, fmt.Errorf("%s is not a CA of the site, choose from %s", ca, strings.Join(cas, ", "))
+		}
+		if certExists(previousCA(ca)) {
+			return nil, fmt.Errorf("%s is already being rotated, use --complete first", ca)
+		}
+	}
+	for _, name := range options.Credentials {
+		if !containsString(creds, name) {
+			return nil, fmt.Errorf("%s is not a credential of the site, choose from %s", name, strings.Join(creds, ", "))
+		}
+	}
+	return nil, nil
+}
+
+// rotateSiteCerts writes the site's CAs and credentials and replaces the
+// router and then the controller, as steps the transaction can roll back
+func (cli *VanClient) rotateSiteCerts(ctx context.Context, tx *siteTransaction, van *types.RouterSpec, options types.CertRotateOptions, completing []string, reissued []types.Credential, revoked []string, now time.Time,
+	transport *driver.ContainerInspect, controller *driver.ContainerInspect) error {
+	routerReplaced := false
+	controllerReplaced := false
+	tx.onRollback("restore container "+types.ControllerDeploymentName, func(ctx context.Context) error {
+		if !routerReplaced && !controllerReplaced {
+			return nil
+		}
+		return cli.restoreSiteContainer(ctx, controller)
+	})
+	tx.onRollback("restore container "+types.TransportDeploymentName, func(ctx context.Context) error {
+		if !routerReplaced {
+			return nil
+		}
+		return cli.restoreSiteContainer(ctx, transport)
+	})
+	restoreFiles, err := backupSiteFiles(tx)
+	if err != nil {
+		return err
+	}
+
+	certsPath := types.GetSkupperPath(types.CertsPath)
+	for _, ca := range options.CAs {
+		if options.Overlap > 0 {
+			err = copyDir(certsPath+"/"+ca, certsPath+"/"+previousCA(ca))
+			if err != nil {
+				return fmt.Errorf("Failed to keep previous CA %s: %w", ca, err)
+			}
+			encoded, err := json.Marshal(caRotation{Started: now, OverlapEnds: now.Add(options.Overlap)})
+			if err != nil {
+				return err
+			}
+			err = ioutil.WriteFile(certsPath+"/"+previousCA(ca)+"/rotation.json", encoded, 0644)
+			if err != nil {
+				return err
+			}
+		}
+		// the subject tells the CAs apart while both are trusted
+		caData := certs.GenerateCACertificateData(ca, ca+"-"+strconv.FormatInt(now.Unix(), 10))
+		for k, v := range caData {
+			if err := ioutil.WriteFile(certsPath+"/"+ca+"/"+k, v, 0755); err != nil {
+				return fmt.Errorf("Failed to write CA certificate file: %w", err)
+			}
+		}
+		// the credentials it issued trust both until the rotation completes
+		for _, cred := range van.Credentials {
+			if cred.CA == ca && options.Overlap > 0 {
+				err = ioutil.WriteFile(certsPath+"/"+cred.Name+"/ca.crt", trustedCAs(ca), 0755)
+				if err != nil {
+					return fmt.Errorf("Failed to write certificate file: %w", err)
+				}
+			}
+		}
+	}
+	for _, ca := range completing {
+		if err := os.RemoveAll(certsPath + "/" + previousCA(ca)); err != nil {
+			return err
+		}
+	}
+	for _, cred := range reissued {
+		err = generateCredentials(cred.CA, cred.Name, cred.Subject, cred.Hosts, cred.ConnectJson)
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range revoked {
+		err = revokeIssuedToken(types.GetSkupperPath(types.TokensPath), name)
+		if err != nil {
+			return fmt.Errorf("Failed to revoke token %s: %w", name, err)
+		}
+	}
+
+	// qdrouterd and the controller read their certs at start, the previous
+	// certs are back in place before a failed replacement restarts them
+	err = driver.ReplaceContainerWith(ctx, cli.CeDriver, transport, driver.ContainerSpec(transport), restoreFiles)
+	if err != nil {
+		return fmt.Errorf("Failed to restart router: %w", err)
+	}
+	routerReplaced = true
+	err = driver.ReplaceContainerWith(ctx, cli.CeDriver, controller, driver.ContainerSpec(controller), restoreFiles)
+	if err != nil {
+		return fmt.Errorf("Failed to restart controller: %w", err)
+	}
+	controllerReplaced = true
+	return nil
+}
+
+// staleTokens returns the tokens issued before the time that are still
+// accepted, and the sites that connected with them or with tokens the site
+// has no record of
+func (cli *VanClient) staleTokens(ctx context.Context, before time.Time) ([]string, []string, error) {
+	tokens, sites := []string{}, []string{}
+	tokensPath := types.GetSkupperPath(types.TokensPath)
+	files, err := ioutil.ReadDir(tokensPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("Failed to read issued tokens: %w", err)
+	}
+	for _, f := range files {
+		token, err := readIssuedToken(tokensPath, f.Name())
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if token.Revoked || !token.Created.Before(before) {
+			continue
+		}
+		tokens = append(tokens, token.Name)
+		redemptions, err := readTokenRedemptions(tokensPath, token.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, r := range redemptions {
+			if !containsString(sites, r.Site) {
+				sites = append(sites, r.Site)
+			}
+		}
+	}
+
+	// the router may not be up, the records are all there is then
+	connections, err := qdr.GetConnections(ctx, cli.CeDriver)
+	if err != nil {
+		return tokens, sites, nil
+	}
+	for _, c := range connections {
+		if c.Dir != "in" || (c.Role != string(qdr.RoleInterRouter) && c.Role != qdr.RoleEdge) || c.User == "" {
+			continue
+		}
+		name := tokenSubject(c.User)
+		if containsString(reservedTokenNames, name) || containsString(sites, c.Container) {
+			continue
+		}
+		if checkTokenName(name) == nil {
+			if _, err := readIssuedToken(tokensPath, name); err == nil {
+				continue
+			}
+		}
+		sites = append(sites, c.Container)
+	}
+	return tokens, sites, nil
+}
+
+// restartProxies restarts the proxy containers so they read their certs
+// again
+func (cli *VanClient) restartProxies(ctx context.Context) error {
+	proxies, err := cli.CeDriver.ContainerList(ctx, driver.ContainerListOptions{
+		Filters: map[string][]string{"label": {types.ComponentLabel + "=" + types.ProxyComponentName}},
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list proxy containers: %w", err)
+	}
+	for _, proxy := range proxies {
+		err = cli.CeDriver.ContainerRestart(ctx, proxy.ID)
+		if err != nil {
+			return fmt.Errorf("Failed to restart proxy %s: %w", proxyName(proxy), err)
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/driver/fake"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"gotest.tools/assert"
+)
+
+// verifyCert tells whether the certificate in the file is issued by one of
+// the CAs in the other
+func verifyCert(t *testing.T, file string, caFile string) error {
+	data, err := ioutil.ReadFile(file)
+	assert.Check(t, err)
+	block, _ := pem.Decode(data)
+	assert.Assert(t, block != nil)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.Check(t, err)
+	ca, err := ioutil.ReadFile(caFile)
+	assert.Check(t, err)
+	roots := x509.NewCertPool()
+	assert.Assert(t, roots.AppendCertsFromPEM(ca))
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+	return err
+}
+
+func TestRotateCerts(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "rotate")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	assert.Check(t, cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}))
+	certsPath := types.GetSkupperPath(types.CertsPath)
+	read := func(file string) string {
+		data, err := ioutil.ReadFile(certsPath + "/" + file)
+		assert.Check(t, err)
+		return string(data)
+	}
+	routerId := func() string {
+		router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+		assert.Check(t, err)
+		assert.Assert(t, router.State.Running)
+		return router.ID
+	}
+	_, err = cli.ConnectorTokenCreate(ctx, "early", tmpDir+"/early.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Check(t, err)
+	dd.SetExecResult([]string{"qdmanage", "query", "--type", "connection"}, 0, `[
+		{"container": "site-b", "role": "inter-router", "dir": "in", "identity": "1", "user": "CN=early"},
+		{"container": "site-c", "role": "inter-router", "dir": "in", "identity": "2", "user": "CN=skupper"}
+	]`, "")
+	assert.Check(t, cli.EnforceTokens(ctx, types.GetSkupperPath(types.TokensPath), time.Now()))
+
+	// the credentials are issued again by the same CAs
+	id := routerId()
+	amqps, internal, ca := read("skupper-amqps/tls.crt"), read("skupper-internal/tls.crt"), read("skupper-internal-ca/tls.crt")
+	rotated, err := cli.RotateCerts(ctx, types.CertRotateOptions{})
+	assert.Check(t, err)
+	assert.DeepEqual(t, rotated.Rotated, []string{"skupper-amqps", "skupper", "skupper-internal"})
+	assert.Equal(t, len(rotated.StaleTokens), 0)
+	assert.Assert(t, read("skupper-amqps/tls.crt") != amqps)
+	assert.Assert(t, read("skupper-internal/tls.crt") != internal)
+	assert.Equal(t, read("skupper-internal-ca/tls.crt"), ca)
+	assert.Assert(t, routerId() != id)
+	internal = read("skupper-internal/tls.crt")
+
+	// a replaced CA stays trusted and issues the site's certificate for
+	// the overlap, the new tokens trust both
+	rotated, err = cli.RotateCerts(ctx, types.CertRotateOptions{CAs: []string{"skupper-internal-ca"}, Overlap: time.Hour})
+	assert.Check(t, err)
+	assert.DeepEqual(t, rotated.Rotated, []string{"skupper-internal-ca"})
+	assert.Assert(t, rotated.OverlapEnds.After(time.Now().Add(59*time.Minute)))
+	// it is only overdue once the overlap is over
+	assert.DeepEqual(t, overdueRotations(time.Now()), []string{})
+	assert.DeepEqual(t, overdueRotations(rotated.OverlapEnds.Add(time.Second)), []string{"skupper-internal-ca"})
+	assert.DeepEqual(t, rotated.StaleTokens, []string{"early"})
+	// site-c connected with a token the site has no record of
+	assert.DeepEqual(t, rotated.Sites, []string{"site-b", "site-c"})
+	assert.Assert(t, read("skupper-internal-ca/tls.crt") != ca)
+	assert.Equal(t, read("skupper-internal/tls.crt"), internal)
+	assert.Equal(t, strings.Count(read("skupper-internal/ca.crt"), "BEGIN CERTIFICATE"), 2)
+	assert.Check(t, verifyCert(t, certsPath+"/skupper-internal/tls.crt", certsPath+"/skupper-internal/ca.crt"))
+	_, err = cli.ConnectorTokenCreate(ctx, "late", tmpDir+"/late.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Check(t, err)
+	late, err := certs.GetSecretContent(tmpDir + "/late.yaml")
+	assert.Check(t, err)
+	assert.Equal(t, strings.Count(string(late["ca.crt"]), "BEGIN CERTIFICATE"), 2)
+	_, err = cli.RotateCerts(ctx, types.CertRotateOptions{CAs: []string{"skupper-internal-ca"}})
+	assert.Error(t, err, "skupper-internal-ca is already being rotated, use --complete first")
+
+	// a rotation that does not come up leaves the certs as they were
+	dd.FailOnce("ContainerWait", driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out")))
+	_, err = cli.RotateCerts(ctx, types.CertRotateOptions{Complete: true})
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
+	assert.ErrorContains(t, err, "Failed to restart router")
+	assert.Equal(t, read("skupper-internal/tls.crt"), internal)
+	assert.Assert(t, certExists(previousCA("skupper-internal-ca")))
+
+	// a router that does not start is started again on the previous certs
+	id = routerId()
+	startedWith := ""
+	dd.StartError = func(c *fake.Container) error {
+		// the replacement, created as skupper-router-recreate
+		if c.Name == types.TransportDeploymentName && c.ID != id {
+			return fmt.Errorf("cannot start")
+		}
+		if c.ID == id {
+			startedWith = read("skupper-internal/tls.crt")
+		}
+		return nil
+	}
+	_, err = cli.RotateCerts(ctx, types.CertRotateOptions{Complete: true})
+	dd.StartError = nil
+	assert.ErrorContains(t, err, "Failed to restart router")
+	assert.Equal(t, startedWith, internal)
+	assert.Equal(t, routerId(), id)
+	assert.Equal(t, read("skupper-internal/tls.crt"), internal)
+	assert.Assert(t, certExists(previousCA("skupper-internal-ca")))
+
+	// completing it issues the site's certificate by the new CA alone and
+	// revokes the earlier tokens
+	rotated, err = cli.RotateCerts(ctx, types.CertRotateOptions{Complete: true})
+	assert.Check(t, err)
+	assert.DeepEqual(t, rotated.Rotated, []string{"skupper-internal"})
+	assert.DeepEqual(t, rotated.StaleTokens, []string{"early"})
+	assert.Assert(t, !certExists(previousCA("skupper-internal-ca")))
+	assert.DeepEqual(t, overdueRotations(time.Now().Add(2*time.Hour)), []string{})
+	assert.Equal(t, strings.Count(read("skupper-internal/ca.crt"), "BEGIN CERTIFICATE"), 1)
+	assert.Check(t, verifyCert(t, certsPath+"/skupper-internal/tls.crt", certsPath+"/skupper-internal-ca/tls.crt"))
+	tokens, err := cli.TokenList(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, tokens[0].Token.Name, "early")
+	assert.Equal(t, tokens[0].Status, types.TokenRevoked)
+	assert.Equal(t, tokens[1].Token.Name, "late")
+	assert.Equal(t, tokens[1].Status, types.TokenActive)
+
+	_, err = cli.RotateCerts(ctx, types.CertRotateOptions{Complete: true})
+	assert.Error(t, err, "No CA rotation to complete")
+	_, err = cli.RotateCerts(ctx, types.CertRotateOptions{CAs: []string{"skupper-edge-ca"}})
+	assert.Error(t, err, "skupper-edge-ca is not a CA of the site, choose from skupper-ca, skupper-internal-ca")
+	_, err = cli.RotateCerts(ctx, types.CertRotateOptions{Credentials: []string{"skupper"}, Overlap: time.Hour})
+	assert.Error(t, err, "--overlap only valid with --ca")
+}
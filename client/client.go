@@ -1,16 +1,24 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"path/filepath"
-	"plugin"
+	"os"
+	"strings"
 
+	"github.com/ajssmith/skupper-exp/api/types"
 	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/driver/remote"
 )
 
 // A VAN client manages orchestration and communication with the network components
 type VanClient struct {
 	CeDriver driver.Driver
+	// CeDriverName and CeEngineConfig record how the driver is connected,
+	// including the result of the engine autodetection
+	CeDriverName   string
+	CeEngineConfig driver.EngineConfig
 }
 
 func NewClient() (*VanClient, error) {
@@ -19,63 +27,163 @@ func NewClient() (*VanClient, error) {
 	return c, nil
 }
 
-func (cli *VanClient) Init(ced string) error {
-	var drv driver.Driver
+func getEngineConfig(spec types.SiteConfigSpec) driver.EngineConfig {
+	return driver.EngineConfig{
+		Endpoint:  spec.ContainerEngineEndpoint,
+		TLSCACert: spec.ContainerEngineTLSCACert,
+		TLSCert:   spec.ContainerEngineTLSCert,
+		TLSKey:    spec.ContainerEngineTLSKey,
+		PluginDir: spec.ContainerEnginePluginDir,
+		RPC:       spec.ContainerEngineDriverRPC,
+	}
+}
+
+// siteNetwork returns the container network of the site, sites created
+// before the network could be chosen use skupper-network
+func siteNetwork(spec types.SiteConfigSpec) string {
+	if spec.NetworkName == "" {
+		return types.TransportNetworkName
+	}
+	return spec.NetworkName
+}
+
+// getDriver returns the built-in driver for ced or, with a plugin dir, the
+// driver of the plugin found there
+func getDriver(ced string, pluginDir string) (driver.Driver, error) {
+	// host mode is built in, there is no engine to load a plugin for
+	if ced == driver.HostDriverName {
+		return &driver.HostDriver, nil
+	}
+	if pluginDir != "" {
+		drv, metadata, err := driver.LoadPlugin(pluginDir, ced)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Loaded driver plugin", metadata.Name, metadata.Version, "from", pluginDir)
+		return drv, nil
+	}
+	switch ced {
+	case driver.DockerDriverName:
+		return &driver.DockerDriver, nil
+	case driver.PodmanDriverName:
+		return &driver.PodmanDriver, nil
+	default:
+		return nil, fmt.Errorf("CE driver %s not recognized", ced)
+	}
+}
 
+// Init connects the client to the container engine. When the driver or
+// the endpoint is not given the well known engine sockets are probed and
+// the first engine that answers is used. Without a plugin dir the
+// SKUPPER_PLUGIN_PATH environment variable selects one. An out of process
+// driver, given by config.RPC or SKUPPER_DRIVER_RPC, finds its engine
+// itself.
+func (cli *VanClient) Init(ctx context.Context, ced string, config driver.EngineConfig) error {
 	fmt.Println("client init for ce: ", ced)
 	if cli.CeDriver != nil {
 		return nil
 	}
+	if config.PluginDir == "" {
+		config.PluginDir = os.Getenv("SKUPPER_PLUGIN_PATH")
+	}
+	if config.RPC == "" {
+		config.RPC = os.Getenv("SKUPPER_DRIVER_RPC")
+	}
+	if config.RPC != "" && ced != driver.HostDriverName {
+		return cli.initRemote(ctx, ced, config)
+	}
 
-	if ced == "docker" {
-		drv = &driver.DockerDriver
-	} else if ced == "podman" {
-		drv = &driver.PodmanDriver
-	} else {
-		return fmt.Errorf("CE driver %s not recognized", ced)
+	if ced == "" || config.Endpoint == "" {
+		return cli.detectEngine(ctx, ced, config)
 	}
 
-	err := drv.New()
+	drv, err := getDriver(ced, config.PluginDir)
+	if err != nil {
+		return err
+	}
+	err = drv.New(ctx, config)
 	if err != nil {
 		return fmt.Errorf("Error connecting to CE backend: %w", err)
 	}
 	cli.CeDriver = drv
+	cli.CeDriverName = ced
+	cli.CeEngineConfig = config
 	return nil
 }
 
-func (cli *VanClient) init2(path string, ced string) error {
-	var p *plugin.Plugin
-
-	if cli.CeDriver != nil {
-		return nil
+func (cli *VanClient) initRemote(ctx context.Context, ced string, config driver.EngineConfig) error {
+	if ced == "" {
+		ced = remote.DriverName
 	}
+	drv := &remote.Driver{}
+	if err := drv.New(ctx, config); err != nil {
+		drv.Close()
+		return fmt.Errorf("Error connecting to remote driver %s: %w", config.RPC, err)
+	}
+	cli.CeDriver = drv
+	cli.CeDriverName = ced
+	cli.CeEngineConfig = config
+	return nil
+}
 
-	module := fmt.Sprintf("%s/%s.so", path, ced)
-	fmt.Println("In client init: ", module)
-	plugins, err := filepath.Glob(module)
-	if err != nil {
-		return err
-	} else {
-		fmt.Println("Plugin found: ", plugins[0])
+// hostMode tells whether the site runs its router and controller as host
+// processes rather than containers
+func (cli *VanClient) hostMode() bool {
+	return cli.CeDriverName == driver.HostDriverName
+}
+
+// containerError reports why a site container could not be retrieved, only
+// a missing container means the site has not been initialized
+func containerError(component string, err error) error {
+	switch {
+	case errors.Is(err, driver.ErrNotFound):
+		return fmt.Errorf("No %s container found (need init?): %w", component, err)
+	case errors.Is(err, driver.ErrEngineUnavailable):
+		return fmt.Errorf("Container engine unavailable: %w", err)
+	default:
+		return fmt.Errorf("Failed to retrieve %s container: %w", component, err)
 	}
+}
 
-	if p, err = plugin.Open(module); err != nil {
-		fmt.Println("plugin error: ", err.Error())
-		return err
+func (cli *VanClient) detectEngine(ctx context.Context, ced string, config driver.EngineConfig) error {
+	names := []string{driver.DockerDriverName, driver.PodmanDriverName}
+	if ced != "" {
+		names = []string{ced}
 	}
 
-	symDriver, err := p.Lookup("Driver")
-	drv, ok := symDriver.(driver.Driver)
-	if !ok {
-		return fmt.Errorf("Plugin % is not a driver", module)
-	} else {
-		fmt.Println("Plugin IS a driver")
-		err = drv.New()
+	tried := []string{}
+	for _, name := range names {
+		drv, err := getDriver(name, config.PluginDir)
 		if err != nil {
-			return fmt.Errorf("Error connecting to ce backend: %w", err)
+			if ced != "" || !errors.Is(err, driver.ErrPluginNotFound) {
+				return err
+			}
+			continue
+		}
+		for _, endpoint := range driver.EngineEndpoints(name) {
+			if socket := driver.UnixSocketPath(endpoint); socket != "" {
+				if _, err := os.Stat(socket); err != nil {
+					continue
+				}
+			}
+			tried = append(tried, name+" at "+endpoint)
+			candidate := config
+			candidate.Endpoint = endpoint
+			if err := drv.New(ctx, candidate); err != nil {
+				continue
+			}
+			if _, err := drv.Info(ctx); err != nil {
+				continue
+			}
+			fmt.Println("Detected container engine", name, "at", endpoint)
+			cli.CeDriver = drv
+			cli.CeDriverName = name
+			cli.CeEngineConfig = candidate
+			return nil
 		}
-		cli.CeDriver = drv
 	}
-
-	return nil
+	if len(tried) == 0 {
+		return driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("No container engine found, is docker or podman running?"))
+	}
+	return driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("No container engine answered, tried: %s", strings.Join(tried, ", ")))
 }
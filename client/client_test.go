@@ -4,9 +4,19 @@ import (
 	"os"
 	"testing"
 
+	"github.com/ajssmith/skupper-exp/driver/fake"
 	"gotest.tools/assert"
 )
 
+// newTestClient returns a VAN client backed by the in-memory fake driver
+func newTestClient(t *testing.T) (*VanClient, *fake.Driver) {
+	cli, err := NewClient()
+	assert.Check(t, err, "Unable to create VAN client")
+	dd := fake.NewDriver()
+	cli.CeDriver = dd
+	return cli, dd
+}
+
 func TestNewClient(t *testing.T) {
 	testCases := []struct {
 		doc             string
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+func (cli *VanClient) componentContainer(ctx context.Context, component string, address string) (string, error) {
+	switch component {
+	case types.TransportComponentName, types.ControllerComponentName:
+		if address != "" {
+			return "", fmt.Errorf("An address is only valid for the %s component", types.ProxyComponentName)
+		}
+	case types.ProxyComponentName:
+		if address == "" {
+			return "", fmt.Errorf("An address must be specified for the %s component", types.ProxyComponentName)
+		}
+	default:
+		return "", fmt.Errorf("Component %s not recognized, must be one of: %s, %s, %s", component,
+			types.TransportComponentName, types.ControllerComponentName, types.ProxyComponentName)
+	}
+
+	containers, err := cli.CeDriver.ContainerList(ctx, driver.ContainerListOptions{
+		Filters: map[string][]string{
+			"label": {types.ComponentLabel + "=" + component},
+		},
+		All: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to list %s containers: %w", component, err)
+	}
+	for _, container := range containers {
+		// the filter is applied again as not every engine honours it
+		if container.Labels[types.ComponentLabel] != component {
+			continue
+		}
+		if address != "" && container.Labels[types.AddressLabel] != address {
+			continue
+		}
+		return container.ID, nil
+	}
+	if address != "" {
+		return "", fmt.Errorf("No %s container found for address %s", component, address)
+	}
+	return "", fmt.Errorf("No %s container found (need init?)", component)
+}
+
+// ComponentLogs writes the logs of the router, controller or the proxy for
+// the given address to stdout and stderr
+func (cli *VanClient) ComponentLogs(ctx context.Context, component string, address string, options types.ComponentLogsOptions, stdout io.Writer, stderr io.Writer) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
+	if err != nil {
+		return fmt.Errorf("Failed to intialize client: %w", err)
+	}
+
+	id, err := cli.componentContainer(ctx, component, address)
+	if err != nil {
+		return err
+	}
+
+	err = cli.CeDriver.ContainerLogs(ctx, id, driver.ContainerLogsOptions{
+		Follow:     options.Follow,
+		Since:      options.Since,
+		Tail:       options.Tail,
+		Timestamps: options.Timestamps,
+	}, stdout, stderr)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve %s logs: %w", component, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"gotest.tools/assert"
+)
+
+func TestComponentLogs(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "logs")
+	assert.Check(t, err, "Unable to create temporary directory")
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+
+	scs := types.SiteConfigSpec{
+		SkupperName:       "skupper",
+		EnableController:  true,
+		EnableServiceSync: true,
+		AuthMode:          "unsecured",
+	}
+	err = cli.RouterCreate(ctx, scs)
+	assert.Check(t, err, "Unable to create VAN router")
+
+	assert.Check(t, dd.SetContainerLogs(types.TransportDeploymentName, "one\ntwo\nthree\n", "oops\n"))
+	resp, err := dd.ContainerCreate(ctx, driver.ContainerCreateOptions{
+		Name: "proxy1",
+		ContainerConfig: &driver.ContainerBaseConfig{
+			Image: types.DefaultTransportImage,
+			Labels: map[string]string{
+				types.ComponentLabel: types.ProxyComponentName,
+				types.AddressLabel:   "tcp-go-echo",
+			},
+		},
+	})
+	assert.Check(t, err)
+	assert.Check(t, dd.SetContainerLogs(resp.ID, "proxy\n", ""))
+
+	testCases := []struct {
+		doc            string
+		component      string
+		address        string
+		tail           string
+		expectedOut    string
+		expectedErrOut string
+		expectedError  string
+	}{
+		{
+			doc:            "router",
+			component:      "router",
+			expectedOut:    "one\ntwo\nthree\n",
+			expectedErrOut: "oops\n",
+		},
+		{
+			doc:            "router tail",
+			component:      "router",
+			tail:           "1",
+			expectedOut:    "three\n",
+			expectedErrOut: "oops\n",
+		},
+		{
+			doc:       "controller",
+			component: "controller",
+		},
+		{
+			doc:         "proxy",
+			component:   "proxy",
+			address:     "tcp-go-echo",
+			expectedOut: "proxy\n",
+		},
+		{
+			doc:           "proxy unknown address",
+			component:     "proxy",
+			address:       "nope",
+			expectedError: "No proxy container found for address nope",
+		},
+		{
+			doc:           "proxy without address",
+			component:     "proxy",
+			expectedError: "An address must be specified for the proxy component",
+		},
+		{
+			doc:           "unknown component",
+			component:     "console",
+			expectedError: "Component console not recognized, must be one of: router, controller, proxy",
+		},
+	}
+
+	for _, c := range testCases {
+		var stdout, stderr bytes.Buffer
+		err := cli.ComponentLogs(ctx, c.component, c.address, types.ComponentLogsOptions{Tail: c.tail}, &stdout, &stderr)
+		if c.expectedError == "" {
+			assert.Check(t, err, c.doc)
+			assert.Equal(t, stdout.String(), c.expectedOut, c.doc)
+			assert.Equal(t, stderr.String(), c.expectedErrOut, c.doc)
+		} else {
+			assert.Error(t, err, c.expectedError, c.doc)
+		}
+	}
+
+	errors := cli.RouterRemove(ctx)
+	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/skupperproject/skupper/pkg/certs"
+)
+
+// claimTimeout is how long the claim endpoint may take to hand out the
+// token
+const claimTimeout = 30 * time.Second
+
+// ConnectorClaim fetches a token from the claim endpoint of another site and
+// connects to that site with it. The endpoint's certificate must have the
+// fingerprint in the path of the claim URL before the password is sent, and
+// be issued by the CA in the token, the password is only good for one claim.
+func (cli *VanClient) ConnectorClaim(ctx context.Context, claim types.TokenClaim, options types.ConnectorCreateOptions) (string, error) {
+	_, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	claimURL, err := url.Parse(claim.URL)
+	if err != nil {
+		return "", fmt.Errorf("Invalid claim URL %s: %w", claim.URL, err)
+	}
+	if claimURL.Scheme != "https" {
+		return "", fmt.Errorf("Invalid claim URL %s, it must be https", claim.URL)
+	}
+	fingerprint := strings.ToLower(strings.Trim(claimURL.Path, "/"))
+	if fingerprint == "" {
+		return "", fmt.Errorf("Invalid claim URL %s, it has no certificate fingerprint", claim.URL)
+	}
+
+	claimCtx, cancel := context.WithTimeout(ctx, claimTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(claimCtx, http.MethodPost, claim.URL, bytes.NewBufferString(claim.Password))
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			// the endpoint's CA is only known from the token, its
+			// certificate is checked against the fingerprint instead
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+					if len(rawCerts) == 0 || subtle.ConstantTimeCompare([]byte(certFingerprint(rawCerts[0])), []byte(fingerprint)) != 1 {
+						return fmt.Errorf("the endpoint's certificate does not match the fingerprint of the claim URL")
+					}
+					return nil
+				},
+			},
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("Failed to claim token: %w", err)
+	}
+	defer response.Body.Close()
+	token, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", fmt.Errorf("Failed to claim token: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token claim refused: %s", strings.TrimSpace(string(token)))
+	}
+
+	tokenFile, err := ioutil.TempFile("", "skupper-claim")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.Write(token)
+	tokenFile.Close()
+	if err != nil {
+		return "", err
+	}
+	secret, err := certs.GetSecretContent(tokenFile.Name())
+	if err != nil {
+		return "", fmt.Errorf("Failed to claim token: %w", err)
+	}
+	err = verifyClaimEndpoint(response.TLS, claimURL.Hostname(), secret["ca.crt"])
+	if err != nil {
+		return "", fmt.Errorf("Claim endpoint %s is not the site that issued the token: %w", claim.URL, err)
+	}
+
+	return cli.ConnectorCreate(ctx, tokenFile.Name(), options)
+}
+
+// verifyClaimEndpoint checks the certificate the claim endpoint presented
+// for the host against the CA
+func verifyClaimEndpoint(state *tls.ConnectionState, host string, ca []byte) error {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("the token has no CA")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
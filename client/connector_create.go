@@ -1,11 +1,15 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ajssmith/skupper-exp/api/types"
 	"github.com/ajssmith/skupper-exp/driver"
@@ -33,14 +37,61 @@ func generateConnectorName(path string) (string, error) {
 	return "conn" + strconv.Itoa(max), nil
 }
 
-func (cli *VanClient) ConnectorCreate(secretFile string, options types.ConnectorCreateOptions) (string, error) {
+// setConnectorEndpoint points a connector at the edge or the inter-router
+// endpoint of the token saved in the connection's dir
+func setConnectorEndpoint(connector *qdr.Connector, connPath string, edge bool) {
+	if edge {
+		hostString, _ := ioutil.ReadFile(connPath + "/edge-host")
+		portString, _ := ioutil.ReadFile(connPath + "/edge-port")
+		connector.Host = string(hostString)
+		connector.Port = string(portString)
+		connector.Role = qdr.RoleEdge
+	} else {
+		hostString, _ := ioutil.ReadFile(connPath + "/inter-router-host")
+		portString, _ := ioutil.ReadFile(connPath + "/inter-router-port")
+		connector.Host = string(hostString)
+		connector.Port = string(portString)
+		connector.Role = qdr.RoleInterRouter
+	}
+}
+
+// endpointDialTimeout is how long an address of a token may take to accept
+// a connection
+const endpointDialTimeout = 3 * time.Second
+
+// reachableEndpoint returns the host and port of the first of the token's
+// addresses that accepts a connection, the first address when none does as
+// the site may not be up yet
+func reachableEndpoint(ctx context.Context, candidates []string) (string, string) {
+	dialer := net.Dialer{Timeout: endpointDialTimeout}
+	for _, candidate := range candidates {
+		conn, err := dialer.DialContext(ctx, "tcp", candidate)
+		if err == nil {
+			conn.Close()
+			host, port, _ := net.SplitHostPort(candidate)
+			return host, port
+		}
+	}
+	host, port, _ := net.SplitHostPort(candidates[0])
+	return host, port
+}
+
+// tokenAnnotations are the annotations of a token the connector keeps
+var tokenAnnotations = map[string]bool{
+	types.TokenGeneratedBy: true,
+	types.TokenCost:        true,
+	types.TokenExpiry:      true,
+	types.TokenUses:        true,
+}
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+func (cli *VanClient) ConnectorCreate(ctx context.Context, secretFile string, options types.ConnectorCreateOptions) (string, error) {
+
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return "", fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return "", fmt.Errorf("Failed to intialize client: %w", err)
 	}
@@ -51,9 +102,9 @@ func (cli *VanClient) ConnectorCreate(secretFile string, options types.Connector
 		return "", fmt.Errorf("Failed to make connector: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return "", fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return "", containerError("transport", err)
 	}
 
 	generatedBy, ok := secret["skupper.io/generated-by"]
@@ -65,6 +116,47 @@ func (cli *VanClient) ConnectorCreate(secretFile string, options types.Connector
 		return "", fmt.Errorf("Cannot create connection to self with token '%s'", secretFile)
 	}
 
+	// the issuing site refuses it as well, this tells why
+	if expiry, ok := secret[types.TokenExpiry]; ok {
+		expires, err := time.Parse(time.RFC3339, string(expiry))
+		if err == nil && time.Now().After(expires) {
+			return "", fmt.Errorf("Token '%s' expired at %s", secretFile, expires.Local().Format(time.RFC1123))
+		}
+	}
+
+	current, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+	if err != nil {
+		return "", fmt.Errorf("Failed to retrieve router config: %w", err)
+	}
+
+	// an edge site connects to the edge listener, an interior site to the
+	// inter-router one
+	role := qdr.RoleInterRouter
+	if current.IsEdge() {
+		role = qdr.RoleEdge
+	}
+	if _, ok := secret[string(role)+"-host"]; !ok {
+		if current.IsEdge() {
+			return "", fmt.Errorf("Token '%s' has no edge endpoint, ask for a token of a newer site", secretFile)
+		}
+		return "", fmt.Errorf("Token '%s' only allows edge sites to connect", secretFile)
+	}
+
+	// the connector keeps the token's files and the annotations of the
+	// issuing site under their own names
+	files := map[string][]byte{}
+	for k, v := range secret {
+		if strings.HasPrefix(k, types.BaseQualifier+"/") {
+			if !tokenAnnotations[k] {
+				continue
+			}
+			k = strings.TrimPrefix(k, types.BaseQualifier+"/")
+		} else if strings.ContainsAny(k, "/\\") || strings.Contains(k, "..") {
+			return "", fmt.Errorf("Token '%s' has an invalid entry '%s'", secretFile, k)
+		}
+		files[k] = v
+	}
+
 	if options.Name == "" {
 		options.Name, err = generateConnectorName(types.GetSkupperPath(types.ConnectionsPath))
 		if err != nil {
@@ -76,73 +168,85 @@ func (cli *VanClient) ConnectorCreate(secretFile string, options types.Connector
 	if err := os.Mkdir(connPath, 0755); err != nil {
 		return "", fmt.Errorf("Failed to create skupper connector directory: %w", err)
 	}
-	for k, v := range secret {
-		if k == types.TokenGeneratedBy {
-			if err := ioutil.WriteFile(connPath+"/generated-by", v, 0755); err != nil {
-				return "", fmt.Errorf("Failed to write connector file: %w", err)
-			}
-		} else {
-			if err := ioutil.WriteFile(connPath+"/"+k, v, 0755); err != nil {
-				return "", fmt.Errorf("Failed to write connector certificate file: %w", err)
-			}
+	for k, v := range files {
+		if err := ioutil.WriteFile(connPath+"/"+k, v, 0755); err != nil {
+			return "", fmt.Errorf("Failed to write connector file: %w", err)
 		}
 	}
 
-	current, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
-	if err != nil {
-		return "", fmt.Errorf("Failed to retrieve router config: %w", err)
+	if candidates, ok := secret[string(role)+"-candidates"]; ok {
+		host, port := reachableEndpoint(ctx, strings.Split(string(candidates), ","))
+		if err := ioutil.WriteFile(connPath+"/"+string(role)+"-host", []byte(host), 0755); err != nil {
+			return "", fmt.Errorf("Failed to write connector file: %w", err)
+		}
+		if err := ioutil.WriteFile(connPath+"/"+string(role)+"-port", []byte(port), 0755); err != nil {
+			return "", fmt.Errorf("Failed to write connector file: %w", err)
+		}
 	}
 
 	profileName := options.Name + "-profile"
-	current.AddConnSslProfile(qdr.SslProfile{
+	profile := qdr.SslProfile{
 		Name: profileName,
-	})
+	}
+	if cli.hostMode() {
+		// qdrouterd reads the certs from the site's dirs
+		profile.CertFile = connPath + "/tls.crt"
+		profile.PrivateKeyFile = connPath + "/tls.key"
+		profile.CaCertFile = connPath + "/ca.crt"
+	}
+	current.AddConnSslProfile(profile)
 	connector := qdr.Connector{
 		Name:       options.Name,
 		Cost:       options.Cost,
 		SslProfile: profileName,
 	}
-	if current.IsEdge() {
-		hostString, _ := ioutil.ReadFile(connPath + "/edge-host")
-		portString, _ := ioutil.ReadFile(connPath + "/edge-port")
-		connector.Host = string(hostString)
-		connector.Port = string(portString)
-		connector.Role = qdr.RoleEdge
-	} else {
-		hostString, _ := ioutil.ReadFile(connPath + "/inter-router-host")
-		portString, _ := ioutil.ReadFile(connPath + "/inter-router-port")
-		connector.Host = string(hostString)
-		connector.Port = string(portString)
-		connector.Role = qdr.RoleInterRouter
-	}
+	setConnectorEndpoint(&connector, connPath, current.IsEdge())
 	current.AddConnector(connector)
 	err = current.WriteToConfigFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
 	if err != nil {
 		return "", fmt.Errorf("Failed to update router config file: %w", err)
 	}
 
-	err = driver.RecreateContainer("skupper-router", cli.CeDriver)
+	// the running router takes the connector as is, it is only recreated
+	// from the config when it cannot
+	err = qdr.CreateSslProfile(ctx, cli.CeDriver, current.SslProfiles[profileName])
+	if err == nil {
+		err = qdr.CreateConnector(ctx, cli.CeDriver, connector)
+	}
+	if err != nil {
+		err = cli.restartRouter(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return options.Name, nil
+}
+
+// restartRouter recreates the router so it reads its config again, and the
+// controller and the proxies that are connected to it
+func (cli *VanClient) restartRouter(ctx context.Context) error {
+	err := driver.RecreateContainer(ctx, "skupper-router", cli.CeDriver)
 	if err != nil {
-		return "", fmt.Errorf("Failed to re-start transport container: %w", err)
+		return fmt.Errorf("Failed to re-start transport container: %w", err)
 	}
 
-	err = driver.RecreateContainer("skupper-service-controller", cli.CeDriver)
+	err = driver.RecreateContainer(ctx, "skupper-service-controller", cli.CeDriver)
 	if err != nil {
-		return "", fmt.Errorf("Failed to re-start service controller container: %w", err)
+		return fmt.Errorf("Failed to re-start service controller container: %w", err)
 	}
 
 	// restart proxies
-	vsis, err := cli.ServiceInterfaceList()
+	vsis, err := cli.ServiceInterfaceList(ctx)
 	if err != nil {
-		return "", fmt.Errorf("Failed to list proxies to restart: %w", err)
+		return fmt.Errorf("Failed to list proxies to restart: %w", err)
 	}
 	for _, vs := range vsis {
 		fmt.Println("Need to restart container", vs.Address)
-		err = cli.CeDriver.ContainerRestart(vs.Address)
+		err = cli.CeDriver.ContainerRestart(ctx, vs.Address)
 		if err != nil {
-			return "", fmt.Errorf("Failed to restart proxy container: %w", err)
+			return fmt.Errorf("Failed to restart proxy container: %w", err)
 		}
 	}
-
-	return options.Name, nil
+	return nil
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 
@@ -8,25 +9,24 @@ import (
 	"github.com/ajssmith/skupper-exp/pkg/qdr"
 )
 
-func (cli *VanClient) ConnectorInspect(name string) (*types.ConnectorInspectResponse, error) {
+func (cli *VanClient) ConnectorInspect(ctx context.Context, name string) (*types.ConnectorInspectResponse, error) {
 	vci := &types.ConnectorInspectResponse{}
 	var role types.ConnectorRole
 	var suffix string
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return vci, fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return vci, fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		// TODO: is not found versus error
-		return vci, fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
+		return vci, containerError("transport", err)
 	}
 
 	current, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
@@ -57,7 +57,7 @@ func (cli *VanClient) ConnectorInspect(name string) (*types.ConnectorInspectResp
 		Role: string(role),
 	}
 
-	connections, err := qdr.GetConnections(cli.CeDriver)
+	connections, err := qdr.GetConnections(ctx, cli.CeDriver)
 
 	if err == nil {
 		connection := qdr.GetInterRouterOrEdgeConnection(vci.Connector.Host+":"+vci.Connector.Port, connections)
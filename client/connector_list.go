@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 
@@ -8,23 +9,23 @@ import (
 	"github.com/ajssmith/skupper-exp/pkg/qdr"
 )
 
-func (cli *VanClient) ConnectorList() ([]*types.Connector, error) {
+func (cli *VanClient) ConnectorList(ctx context.Context) ([]*types.Connector, error) {
 	var connectors []*types.Connector
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return connectors, fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return connectors, fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
 	// verify that the transport is interior mode
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return connectors, fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
+		return connectors, containerError("transport", err)
 	}
 
 	current, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
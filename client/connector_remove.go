@@ -1,28 +1,28 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/ajssmith/skupper-exp/api/types"
-	"github.com/ajssmith/skupper-exp/driver"
 	"github.com/ajssmith/skupper-exp/pkg/qdr"
 )
 
-func (cli *VanClient) ConnectorRemove(name string) error {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+func (cli *VanClient) ConnectorRemove(ctx context.Context, name string) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve transport container: %w", err)
+		return containerError("transport", err)
 	}
 
 	current, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
@@ -31,42 +31,29 @@ func (cli *VanClient) ConnectorRemove(name string) error {
 	}
 
 	found := current.RemoveConnector(name)
-	if found {
-		current.RemoveConnSslProfile(name)
-
-		err = os.RemoveAll(types.GetSkupperPath(types.ConnectionsPath) + "/" + name)
-		if err != nil {
-			return fmt.Errorf("Failed to remove connector file contents: %w", err)
-		}
-
-		err = current.WriteToConfigFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
-		if err != nil {
-			return fmt.Errorf("Failed to update router config file: %w", err)
-		}
+	if !found {
+		return nil
 	}
+	current.RemoveConnSslProfile(name)
 
-	err = driver.RecreateContainer("skupper-router", cli.CeDriver)
+	err = os.RemoveAll(types.GetSkupperPath(types.ConnectionsPath) + "/" + name)
 	if err != nil {
-		return fmt.Errorf("Failed to re-start transport container: %w", err)
+		return fmt.Errorf("Failed to remove connector file contents: %w", err)
 	}
 
-	err = driver.RecreateContainer("skupper-service-controller", cli.CeDriver)
+	err = current.WriteToConfigFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
 	if err != nil {
-		return fmt.Errorf("Failed to re-start service controller container: %w", err)
+		return fmt.Errorf("Failed to update router config file: %w", err)
 	}
 
-	// TODO: Note this is where cli Init might happen twice, is that ok?
-	// restart proxies
-	vsis, err := cli.ServiceInterfaceList()
-	if err != nil {
-		return fmt.Errorf("Failed to list proxies to restart: %w", err)
+	// the connector goes before its sslProfile, the router is only
+	// recreated from the config when it cannot remove them
+	err = qdr.DeleteConnector(ctx, cli.CeDriver, name)
+	if err == nil {
+		err = qdr.DeleteSslProfile(ctx, cli.CeDriver, name+"-profile")
 	}
-	for _, vs := range vsis {
-		fmt.Println("Need to restart: ", vs.Address)
-		err = cli.CeDriver.ContainerRestart(vs.Address)
-		if err != nil {
-			return fmt.Errorf("Failed to restart proxy container: %w", err)
-		}
+	if err != nil {
+		return cli.restartRouter(ctx)
 	}
 
 	return nil
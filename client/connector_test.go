@@ -1,23 +1,33 @@
 package client
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+	"github.com/docker/go-connections/nat"
+	"github.com/skupperproject/skupper/pkg/certs"
 	"gotest.tools/assert"
+	"gotest.tools/assert/cmp"
 )
 
 func TestConnectorCreateTokenInterior(t *testing.T) {
+	ctx := context.Background()
 	tmpDir, err := ioutil.TempDir("", "connector")
 	assert.Check(t, err, "Unable to create temporary directory")
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newTestClient(t)
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -30,25 +40,24 @@ func TestConnectorCreateTokenInterior(t *testing.T) {
 		User:                "",
 		Password:            "",
 	}
-	err = cli.RouterCreate(scs)
-	time.Sleep(time.Second * 1)
+	err = cli.RouterCreate(ctx, scs)
 	assert.Check(t, err, "Unable to create VAN router")
 
-	err = cli.ConnectorTokenCreate("conn1", tmpDir+"/conn1.yaml")
+	_, err = cli.ConnectorTokenCreate(ctx, "conn1", tmpDir+"/conn1.yaml", types.ConnectorTokenCreateOptions{})
 	assert.Check(t, err, "Unable to create connector token")
 
-	errors := cli.RouterRemove()
+	errors := cli.RouterRemove(ctx)
 	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
 }
 
 func TestConnectorCreateTokenEdge(t *testing.T) {
+	ctx := context.Background()
 	tmpDir, err := ioutil.TempDir("", "connector")
 	assert.Check(t, err, "Unable to create temporary directory")
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newTestClient(t)
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -61,25 +70,24 @@ func TestConnectorCreateTokenEdge(t *testing.T) {
 		User:                "",
 		Password:            "",
 	}
-	err = cli.RouterCreate(scs)
-	time.Sleep(time.Second * 1)
+	err = cli.RouterCreate(ctx, scs)
 	assert.Check(t, err, "Unable to create VAN router")
 
-	err = cli.ConnectorTokenCreate("conn1", tmpDir+"/conn1.yaml")
+	_, err = cli.ConnectorTokenCreate(ctx, "conn1", tmpDir+"/conn1.yaml", types.ConnectorTokenCreateOptions{})
 	assert.Equal(t, err.Error(), "Edge mode transport configuration cannot accept connections")
 
-	errors := cli.RouterRemove()
+	errors := cli.RouterRemove(ctx)
 	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
 }
 
 func TestConnectorCreateNoFileError(t *testing.T) {
+	ctx := context.Background()
 	tmpDir, err := ioutil.TempDir("", "connector")
 	assert.Check(t, err, "Unable to create temporary directory")
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newTestClient(t)
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -92,24 +100,23 @@ func TestConnectorCreateNoFileError(t *testing.T) {
 		User:                "",
 		Password:            "",
 	}
-	err = cli.RouterCreate(scs)
-	time.Sleep(time.Second * 1)
+	err = cli.RouterCreate(ctx, scs)
 	assert.Check(t, err, "Unable to create VAN router")
 
-	_, err = cli.ConnectorCreate(tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{})
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{})
 	assert.Equal(t, err.Error(), "Failed to make connector: Could not read connection token: open "+tmpDir+"/conn1.yaml: no such file or directory")
-	errors := cli.RouterRemove()
+	errors := cli.RouterRemove(ctx)
 	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
 }
 
 func TestConnectorCreateFakeOut(t *testing.T) {
+	ctx := context.Background()
 	tmpDir, err := ioutil.TempDir("", "connector")
 	assert.Check(t, err, "Unable to create temporary directory")
 	os.Setenv("SKUPPER_TMPDIR", tmpDir)
 	defer os.RemoveAll(tmpDir)
 
-	cli, err := NewClient()
-	assert.Check(t, err, "Unable to create VAN client")
+	cli, _ := newTestClient(t)
 
 	scs := types.SiteConfigSpec{
 		SkupperName:         "skupper",
@@ -122,40 +129,296 @@ func TestConnectorCreateFakeOut(t *testing.T) {
 		User:                "",
 		Password:            "",
 	}
-	err = cli.RouterCreate(scs)
-	time.Sleep(time.Second * 1)
+	err = cli.RouterCreate(ctx, scs)
 	assert.Check(t, err, "Unable to create VAN router")
 
-	err = cli.ConnectorTokenCreate("subject1", tmpDir+"/conn1.yaml")
+	_, err = cli.ConnectorTokenCreate(ctx, "subject1", tmpDir+"/conn1.yaml", types.ConnectorTokenCreateOptions{})
 	assert.Check(t, err, "Unable to create token")
 
-	err = cli.ConnectorTokenCreate("subjec2", tmpDir+"/conn2.yaml")
+	_, err = cli.ConnectorTokenCreate(ctx, "subjec2", tmpDir+"/conn2.yaml", types.ConnectorTokenCreateOptions{})
 	assert.Check(t, err, "Unable to create token")
 
-	errors := cli.RouterRemove()
+	errors := cli.RouterRemove(ctx)
 	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
-	time.Sleep(time.Second * 1)
 
-	err = cli.RouterCreate(scs)
+	err = cli.RouterCreate(ctx, scs)
 	assert.Check(t, err, "Unable to create VAN router")
-	time.Sleep(time.Second * 1)
 
-	_, err = cli.ConnectorCreate(tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{})
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{})
 	assert.Check(t, err, "Unable to create connector")
 
-	_, err = cli.ConnectorCreate(tmpDir+"/conn2.yaml", types.ConnectorCreateOptions{})
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn2.yaml", types.ConnectorCreateOptions{})
 	assert.Check(t, err, "Unable to create connector")
 
-	conns, err := cli.ConnectorList()
+	conns, err := cli.ConnectorList(ctx)
 	assert.Check(t, err, "Unable to list connectors")
 	assert.Assert(t, len(conns) == 2, "Error with the number of connectors")
 
-	_, err = cli.ConnectorInspect("conn1")
+	_, err = cli.ConnectorInspect(ctx, "conn1")
 	assert.Check(t, err, "Unable to inspect connector")
 
-	err = cli.ConnectorRemove("conn1")
+	err = cli.ConnectorRemove(ctx, "conn1")
 	assert.Check(t, err, "Unable to remove connector")
 
-	errors = cli.RouterRemove()
+	errors = cli.RouterRemove(ctx)
 	assert.Assert(t, len(errors) == 0, "Error removing VAN router")
 }
+
+func TestConnectorCreateTokenEntries(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "connector")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, _ := newTestClient(t)
+	scs := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	_, err = cli.ConnectorTokenCreate(ctx, "subject1", tmpDir+"/conn1.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Check(t, err)
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+
+	content, err := certs.GetSecretContent(tmpDir + "/conn1.yaml")
+	assert.Check(t, err)
+	certData := certs.CertificateData{}
+	annotations := map[string]string{}
+	for k, v := range content {
+		if strings.HasSuffix(k, ".crt") || strings.HasSuffix(k, ".key") {
+			certData[k] = v
+		} else {
+			annotations[k] = string(v)
+		}
+	}
+	connectionsPath := types.GetSkupperPath(types.ConnectionsPath)
+
+	// the annotations the connector does not know of are left out
+	annotations[types.BaseQualifier+"/../../escaped"] = "data"
+	certs.PutCertificateData("subject1", tmpDir+"/conn2.yaml", certData, annotations)
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn2.yaml", types.ConnectorCreateOptions{Name: "conn2"})
+	assert.Check(t, err)
+	_, err = os.Stat(connectionsPath + "/conn2/../../escaped")
+	assert.Assert(t, os.IsNotExist(err))
+	_, err = os.Stat(connectionsPath + "/conn2/generated-by")
+	assert.Check(t, err)
+
+	// and the files that are not the connector's are refused
+	delete(annotations, types.BaseQualifier+"/../../escaped")
+	certData["../escaped.crt"] = certData["ca.crt"]
+	certs.PutCertificateData("subject1", tmpDir+"/conn3.yaml", certData, annotations)
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn3.yaml", types.ConnectorCreateOptions{Name: "conn3"})
+	assert.Error(t, err, "Token '"+tmpDir+"/conn3.yaml' has an invalid entry '../escaped.crt'")
+	_, err = os.Stat(connectionsPath + "/conn3")
+	assert.Assert(t, os.IsNotExist(err))
+	_, err = os.Stat(connectionsPath + "/escaped.crt")
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestConnectorLive(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "connector")
+	assert.Check(t, err, "Unable to create temporary directory")
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	scs := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	_, err = cli.ConnectorTokenCreate(ctx, "subject1", tmpDir+"/conn1.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Check(t, err)
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	routerId := func() string {
+		router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+		assert.Check(t, err)
+		return router.ID
+	}
+	lastCommands := func(n int) []string {
+		router, ok := dd.Container(types.TransportDeploymentName)
+		assert.Assert(t, ok)
+		assert.Assert(t, len(router.ExecCalls) >= n)
+		commands := []string{}
+		for _, cmd := range router.ExecCalls[len(router.ExecCalls)-n:] {
+			commands = append(commands, strings.Join(cmd[:6], " "))
+		}
+		return commands
+	}
+	configFile := types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json"
+
+	// the running router takes the connector
+	id := routerId()
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{Name: "conn1", Cost: 2})
+	assert.Check(t, err)
+	assert.Equal(t, routerId(), id)
+	assert.DeepEqual(t, lastCommands(2), []string{
+		"qdmanage create --type sslProfile --name conn1-profile",
+		"qdmanage create --type connector --name conn1",
+	})
+	config, err := qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	assert.Equal(t, config.Connectors["conn1"].Cost, int32(2))
+
+	// and is recreated from the config when it cannot
+	dd.FailOnce("ContainerExec", fmt.Errorf("qdmanage: connection refused"))
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/conn1.yaml", types.ConnectorCreateOptions{Name: "conn2"})
+	assert.Check(t, err)
+	assert.Assert(t, routerId() != id)
+	config, err = qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	_, ok := config.Connectors["conn2"]
+	assert.Assert(t, ok)
+
+	id = routerId()
+	assert.Check(t, cli.ConnectorRemove(ctx, "conn1"))
+	assert.Equal(t, routerId(), id)
+	assert.DeepEqual(t, lastCommands(2), []string{
+		"qdmanage delete --type connector --name conn1",
+		"qdmanage delete --type sslProfile --name conn1-profile",
+	})
+	config, err = qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	_, ok = config.Connectors["conn1"]
+	assert.Assert(t, !ok)
+	_, ok = config.SslProfiles["conn1-profile"]
+	assert.Assert(t, !ok)
+}
+
+func TestConnectorEdgeToken(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "connector")
+	assert.Check(t, err, "Unable to create temporary directory")
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, _ := newTestClient(t)
+	scs := types.SiteConfigSpec{
+		SkupperName: "skupper",
+		AuthMode:    "unsecured",
+	}
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	_, err = cli.ConnectorTokenCreate(ctx, "subject1", tmpDir+"/any.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Check(t, err)
+	_, err = cli.ConnectorTokenCreate(ctx, "subject2", tmpDir+"/edge.yaml", types.ConnectorTokenCreateOptions{EdgeOnly: true})
+	assert.Check(t, err)
+	token, err := certs.GetSecretContent(tmpDir + "/edge.yaml")
+	assert.Check(t, err)
+	_, ok := token["inter-router-host"]
+	assert.Assert(t, !ok)
+	assert.Equal(t, string(token["edge-port"]), "45671")
+
+	// an interior site cannot use an edge token
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/edge.yaml", types.ConnectorCreateOptions{})
+	assert.Error(t, err, "Token '"+tmpDir+"/edge.yaml' only allows edge sites to connect")
+
+	// an edge site connects to the edge listener with either token
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+	scs.IsEdge = true
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	for _, file := range []string{"any.yaml", "edge.yaml"} {
+		name, err := cli.ConnectorCreate(ctx, tmpDir+"/"+file, types.ConnectorCreateOptions{})
+		assert.Check(t, err)
+		config, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+		assert.Check(t, err)
+		assert.Equal(t, config.Connectors[name].Role, qdr.Role(qdr.RoleEdge), file)
+		assert.Equal(t, config.Connectors[name].Port, "45671", file)
+	}
+}
+
+func certHosts(t *testing.T, file string) []string {
+	data, err := ioutil.ReadFile(file)
+	assert.Check(t, err)
+	block, _ := pem.Decode(data)
+	assert.Assert(t, block != nil)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.Check(t, err)
+	return cert.DNSNames
+}
+
+func TestConnectorTokenIngress(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "connector")
+	assert.Check(t, err, "Unable to create temporary directory")
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	scs := types.SiteConfigSpec{
+		SkupperName:  "skupper",
+		AuthMode:     "unsecured",
+		IngressHosts: []string{"site1.example.com", "10.0.0.5"},
+		IngressPort:  30671,
+	}
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.DeepEqual(t, router.HostConfig.PortBindings, nat.PortMap{
+		"55671/tcp": {{HostPort: "30671"}},
+		"45671/tcp": {{HostPort: "45671"}},
+	})
+	assert.Assert(t, cmp.Contains(certHosts(t, types.GetSkupperPath(types.CertsPath)+"/skupper-internal/tls.crt"), "site1.example.com"))
+
+	// the token has the site's addresses in order and then the router's
+	// address on the bridge
+	_, err = cli.ConnectorTokenCreate(ctx, "subject1", tmpDir+"/conn1.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Check(t, err)
+	token, err := certs.GetSecretContent(tmpDir + "/conn1.yaml")
+	assert.Check(t, err)
+	bridge := router.NetworkSettings.IPAddress + ":55671"
+	assert.Equal(t, string(token["inter-router-host"]), "site1.example.com")
+	assert.Equal(t, string(token["inter-router-port"]), "30671")
+	assert.Equal(t, string(token["inter-router-candidates"]), "site1.example.com:30671,10.0.0.5:30671,"+bridge)
+	assert.Equal(t, string(token["edge-host"]), "site1.example.com")
+	assert.Equal(t, string(token["edge-port"]), "45671")
+	assert.Equal(t, string(token["edge-candidates"]), "site1.example.com:45671,10.0.0.5:45671,"+router.NetworkSettings.IPAddress+":45671")
+
+	// or the ones it is given, of the site's as the router's certificate
+	// is issued for them
+	_, err = cli.ConnectorTokenCreate(ctx, "subject2", tmpDir+"/conn2.yaml", types.ConnectorTokenCreateOptions{IngressHosts: []string{"10.0.0.5"}, IngressPort: 443})
+	assert.Check(t, err)
+	token, err = certs.GetSecretContent(tmpDir + "/conn2.yaml")
+	assert.Check(t, err)
+	assert.Equal(t, string(token["inter-router-candidates"]), "10.0.0.5:443,"+bridge)
+	_, err = cli.ConnectorTokenCreate(ctx, "subject4", tmpDir+"/conn4.yaml", types.ConnectorTokenCreateOptions{IngressHosts: []string{"lb.example.com"}})
+	assert.Error(t, err, "lb.example.com is not an ingress host of the site, add it with 'skupper-exp update --ingress-host'")
+
+	// a router running without the published listeners
+	spec := driver.ContainerSpec(router)
+	spec.HostConfig.PortBindings = nil
+	assert.Check(t, driver.ReplaceContainer(ctx, dd, router, spec))
+	_, err = cli.ConnectorTokenCreate(ctx, "subject5", tmpDir+"/conn5.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Error(t, err, "The site published no listeners for its ingress hosts, publish them with 'skupper-exp update --ingress-host'")
+
+	_, err = cli.ConnectorTokenCreate(ctx, "subject3", tmpDir+"/conn3.yaml", types.ConnectorTokenCreateOptions{IngressPort: 443})
+	assert.Error(t, err, "--ingress-port only valid with --ingress-host")
+
+	// an edge site accepts no connections
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+	scs.IsEdge = true
+	err = cli.RouterCreate(ctx, scs)
+	assert.Error(t, err, "--ingress-host is not valid for an edge site, it accepts no connections")
+}
+
+func TestReachableEndpoint(t *testing.T) {
+	ctx := context.Background()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Check(t, err)
+	defer listener.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Check(t, err)
+	closed.Close()
+
+	host, port := reachableEndpoint(ctx, []string{closed.Addr().String(), listener.Addr().String()})
+	assert.Equal(t, net.JoinHostPort(host, port), listener.Addr().String())
+	host, port = reachableEndpoint(ctx, []string{closed.Addr().String()})
+	assert.Equal(t, net.JoinHostPort(host, port), closed.Addr().String(), "the first address is used when none is reachable")
+}
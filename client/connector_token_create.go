@@ -1,55 +1,173 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ajssmith/skupper-exp/api/types"
 	"github.com/ajssmith/skupper-exp/pkg/qdr"
 	"github.com/skupperproject/skupper/pkg/certs"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/client-go/kubernetes/scheme"
 )
 
-func (cli *VanClient) ConnectorTokenCreate(subject string, secretFile string) error {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+// ConnectorTokenCreate writes a token other sites connect to this one with
+// and records it under its name, the subject when given, which it returns
+func (cli *VanClient) ConnectorTokenCreate(ctx context.Context, subject string, secretFile string, options types.ConnectorTokenCreateOptions) (string, error) {
+	name, certData, annotations, err := cli.issueToken(ctx, subject, options)
 	if err != nil {
-		return fmt.Errorf("Unable to retrieve site config: %w", err)
+		return "", err
+	}
+	// TODO err return from certs pkg
+	certs.PutCertificateData(name, secretFile, certData, annotations)
+	return name, nil
+}
+
+// issueToken generates and records a token, its client certificate and the
+// annotations with the site's endpoints and the token's limits
+func (cli *VanClient) issueToken(ctx context.Context, subject string, options types.ConnectorTokenCreateOptions) (string, certs.CertificateData, map[string]string, error) {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
-		return fmt.Errorf("Failed to intialize client: %w", err)
+		return "", nil, nil, fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
 	// verify that the transport is interior mode
-	router, err := cli.CeDriver.ContainerInspect("skupper-router")
+	router, err := cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Unable to retrieve transport container (need init?): %w", err)
+		return "", nil, nil, containerError("transport", err)
 	}
 
 	current, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve router config: %w", err)
+		return "", nil, nil, fmt.Errorf("Failed to retrieve router config: %w", err)
 	}
 
 	if current.IsEdge() {
-		return fmt.Errorf("Edge mode transport configuration cannot accept connections")
+		return "", nil, nil, fmt.Errorf("Edge mode transport configuration cannot accept connections")
 	}
 
-	caData, err := getCertData("skupper-internal-ca")
+	caData, err := getCertData(internalCA)
 	if err != nil {
-		return fmt.Errorf("Unable to retrieve CA data: %w", err)
+		return "", nil, nil, fmt.Errorf("Unable to retrieve CA data: %w", err)
 	}
 
+	// the token points at the site's ingress, or at the router's address
+	// on the engine's bridge, which only the sites on this host reach. The
+	// router's certificate is only issued for the site's ingress hosts.
+	hosts := options.IngressHosts
+	if len(hosts) == 0 {
+		if options.IngressPort != 0 {
+			return "", nil, nil, fmt.Errorf("--ingress-port only valid with --ingress-host")
+		}
+		hosts = sc.Spec.IngressHosts
+	}
+	for _, host := range hosts {
+		if !containsString(sc.Spec.IngressHosts, host) {
+			return "", nil, nil, fmt.Errorf("%s is not an ingress host of the site, add it with 'skupper-exp update --ingress-host'", host)
+		}
+	}
+	if len(hosts) > 0 && len(router.HostConfig.PortBindings) == 0 {
+		return "", nil, nil, fmt.Errorf("The site published no listeners for its ingress hosts, publish them with 'skupper-exp update --ingress-host'")
+	}
+	port := options.IngressPort
+	if port == 0 {
+		port = sc.Spec.IngressPort
+	}
 	// TODO add to driver
 	ipAddr := router.NetworkSettings.IPAddress
 	//ipAddr := string(router.NetworkSettings.Networks["skupper-network"].IPAddress)
 	annotations := make(map[string]string)
-	annotations["inter-router-port"] = "55671"
-	annotations["inter-router-host"] = ipAddr
+	if !options.EdgeOnly {
+		setTokenEndpoints(annotations, qdr.RoleInterRouter, tokenEndpoints(hosts, ingressPort(port), ipAddr, types.InterRouterListenerPort))
+	}
+	// the edge listener is published on its own port
+	setTokenEndpoints(annotations, qdr.RoleEdge, tokenEndpoints(hosts, int(types.EdgeListenerPort), ipAddr, types.EdgeListenerPort))
 	annotations[types.TokenGeneratedBy] = sc.UID
 
-	// TODO err return from certs pkg
-	certData := certs.GenerateCertificateData(subject, subject, ipAddr, caData)
-	certs.PutCertificateData(subject, secretFile, certData, annotations)
+	// the token's client certificate is issued for its name, which the
+	// site checks the connections made with it against
+	if options.Expiry < 0 || options.Uses < 0 {
+		return "", nil, nil, fmt.Errorf("--expiry and --uses cannot be negative")
+	}
+	tokensPath := types.GetSkupperPath(types.TokensPath)
+	if err := os.MkdirAll(tokensPath, 0755); err != nil {
+		return "", nil, nil, fmt.Errorf("Failed to create skupper tokens directory: %w", err)
+	}
+	if subject == "" {
+		subject, err = generateTokenName(tokensPath)
+		if err != nil {
+			return "", nil, nil, err
+		}
+	}
+	err = checkTokenName(subject)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if _, err := readIssuedToken(tokensPath, subject); !os.IsNotExist(err) {
+		return "", nil, nil, fmt.Errorf("Token %s was already issued, choose another client identity", subject)
+	}
+	token := &types.IssuedToken{
+		Name:    subject,
+		Created: time.Now().UTC(),
+		Uses:    options.Uses,
+	}
+	if options.Expiry > 0 {
+		token.Expiry = token.Created.Add(options.Expiry)
+		annotations[types.TokenExpiry] = token.Expiry.Format(time.RFC3339)
+	}
+	if options.Uses > 0 {
+		annotations[types.TokenUses] = strconv.Itoa(options.Uses)
+	}
+	err = writeIssuedToken(tokensPath, token)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("Failed to record token %s: %w", subject, err)
+	}
+
+	certHosts := append(append([]string{}, hosts...), ipAddr)
+	certData := certs.GenerateCertificateData(subject, subject, strings.Join(certHosts, ","), caData)
+	// the site's certificate may still be issued by the previous CA
+	certData["ca.crt"] = trustedCAs(internalCA)
+	return subject, certData, annotations, nil
+}
 
-	return nil
+// tokenEndpoints returns the addresses of a listener in the order they are
+// tried, the ingress and then the router's address on the bridge
+func tokenEndpoints(hosts []string, hostPort int, ipAddr string, port int32) []string {
+	candidates := []string{}
+	for _, host := range hosts {
+		candidates = append(candidates, net.JoinHostPort(host, strconv.Itoa(hostPort)))
+	}
+	return append(candidates, net.JoinHostPort(ipAddr, strconv.Itoa(int(port))))
+}
+
+// setTokenEndpoints adds the first address and the candidates of the
+// listener of the role to the token
+func setTokenEndpoints(annotations map[string]string, role qdr.Role, candidates []string) {
+	host, port, _ := net.SplitHostPort(candidates[0])
+	annotations[string(role)+"-host"] = host
+	annotations[string(role)+"-port"] = port
+	annotations[string(role)+"-candidates"] = strings.Join(candidates, ",")
+}
+
+// encodeToken returns the token as ConnectorTokenCreate writes it
+func encodeToken(name string, certData certs.CertificateData, annotations map[string]string) ([]byte, error) {
+	secret := certs.CertDataToSecret(name, certData, annotations)
+	s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
+	var out bytes.Buffer
+	err := s.Encode(&secret, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
 }
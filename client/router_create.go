@@ -1,11 +1,16 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -39,9 +44,12 @@ func getCertData(name string) (certs.CertificateData, error) {
 	return certData, err
 }
 
+// generateCredentials issues the credential, while the CA is rotated it is
+// issued by the previous CA and trusts both
 func generateCredentials(ca string, name string, subject string, hosts []string, includeConnectJson bool) error {
-	caData, _ := getCertData(ca)
+	caData, _ := getCertData(issuingCA(ca))
 	certData := certs.GenerateCertificateData(name, subject, strings.Join(hosts, ","), caData)
+	certData["ca.crt"] = trustedCAs(ca)
 
 	for k, v := range certData {
 		if err := ioutil.WriteFile(types.GetSkupperPath(types.CertsPath)+"/"+name+"/"+k, v, 0755); err != nil {
@@ -77,22 +85,19 @@ func ensureCA(name string) (certs.CertificateData, error) {
 	return caData, nil
 }
 
-func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId string) (*types.RouterSpec, error) {
+func (cli *VanClient) GetRouterSpecFromOpts(ctx context.Context, options types.SiteConfigSpec, siteId string) (*types.RouterSpec, error) {
 	van := &types.RouterSpec{}
 	//TODO: think througn van name, router name, secret names, etc.
 	if options.SkupperName == "" {
-		info, _ := cli.CeDriver.Info()
+		info, _ := cli.CeDriver.Info(ctx)
 		van.Name = info.Name
 	} else {
 		van.Name = options.SkupperName
 	}
 
-	if os.Getenv("QDROUTERD_MAGE") != "" {
-		van.Transport.Image = os.Getenv("QDROUTERD_IMAGE")
-	} else {
-		van.Transport.Image = types.DefaultTransportImage
-	}
+	van.Transport.Image = transportImage(options)
 
+	van.Network = siteNetwork(options)
 	van.AuthMode = types.ConsoleAuthMode(options.AuthMode)
 	van.Transport.LivenessPort = types.TransportLivenessPort
 	van.Transport.Labels = map[string]string{
@@ -102,7 +107,13 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 		"prometheus.io/scrape": "true",
 	}
 
-	routerConfig := qdr.InitialConfig(van.Name+"-${HOSTNAME}", siteId, options.IsEdge)
+	routerId := van.Name + "-${HOSTNAME}"
+	if cli.hostMode() {
+		// the router image expands ${HOSTNAME}, qdrouterd itself does not
+		routerId = van.Name + "-" + types.TransportDeploymentName
+		van.Transport.Cmd = []string{hostCommand("QDROUTERD_COMMAND", types.TransportCommand), "-c", "/etc/qpid-dispatch/config/" + types.TransportConfigFile}
+	}
+	routerConfig := qdr.InitialConfig(routerId, siteId, options.IsEdge)
 	routerConfig.AddAddress(qdr.Address{
 		Prefix:       "mc",
 		Distribution: "multicast",
@@ -174,7 +185,6 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 			AuthenticatePeer: true,
 		})
 	}
-	van.RouterConfig, _ = qdr.MarshalRouterConfig(routerConfig)
 
 	envVars := map[string]string{
 		"QDROUTERD_CONF":      "/etc/qpid-dispatch/config/" + types.TransportConfigFile,
@@ -224,6 +234,23 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	}
 	van.Transport.Ports = ports
 
+	if len(options.IngressHosts) > 0 {
+		if options.IsEdge {
+			return nil, fmt.Errorf("--ingress-host is not valid for an edge site, it accepts no connections")
+		}
+		port := ingressPort(options.IngressPort)
+		if cli.hostMode() && port != int(types.InterRouterListenerPort) {
+			return nil, fmt.Errorf("--ingress-port is not supported in host mode, the router listens on port %d of the host", types.InterRouterListenerPort)
+		}
+		// the other hosts reach the listeners through the host's ports
+		van.Transport.PortBindings = nat.PortMap{
+			nat.Port(strconv.Itoa(int(types.InterRouterListenerPort)) + "/tcp"): {{HostPort: strconv.Itoa(port)}},
+			nat.Port(strconv.Itoa(int(types.EdgeListenerPort)) + "/tcp"):        {{HostPort: strconv.Itoa(int(types.EdgeListenerPort))}},
+		}
+	} else if options.IngressPort != 0 {
+		return nil, fmt.Errorf("--ingress-port only valid with --ingress-host")
+	}
+
 	volumes := []string{
 		"skupper",
 		"skupper-amqps",
@@ -247,6 +274,12 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	mounts[types.GetSkupperPath(types.SaslConfigPath)] = "/etc/sasl2"
 	van.Transport.Mounts = mounts
 
+	if cli.hostMode() {
+		// qdrouterd reads the certs from the site's dirs
+		resolveSslProfiles(&routerConfig, bindMounts(mounts))
+	}
+	van.RouterConfig, _ = qdr.MarshalRouterConfig(routerConfig)
+
 	cas := []types.CertAuthority{}
 	cas = append(cas, types.CertAuthority{Name: "skupper-ca"})
 	if !options.IsEdge {
@@ -276,7 +309,7 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 			CA:          "skupper-internal-ca",
 			Name:        "skupper-internal",
 			Subject:     "skupper-internal",
-			Hosts:       []string{"skupper-router"},
+			Hosts:       append([]string{"skupper-router"}, options.IngressHosts...),
 			ConnectJson: false,
 			Post:        false,
 		})
@@ -284,11 +317,7 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	van.Credentials = credentials
 
 	// Controller spec portion
-	if os.Getenv("SKUPPER_CONTROLLER_IMAGE") != "" {
-		van.Controller.Image = os.Getenv("SKUPPER_CONTROLLER_IMAGE")
-	} else {
-		van.Controller.Image = types.DefaultControllerImage
-	}
+	van.Controller.Image = controllerImage(options)
 	van.Controller.Labels = map[string]string{
 		"application":          types.ControllerDeploymentName,
 		"skupper.io/component": types.ControllerComponentName,
@@ -300,15 +329,41 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 		skupperHost = "host-gateway"
 	}
 	van.Controller.EnvVar = map[string]string{
-		"SKUPPER_SITE_ID":          siteId,
-		"SKUPPER_TMPDIR":           os.Getenv("SKUPPER_TMPDIR"),
-		"SKUPPER_PROXY_IMAGE":      van.Controller.Image,
-		"SKUPPER_HOST":             skupperHost,
-		"SKUPPER_CONTAINER_ENGINE": options.ContainerEngineDriver,
+		"SKUPPER_SITE_ID":           siteId,
+		"SKUPPER_TMPDIR":            os.Getenv("SKUPPER_TMPDIR"),
+		"SKUPPER_PROXY_IMAGE":       van.Controller.Image,
+		"QDROUTERD_IMAGE":           van.Transport.Image,
+		"SKUPPER_HOST":              skupperHost,
+		"SKUPPER_CONTAINER_ENGINE":  options.ContainerEngineDriver,
+		"SKUPPER_IMAGE_PULL_POLICY": options.ImagePullPolicy,
+		"REGISTRY_AUTH_FILE":        types.ControllerRegistryAuth,
+		"SKUPPER_NETWORK":           van.Network,
 	}
 	if options.MapToHost {
 		van.Controller.EnvVar["SKUPPER_MAP_TO_HOST"] = "true"
 	}
+	van.Controller.Cmd = []string{types.ControllerCommand}
+	if cli.hostMode() {
+		// the paths are translated to the site's dirs by the host driver
+		van.Controller.Cmd = []string{hostCommand("SKUPPER_CONTROLLER_COMMAND", types.ControllerHostCommand)}
+		van.Controller.EnvVar["SKUPPER_CONFIG_PATH"] = types.ControllerConfigPath
+		van.Controller.EnvVar["SKUPPER_SERVICES_FILE"] = types.ControllerConfigPath + "services/skupper-services"
+		van.Controller.EnvVar["SKUPPER_TOKENS_PATH"] = types.ControllerConfigPath + "tokens"
+		van.Controller.EnvVar["SKUPPER_ROUTER_HOST"] = "127.0.0.1"
+	}
+	if options.ContainerEngineEndpoint != "" {
+		van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE_ENDPOINT"] = options.ContainerEngineEndpoint
+	}
+	tlsEnv := map[string]string{
+		"SKUPPER_CONTAINER_ENGINE_TLS_CACERT": options.ContainerEngineTLSCACert,
+		"SKUPPER_CONTAINER_ENGINE_TLS_CERT":   options.ContainerEngineTLSCert,
+		"SKUPPER_CONTAINER_ENGINE_TLS_KEY":    options.ContainerEngineTLSKey,
+	}
+	for name, file := range tlsEnv {
+		if file != "" {
+			van.Controller.EnvVar[name] = file
+		}
+	}
 	if options.TraceLog {
 		van.Controller.EnvVar["PN_TRACE_FRM"] = "1"
 	}
@@ -326,30 +381,145 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	// }
 
 	van.Controller.Mounts = map[string]string{
-		types.GetSkupperPath(types.CertsPath) + "/" + "skupper": "/etc/messaging",
-		types.GetSkupperPath(types.ServicesPath):                "/etc/messaging/services",
-		"/var/run":                                              "/var/run",
+		types.GetSkupperPath(types.CertsPath) + "/" + "skupper":              "/etc/messaging",
+		types.GetSkupperPath(types.ServicesPath):                             "/etc/messaging/services",
+		types.GetSkupperPath(types.TokensPath):                               "/etc/messaging/tokens",
+		"/var/run":                                                           "/var/run",
+		types.GetSkupperPath(types.SitesPath) + "/" + types.RegistryAuthFile: types.ControllerRegistryAuth,
+	}
+	// the engine socket and TLS material are mounted at the same path so
+	// the controller can use the site's engine config as is, /var/run is
+	// already there
+	socket := driver.UnixSocketPath(options.ContainerEngineEndpoint)
+	if socket != "" && !strings.HasPrefix(socket, "/var/run/") {
+		van.Controller.Mounts[socket] = socket
+	}
+	for _, file := range tlsEnv {
+		if file != "" {
+			van.Controller.Mounts[file] = file
+		}
+	}
+	// the controller loads the same driver plugin from the site's plugin dir
+	if options.ContainerEnginePluginDir != "" {
+		van.Controller.EnvVar["SKUPPER_PLUGIN_PATH"] = types.ControllerPluginPath
+		van.Controller.Mounts[options.ContainerEnginePluginDir] = types.ControllerPluginPath
+	}
+	// and the same out of process driver, its socket or executable is
+	// mounted at the same path
+	if options.ContainerEngineDriverRPC != "" {
+		van.Controller.EnvVar["SKUPPER_DRIVER_RPC"] = options.ContainerEngineDriverRPC
+		if rpcSocket := driver.UnixSocketPath(options.ContainerEngineDriverRPC); rpcSocket != "" {
+			if !strings.HasPrefix(rpcSocket, "/var/run/") {
+				van.Controller.Mounts[rpcSocket] = rpcSocket
+			}
+		} else if executable := strings.Fields(options.ContainerEngineDriverRPC)[0]; filepath.IsAbs(executable) {
+			van.Controller.Mounts[executable] = executable
+		}
 	}
 
 	return van, nil
 }
 
-func getControllerContainerCreateOptions(van *types.RouterSpec) *driver.ContainerCreateOptions {
+// transportImage returns the router image of the site, the proxies run it
+// as well
+func transportImage(options types.SiteConfigSpec) string {
+	if options.TransportImage != "" {
+		return options.TransportImage
+	}
+	if os.Getenv("QDROUTERD_IMAGE") != "" {
+		return os.Getenv("QDROUTERD_IMAGE")
+	}
+	return types.DefaultTransportImage
+}
+
+// controllerImage returns the controller image of the site
+func controllerImage(options types.SiteConfigSpec) string {
+	if options.ControllerImage != "" {
+		return options.ControllerImage
+	}
+	if os.Getenv("SKUPPER_CONTROLLER_IMAGE") != "" {
+		return os.Getenv("SKUPPER_CONTROLLER_IMAGE")
+	}
+	return types.DefaultControllerImage
+}
+
+// siteImage identifies the image for the site config, an image that cannot
+// be inspected is only known by its name
+func (cli *VanClient) siteImage(ctx context.Context, name string) types.SiteImage {
+	image := types.SiteImage{Name: name}
+	if inspect, err := cli.CeDriver.ImageInspect(ctx, name); err == nil {
+		image.ID = inspect.ID
+	}
+	if version, err := cli.CeDriver.ImageVersion(ctx, name); err == nil {
+		image.Version = version
+	}
+	return image
+}
+
+// hostCommand returns the executable run in host mode, the environment
+// variable overrides the one found in the PATH
+func hostCommand(env string, command string) string {
+	if os.Getenv(env) != "" {
+		return os.Getenv(env)
+	}
+	return command
+}
+
+// bindMounts returns the bind mounts for a host dir to container dir map,
+// sorted by container dir
+func bindMounts(dirs map[string]string) []driver.MountPoint {
 	mounts := []driver.MountPoint{}
-	for source, target := range van.Controller.Mounts {
+	for source, target := range dirs {
 		mounts = append(mounts, driver.MountPoint{
 			Type:        driver.TypeBind,
 			Source:      source,
 			Destination: target,
 		})
 	}
+	// in a stable order so specs can be compared
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].Destination < mounts[j].Destination
+	})
+	return mounts
+}
+
+// resolveSslProfiles replaces the container paths of the sslProfiles with
+// the host paths they are mounted from
+func resolveSslProfiles(config *qdr.RouterConfig, mounts []driver.MountPoint) {
+	for name, profile := range config.SslProfiles {
+		profile.CertFile = driver.HostPath(mounts, profile.CertFile)
+		profile.PrivateKeyFile = driver.HostPath(mounts, profile.PrivateKeyFile)
+		profile.CaCertFile = driver.HostPath(mounts, profile.CaCertFile)
+		config.SslProfiles[name] = profile
+	}
+}
+
+// routerHealthyTimeout is how long the router may take to pass its health
+// check, longer than its start period
+const routerHealthyTimeout = 120 * time.Second
+
+// waitForRouterHealthy blocks until the router's /healthz passes, the
+// controller and the proxies need the router to be up
+func (cli *VanClient) waitForRouterHealthy(ctx context.Context) error {
+	err := cli.CeDriver.ContainerWait(ctx, types.TransportDeploymentName, driver.HealthyState, routerHealthyTimeout, time.Second)
+	if err != nil {
+		return fmt.Errorf("Transport container did not become healthy: %w", err)
+	}
+	if router, err := cli.CeDriver.ContainerInspect(ctx, types.TransportDeploymentName); err == nil && driver.HealthCheckNeverRan(router) {
+		log.Println("The router's health check never ran, the container engine may not run health checks (podman without systemd), continuing as the router is running")
+	}
+	return nil
+}
+
+func getControllerContainerCreateOptions(van *types.RouterSpec) *driver.ContainerCreateOptions {
+	mounts := bindMounts(van.Controller.Mounts)
 
 	cfg := &driver.ContainerCreateOptions{
 		Name: types.ControllerDeploymentName,
 		ContainerConfig: &driver.ContainerBaseConfig{
 			Hostname: types.ControllerDeploymentName,
 			Image:    van.Controller.Image,
-			Cmd:      []string{"/go/src/app/controller"},
+			Cmd:      van.Controller.Cmd,
 			Env:      van.Controller.EnvVar,
 			HealthCheck: &driver.HealthConfig{
 				Test:        []string{},
@@ -364,7 +534,7 @@ func getControllerContainerCreateOptions(van *types.RouterSpec) *driver.Containe
 		},
 		NetworkingConfig: &driver.ContainerNetworkingConfig{
 			EndpointsConfig: map[string]*driver.NetworkEndpointSetting{
-				types.TransportNetworkName: {},
+				van.Network: {},
 			},
 		},
 	}
@@ -373,35 +543,33 @@ func getControllerContainerCreateOptions(van *types.RouterSpec) *driver.Containe
 }
 
 func getTransportContainerCreateOptions(van *types.RouterSpec) *driver.ContainerCreateOptions {
-	mounts := []driver.MountPoint{}
-	for source, target := range van.Transport.Mounts {
-		mounts = append(mounts, driver.MountPoint{
-			Type:        driver.TypeBind,
-			Source:      source,
-			Destination: target,
-		})
-	}
+	mounts := bindMounts(van.Transport.Mounts)
 
 	cfg := &driver.ContainerCreateOptions{
 		Name: types.TransportDeploymentName,
 		ContainerConfig: &driver.ContainerBaseConfig{
 			Hostname: types.TransportDeploymentName,
 			Image:    van.Transport.Image,
+			Cmd:      van.Transport.Cmd,
 			Env:      van.Transport.EnvVar,
 			HealthCheck: &driver.HealthConfig{
-				Test:        []string{"curl --fail -s http://localhost:9090/healthz || exit 1"},
+				Test:        []string{"CMD-SHELL", "curl --fail -s http://localhost:9090/healthz || exit 1"},
+				Interval:    (time.Duration(5) * time.Second),
+				Timeout:     (time.Duration(3) * time.Second),
 				StartPeriod: (time.Duration(60) * time.Second),
+				Retries:     3,
 			},
 			Labels:       van.Transport.Labels,
 			ExposedPorts: van.Transport.Ports,
 		},
 		HostConfig: &driver.ContainerHostConfig{
-			Mounts:     mounts,
-			Privileged: true,
+			Mounts:       mounts,
+			PortBindings: van.Transport.PortBindings,
+			Privileged:   true,
 		},
 		NetworkingConfig: &driver.ContainerNetworkingConfig{
 			EndpointsConfig: map[string]*driver.NetworkEndpointSetting{
-				types.TransportNetworkName: {},
+				van.Network: {},
 			},
 		},
 	}
@@ -409,14 +577,96 @@ func getTransportContainerCreateOptions(van *types.RouterSpec) *driver.Container
 	return cfg
 }
 
-// RouterCreate instantiates a VAN Router (transport and controller)
-func (cli *VanClient) RouterCreate(options types.SiteConfigSpec) error {
-	clerr := cli.Init(options.ContainerEngineDriver)
-	if clerr != nil {
-		fmt.Println("client error: ", clerr.Error())
+// ingressPort returns the host port the inter-router listener is published
+// on
+func ingressPort(port int) int {
+	if port == 0 {
+		return int(types.InterRouterListenerPort)
+	}
+	return port
+}
+
+// getNetworkCreateOptions returns the options of the site's network, the
+// default network keeps its skupper0 bridge
+func getNetworkCreateOptions(options types.SiteConfigSpec, siteId string) driver.NetworkCreateOptions {
+	nco := driver.NetworkCreateOptions{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Options: map[string]string{
+			"com.docker.network.bridge.enable_icc":           "true",
+			"com.docker.network.bridge.enable_ip_masquerade": "true",
+		},
+		Labels: map[string]string{
+			types.SiteIdLabel: siteId,
+		},
+	}
+	if siteNetwork(options) == types.TransportNetworkName {
+		nco.Options["com.docker.network.bridge.name"] = "skupper0"
+	}
+	if options.NetworkSubnet != "" {
+		nco.IPAM.Config = []driver.NetworkIPAMConfig{{Subnet: options.NetworkSubnet}}
+	}
+	return nco
+}
+
+// checkSiteNetwork fails when the site's network exists or its subnet
+// overlaps the subnet of another network, the owned network of an existing
+// site is not in the way
+func (cli *VanClient) checkSiteNetwork(ctx context.Context, options types.SiteConfigSpec, owned string) error {
+	var subnet *net.IPNet
+	if options.NetworkSubnet != "" {
+		var err error
+		if _, subnet, err = net.ParseCIDR(options.NetworkSubnet); err != nil {
+			return fmt.Errorf("Invalid network subnet %s: %w", options.NetworkSubnet, err)
+		}
+	}
+	networks, err := cli.CeDriver.NetworkList(ctx, driver.NetworkListOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to list networks: %w", err)
+	}
+	name := siteNetwork(options)
+	for _, n := range networks {
+		if owned != "" && n.Name == owned {
+			continue
+		}
+		if n.Name == name {
+			return driver.WrapError(driver.ErrAlreadyExists, fmt.Errorf("Network %s already exists, choose another network name", name))
+		}
+		if subnet == nil {
+			continue
+		}
+		for _, config := range n.IPAM.Config {
+			if _, other, err := net.ParseCIDR(config.Subnet); err == nil && (other.Contains(subnet.IP) || subnet.Contains(other.IP)) {
+				return fmt.Errorf("Network subnet %s overlaps subnet %s of network %s", options.NetworkSubnet, config.Subnet, n.Name)
+			}
+		}
 	}
+	return nil
+}
 
-	//TODO return error
+// getRegistryAuth resolves the credentials for an image, explicit
+// credentials take precedence over the auth files
+func getRegistryAuth(options types.SiteConfigSpec, image string) (*driver.RegistryAuth, error) {
+	if options.RegistryUser != "" {
+		return &driver.RegistryAuth{
+			Username:      options.RegistryUser,
+			Password:      options.RegistryPassword,
+			ServerAddress: driver.RegistryHost(image),
+		}, nil
+	}
+	files := driver.DefaultRegistryAuthFiles()
+	if options.RegistryAuthFile != "" {
+		if _, err := os.Stat(options.RegistryAuthFile); err != nil {
+			return nil, fmt.Errorf("Unable to use registry auth file: %w", err)
+		}
+		files = []string{options.RegistryAuthFile}
+	}
+	return driver.GetRegistryAuth(image, files)
+}
+
+// setConsoleOptions defaults the console to internal auth with a generated
+// password, the user and password are only valid with internal auth
+func (cli *VanClient) setConsoleOptions(options *types.SiteConfigSpec) error {
 	if options.EnableConsole {
 		if options.AuthMode == string(types.ConsoleAuthModeInternal) || options.AuthMode == "" {
 			options.AuthMode = string(types.ConsoleAuthModeInternal)
@@ -434,123 +684,327 @@ func (cli *VanClient) RouterCreate(options types.SiteConfigSpec) error {
 				return fmt.Errorf("--router-console-password only valid when --router-console-auth=internal")
 			}
 		}
+	}
 
+	if cli.hostMode() && options.AuthMode == string(types.ConsoleAuthModeInternal) {
+		// the sasl database is set up by the router image
+		return fmt.Errorf("--console-auth=internal is not supported in host mode")
 	}
 
-	// TODO check if resources already exist: either delete them all or error out
-	// setup host dirs
-	_ = os.RemoveAll(types.GetSkupperPath(types.HostPath))
-	// create host dirs TODO this should not be here
-	if err := os.MkdirAll(types.GetSkupperPath(types.HostPath), 0755); err != nil {
-		return err
+	return nil
+}
+
+// RouterCreate instantiates a VAN Router (transport and controller)
+func (cli *VanClient) RouterCreate(ctx context.Context, options types.SiteConfigSpec) error {
+	// the TLS material is mounted into the controller, it needs absolute paths
+	for _, file := range []*string{&options.ContainerEngineTLSCACert, &options.ContainerEngineTLSCert, &options.ContainerEngineTLSKey} {
+		if *file != "" {
+			abs, err := filepath.Abs(*file)
+			if err != nil {
+				return err
+			}
+			*file = abs
+		}
 	}
-	if err := os.Mkdir(types.GetSkupperPath(types.SitesPath), 0755); err != nil {
-		return err
+
+	err := cli.Init(ctx, options.ContainerEngineDriver, getEngineConfig(options))
+	if err != nil {
+		return fmt.Errorf("Failed to intialize client: %w", err)
+	} else if cli.CeDriverName != "" {
+		// persist the detected engine so later commands reuse it
+		options.ContainerEngineDriver = cli.CeDriverName
+		options.ContainerEngineEndpoint = cli.CeEngineConfig.Endpoint
+		if cli.CeEngineConfig.PluginDir != "" {
+			// the plugin dir is mounted into the controller
+			abs, err := filepath.Abs(cli.CeEngineConfig.PluginDir)
+			if err != nil {
+				return err
+			}
+			options.ContainerEnginePluginDir = abs
+		}
+		options.ContainerEngineDriverRPC = cli.CeEngineConfig.RPC
 	}
 
-	sc, err := cli.SiteConfigCreate(options)
+	err = cli.setConsoleOptions(&options)
 	if err != nil {
 		return err
 	}
 
-	van, err := cli.GetRouterSpecFromOpts(options, sc.UID)
+	if options.RegistryPassword != "" && options.RegistryUser == "" {
+		return fmt.Errorf("--registry-password only valid with --registry-user")
+	}
+	pullPolicy, err := driver.ParsePullPolicy(options.ImagePullPolicy)
 	if err != nil {
 		return err
 	}
+	options.ImagePullPolicy = string(pullPolicy)
 
-	_, err = cli.CeDriver.ImagesPull(van.Transport.Image, driver.ImagePullOptions{})
+	if options.Force && options.Reconcile {
+		return fmt.Errorf("--force and --reconcile cannot be used together")
+	}
+
+	options.NetworkName = siteNetwork(options)
+	site, err := cli.getExistingSite(ctx, options)
 	if err != nil {
 		return err
 	}
-
-	_, err = cli.CeDriver.ImagesPull(van.Controller.Image, driver.ImagePullOptions{})
+	if site.found() && !options.Force && !options.Reconcile {
+		return driver.WrapError(driver.ErrAlreadyExists, fmt.Errorf("Skupper is already installed (found %s), use --force to replace it or --reconcile to update it", site))
+	}
+	err = cli.checkSiteNetwork(ctx, options, site.networkName())
 	if err != nil {
 		return err
 	}
-
-	for mnt := range van.Transport.Mounts {
-		if err := os.Mkdir(mnt, 0755); err != nil {
-			return err
+	if site.found() && options.Force {
+		if errs := cli.removeSite(ctx, site.networkName()); len(errs) > 0 {
+			return fmt.Errorf("Failed to remove the existing site: %w", errs[0])
 		}
-	}
-	for _, v := range van.Transport.Volumes {
-		if err := os.Mkdir(types.GetSkupperPath(types.CertsPath)+"/"+v, 0755); err != nil {
-			return err
+		site = &existingSite{}
+	}
+	// an existing site keeps its identity, CAs, connections and services
+	reconcile := site.found()
+	if reconcile && site.config != nil {
+		// and its images, they are changed by an upgrade
+		if options.TransportImage == "" {
+			options.TransportImage = site.config.Spec.TransportImage
+		}
+		if options.ControllerImage == "" {
+			options.ControllerImage = site.config.Spec.ControllerImage
 		}
 	}
 
-	// this one is needed by the controller
-	if err := os.Mkdir(types.GetSkupperPath(types.ServicesPath), 0755); err != nil {
+	tx := &siteTransaction{}
+	err = cli.createSite(ctx, tx, options, site, reconcile, pullPolicy)
+	if err != nil {
+		return tx.rollback(err)
+	}
+	tx.commit()
+	return nil
+}
+
+// createSite creates the site, or converges the existing one, as steps the
+// transaction can roll back. The images are pulled first, they are not
+// removed on rollback.
+func (cli *VanClient) createSite(ctx context.Context, tx *siteTransaction, options types.SiteConfigSpec, site *existingSite, reconcile bool, pullPolicy driver.PullPolicy) error {
+	sc := &types.SiteConfig{
+		Spec: options,
+		UID:  site.siteId(),
+	}
+	if sc.UID == "" {
+		sc.UID = NewUUID()
+	}
+
+	van, err := cli.GetRouterSpecFromOpts(ctx, options, sc.UID)
+	if err != nil {
 		return err
 	}
+	sc.Spec.TransportImage = van.Transport.Image
+	sc.Spec.ControllerImage = van.Controller.Image
 
-	svcDefs := make(map[string]types.ServiceInterface)
-	encoded, err := json.Marshal(svcDefs)
+	transportAuth, err := getRegistryAuth(options, van.Transport.Image)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(types.GetSkupperPath(types.ServicesPath)+"/skupper-services", encoded, 0755)
+	err = driver.PullImage(ctx, cli.CeDriver, van.Transport.Image, pullPolicy, transportAuth)
 	if err != nil {
 		return err
 	}
 
-	// write qdrouterd configs
-	err = ioutil.WriteFile(types.GetSkupperPath(types.ConfigPath)+"/qdrouterd.json", []byte(van.RouterConfig), 0755)
+	controllerAuth, err := getRegistryAuth(options, van.Controller.Image)
 	if err != nil {
 		return err
 	}
-	if options.EnableConsole && options.AuthMode == string(types.ConsoleAuthModeInternal) {
-		config := `
-pwcheck_method: auxprop
-auxprop_plugin: sasldb
-sasldb_path: /tmp/qdrouterd.sasldb
-`
-		err := ioutil.WriteFile(types.GetSkupperPath(types.SaslConfigPath)+"/qdrouterd.conf", []byte(config), 0755)
+	err = driver.PullImage(ctx, cli.CeDriver, van.Controller.Image, pullPolicy, controllerAuth)
+	if err != nil {
+		return err
+	}
+	sc.Images = map[string]types.SiteImage{
+		types.TransportComponentName:  cli.siteImage(ctx, van.Transport.Image),
+		types.ControllerComponentName: cli.siteImage(ctx, van.Controller.Image),
+	}
+
+	// the containers of an existing site keep running until they are
+	// replaced by ones created from the spec
+	transport, controller, err := cli.siteContainers(ctx, tx, site)
+	if err != nil {
+		return err
+	}
+	var restoreFiles func() error
+	if reconcile {
+		err = cli.reconcileNetwork(ctx, tx, site.network, options, sc.UID)
 		if err != nil {
 			return err
 		}
-		err = ioutil.WriteFile(types.GetSkupperPath(types.ConsoleUsersPath)+"/"+options.User, []byte(options.Password), 0755)
+		restoreFiles, err = backupSiteFiles(tx)
 		if err != nil {
 			return err
 		}
+	} else {
+		// setup host dirs
+		_ = os.RemoveAll(types.GetSkupperPath(types.HostPath))
+		tx.onRollback("remove skupper files", func(ctx context.Context) error {
+			return os.RemoveAll(types.GetSkupperPath(types.HostPath))
+		})
+	}
+	// create host dirs TODO this should not be here
+	if err := os.MkdirAll(types.GetSkupperPath(types.HostPath), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(types.GetSkupperPath(types.SitesPath), 0755); err != nil {
+		return err
 	}
 
-	// create user network
-	_, err = cli.CeDriver.NetworkCreate(types.TransportNetworkName, driver.NetworkCreateOptions{})
+	err = writeSiteConfig(sc)
 	if err != nil {
 		return err
 	}
 
-	transportOpts := getTransportContainerCreateOptions(van)
-	transportResp, err := cli.CeDriver.ContainerCreate(*transportOpts)
+	// the controller pulls the proxy image, which is the transport image,
+	// with the credentials of both images as their registries may differ
+	err = driver.WriteRegistryAuthFile(types.GetSkupperPath(types.SitesPath)+"/"+types.RegistryAuthFile, []*driver.RegistryAuth{controllerAuth, transportAuth})
 	if err != nil {
-		return err
+		return fmt.Errorf("Failed to write registry auth file: %w", err)
 	}
 
-	for _, ca := range van.CertAuthoritys {
-		ensureCA(ca.Name)
+	// write qdrouterd configs
+	routerConfig := van.RouterConfig
+	if reconcile {
+		routerConfig, err = reconcileRouterConfig(routerConfig, options.IsEdge)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeSiteFiles(options, van, routerConfig)
+	if err != nil {
+		return err
 	}
 
-	for _, cred := range van.Credentials {
-		generateCredentials(cred.CA, cred.Name, cred.Subject, cred.Hosts, cred.ConnectJson)
+	if !reconcile {
+		// create user network
+		err = cli.createNetwork(ctx, van.Network, getNetworkCreateOptions(options, sc.UID))
+		if err != nil {
+			return err
+		}
+		tx.onRollback("remove network "+van.Network, func(ctx context.Context) error {
+			return cli.CeDriver.NetworkRemove(ctx, van.Network)
+		})
 	}
 
-	// //TODO : generate certs first?
-	err = cli.CeDriver.ContainerStart(transportResp.ID)
-	if err != nil {
-		return fmt.Errorf("Could not start transport container: %w", err)
+	generateSiteCerts(van)
+
+	transportOpts := getTransportContainerCreateOptions(van)
+	if transport.current != nil {
+		err = driver.ReplaceContainerWith(ctx, cli.CeDriver, transport.current, *transportOpts, restoreFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to replace transport container: %w", err)
+		}
+		transport.replaced = true
+	} else {
+		transportResp, err := cli.createContainer(ctx, tx, *transportOpts)
+		if err != nil {
+			return err
+		}
+		err = cli.CeDriver.ContainerStart(ctx, transportResp.ID)
+		if err != nil {
+			return fmt.Errorf("Could not start transport container: %w", err)
+		}
+		err = cli.waitForRouterHealthy(ctx)
+		if err != nil {
+			return err
+		}
 	}
 
 	controllerOpts := getControllerContainerCreateOptions(van)
-	controllerResp, err := cli.CeDriver.ContainerCreate(*controllerOpts)
-	if err != nil {
+	if controller.current != nil {
+		err = driver.ReplaceContainerWith(ctx, cli.CeDriver, controller.current, *controllerOpts, restoreFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to replace controller container: %w", err)
+		}
+		controller.replaced = true
+	} else {
+		controllerResp, err := cli.createContainer(ctx, tx, *controllerOpts)
+		if err != nil {
+			return err
+		}
+		err = cli.CeDriver.ContainerStart(ctx, controllerResp.ID)
+		if err != nil {
+			return fmt.Errorf("Could not start controller container: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeSiteFiles creates the site's dirs and writes the router config and
+// the console users, the services file is only created when missing
+func writeSiteFiles(options types.SiteConfigSpec, van *types.RouterSpec, routerConfig string) error {
+	for mnt := range van.Transport.Mounts {
+		if err := os.MkdirAll(mnt, 0755); err != nil {
+			return err
+		}
+	}
+	for _, v := range van.Transport.Volumes {
+		if err := os.MkdirAll(types.GetSkupperPath(types.CertsPath)+"/"+v, 0755); err != nil {
+			return err
+		}
+	}
+
+	// these are needed by the controller
+	if err := os.MkdirAll(types.GetSkupperPath(types.ServicesPath), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(types.GetSkupperPath(types.TokensPath), 0755); err != nil {
 		return err
 	}
 
-	err = cli.CeDriver.ContainerStart(controllerResp.ID)
-	if err != nil {
-		return fmt.Errorf("Could not start controller container: %w", err)
+	servicesFile := types.GetSkupperPath(types.ServicesPath) + "/skupper-services"
+	if _, err := os.Stat(servicesFile); os.IsNotExist(err) {
+		svcDefs := make(map[string]types.ServiceInterface)
+		encoded, err := json.Marshal(svcDefs)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(servicesFile, encoded, 0755)
+		if err != nil {
+			return err
+		}
 	}
 
+	// write qdrouterd configs
+	err := ioutil.WriteFile(types.GetSkupperPath(types.ConfigPath)+"/qdrouterd.json", []byte(routerConfig), 0755)
+	if err != nil {
+		return err
+	}
+	if options.EnableConsole && options.AuthMode == string(types.ConsoleAuthModeInternal) {
+		config := `
+pwcheck_method: auxprop
+auxprop_plugin: sasldb
+sasldb_path: /tmp/qdrouterd.sasldb
+`
+		err = ioutil.WriteFile(types.GetSkupperPath(types.SaslConfigPath)+"/qdrouterd.conf", []byte(config), 0755)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(types.GetSkupperPath(types.ConsoleUsersPath)+"/"+options.User, []byte(options.Password), 0755)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// generateSiteCerts generates the CAs and credentials of the spec that the
+// site does not have yet, and the credentials it has for other hosts
+func generateSiteCerts(van *types.RouterSpec) {
+	for _, ca := range van.CertAuthoritys {
+		if !certExists(ca.Name) {
+			ensureCA(ca.Name)
+		}
+	}
+
+	for _, cred := range van.Credentials {
+		if !certExists(cred.Name) || certHostsChanged(cred.Name, cred.Hosts) {
+			generateCredentials(cred.CA, cred.Name, cred.Subject, cred.Hosts, cred.ConnectJson)
+		}
+	}
+}
@@ -1,69 +1,81 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
 	"github.com/ajssmith/skupper-exp/pkg/qdr"
 )
 
-func (cli *VanClient) RouterInspect() (*types.RouterInspectResponse, error) {
+func (cli *VanClient) RouterInspect(ctx context.Context) (*types.RouterInspectResponse, error) {
 	vir := &types.RouterInspectResponse{}
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return vir, fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return vir, fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	transport, err := cli.CeDriver.ContainerInspect("skupper-router")
+	transport, err := cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		log.Println("Failed to retrieve transport container (need init?): ", err.Error())
-		return vir, err
+		return vir, containerError("transport", err)
 	}
 
-	vir.TransportVersion, err = cli.CeDriver.ImageVersion(transport.Config.Image)
+	vir.TransportVersion, err = cli.CeDriver.ImageVersion(ctx, transport.Config.Image)
 	if err != nil {
 		log.Println("Failed to retrieve transport container version:", err.Error())
 		return vir, err
 	}
 	vir.Status.State = transport.State.Status
+	if transport.State.Health != nil {
+		vir.Status.Health = transport.State.Health.Status
+	}
 
-	controller, err := cli.CeDriver.ContainerInspect(types.ControllerDeploymentName)
+	controller, err := cli.CeDriver.ContainerInspect(ctx, types.ControllerDeploymentName)
 	if err != nil {
-		log.Println("Failed to retrieve controller container (need init?): ", err.Error())
-		return vir, err
+		return vir, containerError("controller", err)
 	}
 
-	vir.ControllerVersion, err = cli.CeDriver.ImageVersion(controller.Config.Image)
+	vir.ControllerVersion, err = cli.CeDriver.ImageVersion(ctx, controller.Config.Image)
 	if err != nil {
 		log.Println("Failed to retrieve controller container version:", err.Error())
 		return vir, err
 	}
 
+	vir.VersionSkew, err = cli.versionSkew(ctx, sc, transport, controller)
+	if err != nil {
+		return vir, err
+	}
+	vir.OverdueRotations = overdueRotations(time.Now())
+
 	routerConfig, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
 	if err != nil {
 		return vir, fmt.Errorf("Failed to retrieve router config: %w", err)
 	}
 	vir.Status.Mode = string(routerConfig.Metadata.Mode)
 
-	connected, err := qdr.GetConnectedSites(cli.CeDriver)
-	for i := 0; i < 5 && err != nil; i++ {
-		time.Sleep(500 * time.Millisecond)
-		connected, err = qdr.GetConnectedSites(cli.CeDriver)
-	}
-	if err != nil {
-		return vir, err
+	// a router that is not up cannot be queried for its sites
+	if vir.Status.State == "running" && (vir.Status.Health == "" || vir.Status.Health == driver.HealthHealthy) {
+		connected, err := qdr.GetConnectedSites(ctx, cli.CeDriver)
+		for i := 0; i < 5 && err != nil; i++ {
+			time.Sleep(500 * time.Millisecond)
+			connected, err = qdr.GetConnectedSites(ctx, cli.CeDriver)
+		}
+		if err != nil {
+			return vir, err
+		}
+		vir.Status.ConnectedSites = connected
 	}
-	vir.Status.ConnectedSites = connected
 
-	vsis, err := cli.ServiceInterfaceList()
+	vsis, err := cli.ServiceInterfaceList(ctx)
 	if err != nil {
 		vir.ExposedServices = 0
 	} else {
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"gotest.tools/assert"
+)
+
+func TestRouterCreatePullPolicy(t *testing.T) {
+	ctx := context.Background()
+	// keep the credentials of the user running the tests out of the way
+	for _, name := range []string{"HOME", "REGISTRY_AUTH_FILE", "XDG_RUNTIME_DIR", "DOCKER_CONFIG"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	testCases := []struct {
+		doc              string
+		pullPolicy       string
+		registryUser     string
+		registryPassword string
+		authFile         string
+		presentImages    []string
+		expectedError    string
+		expectedPulled   []string
+		expectedUser     string
+	}{
+		{
+			doc:            "default pulls missing images",
+			expectedPulled: []string{types.DefaultTransportImage, types.DefaultControllerImage},
+		},
+		{
+			doc:            "if not present skips present images",
+			pullPolicy:     "IfNotPresent",
+			presentImages:  []string{types.DefaultTransportImage},
+			expectedPulled: []string{types.DefaultControllerImage},
+		},
+		{
+			doc:            "always pulls present images",
+			pullPolicy:     "Always",
+			presentImages:  []string{types.DefaultTransportImage, types.DefaultControllerImage},
+			expectedPulled: []string{types.DefaultTransportImage, types.DefaultControllerImage},
+		},
+		{
+			doc:            "never with present images",
+			pullPolicy:     "Never",
+			presentImages:  []string{types.DefaultTransportImage, types.DefaultControllerImage},
+			expectedPulled: []string{},
+		},
+		{
+			doc:           "never with missing image",
+			pullPolicy:    "Never",
+			presentImages: []string{types.DefaultTransportImage},
+			expectedError: "Image " + types.DefaultControllerImage + " is not present and the pull policy is Never: No such image: " + types.DefaultControllerImage,
+		},
+		{
+			doc:           "bad policy",
+			pullPolicy:    "Sometimes",
+			expectedError: "Image pull policy Sometimes not recognized, must be one of: Always, IfNotPresent, Never",
+		},
+		{
+			doc:              "explicit credentials",
+			registryUser:     "fred",
+			registryPassword: "flintstone",
+			expectedPulled:   []string{types.DefaultTransportImage, types.DefaultControllerImage},
+			expectedUser:     "fred",
+		},
+		{
+			doc:              "password without user",
+			registryPassword: "flintstone",
+			expectedError:    "--registry-password only valid with --registry-user",
+		},
+		{
+			doc:            "credentials from auth file",
+			authFile:       `{"auths": {"https://quay.io/v1/": {"auth": "YmFybmV5OnJ1YmJsZQ=="}, "localhost:5000": {"auth": "YmFybmV5OnJ1YmJsZQ=="}}}`,
+			expectedPulled: []string{types.DefaultTransportImage, types.DefaultControllerImage},
+			expectedUser:   "barney",
+		},
+	}
+
+	for _, c := range testCases {
+		tmpDir, err := ioutil.TempDir("", "pull")
+		assert.Check(t, err, c.doc)
+		os.Setenv("SKUPPER_TMPDIR", tmpDir)
+		defer os.RemoveAll(tmpDir)
+
+		cli, dd := newTestClient(t)
+		for _, image := range c.presentImages {
+			dd.AddImage(image)
+		}
+		pulled := []string{}
+		dd.PullAllowed = func(ref string, options driver.ImagePullOptions) bool {
+			pulled = append(pulled, ref)
+			if c.expectedUser == "" {
+				return true
+			}
+			return options.Auth != nil && options.Auth.Username == c.expectedUser
+		}
+
+		scs := types.SiteConfigSpec{
+			SkupperName:       "skupper",
+			EnableController:  true,
+			EnableServiceSync: true,
+			AuthMode:          "unsecured",
+			ImagePullPolicy:   c.pullPolicy,
+			RegistryUser:      c.registryUser,
+			RegistryPassword:  c.registryPassword,
+		}
+		if c.authFile != "" {
+			scs.RegistryAuthFile = filepath.Join(tmpDir, "auth.json")
+			assert.Check(t, ioutil.WriteFile(scs.RegistryAuthFile, []byte(c.authFile), 0600), c.doc)
+		}
+
+		err = cli.RouterCreate(ctx, scs)
+		if c.expectedError != "" {
+			assert.Error(t, err, c.expectedError, c.doc)
+			continue
+		}
+		assert.Check(t, err, c.doc)
+		assert.DeepEqual(t, pulled, c.expectedPulled)
+
+		// the controller gets the credentials for the proxy image and its
+		// own, which is in another registry
+		authFile := types.GetSkupperPath(types.SitesPath) + "/" + types.RegistryAuthFile
+		info, err := os.Stat(authFile)
+		assert.Check(t, err, c.doc)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0600), c.doc)
+		for _, image := range []string{types.DefaultTransportImage, types.DefaultControllerImage} {
+			auth, err := driver.GetRegistryAuth(image, []string{authFile})
+			assert.Check(t, err, c.doc)
+			if c.expectedUser == "" {
+				assert.Assert(t, auth == nil, c.doc)
+			} else {
+				assert.Equal(t, auth.Username, c.expectedUser, c.doc)
+			}
+		}
+
+		controller, ok := dd.Container(types.ControllerDeploymentName)
+		assert.Assert(t, ok, c.doc)
+		env := controller.Options.ContainerConfig.Env
+		assert.Equal(t, env["REGISTRY_AUTH_FILE"], types.ControllerRegistryAuth, c.doc)
+		if c.pullPolicy == "" {
+			assert.Equal(t, env["SKUPPER_IMAGE_PULL_POLICY"], string(driver.PullIfNotPresent), c.doc)
+		} else {
+			assert.Equal(t, env["SKUPPER_IMAGE_PULL_POLICY"], c.pullPolicy, c.doc)
+		}
+
+		errors := cli.RouterRemove(ctx)
+		assert.Assert(t, len(errors) == 0, c.doc)
+	}
+}
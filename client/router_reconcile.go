@@ -0,0 +1,311 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+)
+
+// existingSite is what is found of a site from an earlier init, possibly
+// one that failed halfway
+type existingSite struct {
+	config     *types.SiteConfig
+	files      bool
+	containers []string
+	network    *driver.NetworkInspect
+}
+
+func (s *existingSite) found() bool {
+	return s.config != nil || s.files || len(s.containers) > 0 || s.network != nil
+}
+
+func (s *existingSite) String() string {
+	found := []string{}
+	if s.config != nil {
+		found = append(found, "site config")
+	} else if s.files {
+		found = append(found, "site files")
+	}
+	for _, name := range s.containers {
+		found = append(found, "container "+name)
+	}
+	if s.network != nil {
+		found = append(found, "network "+s.network.Name)
+	}
+	return strings.Join(found, ", ")
+}
+
+func (s *existingSite) hasContainer(name string) bool {
+	for _, container := range s.containers {
+		if container == name {
+			return true
+		}
+	}
+	return false
+}
+
+// networkName returns the name of the site's network, empty when there is
+// none
+func (s *existingSite) networkName() string {
+	if s.network == nil {
+		return ""
+	}
+	return s.network.Name
+}
+
+// siteId returns the identity of the site, a site that lost its config
+// still has it on its network
+func (s *existingSite) siteId() string {
+	if s.config != nil {
+		return s.config.UID
+	}
+	if s.network != nil {
+		return s.network.Labels[types.SiteIdLabel]
+	}
+	return ""
+}
+
+// getExistingSite looks for the site config, files, containers and network
+// of a site. The network is the one of the site config or the requested
+// one when it was created for a site, or on an engine without network
+// labels when it has the name.
+func (cli *VanClient) getExistingSite(ctx context.Context, options types.SiteConfigSpec) (*existingSite, error) {
+	site := &existingSite{}
+	if sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName); err == nil {
+		site.config = sc
+	}
+	if files, err := ioutil.ReadDir(types.GetSkupperPath(types.HostPath)); err == nil && len(files) > 0 {
+		site.files = true
+	}
+
+	for _, name := range []string{types.TransportDeploymentName, types.ControllerDeploymentName} {
+		_, err := cli.CeDriver.ContainerInspect(ctx, name)
+		if err == nil {
+			site.containers = append(site.containers, name)
+		} else if !errors.Is(err, driver.ErrNotFound) {
+			return nil, fmt.Errorf("Failed to retrieve container %s: %w", name, err)
+		}
+	}
+
+	names := []string{siteNetwork(options)}
+	if site.config != nil {
+		names = append([]string{siteNetwork(site.config.Spec)}, names...)
+	}
+	for i, name := range names {
+		n, err := cli.CeDriver.NetworkInspect(ctx, name)
+		if errors.Is(err, driver.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve network %s: %w", name, err)
+		}
+		if (site.config != nil && i == 0) || n.Labels[types.SiteIdLabel] != "" || !cli.labelsNetworks() {
+			site.network = &n
+			break
+		}
+	}
+	return site, nil
+}
+
+// labelsNetworks tells whether the engine's networks carry labels, the site's
+// network is only known by its name on podman
+func (cli *VanClient) labelsNetworks() bool {
+	return cli.CeDriverName != driver.PodmanDriverName
+}
+
+// createNetwork creates the network, without its labels when the engine
+// does not support them
+func (cli *VanClient) createNetwork(ctx context.Context, name string, options driver.NetworkCreateOptions) error {
+	_, err := cli.CeDriver.NetworkCreate(ctx, name, options)
+	if errors.Is(err, driver.ErrNotSupported) && len(options.Labels) > 0 {
+		options.Labels = nil
+		_, err = cli.CeDriver.NetworkCreate(ctx, name, options)
+	}
+	return err
+}
+
+// removeContainer stops and removes a site container, it is fine for it to
+// be missing
+func (cli *VanClient) removeContainer(ctx context.Context, name string) error {
+	_, err := cli.CeDriver.ContainerInspect(ctx, name)
+	if errors.Is(err, driver.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to retrieve container %s: %w", name, err)
+	}
+	err = cli.CeDriver.ContainerStop(ctx, name)
+	if err != nil {
+		return fmt.Errorf("Could not stop container %s: %w", name, err)
+	}
+	err = cli.CeDriver.ContainerRemove(ctx, name)
+	if err != nil {
+		return fmt.Errorf("Could not remove container %s: %w", name, err)
+	}
+	return nil
+}
+
+// hasSubnet tells whether the network has the subnet, any subnet will do
+// when none is given
+func hasSubnet(n *driver.NetworkInspect, subnet string) bool {
+	if subnet == "" {
+		return true
+	}
+	for _, config := range n.IPAM.Config {
+		if config.Subnet == subnet {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileNetwork converges the site's network to the spec. A network of
+// another name or subnet is replaced, the containers still attached to it,
+// the proxies and the service targets, move to the new one. The network
+// and the containers are put back on rollback.
+func (cli *VanClient) reconcileNetwork(ctx context.Context, tx *siteTransaction, current *driver.NetworkInspect, options types.SiteConfigSpec, siteId string) error {
+	name := siteNetwork(options)
+	if current != nil && current.Name == name && hasSubnet(current, options.NetworkSubnet) {
+		return nil
+	}
+
+	attached := []string{}
+	if current != nil {
+		n, err := cli.CeDriver.NetworkInspect(ctx, current.Name)
+		if err != nil {
+			return fmt.Errorf("Failed to retrieve network %s: %w", current.Name, err)
+		}
+		for _, c := range n.Containers {
+			container := c.Name
+			err = cli.CeDriver.NetworkDisconnect(ctx, n.Name, container, true)
+			if err != nil {
+				return fmt.Errorf("Failed to disconnect container %s from network %s: %w", container, n.Name, err)
+			}
+			tx.onRollback("connect container "+container+" to network "+n.Name, func(ctx context.Context) error {
+				return cli.CeDriver.NetworkConnect(ctx, n.Name, container, []string{})
+			})
+			attached = append(attached, container)
+		}
+		err = cli.CeDriver.NetworkRemove(ctx, n.Name)
+		if err != nil {
+			return fmt.Errorf("Could not remove network %s: %w", n.Name, err)
+		}
+		tx.onRollback("restore network "+n.Name, func(ctx context.Context) error {
+			return cli.createNetwork(ctx, n.Name, driver.NetworkCreateOptions{
+				CheckDuplicate: true,
+				Driver:         n.Driver,
+				Internal:       n.Internal,
+				IPAM:           n.IPAM,
+				Options:        n.Options,
+				Labels:         n.Labels,
+			})
+		})
+	}
+
+	err := cli.createNetwork(ctx, name, getNetworkCreateOptions(options, siteId))
+	if err != nil {
+		return err
+	}
+	tx.onRollback("remove network "+name, func(ctx context.Context) error {
+		return cli.CeDriver.NetworkRemove(ctx, name)
+	})
+	for _, container := range attached {
+		err = cli.CeDriver.NetworkConnect(ctx, name, container, []string{})
+		if err != nil {
+			return fmt.Errorf("Failed to connect container %s to network %s: %w", container, name, err)
+		}
+		container := container
+		tx.onRollback("disconnect container "+container+" from network "+name, func(ctx context.Context) error {
+			return cli.CeDriver.NetworkDisconnect(ctx, name, container, true)
+		})
+	}
+	return nil
+}
+
+// reconcileRouterConfig carries the connectors, their sslProfiles and the
+// service bridges of the site's router config over to the config generated
+// from the spec. The connectors use the edge or inter-router endpoint of
+// their token as the mode may have changed.
+func reconcileRouterConfig(routerConfig string, edge bool) (string, error) {
+	previous, err := qdr.GetRouterConfigFromFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+	if os.IsNotExist(err) {
+		return routerConfig, nil
+	} else if err != nil {
+		return "", fmt.Errorf("Failed to retrieve router config: %w", err)
+	}
+	config, err := qdr.UnmarshalRouterConfig(routerConfig)
+	if err != nil {
+		return "", err
+	}
+	for _, connector := range previous.Connectors {
+		setConnectorEndpoint(&connector, types.GetSkupperPath(types.ConnectionsPath)+"/"+connector.Name, edge)
+		config.AddConnector(connector)
+		if profile, ok := previous.SslProfiles[connector.SslProfile]; ok {
+			config.SslProfiles[profile.Name] = profile
+		}
+	}
+	config.Bridges = previous.Bridges
+	return qdr.MarshalRouterConfig(config)
+}
+
+// certExists tells whether the CA or credential was generated before
+func certExists(name string) bool {
+	_, err := os.Stat(types.GetSkupperPath(types.CertsPath) + "/" + name + "/tls.crt")
+	return err == nil
+}
+
+// certHostsChanged tells whether the credential was issued for other hosts
+// than the given ones, e.g. when the ingress hosts changed since, a
+// credential that cannot be read is issued again as well
+func certHostsChanged(name string, hosts []string) bool {
+	data, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/" + name + "/tls.crt")
+	if err != nil {
+		return true
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	issued := map[string]bool{}
+	for _, host := range cert.DNSNames {
+		issued[host] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		issued[ip.String()] = true
+	}
+	wanted := map[string]bool{}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			host = ip.String()
+		}
+		wanted[host] = true
+	}
+	return !reflect.DeepEqual(sortedKeys(issued), sortedKeys(wanted))
+}
+
+// sortedKeys returns the keys of the set but the empty one, a credential
+// issued for no hosts has an empty name
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
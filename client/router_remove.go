@@ -1,6 +1,8 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -11,27 +13,37 @@ import (
 //TODO should there be remove options
 
 // RouterRemove delete a VAN (transport and controller) deployment
-func (cli *VanClient) RouterRemove() []error {
+func (cli *VanClient) RouterRemove(ctx context.Context) []error {
 	results := []error{}
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return append(results, fmt.Errorf("Unable to retrieve site config: %w", err))
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return append(results, fmt.Errorf("Failed to intialize client: %w", err))
 	}
 
-	_, err = cli.CeDriver.ContainerInspect(types.ControllerDeploymentName)
-	if err == nil {
+	return cli.removeSite(ctx, siteNetwork(sc.Spec))
+}
+
+// removeSite removes the containers, the network and the files of a site,
+// the network is left alone when it is not given
+func (cli *VanClient) removeSite(ctx context.Context, network string) []error {
+	results := []error{}
+
+	_, err := cli.CeDriver.ContainerInspect(ctx, types.ControllerDeploymentName)
+	if err != nil && !errors.Is(err, driver.ErrNotFound) {
+		results = append(results, containerError("controller", err))
+	} else if err == nil {
 		// stop controller
-		err = cli.CeDriver.ContainerStop(types.ControllerDeploymentName)
+		err = cli.CeDriver.ContainerStop(ctx, types.ControllerDeploymentName)
 		if err != nil {
 			results = append(results, fmt.Errorf("Could not stop controller container: %w", err))
 		} else {
-			err = cli.CeDriver.ContainerRemove(types.ControllerDeploymentName)
+			err = cli.CeDriver.ContainerRemove(ctx, types.ControllerDeploymentName)
 			if err != nil {
 				results = append(results, fmt.Errorf("Could not remove controller container: %w", err))
 			}
@@ -46,16 +58,16 @@ func (cli *VanClient) RouterRemove() []error {
 		Filters: filters,
 		All:     true,
 	}
-	containers, err := cli.CeDriver.ContainerList(opts)
+	containers, err := cli.CeDriver.ContainerList(ctx, opts)
 	if err == nil {
 		for _, container := range containers {
 			if value, ok := container.Labels["skupper.io/component"]; ok {
 				if value == "proxy" {
-					err := cli.CeDriver.ContainerStop(container.ID)
+					err := cli.CeDriver.ContainerStop(ctx, container.ID)
 					if err != nil {
 						results = append(results, fmt.Errorf("Failed to stop proxy container: %w", err))
 					} else {
-						err = cli.CeDriver.ContainerRemove(container.ID)
+						err = cli.CeDriver.ContainerRemove(ctx, container.ID)
 						if err != nil {
 							results = append(results, fmt.Errorf("Failed to remove proxy container: %w", err))
 						}
@@ -67,26 +79,32 @@ func (cli *VanClient) RouterRemove() []error {
 		results = append(results, fmt.Errorf("Failed to list proxy containers: %w", err))
 	}
 
-	_, err = cli.CeDriver.ContainerInspect(types.TransportDeploymentName)
-	if err == nil {
+	_, err = cli.CeDriver.ContainerInspect(ctx, types.TransportDeploymentName)
+	if err != nil && !errors.Is(err, driver.ErrNotFound) {
+		results = append(results, containerError("transport", err))
+	} else if err == nil {
 		// stop transport
-		err = cli.CeDriver.ContainerStop(types.TransportDeploymentName)
+		err = cli.CeDriver.ContainerStop(ctx, types.TransportDeploymentName)
 		if err != nil {
 			results = append(results, fmt.Errorf("Could not stop transport container: %w", err))
 		} else {
-			err = cli.CeDriver.ContainerRemove(types.TransportDeploymentName)
+			err = cli.CeDriver.ContainerRemove(ctx, types.TransportDeploymentName)
 			if err != nil {
 				results = append(results, fmt.Errorf("Could not remove controller container: %w", err))
 			}
 		}
 	}
 
-	_, err = cli.CeDriver.NetworkInspect("skupper-network")
-	if err == nil {
-		// remove network
-		err = cli.CeDriver.NetworkRemove("skupper-network")
-		if err != nil {
-			results = append(results, fmt.Errorf("Could not remove skupper network: %w", err))
+	if network != "" {
+		_, err = cli.CeDriver.NetworkInspect(ctx, network)
+		if err != nil && !errors.Is(err, driver.ErrNotFound) {
+			results = append(results, fmt.Errorf("Failed to retrieve skupper network: %w", err))
+		} else if err == nil {
+			// remove network
+			err = cli.CeDriver.NetworkRemove(ctx, network)
+			if err != nil {
+				results = append(results, fmt.Errorf("Could not remove skupper network: %w", err))
+			}
 		}
 	}
 
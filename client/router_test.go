@@ -1,16 +1,24 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/driver/fake"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
 	"gotest.tools/assert"
 )
 
 func TestRouterCreateDefaults(t *testing.T) {
+	ctx := context.Background()
 	testCases := []struct {
 		doc                 string
 		expectedError       string
@@ -132,8 +140,7 @@ func TestRouterCreateDefaults(t *testing.T) {
 		os.Setenv("SKUPPER_TMPDIR", tmpDir)
 		defer os.RemoveAll(tmpDir)
 
-		cli, err := NewClient()
-		assert.Check(t, err, c.doc)
+		cli, _ := newTestClient(t)
 
 		scs := types.SiteConfigSpec{
 			SkupperName:         c.skupperName,
@@ -147,8 +154,7 @@ func TestRouterCreateDefaults(t *testing.T) {
 			Password:            c.password,
 		}
 
-		err = cli.RouterCreate(scs)
-		time.Sleep(time.Second * 1)
+		err = cli.RouterCreate(ctx, scs)
 		if c.expectedError == "" {
 			assert.Check(t, err, c.doc)
 		} else {
@@ -156,17 +162,583 @@ func TestRouterCreateDefaults(t *testing.T) {
 		}
 
 		if c.expectedError == "" {
-			_, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+			_, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 			assert.Check(t, err, c.doc)
 
-			vir, err := cli.RouterInspect()
+			vir, err := cli.RouterInspect(ctx)
 			assert.Check(t, err, c.doc)
 			assert.Assert(t, vir.Status.State == "running", c.doc)
 			assert.Assert(t, vir.Status.Mode == string(types.TransportModeInterior), c.doc)
+
+			errors := cli.RouterRemove(ctx)
+			assert.Assert(t, len(errors) == 0, c.doc)
+		}
+	}
+}
+
+func TestRouterSpecEngineEndpoint(t *testing.T) {
+	ctx := context.Background()
+	cli, _ := newTestClient(t)
+
+	van, err := cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver:   "podman",
+		ContainerEngineEndpoint: "unix:///run/user/1000/podman/podman.sock",
+	}, "site")
+	assert.Check(t, err)
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE"], "podman")
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE_ENDPOINT"], "unix:///run/user/1000/podman/podman.sock")
+	assert.Equal(t, van.Controller.Mounts["/run/user/1000/podman/podman.sock"], "/run/user/1000/podman/podman.sock")
+
+	van, err = cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver:    "docker",
+		ContainerEngineEndpoint:  "tcp://engine.example.com:2376",
+		ContainerEngineTLSCACert: "/certs/ca.pem",
+		ContainerEngineTLSCert:   "/certs/cert.pem",
+		ContainerEngineTLSKey:    "/certs/key.pem",
+	}, "site")
+	assert.Check(t, err)
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE_ENDPOINT"], "tcp://engine.example.com:2376")
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE_TLS_CACERT"], "/certs/ca.pem")
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE_TLS_CERT"], "/certs/cert.pem")
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONTAINER_ENGINE_TLS_KEY"], "/certs/key.pem")
+	for _, file := range []string{"/certs/ca.pem", "/certs/cert.pem", "/certs/key.pem"} {
+		assert.Equal(t, van.Controller.Mounts[file], file)
+	}
+}
+
+func TestRouterSpecPluginDir(t *testing.T) {
+	ctx := context.Background()
+	cli, _ := newTestClient(t)
+
+	van, err := cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver:    "podman",
+		ContainerEnginePluginDir: "/opt/skupper/plugins",
+	}, "site")
+	assert.Check(t, err)
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_PLUGIN_PATH"], types.ControllerPluginPath)
+	assert.Equal(t, van.Controller.Mounts["/opt/skupper/plugins"], types.ControllerPluginPath)
+
+	van, err = cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver: "podman",
+	}, "site")
+	assert.Check(t, err)
+	_, ok := van.Controller.EnvVar["SKUPPER_PLUGIN_PATH"]
+	assert.Assert(t, !ok, "the built-in drivers need no plugin dir")
+}
+
+func TestRouterSpecDriverRPC(t *testing.T) {
+	ctx := context.Background()
+	cli, _ := newTestClient(t)
+
+	van, err := cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver:    "remote",
+		ContainerEngineDriverRPC: "unix:///run/skupper/driver.sock",
+	}, "site")
+	assert.Check(t, err)
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_DRIVER_RPC"], "unix:///run/skupper/driver.sock")
+	assert.Equal(t, van.Controller.Mounts["/run/skupper/driver.sock"], "/run/skupper/driver.sock")
+
+	van, err = cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver:    "remote",
+		ContainerEngineDriverRPC: "/usr/local/bin/skupper-driver --engine lxd",
+	}, "site")
+	assert.Check(t, err)
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_DRIVER_RPC"], "/usr/local/bin/skupper-driver --engine lxd")
+	assert.Equal(t, van.Controller.Mounts["/usr/local/bin/skupper-driver"], "/usr/local/bin/skupper-driver")
+}
+
+func TestRouterSpecHostMode(t *testing.T) {
+	ctx := context.Background()
+	cli, _ := newTestClient(t)
+	cli.CeDriverName = driver.HostDriverName
+
+	van, err := cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{
+		SkupperName:           "site-a",
+		ContainerEngineDriver: driver.HostDriverName,
+	}, "site")
+	assert.Check(t, err)
+	assert.DeepEqual(t, van.Transport.Cmd, []string{"qdrouterd", "-c", "/etc/qpid-dispatch/config/qdrouterd.json"})
+	assert.DeepEqual(t, van.Controller.Cmd, []string{types.ControllerHostCommand})
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_ROUTER_HOST"], "127.0.0.1")
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_CONFIG_PATH"], types.ControllerConfigPath)
+	assert.Equal(t, van.Controller.EnvVar["SKUPPER_TOKENS_PATH"], types.ControllerConfigPath+"tokens")
+	assert.Equal(t, van.Controller.Mounts[types.GetSkupperPath(types.TokensPath)], types.ControllerConfigPath+"tokens")
+
+	// qdrouterd reads its certs from the site's dirs
+	config, err := qdr.UnmarshalRouterConfig(van.RouterConfig)
+	assert.Check(t, err)
+	assert.Equal(t, config.Metadata.Id, "site-a-skupper-router")
+	profile := config.SslProfiles[types.InterRouterProfile]
+	assert.Equal(t, profile.CertFile, types.GetSkupperPath(types.CertsPath)+"/"+types.InterRouterProfile+"/tls.crt")
+	assert.Equal(t, profile.CaCertFile, types.GetSkupperPath(types.CertsPath)+"/"+types.InterRouterProfile+"/ca.crt")
+
+	opts := getTransportContainerCreateOptions(van)
+	assert.DeepEqual(t, opts.ContainerConfig.Cmd, van.Transport.Cmd)
+
+	cli.CeDriverName = driver.DockerDriverName
+	van, err = cli.GetRouterSpecFromOpts(ctx, types.SiteConfigSpec{SkupperName: "site-a"}, "site")
+	assert.Check(t, err)
+	assert.Assert(t, van.Transport.Cmd == nil)
+	assert.DeepEqual(t, van.Controller.Cmd, []string{types.ControllerCommand})
+	config, err = qdr.UnmarshalRouterConfig(van.RouterConfig)
+	assert.Check(t, err)
+	assert.Equal(t, config.SslProfiles[types.InterRouterProfile].CertFile, "/etc/qpid-dispatch-certs/"+types.InterRouterProfile+"/tls.crt")
+}
+
+func TestHostModeTargets(t *testing.T) {
+	ctx := context.Background()
+	cli, _ := newTestClient(t)
+	cli.CeDriverName = driver.HostDriverName
+
+	_, err := getServiceInterfaceTarget(ctx, "container", "nginx", false, cli)
+	assert.Error(t, err, "Only host-service targets are supported in host mode")
+	target, err := getServiceInterfaceTarget(ctx, "host-service", "web", false, cli)
+	assert.Check(t, err)
+	assert.Equal(t, target.Name, "web:127.0.0.1")
+	assert.Equal(t, target.Selector, "internal.skupper.io/host-service")
+}
+
+func TestRouterCreateHostModeConsole(t *testing.T) {
+	ctx := context.Background()
+	cli, _ := newTestClient(t)
+	cli.CeDriverName = driver.HostDriverName
+
+	err := cli.RouterCreate(ctx, types.SiteConfigSpec{
+		ContainerEngineDriver: driver.HostDriverName,
+		EnableConsole:         true,
+	})
+	assert.Error(t, err, "--console-auth=internal is not supported in host mode")
+}
+
+func TestInitPluginNotFound(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "plugins")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	cli, err := NewClient()
+	assert.Check(t, err)
+	err = cli.Init(context.Background(), "docker", driver.EngineConfig{
+		Endpoint:  "unix:///var/run/docker.sock",
+		PluginDir: tmpDir,
+	})
+	assert.Assert(t, errors.Is(err, driver.ErrPluginNotFound))
+	assert.Assert(t, cli.CeDriver == nil)
+}
+
+func TestRouterInspectErrors(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	err = cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	})
+	assert.Check(t, err)
+
+	dd.FailOn("ContainerInspect", driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("Cannot connect to the Docker daemon")))
+	_, err = cli.RouterInspect(ctx)
+	assert.Assert(t, errors.Is(err, driver.ErrEngineUnavailable))
+	assert.Error(t, err, "Container engine unavailable: Cannot connect to the Docker daemon")
+	_, err = cli.ServiceInterfaceList(ctx)
+	assert.Assert(t, errors.Is(err, driver.ErrEngineUnavailable))
+
+	dd.FailOn("ContainerInspect", nil)
+	assert.Check(t, dd.ContainerStop(ctx, types.TransportDeploymentName))
+	assert.Check(t, dd.ContainerRemove(ctx, types.TransportDeploymentName))
+	_, err = cli.RouterInspect(ctx)
+	assert.Assert(t, errors.Is(err, driver.ErrNotFound))
+	assert.Error(t, err, "No transport container found (need init?): No such container: "+types.TransportDeploymentName)
+
+	removeErrors := cli.RouterRemove(ctx)
+	assert.Assert(t, len(removeErrors) == 0, "a missing container is not an error on remove")
+}
+
+func TestRouterCreateCanceled(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	})
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	_, ok := dd.Container(types.TransportDeploymentName)
+	assert.Assert(t, !ok, "no container should be created once the context is canceled")
+}
+
+func TestRouterCreateWaitsForHealthyRouter(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	dd.FailOn("ContainerWait", driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out waiting for container skupper-router to be healthy")))
+	err = cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	})
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
+	assert.ErrorContains(t, err, "Transport container did not become healthy")
+	_, ok := dd.Container(types.ControllerDeploymentName)
+	assert.Assert(t, !ok, "the controller should not be created before the router is healthy")
+
+	cli, dd = newTestClient(t)
+	err = cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	})
+	assert.Check(t, err)
+	assert.Check(t, dd.SetContainerHealth(types.TransportDeploymentName, driver.HealthStarting))
+	vir, err := cli.RouterInspect(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, vir.Status.State, "running")
+	assert.Equal(t, vir.Status.Health, driver.HealthStarting)
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+
+	// an engine that does not run the health check is only waited for for
+	// the grace period
+	defer func(grace time.Duration) { driver.HealthCheckGrace = grace }(driver.HealthCheckGrace)
+	driver.HealthCheckGrace = 100 * time.Millisecond
+	dd.NoHealthChecks = true
+	err = cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	})
+	assert.Check(t, err)
+	vir, err = cli.RouterInspect(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, vir.Status.Health, driver.HealthStarting)
+}
+
+func TestRouterCreateNetwork(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	_, err = dd.NetworkCreate(ctx, "other-network", driver.NetworkCreateOptions{
+		IPAM: driver.NetworkIPAM{Config: []driver.NetworkIPAMConfig{{Subnet: "10.99.0.0/16"}}},
+	})
+	assert.Check(t, err)
+	options := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+		NetworkName:      "site-network",
+		NetworkSubnet:    "10.99.1.0/24",
+	}
+	err = cli.RouterCreate(ctx, options)
+	assert.Error(t, err, "Network subnet 10.99.1.0/24 overlaps subnet 10.99.0.0/16 of network other-network")
+
+	options.NetworkSubnet = "10.100.0.0/24"
+	assert.Check(t, cli.RouterCreate(ctx, options))
+	n, ok := dd.Network("site-network")
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, n.Options.IPAM.Config, []driver.NetworkIPAMConfig{{Subnet: "10.100.0.0/24"}})
+	assert.Assert(t, n.Options.Labels["skupper.io/site-id"] != "")
+	_, ok = n.Options.Options["com.docker.network.bridge.name"]
+	assert.Assert(t, !ok, "only the default network uses the skupper0 bridge")
+	_, ok = dd.Network(types.TransportNetworkName)
+	assert.Assert(t, !ok)
+
+	router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, router.NetworkSettings.Networks["site-network"].IPAddress, "10.100.0.2")
+	controller, err := dd.ContainerInspect(ctx, types.ControllerDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, controller.Config.Env["SKUPPER_NETWORK"], "site-network")
+
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.Spec.NetworkName, "site-network")
+	assert.Equal(t, sc.Spec.NetworkSubnet, "10.100.0.0/24")
+
+	removeErrors := cli.RouterRemove(ctx)
+	assert.Assert(t, len(removeErrors) == 0)
+	_, ok = dd.Network("site-network")
+	assert.Assert(t, !ok, "the site's network should be removed")
+}
+
+func TestRouterCreateUnlabelledNetwork(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	// podman networks carry no labels, the site's network is created
+	// without them and known by its name
+	cli, dd := newTestClient(t)
+	cli.CeDriverName = driver.PodmanDriverName
+	options := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	dd.FailOnce("NetworkCreate", driver.WrapError(driver.ErrNotSupported, fmt.Errorf("Podman networks carry no labels")))
+	assert.Check(t, cli.RouterCreate(ctx, options))
+	n, ok := dd.Network(types.TransportNetworkName)
+	assert.Assert(t, ok)
+	assert.Equal(t, len(n.Options.Labels), 0)
+
+	assert.Check(t, os.Remove(types.GetSkupperPath(types.SitesPath)+"/"+types.DefaultBridgeName+".json"))
+	err = cli.RouterCreate(ctx, options)
+	assert.Error(t, err, "Skupper is already installed (found site files, container skupper-router, container skupper-service-controller, network skupper-network), use --force to replace it or --reconcile to update it")
+}
+
+func TestRouterCreateExistingSite(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	options := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	assert.Check(t, cli.RouterCreate(ctx, options))
+	original, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	ca, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/skupper-internal-ca/tls.crt")
+	assert.Check(t, err)
+
+	err = cli.RouterCreate(ctx, options)
+	assert.Assert(t, errors.Is(err, driver.ErrAlreadyExists))
+	assert.Error(t, err, "Skupper is already installed (found site config, container skupper-router, container skupper-service-controller, network skupper-network), use --force to replace it or --reconcile to update it")
+
+	options.Force = true
+	options.Reconcile = true
+	assert.Error(t, cli.RouterCreate(ctx, options), "--force and --reconcile cannot be used together")
+
+	// a connection, a service and its proxy on the site's network
+	connPath := types.GetSkupperPath(types.ConnectionsPath) + "/conn1"
+	assert.Check(t, os.Mkdir(connPath, 0755))
+	for file, value := range map[string]string{"inter-router-host": "remote", "inter-router-port": "55671", "edge-host": "remote", "edge-port": "45671"} {
+		assert.Check(t, ioutil.WriteFile(connPath+"/"+file, []byte(value), 0644))
+	}
+	configFile := types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json"
+	config, err := qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	config.AddConnSslProfile(qdr.SslProfile{Name: "conn1-profile"})
+	config.AddConnector(qdr.Connector{Name: "conn1", Cost: 5, SslProfile: "conn1-profile", Host: "remote", Port: "55671", Role: qdr.RoleInterRouter})
+	assert.Check(t, config.WriteToConfigFile(configFile))
+	servicesFile := types.GetSkupperPath(types.ServicesPath) + "/skupper-services"
+	services := `{"web":{"address":"web","protocol":"http","port":8080}}`
+	assert.Check(t, ioutil.WriteFile(servicesFile, []byte(services), 0755))
+	_, err = dd.ContainerCreate(ctx, driver.ContainerCreateOptions{
+		Name:            "web",
+		ContainerConfig: &driver.ContainerBaseConfig{Image: types.DefaultTransportImage},
+		NetworkingConfig: &driver.ContainerNetworkingConfig{
+			EndpointsConfig: map[string]*driver.NetworkEndpointSetting{types.TransportNetworkName: {}},
+		},
+	})
+	assert.Check(t, err)
+
+	options.Force = false
+	options.IsEdge = true
+	options.NetworkSubnet = "10.101.0.0/24"
+	assert.Check(t, cli.RouterCreate(ctx, options))
+
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.UID, original.UID)
+	assert.Assert(t, sc.Spec.IsEdge)
+	reconciledCA, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/skupper-internal-ca/tls.crt")
+	assert.Check(t, err)
+	assert.Equal(t, string(reconciledCA), string(ca), "the CAs are kept")
+	reconciledServices, err := ioutil.ReadFile(servicesFile)
+	assert.Check(t, err)
+	assert.Equal(t, string(reconciledServices), services)
+	backups, err := filepath.Glob(filepath.Join(tmpDir, "skupper-backup-*"))
+	assert.Check(t, err)
+	assert.Equal(t, len(backups), 0, "the backup of the site's files is removed")
+
+	config, err = qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	assert.Assert(t, config.IsEdge())
+	assert.DeepEqual(t, config.Connectors["conn1"], qdr.Connector{Name: "conn1", Cost: 5, SslProfile: "conn1-profile", Host: "remote", Port: "45671", Role: qdr.RoleEdge})
+	_, ok := config.SslProfiles["conn1-profile"]
+	assert.Assert(t, ok)
+
+	n, ok := dd.Network(types.TransportNetworkName)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, n.Options.IPAM.Config, []driver.NetworkIPAMConfig{{Subnet: "10.101.0.0/24"}})
+	assert.Equal(t, n.Options.Labels[types.SiteIdLabel], original.UID)
+	web, ok := dd.Container("web")
+	assert.Assert(t, ok)
+	_, ok = web.Networks[types.TransportNetworkName]
+	assert.Assert(t, ok, "the containers on the site's network move to the new one")
+	router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Assert(t, router.State.Running)
+	assert.Equal(t, router.Config.Env["SKUPPER_SITE_ID"], original.UID)
+	_, ok = router.Config.Env["APPLICATION_NAME"]
+	assert.Assert(t, !ok, "the router is created again as an edge router")
+
+	// the router runs until its replacement does, one that cannot be
+	// created leaves the site as it was
+	internalCert := types.GetSkupperPath(types.CertsPath) + "/skupper-internal/tls.crt"
+	assert.DeepEqual(t, certHosts(t, internalCert), []string{"skupper-router"})
+	options.IsEdge = false
+	options.IngressHosts = []string{"site.example.com"}
+	dd.FailOnce("ContainerCreate", fmt.Errorf("no space left on device"))
+	err = cli.RouterCreate(ctx, options)
+	assert.ErrorContains(t, err, "Failed to replace transport container")
+	current, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, router.ID)
+	assert.Assert(t, current.State.Running)
+	assert.DeepEqual(t, certHosts(t, internalCert), []string{"skupper-router"})
+
+	// one that does not start brings the router back on the site's files,
+	// restored in place before it starts again
+	hostDir, err := os.Stat(types.GetSkupperPath(types.HostPath))
+	assert.Check(t, err)
+	previousConfig, err := ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	startedOn := ""
+	dd.StartError = func(c *fake.Container) error {
+		// the replacement, created as skupper-router-recreate
+		if c.Name == types.TransportDeploymentName && c.ID != router.ID {
+			return fmt.Errorf("cannot start")
 		}
+		if c.ID == router.ID {
+			data, _ := ioutil.ReadFile(configFile)
+			startedOn = string(data)
+		}
+		return nil
+	}
+	err = cli.RouterCreate(ctx, options)
+	dd.StartError = nil
+	assert.ErrorContains(t, err, "Failed to replace transport container")
+	assert.Equal(t, startedOn, string(previousConfig))
+	restoredConfig, err := ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	assert.Equal(t, string(restoredConfig), string(previousConfig))
+	restoredDir, err := os.Stat(types.GetSkupperPath(types.HostPath))
+	assert.Check(t, err)
+	assert.Assert(t, os.SameFile(hostDir, restoredDir), "the mounted dir is kept")
+	current, err = dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, router.ID)
+	assert.Assert(t, current.State.Running)
+	assert.DeepEqual(t, certHosts(t, internalCert), []string{"skupper-router"})
+
+	// the credentials are issued again for the new ingress hosts
+	assert.Check(t, cli.RouterCreate(ctx, options))
+	assert.DeepEqual(t, certHosts(t, internalCert), []string{"skupper-router", "site.example.com"})
+	reconciledCA, err = ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/skupper-internal-ca/tls.crt")
+	assert.Check(t, err)
+	assert.Equal(t, string(reconciledCA), string(ca))
+
+	options.Reconcile = false
+	options.IngressHosts = nil
+	options.Force = true
+	assert.Check(t, dd.NetworkDisconnect(ctx, types.TransportNetworkName, "web", true))
+	assert.Check(t, cli.RouterCreate(ctx, options))
+	sc, err = cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Assert(t, sc.UID != original.UID, "a forced init creates a new site")
+	_, err = os.Stat(connPath)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestRouterCreateRollback(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+	options := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	notHealthy := driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out waiting for container skupper-router to be healthy"))
+
+	// nothing is left of a failed init
+	cli, dd := newTestClient(t)
+	dd.FailOn("ContainerWait", notHealthy)
+	err = cli.RouterCreate(ctx, options)
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
+	containers, err := dd.ContainerList(ctx, driver.ContainerListOptions{All: true})
+	assert.Check(t, err)
+	assert.Equal(t, len(containers), 0)
+	_, ok := dd.Network(types.TransportNetworkName)
+	assert.Assert(t, !ok)
+	_, err = os.Stat(types.GetSkupperPath(types.HostPath))
+	assert.Assert(t, os.IsNotExist(err))
+
+	// along with what could not be rolled back
+	cli, dd = newTestClient(t)
+	dd.FailOnce("ContainerCreate", fmt.Errorf("invalid spec"))
+	dd.FailOn("NetworkRemove", fmt.Errorf("network has active endpoints"))
+	err = cli.RouterCreate(ctx, options)
+	assert.Error(t, err, "invalid spec, rolling back failed: remove network skupper-network: network has active endpoints")
+	_, err = os.Stat(types.GetSkupperPath(types.HostPath))
+	assert.Assert(t, os.IsNotExist(err))
+
+	// a failed reconcile restores the site
+	cli, dd = newTestClient(t)
+	assert.Check(t, cli.RouterCreate(ctx, options))
+	original, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	configFile := types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json"
+	config, err := ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	network, err := dd.NetworkInspect(ctx, types.TransportNetworkName)
+	assert.Check(t, err)
 
-		errors := cli.RouterRemove()
-		assert.Assert(t, len(errors) == 0, c.doc)
+	dd.FailOn("ContainerWait", notHealthy)
+	reconciled := options
+	reconciled.Reconcile = true
+	reconciled.IsEdge = true
+	reconciled.NetworkSubnet = "10.102.0.0/24"
+	err = cli.RouterCreate(ctx, reconciled)
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
 
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.DeepEqual(t, sc, original)
+	restoredConfig, err := ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	assert.Equal(t, string(restoredConfig), string(config))
+	restoredNetwork, err := dd.NetworkInspect(ctx, types.TransportNetworkName)
+	assert.Check(t, err)
+	assert.DeepEqual(t, restoredNetwork.IPAM, network.IPAM)
+	assert.DeepEqual(t, restoredNetwork.Labels, network.Labels)
+	for _, name := range []string{types.TransportDeploymentName, types.ControllerDeploymentName} {
+		current, err := dd.ContainerInspect(ctx, name)
+		assert.Check(t, err)
+		assert.Assert(t, current.State.Running, name)
+		_, ok := current.NetworkSettings.Networks[types.TransportNetworkName]
+		assert.Assert(t, ok, name)
 	}
+	router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, router.Config.Env["APPLICATION_NAME"], types.TransportDeploymentName, "the interior router is restored")
+	backups, err := filepath.Glob(filepath.Join(tmpDir, "skupper-backup-*"))
+	assert.Check(t, err)
+	assert.Equal(t, len(backups), 0)
 }
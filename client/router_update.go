@@ -0,0 +1,276 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+)
+
+// RouterUpdate changes the settings of the site to the spec. The router
+// config, the console users and the container specs are generated for the
+// spec and compared with the site's, the router is only recreated when one
+// of them changed and the controller when its spec changed or the router
+// was recreated, it does not reconnect. The site keeps its identity,
+// connections and services, and the files and containers are restored when
+// a container does not come up. It tells whether anything changed.
+func (cli *VanClient) RouterUpdate(ctx context.Context, options types.SiteConfigSpec) (bool, error) {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return false, fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
+	if err != nil {
+		return false, fmt.Errorf("Failed to intialize client: %w", err)
+	}
+
+	err = checkUpdatable(sc.Spec, &options)
+	if err != nil {
+		return false, err
+	}
+	err = cli.setConsoleOptions(&options)
+	if err != nil {
+		return false, err
+	}
+	pullPolicy, err := driver.ParsePullPolicy(options.ImagePullPolicy)
+	if err != nil {
+		return false, err
+	}
+	options.ImagePullPolicy = string(pullPolicy)
+	options.Force = false
+	options.Reconcile = false
+
+	previous, err := cli.GetRouterSpecFromOpts(ctx, sc.Spec, sc.UID)
+	if err != nil {
+		return false, err
+	}
+	van, err := cli.GetRouterSpecFromOpts(ctx, options, sc.UID)
+	if err != nil {
+		return false, err
+	}
+	routerConfig, err := reconcileRouterConfig(van.RouterConfig, options.IsEdge)
+	if err != nil {
+		return false, err
+	}
+	configChanged, err := routerConfigChanged(routerConfig)
+	if err != nil {
+		return false, err
+	}
+
+	stale := staleCredentials(previous, van)
+
+	transport, err := cli.CeDriver.ContainerInspect(ctx, types.TransportDeploymentName)
+	if err != nil {
+		return false, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+	}
+	controller, err := cli.CeDriver.ContainerInspect(ctx, types.ControllerDeploymentName)
+	if err != nil {
+		return false, fmt.Errorf("Failed to retrieve controller container (need init?): %w", err)
+	}
+
+	// a nil spec leaves the container as it is
+	var transportOpts, controllerOpts *driver.ContainerCreateOptions
+	if opts := getTransportContainerCreateOptions(van); !reflect.DeepEqual(getTransportContainerCreateOptions(previous), opts) {
+		transportOpts = opts
+	} else if configChanged || consoleUser(sc.Spec) != consoleUser(options) || !hasSiteCerts(van) || len(stale) > 0 {
+		// qdrouterd reads its config, users and certs at start
+		spec := driver.ContainerSpec(transport)
+		transportOpts = &spec
+	}
+	if opts := getControllerContainerCreateOptions(van); !reflect.DeepEqual(getControllerContainerCreateOptions(previous), opts) {
+		controllerOpts = opts
+	} else if transportOpts != nil {
+		spec := driver.ContainerSpec(controller)
+		controllerOpts = &spec
+	}
+	if transportOpts == nil && controllerOpts == nil && reflect.DeepEqual(sc.Spec, options) {
+		return false, nil
+	}
+
+	tx := &siteTransaction{}
+	err = cli.updateSite(ctx, tx, sc, options, van, routerConfig, stale, transport, transportOpts, controller, controllerOpts)
+	if err != nil {
+		return false, tx.rollback(err)
+	}
+	tx.commit()
+	return true, nil
+}
+
+// updateSite writes the site's files for the spec and replaces the router
+// and then the controller, as steps the transaction can roll back. The
+// containers are restored after the files so they start from the site's
+// previous config, a replacement that fails restores the files before its
+// original starts again.
+func (cli *VanClient) updateSite(ctx context.Context, tx *siteTransaction, sc *types.SiteConfig, options types.SiteConfigSpec, van *types.RouterSpec, routerConfig string, stale []string,
+	transport *driver.ContainerInspect, transportOpts *driver.ContainerCreateOptions, controller *driver.ContainerInspect, controllerOpts *driver.ContainerCreateOptions) error {
+	routerReplaced := false
+	controllerReplaced := false
+	// the controller must reconnect to a restored router
+	tx.onRollback("restore container "+types.ControllerDeploymentName, func(ctx context.Context) error {
+		if !routerReplaced && !controllerReplaced {
+			return nil
+		}
+		return cli.restoreSiteContainer(ctx, controller)
+	})
+	tx.onRollback("restore container "+types.TransportDeploymentName, func(ctx context.Context) error {
+		if !routerReplaced {
+			return nil
+		}
+		return cli.restoreSiteContainer(ctx, transport)
+	})
+	restoreFiles, err := backupSiteFiles(tx)
+	if err != nil {
+		return err
+	}
+
+	previous := sc.Spec
+	sc.Spec = options
+	err = writeSiteConfig(sc)
+	if err != nil {
+		return err
+	}
+	for _, name := range stale {
+		if err := os.RemoveAll(types.GetSkupperPath(types.CertsPath) + "/" + name); err != nil {
+			return err
+		}
+	}
+	err = writeSiteFiles(options, van, routerConfig)
+	if err != nil {
+		return err
+	}
+	if consoleUser(previous) != "" && consoleUser(previous) != consoleUser(options) {
+		err = os.Remove(types.GetSkupperPath(types.ConsoleUsersPath) + "/" + previous.User)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	generateSiteCerts(van)
+
+	if transportOpts != nil {
+		err = driver.ReplaceContainerWith(ctx, cli.CeDriver, transport, *transportOpts, restoreFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to update router: %w", err)
+		}
+		routerReplaced = true
+	}
+	if controllerOpts != nil {
+		err = driver.ReplaceContainerWith(ctx, cli.CeDriver, controller, *controllerOpts, restoreFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to update controller: %w", err)
+		}
+		controllerReplaced = true
+	}
+	return nil
+}
+
+// restoreSiteContainer replaces the site container of the same name with
+// one created from the inspected spec
+func (cli *VanClient) restoreSiteContainer(ctx context.Context, previous *driver.ContainerInspect) error {
+	current, err := cli.CeDriver.ContainerInspect(ctx, strings.TrimPrefix(previous.Name, "/"))
+	if err != nil {
+		return err
+	}
+	return driver.ReplaceContainer(ctx, cli.CeDriver, current, driver.ContainerSpec(previous))
+}
+
+// checkUpdatable refuses changes to the engine, the network, the registry
+// and the images of the site, the settings left empty are kept
+func checkUpdatable(current types.SiteConfigSpec, desired *types.SiteConfigSpec) error {
+	fixed := []struct {
+		flag    string
+		current string
+		desired *string
+		command string
+	}{
+		{"--ce-driver", current.ContainerEngineDriver, &desired.ContainerEngineDriver, "init --reconcile"},
+		{"--ce-endpoint", current.ContainerEngineEndpoint, &desired.ContainerEngineEndpoint, "init --reconcile"},
+		{"--ce-tls-cacert", current.ContainerEngineTLSCACert, &desired.ContainerEngineTLSCACert, "init --reconcile"},
+		{"--ce-tls-cert", current.ContainerEngineTLSCert, &desired.ContainerEngineTLSCert, "init --reconcile"},
+		{"--ce-tls-key", current.ContainerEngineTLSKey, &desired.ContainerEngineTLSKey, "init --reconcile"},
+		{"--ce-plugin-dir", current.ContainerEnginePluginDir, &desired.ContainerEnginePluginDir, "init --reconcile"},
+		{"--ce-driver-rpc", current.ContainerEngineDriverRPC, &desired.ContainerEngineDriverRPC, "init --reconcile"},
+		{"--network-name", siteNetwork(current), &desired.NetworkName, "init --reconcile"},
+		{"--network-subnet", current.NetworkSubnet, &desired.NetworkSubnet, "init --reconcile"},
+		{"--registry-auth-file", current.RegistryAuthFile, &desired.RegistryAuthFile, "init --reconcile"},
+		{"--registry-user", current.RegistryUser, &desired.RegistryUser, "init --reconcile"},
+		{"--router-image", current.TransportImage, &desired.TransportImage, "upgrade"},
+		{"--controller-image", current.ControllerImage, &desired.ControllerImage, "upgrade"},
+	}
+	for _, f := range fixed {
+		if *f.desired == "" {
+			*f.desired = f.current
+		} else if *f.desired != f.current {
+			return fmt.Errorf("%s cannot be changed by update, use 'skupper-exp %s'", f.flag, f.command)
+		}
+	}
+	if desired.RegistryPassword != "" {
+		return fmt.Errorf("--registry-password cannot be changed by update, use 'skupper-exp init --reconcile'")
+	}
+	return nil
+}
+
+// consoleUser returns the console user and password the router creates its
+// sasl database from, empty without internal auth
+func consoleUser(options types.SiteConfigSpec) string {
+	if !options.EnableConsole || options.AuthMode != string(types.ConsoleAuthModeInternal) {
+		return ""
+	}
+	return options.User + ":" + options.Password
+}
+
+// hasSiteCerts tells whether the site has the CAs and credentials of the
+// spec, an edge site turned interior needs the inter-router ones
+func hasSiteCerts(van *types.RouterSpec) bool {
+	for _, ca := range van.CertAuthoritys {
+		if !certExists(ca.Name) {
+			return false
+		}
+	}
+	for _, cred := range van.Credentials {
+		if !certExists(cred.Name) || certHostsChanged(cred.Name, cred.Hosts) {
+			return false
+		}
+	}
+	return true
+}
+
+// staleCredentials returns the credentials of the site the spec issues for
+// other hosts, they are generated again
+func staleCredentials(previous *types.RouterSpec, van *types.RouterSpec) []string {
+	stale := []string{}
+	for _, cred := range van.Credentials {
+		for _, issued := range previous.Credentials {
+			if issued.Name == cred.Name && !reflect.DeepEqual(issued, cred) {
+				stale = append(stale, cred.Name)
+			}
+		}
+	}
+	return stale
+}
+
+// routerConfigChanged tells whether the router config differs from the
+// site's, the order of the entities does not matter
+func routerConfigChanged(routerConfig string) (bool, error) {
+	data, err := ioutil.ReadFile(types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json")
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Failed to retrieve router config: %w", err)
+	}
+	current, err := qdr.UnmarshalRouterConfig(string(data))
+	if err != nil {
+		return false, err
+	}
+	desired, err := qdr.UnmarshalRouterConfig(routerConfig)
+	if err != nil {
+		return false, err
+	}
+	return !reflect.DeepEqual(current, desired), nil
+}
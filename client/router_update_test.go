@@ -0,0 +1,183 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/driver/fake"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+	"github.com/docker/go-connections/nat"
+	"gotest.tools/assert"
+	"gotest.tools/assert/cmp"
+)
+
+func TestRouterUpdate(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	assert.Check(t, cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}))
+	original, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	configFile := types.GetSkupperPath(types.ConfigPath) + "/qdrouterd.json"
+	config, err := qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	config.AddConnSslProfile(qdr.SslProfile{Name: "conn1-profile"})
+	config.AddConnector(qdr.Connector{Name: "conn1", Cost: 5, SslProfile: "conn1-profile", Host: "remote", Port: "55671", Role: qdr.RoleInterRouter})
+	assert.Check(t, config.WriteToConfigFile(configFile))
+	connPath := types.GetSkupperPath(types.ConnectionsPath) + "/conn1"
+	assert.Check(t, os.Mkdir(connPath, 0755))
+	for file, value := range map[string]string{"inter-router-host": "remote", "inter-router-port": "55671", "edge-host": "remote", "edge-port": "45671"} {
+		assert.Check(t, ioutil.WriteFile(connPath+"/"+file, []byte(value), 0644))
+	}
+	containerIds := func() (string, string) {
+		router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+		assert.Check(t, err)
+		assert.Assert(t, router.State.Running)
+		controller, err := dd.ContainerInspect(ctx, types.ControllerDeploymentName)
+		assert.Check(t, err)
+		assert.Assert(t, controller.State.Running)
+		return router.ID, controller.ID
+	}
+	routerId, controllerId := containerIds()
+
+	// nothing is restarted for the site's own settings
+	updated, err := cli.RouterUpdate(ctx, original.Spec)
+	assert.Check(t, err)
+	assert.Assert(t, !updated)
+	currentRouterId, currentControllerId := containerIds()
+	assert.Equal(t, currentRouterId, routerId)
+	assert.Equal(t, currentControllerId, controllerId)
+
+	// the controller alone has the pull policy
+	options := original.Spec
+	options.ImagePullPolicy = "Always"
+	updated, err = cli.RouterUpdate(ctx, options)
+	assert.Check(t, err)
+	assert.Assert(t, updated)
+	currentRouterId, currentControllerId = containerIds()
+	assert.Equal(t, currentRouterId, routerId)
+	assert.Assert(t, currentControllerId != controllerId)
+	controller, err := dd.ContainerInspect(ctx, types.ControllerDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, controller.Config.Env["SKUPPER_IMAGE_PULL_POLICY"], "Always")
+	controllerId = currentControllerId
+
+	// the router reads the console listener from its config and the
+	// controller reconnects to the new router
+	options.EnableRouterConsole = true
+	updated, err = cli.RouterUpdate(ctx, options)
+	assert.Check(t, err)
+	assert.Assert(t, updated)
+	currentRouterId, currentControllerId = containerIds()
+	assert.Assert(t, currentRouterId != routerId)
+	assert.Assert(t, currentControllerId != controllerId)
+	routerId, controllerId = currentRouterId, currentControllerId
+	config, err = qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	_, ok := config.Listeners[types.ConsolePortName]
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, config.Connectors["conn1"], qdr.Connector{Name: "conn1", Cost: 5, SslProfile: "conn1-profile", Host: "remote", Port: "55671", Role: qdr.RoleInterRouter})
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Assert(t, sc.Spec.EnableRouterConsole)
+	assert.Equal(t, sc.UID, original.UID)
+
+	// the engine, network and images are not changed by an update
+	refused := options
+	refused.NetworkSubnet = "10.103.0.0/24"
+	_, err = cli.RouterUpdate(ctx, refused)
+	assert.Error(t, err, "--network-subnet cannot be changed by update, use 'skupper-exp init --reconcile'")
+	refused = options
+	refused.TransportImage = "quay.io/skupper/qdrouterd:0.5"
+	_, err = cli.RouterUpdate(ctx, refused)
+	assert.Error(t, err, "--router-image cannot be changed by update, use 'skupper-exp upgrade'")
+
+	// a router that does not come up is restored along with the files
+	previousConfig, err := ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	dd.FailOnce("ContainerWait", driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out")))
+	failed := options
+	failed.EnableRouterConsole = false
+	_, err = cli.RouterUpdate(ctx, failed)
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
+	assert.ErrorContains(t, err, "Failed to update router")
+	currentRouterId, currentControllerId = containerIds()
+	assert.Equal(t, currentRouterId, routerId)
+	assert.Equal(t, currentControllerId, controllerId)
+	restoredConfig, err := ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	assert.Equal(t, string(restoredConfig), string(previousConfig))
+	restored, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.DeepEqual(t, restored, sc)
+
+	// a router that does not start is started again on the restored files
+	startedOn := ""
+	dd.StartError = func(c *fake.Container) error {
+		// the replacement, created as skupper-router-recreate
+		if c.Name == types.TransportDeploymentName && c.ID != routerId {
+			return fmt.Errorf("cannot start")
+		}
+		if c.ID == routerId {
+			data, _ := ioutil.ReadFile(configFile)
+			startedOn = string(data)
+		}
+		return nil
+	}
+	_, err = cli.RouterUpdate(ctx, failed)
+	dd.StartError = nil
+	assert.ErrorContains(t, err, "Failed to update router")
+	assert.Equal(t, startedOn, string(previousConfig))
+	currentRouterId, currentControllerId = containerIds()
+	assert.Equal(t, currentRouterId, routerId)
+	assert.Equal(t, currentControllerId, controllerId)
+	restoredConfig, err = ioutil.ReadFile(configFile)
+	assert.Check(t, err)
+	assert.Equal(t, string(restoredConfig), string(previousConfig))
+
+	// the router is published and its certificate issued for the ingress
+	internalCert := types.GetSkupperPath(types.CertsPath) + "/skupper-internal/tls.crt"
+	ca, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/skupper-internal-ca/tls.crt")
+	assert.Check(t, err)
+	options.IngressHosts = []string{"site1.example.com"}
+	updated, err = cli.RouterUpdate(ctx, options)
+	assert.Check(t, err)
+	assert.Assert(t, updated)
+	router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.DeepEqual(t, router.HostConfig.PortBindings["55671/tcp"], []nat.PortBinding{{HostPort: "55671"}})
+	assert.Assert(t, cmp.Contains(certHosts(t, internalCert), "site1.example.com"))
+	updatedCA, err := ioutil.ReadFile(types.GetSkupperPath(types.CertsPath) + "/skupper-internal-ca/tls.crt")
+	assert.Check(t, err)
+	assert.Equal(t, string(updatedCA), string(ca), "the CA is kept")
+	options.IngressHosts = nil
+
+	// an edge site keeps its connections through their edge endpoints
+	options.IsEdge = true
+	updated, err = cli.RouterUpdate(ctx, options)
+	assert.Check(t, err)
+	assert.Assert(t, updated)
+	config, err = qdr.GetRouterConfigFromFile(configFile)
+	assert.Check(t, err)
+	assert.Assert(t, config.IsEdge())
+	assert.DeepEqual(t, config.Connectors["conn1"], qdr.Connector{Name: "conn1", Cost: 5, SslProfile: "conn1-profile", Host: "remote", Port: "45671", Role: qdr.RoleEdge})
+	router, err = dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	_, ok = router.Config.Env["APPLICATION_NAME"]
+	assert.Assert(t, !ok)
+	assert.Equal(t, router.Config.Env["SKUPPER_SITE_ID"], original.UID)
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+// RouterUpgrade moves the site to new router and controller images. The
+// router, the controller and then the proxies are recreated one at a time
+// from their current spec and each must be up before the next one is
+// replaced, a container that fails is restored and ends the upgrade. The
+// certs, connections and services are mounted and stay as they are.
+func (cli *VanClient) RouterUpgrade(ctx context.Context, options types.RouterUpgradeOptions) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
+	if err != nil {
+		return fmt.Errorf("Failed to intialize client: %w", err)
+	}
+
+	// the images usually keep their tag, they are pulled unless told not to
+	pullPolicy := driver.PullAlways
+	if options.ImagePullPolicy != "" {
+		pullPolicy, err = driver.ParsePullPolicy(options.ImagePullPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
+	spec := sc.Spec
+	spec.TransportImage = options.TransportImage
+	spec.ControllerImage = options.ControllerImage
+	images := map[string]string{
+		types.TransportComponentName:  transportImage(spec),
+		types.ControllerComponentName: controllerImage(spec),
+	}
+	for _, image := range images {
+		auth, err := driver.GetRegistryAuth(image, siteRegistryAuthFiles())
+		if err != nil {
+			return err
+		}
+		err = driver.PullImage(ctx, cli.CeDriver, image, pullPolicy, auth)
+		if err != nil {
+			return err
+		}
+	}
+	if sc.Images == nil {
+		sc.Images = map[string]types.SiteImage{}
+	}
+
+	transport := cli.siteImage(ctx, images[types.TransportComponentName])
+	err = cli.upgradeContainer(ctx, types.TransportDeploymentName, transport, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to upgrade router: %w", err)
+	}
+	sc.Spec.TransportImage = transport.Name
+	sc.Images[types.TransportComponentName] = transport
+	err = writeSiteConfig(sc)
+	if err != nil {
+		return err
+	}
+
+	// the controller creates the proxies from the router image
+	controller := cli.siteImage(ctx, images[types.ControllerComponentName])
+	err = cli.upgradeContainer(ctx, types.ControllerDeploymentName, controller, map[string]string{"QDROUTERD_IMAGE": transport.Name})
+	if err != nil {
+		return fmt.Errorf("Failed to upgrade controller: %w", err)
+	}
+	sc.Spec.ControllerImage = controller.Name
+	sc.Images[types.ControllerComponentName] = controller
+	err = writeSiteConfig(sc)
+	if err != nil {
+		return err
+	}
+
+	proxies, err := cli.CeDriver.ContainerList(ctx, driver.ContainerListOptions{
+		Filters: map[string][]string{"label": {types.ComponentLabel + "=" + types.ProxyComponentName}},
+		All:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to list proxy containers: %w", err)
+	}
+	for _, proxy := range proxies {
+		err = cli.upgradeContainer(ctx, proxy.ID, transport, nil)
+		if err != nil {
+			return fmt.Errorf("Failed to upgrade proxy %s: %w", proxyName(proxy), err)
+		}
+	}
+	return nil
+}
+
+// upgradeContainer recreates a container from its spec with the image and
+// the environment variables, it is left alone when it runs the image
+func (cli *VanClient) upgradeContainer(ctx context.Context, name string, image types.SiteImage, env map[string]string) error {
+	current, err := cli.CeDriver.ContainerInspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	opts := driver.ContainerSpec(current)
+	upToDate := current.Config.Image == image.Name && current.Image == image.ID
+	opts.ContainerConfig.Image = image.Name
+	// the spec shares the environment with the current container, which
+	// is restored when the upgrade fails
+	upgradedEnv := map[string]string{}
+	for k, v := range current.Config.Env {
+		upgradedEnv[k] = v
+	}
+	for k, v := range env {
+		upToDate = upToDate && upgradedEnv[k] == v
+		upgradedEnv[k] = v
+	}
+	opts.ContainerConfig.Env = upgradedEnv
+	if upToDate {
+		return nil
+	}
+	return driver.ReplaceContainer(ctx, cli.CeDriver, current, opts)
+}
+
+// versionSkew lists the router, the controller and the proxies that run
+// another image than the one recorded for the site at init or upgrade
+func (cli *VanClient) versionSkew(ctx context.Context, sc *types.SiteConfig, transport *driver.ContainerInspect, controller *driver.ContainerInspect) ([]string, error) {
+	skew := []string{}
+	check := func(component string, image types.SiteImage, name string, id string) {
+		if image.Name == "" {
+			return
+		}
+		if name != image.Name || (image.ID != "" && id != image.ID) {
+			version := image.Version
+			if version == "" {
+				version = image.Name
+			}
+			skew = append(skew, fmt.Sprintf("%s is not running the site's image %s", component, version))
+		}
+	}
+	check(types.TransportComponentName, sc.Images[types.TransportComponentName], transport.Config.Image, transport.Image)
+	check(types.ControllerComponentName, sc.Images[types.ControllerComponentName], controller.Config.Image, controller.Image)
+
+	proxies, err := cli.CeDriver.ContainerList(ctx, driver.ContainerListOptions{
+		Filters: map[string][]string{"label": {types.ComponentLabel + "=" + types.ProxyComponentName}},
+		All:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list proxy containers: %w", err)
+	}
+	for _, proxy := range proxies {
+		check(types.ProxyComponentName+" "+proxyName(proxy), sc.Images[types.TransportComponentName], proxy.Image, proxy.ImageID)
+	}
+	return skew, nil
+}
+
+// proxyName returns the name of a listed proxy container
+func proxyName(proxy driver.ContainerSummary) string {
+	if len(proxy.Names) > 0 {
+		return strings.TrimPrefix(proxy.Names[0], "/")
+	}
+	return proxy.ID
+}
+
+// siteRegistryAuthFiles returns the registry credentials resolved at init
+// followed by the standard locations
+func siteRegistryAuthFiles() []string {
+	return append([]string{types.GetSkupperPath(types.SitesPath) + "/" + types.RegistryAuthFile}, driver.DefaultRegistryAuthFiles()...)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/driver/fake"
+	"gotest.tools/assert"
+)
+
+func TestRouterUpgrade(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "router")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+	defer os.Setenv("QDROUTERD_IMAGE", os.Getenv("QDROUTERD_IMAGE"))
+	os.Unsetenv("QDROUTERD_IMAGE")
+
+	cli, dd := newTestClient(t)
+	assert.Check(t, cli.RouterCreate(ctx, types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}))
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.Spec.TransportImage, types.DefaultTransportImage)
+	assert.Equal(t, sc.Images[types.TransportComponentName].Name, types.DefaultTransportImage)
+	assert.Assert(t, sc.Images[types.TransportComponentName].ID != "")
+	fake.CreateContainer(t, dd, "web", types.DefaultTransportImage, map[string]string{types.ComponentLabel: types.ProxyComponentName}, types.TransportNetworkName)
+	assert.Check(t, dd.ContainerStart(ctx, "web"))
+	vir, err := cli.RouterInspect(ctx)
+	assert.Check(t, err)
+	assert.DeepEqual(t, vir.VersionSkew, []string{})
+
+	newImage := "quay.io/skupper/qdrouterd:0.5"
+	options := types.RouterUpgradeOptions{TransportImage: newImage}
+	assert.Check(t, cli.RouterUpgrade(ctx, options))
+	sc, err = cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, sc.Spec.TransportImage, newImage)
+	assert.Equal(t, sc.Images[types.TransportComponentName].Name, newImage)
+	router, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, router.Config.Image, newImage)
+	assert.Equal(t, router.Image, sc.Images[types.TransportComponentName].ID)
+	assert.Assert(t, router.State.Running)
+	assert.Equal(t, router.Config.Env["SKUPPER_SITE_ID"], sc.UID)
+	controller, err := dd.ContainerInspect(ctx, types.ControllerDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, controller.Config.Env["QDROUTERD_IMAGE"], newImage, "the controller creates proxies from the new image")
+	web, err := dd.ContainerInspect(ctx, "web")
+	assert.Check(t, err)
+	assert.Equal(t, web.Config.Image, newImage)
+	assert.Equal(t, web.Config.Labels[types.ComponentLabel], types.ProxyComponentName)
+
+	// a proxy left behind is reported
+	fake.CreateContainer(t, dd, "db", types.DefaultTransportImage, map[string]string{types.ComponentLabel: types.ProxyComponentName}, types.TransportNetworkName)
+	assert.Check(t, dd.ContainerStart(ctx, "db"))
+	vir, err = cli.RouterInspect(ctx)
+	assert.Check(t, err)
+	assert.DeepEqual(t, vir.VersionSkew, []string{"proxy db is not running the site's image " + sc.Images[types.TransportComponentName].Version})
+
+	// the router is restored when the new one is not healthy
+	dd.FailOnce("ContainerWait", driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out")))
+	err = cli.RouterUpgrade(ctx, types.RouterUpgradeOptions{TransportImage: "quay.io/skupper/qdrouterd:0.6"})
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
+	assert.ErrorContains(t, err, "Failed to upgrade router")
+	restored, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, restored.ID, router.ID)
+	assert.Assert(t, restored.State.Running)
+	upgraded, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	assert.Check(t, err)
+	assert.Equal(t, upgraded.Spec.TransportImage, newImage)
+
+	// the components running the images are left alone
+	assert.Check(t, cli.RouterUpgrade(ctx, options))
+	current, err := dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, router.ID)
+	vir, err = cli.RouterInspect(ctx)
+	assert.Check(t, err)
+	assert.DeepEqual(t, vir.VersionSkew, []string{})
+
+	// a newer image under the same name is picked up
+	dd.UpdateImage(newImage)
+	assert.Check(t, cli.RouterUpgrade(ctx, options))
+	current, err = dd.ContainerInspect(ctx, types.TransportDeploymentName)
+	assert.Check(t, err)
+	assert.Assert(t, current.ID != router.ID)
+}
@@ -1,26 +1,27 @@
 package client
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/ajssmith/skupper-exp/api/types"
 )
 
-func (cli *VanClient) ServiceInterfaceCreate(service *types.ServiceInterface) error {
+func (cli *VanClient) ServiceInterfaceCreate(ctx context.Context, service *types.ServiceInterface) error {
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return containerError("transport", err)
 	}
 
 	err = validateServiceInterface(service)
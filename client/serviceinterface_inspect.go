@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,23 +9,23 @@ import (
 	"github.com/ajssmith/skupper-exp/api/types"
 )
 
-func (cli *VanClient) ServiceInterfaceInspect(address string) (*types.ServiceInterface, error) {
+func (cli *VanClient) ServiceInterfaceInspect(ctx context.Context, address string) (*types.ServiceInterface, error) {
 
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
 	svcDefs := make(map[string]types.ServiceInterface)
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return nil, containerError("transport", err)
 	}
 
 	svcFile, err := ioutil.ReadFile(types.GetSkupperPath(types.ServicesPath) + "/skupper-services")
@@ -1,20 +1,23 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 
 	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
 )
 
-func (cli *VanClient) ServiceInterfaceList() ([]types.ServiceInterface, error) {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+func (cli *VanClient) ServiceInterfaceList(ctx context.Context) ([]types.ServiceInterface, error) {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to intialize client: %w", err)
 	}
@@ -22,9 +25,9 @@ func (cli *VanClient) ServiceInterfaceList() ([]types.ServiceInterface, error) {
 	var vsis []types.ServiceInterface
 	svcDefs := make(map[string]types.ServiceInterface)
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return nil, fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return nil, containerError("transport", err)
 	}
 
 	svcFile, err := ioutil.ReadFile(types.GetSkupperPath(types.ServicesPath) + "/skupper-services")
@@ -36,8 +39,10 @@ func (cli *VanClient) ServiceInterfaceList() ([]types.ServiceInterface, error) {
 		return vsis, fmt.Errorf("Failed to decode json for service interface definitions: %w", err)
 	}
 	for _, v := range svcDefs {
-		_, err := cli.CeDriver.ContainerInspect(v.Address)
-		if err == nil {
+		_, err := cli.CeDriver.ContainerInspect(ctx, v.Address)
+		if err != nil && !errors.Is(err, driver.ErrNotFound) {
+			return nil, fmt.Errorf("Failed to retrieve proxy container for %s: %w", v.Address, err)
+		} else if err == nil {
 			// TODO: driver network settings
 			v.Alias = "10.10.10.1"
 			//			v.Alias = string(current.NetworkSettings.Networks["skupper-network"].IPAddress)
@@ -28,10 +28,26 @@ func addTargetToServiceInterface(service *types.ServiceInterface, target *types.
 	service.Targets = targets
 }
 
-func getServiceInterfaceTarget(targetType string, targetName string, deducePort bool, cli *VanClient) (*types.ServiceInterfaceTarget, error) {
+// hostServiceAddress returns the address the router reaches the services
+// of the host at when a host-service target does not give one
+func (cli *VanClient) hostServiceAddress() string {
+	if cli.hostMode() {
+		// the router is a process of the host
+		return "127.0.0.1"
+	}
+	host := utils.GetInternalIP("docker0")
+	if host == "" {
+		host = "172.17.0.1"
+	}
+	return host
+}
+
+func getServiceInterfaceTarget(ctx context.Context, targetType string, targetName string, deducePort bool, cli *VanClient) (*types.ServiceInterfaceTarget, error) {
 	// note: selector will indicate targetType
-	if targetType == "container" {
-		_, err := cli.CeDriver.ContainerInspect(targetName)
+	if targetType == "container" && cli.hostMode() {
+		return nil, fmt.Errorf("Only host-service targets are supported in host mode")
+	} else if targetType == "container" {
+		_, err := cli.CeDriver.ContainerInspect(ctx, targetName)
 		if err == nil {
 			target := types.ServiceInterfaceTarget{
 				Name:     targetName,
@@ -46,18 +62,14 @@ func getServiceInterfaceTarget(targetType string, targetName string, deducePort
 			//			}
 			return &target, nil
 		} else {
-			return nil, fmt.Errorf("Could not read container %s: %s", targetName, err)
+			return nil, fmt.Errorf("Could not read container %s: %w", targetName, err)
 		}
 	} else if targetType == "host-service" {
 		// add ip if not provided
 		name := targetName
 		arr := strings.SplitN(name, ":", 2)
 		if len(arr) == 1 {
-			host := utils.GetInternalIP("docker0")
-			if host == "" {
-				host = "172.17.0.1"
-			}
-			name = targetName + ":" + host
+			name = targetName + ":" + cli.hostServiceAddress()
 		}
 		target := types.ServiceInterfaceTarget{
 			Name:     name,
@@ -128,22 +140,22 @@ func validateServiceInterface(service *types.ServiceInterface) error {
 }
 
 func (cli *VanClient) ServiceInterfaceUpdate(ctx context.Context, service *types.ServiceInterface) error {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return containerError("transport", err)
 	}
 
-	_, err = cli.ServiceInterfaceInspect(service.Address)
+	_, err = cli.ServiceInterfaceInspect(ctx, service.Address)
 	if err != nil {
 		return fmt.Errorf("Service not found: %w", err)
 	}
@@ -155,20 +167,20 @@ func (cli *VanClient) ServiceInterfaceUpdate(ctx context.Context, service *types
 	return updateServiceInterface(service, true, cli)
 }
 
-func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+func (cli *VanClient) ServiceInterfaceBind(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return containerError("transport", err)
 	}
 
 	err = validateServiceInterface(service)
@@ -178,7 +190,7 @@ func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targ
 	if protocol != "" && service.Protocol != protocol {
 		return fmt.Errorf("Invalid protocol %s for service with mapping %s", protocol, service.Protocol)
 	}
-	target, err := getServiceInterfaceTarget(targetType, targetName, service.Port == 0 && targetPort == 0, cli)
+	target, err := getServiceInterfaceTarget(ctx, targetType, targetName, service.Port == 0 && targetPort == 0, cli)
 	if err != nil {
 		return err
 	}
@@ -203,22 +215,22 @@ func (cli *VanClient) ServiceInterfaceBind(service *types.ServiceInterface, targ
 	return updateServiceInterface(service, true, cli)
 }
 
-func removeServiceInterfaceTarget(serviceName string, targetName string, deleteIfNoTargets bool, cli *VanClient) error {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+func removeServiceInterfaceTarget(ctx context.Context, serviceName string, targetName string, deleteIfNoTargets bool, cli *VanClient) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
 	current := make(map[string]types.ServiceInterface)
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return containerError("transport", err)
 	}
 
 	svcFile, err := ioutil.ReadFile(types.GetSkupperPath(types.ServicesPath) + "/skupper-services")
@@ -246,11 +258,7 @@ func removeServiceInterfaceTarget(serviceName string, targetName string, deleteI
 			arr := strings.SplitN(name, ":", 2)
 			if len(arr) == 1 {
 				// magic address
-				host := utils.GetInternalIP("docker0")
-				if host == "" {
-					host = "172.17.0.1"
-				}
-				name = targetName + ":" + host
+				name = targetName + ":" + cli.hostServiceAddress()
 			}
 		}
 		if t.Name == name || (t.Name == "" && targetName == serviceName) {
@@ -281,24 +289,24 @@ func removeServiceInterfaceTarget(serviceName string, targetName string, deleteI
 	return nil
 }
 
-func (cli *VanClient) ServiceInterfaceUnbind(targetType string, targetName string, address string, deleteIfNoTargets bool) error {
-	sc, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+func (cli *VanClient) ServiceInterfaceUnbind(ctx context.Context, targetType string, targetName string, address string, deleteIfNoTargets bool) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
 	if err != nil {
 		return fmt.Errorf("Unable to retrieve site config: %w", err)
 	}
 
-	err = cli.Init(sc.Spec.ContainerEngineDriver)
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
 	if err != nil {
 		return fmt.Errorf("Failed to intialize client: %w", err)
 	}
 
-	_, err = cli.CeDriver.ContainerInspect("skupper-router")
+	_, err = cli.CeDriver.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
-		return fmt.Errorf("Failed to retrieve transport container (need init?): %w", err)
+		return containerError("transport", err)
 	}
 
 	if targetType == "container" || targetType == "host-service" {
-		err := removeServiceInterfaceTarget(address, targetName, deleteIfNoTargets, cli)
+		err := removeServiceInterfaceTarget(ctx, address, targetName, deleteIfNoTargets, cli)
 		return err
 	} else {
 		return fmt.Errorf("Unsupported target type for service interface %s", targetType)
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 
@@ -13,18 +14,22 @@ func NewUUID() string {
 	return uuid.New().String()
 }
 
-func (cli *VanClient) SiteConfigCreate(spec types.SiteConfigSpec) (*types.SiteConfig, error) {
+func (cli *VanClient) SiteConfigCreate(ctx context.Context, spec types.SiteConfigSpec) (*types.SiteConfig, error) {
 	sc := &types.SiteConfig{
 		Spec: spec,
 		UID:  NewUUID(),
 	}
-	encoded, err := json.Marshal(sc)
+	err := writeSiteConfig(sc)
 	if err != nil {
 		return nil, err
 	}
-	err = ioutil.WriteFile(types.GetSkupperPath(types.SitesPath)+"/"+types.DefaultBridgeName+".json", encoded, 0755)
+	return sc, nil
+}
+
+func writeSiteConfig(sc *types.SiteConfig) error {
+	encoded, err := json.Marshal(sc)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return sc, nil
+	return ioutil.WriteFile(types.GetSkupperPath(types.SitesPath)+"/"+types.DefaultBridgeName+".json", encoded, 0755)
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,7 +9,7 @@ import (
 	"github.com/ajssmith/skupper-exp/api/types"
 )
 
-func (cli *VanClient) SiteConfigInspect(name string) (*types.SiteConfig, error) {
+func (cli *VanClient) SiteConfigInspect(ctx context.Context, name string) (*types.SiteConfig, error) {
 	sc := &types.SiteConfig{}
 
 	scFile, err := ioutil.ReadFile(types.GetSkupperPath(types.SitesPath) + "/" + name + ".json")
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+// undoStep reverts one step of a site creation
+type undoStep struct {
+	description string
+	undo        func(ctx context.Context) error
+}
+
+// siteTransaction records how to revert the steps of a site creation, a
+// failed creation reverts them in reverse order
+type siteTransaction struct {
+	steps   []undoStep
+	commits []func()
+}
+
+// onRollback records how to revert a step that was done
+func (tx *siteTransaction) onRollback(description string, undo func(ctx context.Context) error) {
+	tx.steps = append(tx.steps, undoStep{description: description, undo: undo})
+}
+
+// onCommit records what to clean up once the creation succeeded
+func (tx *siteTransaction) onCommit(done func()) {
+	tx.commits = append(tx.commits, done)
+}
+
+func (tx *siteTransaction) commit() {
+	for _, done := range tx.commits {
+		done()
+	}
+}
+
+// rollback reverts the steps in reverse order and returns the cause along
+// with the steps that could not be reverted. It proceeds even though the
+// caller's context may be what made the creation fail.
+func (tx *siteTransaction) rollback(cause error) error {
+	ctx := context.Background()
+	failures := []string{}
+	for i := len(tx.steps) - 1; i >= 0; i-- {
+		if err := tx.steps[i].undo(ctx); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", tx.steps[i].description, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%w, rolling back failed: %s", cause, strings.Join(failures, "; "))
+	}
+	return cause
+}
+
+// createContainer creates a site container, it is removed on rollback
+func (cli *VanClient) createContainer(ctx context.Context, tx *siteTransaction, options driver.ContainerCreateOptions) (driver.ContainerCreateResponse, error) {
+	resp, err := cli.CeDriver.ContainerCreate(ctx, options)
+	if err != nil {
+		return resp, err
+	}
+	tx.onRollback("remove container "+options.Name, func(ctx context.Context) error {
+		return cli.removeContainer(ctx, resp.ID)
+	})
+	return resp, nil
+}
+
+// siteContainer is a container of an existing site, nil when the site has
+// none, that is replaced during the creation
+type siteContainer struct {
+	current  *driver.ContainerInspect
+	replaced bool
+}
+
+// siteContainers returns the router and the controller of an existing
+// site, they are restored from their spec on rollback once replaced, the
+// router first and the controller along with it as it has to reconnect
+func (cli *VanClient) siteContainers(ctx context.Context, tx *siteTransaction, site *existingSite) (*siteContainer, *siteContainer, error) {
+	transport, controller := &siteContainer{}, &siteContainer{}
+	for name, c := range map[string]*siteContainer{types.TransportDeploymentName: transport, types.ControllerDeploymentName: controller} {
+		if !site.hasContainer(name) {
+			continue
+		}
+		current, err := cli.CeDriver.ContainerInspect(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to retrieve container %s: %w", name, err)
+		}
+		c.current = current
+	}
+	tx.onRollback("restore container "+types.ControllerDeploymentName, func(ctx context.Context) error {
+		if controller.current == nil || (!controller.replaced && !transport.replaced) {
+			return nil
+		}
+		return cli.restoreSiteContainer(ctx, controller.current)
+	})
+	tx.onRollback("restore container "+types.TransportDeploymentName, func(ctx context.Context) error {
+		if !transport.replaced {
+			return nil
+		}
+		return cli.restoreSiteContainer(ctx, transport.current)
+	})
+	return transport, controller, nil
+}
+
+// backupSiteFiles copies the files of an existing site aside, they are
+// copied back over the site's files on rollback. It returns the restore for
+// a failed replacement to run before the original container starts again,
+// the site's containers mount the dirs so they are restored in place.
+func backupSiteFiles(tx *siteTransaction) (func() error, error) {
+	hostPath := types.GetSkupperPath(types.HostPath)
+	backup, err := ioutil.TempDir(filepath.Dir(hostPath), "skupper-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to back up skupper files: %w", err)
+	}
+	err = copyDir(hostPath, backup)
+	if err != nil {
+		os.RemoveAll(backup)
+		return nil, fmt.Errorf("Failed to back up skupper files: %w", err)
+	}
+	restore := func() error {
+		return restoreDir(backup, hostPath)
+	}
+	tx.onRollback("restore skupper files", func(ctx context.Context) error {
+		if err := restore(); err != nil {
+			return err
+		}
+		return os.RemoveAll(backup)
+	})
+	tx.onCommit(func() {
+		os.RemoveAll(backup)
+	})
+	return restore, nil
+}
+
+// restoreDir copies the files of the backup back into the dir and removes
+// the ones the backup does not have, the dir and its files are written in
+// place
+func restoreDir(backup string, dir string) error {
+	err := copyDir(backup, dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(backup, rel)); !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// copyDir copies the files of the src dir into the dst dir, keeping their
+// modes
+func copyDir(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+)
+
+// TokenList returns the tokens the site issued, with the sites that
+// connected with them, by name
+func (cli *VanClient) TokenList(ctx context.Context) ([]*types.TokenInspectResponse, error) {
+	tokens := []*types.TokenInspectResponse{}
+
+	_, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return tokens, fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	tokensPath := types.GetSkupperPath(types.TokensPath)
+	files, err := ioutil.ReadDir(tokensPath)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	} else if err != nil {
+		return tokens, fmt.Errorf("Failed to read issued tokens: %w", err)
+	}
+	now := time.Now()
+	for _, f := range files {
+		token, err := readIssuedToken(tokensPath, f.Name())
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return tokens, err
+		}
+		redemptions, err := readTokenRedemptions(tokensPath, f.Name())
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, &types.TokenInspectResponse{
+			Token:       *token,
+			Redemptions: redemptions,
+			Status:      tokenStatus(token, redemptions, now),
+		})
+	}
+	return tokens, nil
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+)
+
+// TokenRevoke refuses the token to all sites, including the ones that
+// connected with it before. Their connections are closed right away, but
+// the router still accepts the token's certificate: a site that connects
+// again stays connected until the controller's next check closes it.
+func (cli *VanClient) TokenRevoke(ctx context.Context, name string) error {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	err = cli.Init(ctx, sc.Spec.ContainerEngineDriver, getEngineConfig(sc.Spec))
+	if err != nil {
+		return fmt.Errorf("Failed to intialize client: %w", err)
+	}
+
+	tokensPath := types.GetSkupperPath(types.TokensPath)
+	if checkTokenName(name) != nil {
+		return fmt.Errorf("No token %s was issued by this site", name)
+	}
+	if _, err := readIssuedToken(tokensPath, name); os.IsNotExist(err) {
+		return fmt.Errorf("No token %s was issued by this site", name)
+	}
+	err = revokeIssuedToken(tokensPath, name)
+	if err != nil {
+		return fmt.Errorf("Failed to revoke token %s: %w", name, err)
+	}
+
+	err = cli.EnforceTokens(ctx, tokensPath, time.Now())
+	if err != nil {
+		return fmt.Errorf("Token %s is revoked but its connections could not be closed: %w", name, err)
+	}
+	return nil
+}
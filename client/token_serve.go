@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/pkg/utils"
+	"github.com/skupperproject/skupper/pkg/certs"
+)
+
+// claimPasswordLength is the length of the generated claim passwords
+const claimPasswordLength = 16
+
+// TokenServe hands out a token to the first site that claims it with the
+// password, over an HTTPS endpoint with a certificate of the site's
+// skupper-internal-ca. The claim URL has the fingerprint of the endpoint's
+// certificate as its path, the claiming site checks it before it sends the
+// password. The token is generated for a single use before the
+// endpoint is up, which it tells the ready func about, and is revoked when
+// no site claimed it before the timeout, the context was canceled or a
+// password was wrong too many times. It returns the name of the claimed
+// token.
+func (cli *VanClient) TokenServe(ctx context.Context, options types.TokenServeOptions, ready func(claim types.TokenClaim)) (string, error) {
+	sc, err := cli.SiteConfigInspect(ctx, types.DefaultBridgeName)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve site config: %w", err)
+	}
+
+	if options.Port == 0 {
+		options.Port = types.ClaimDefaultPort
+	}
+	if options.Timeout == 0 {
+		options.Timeout = types.ClaimDefaultTimeout
+	}
+	if options.Password == "" {
+		options.Password = utils.RandomId(claimPasswordLength)
+	}
+	if options.Host == "" {
+		if len(sc.Spec.IngressHosts) > 0 {
+			options.Host = sc.Spec.IngressHosts[0]
+		} else if options.Host, err = os.Hostname(); err != nil {
+			return "", fmt.Errorf("Unable to retrieve host name, use --host: %w", err)
+		}
+	}
+	if options.Token.Uses == 0 {
+		options.Token.Uses = 1
+	}
+
+	tokensPath := types.GetSkupperPath(types.TokensPath)
+	name, tokenData, annotations, err := cli.issueToken(ctx, "", options.Token)
+	if err != nil {
+		return "", err
+	}
+	token, err := encodeToken(name, tokenData, annotations)
+	if err != nil {
+		return "", err
+	}
+
+	// the claiming site checks the endpoint against the CA in the token
+	caData, err := getCertData(internalCA)
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve CA data: %w", err)
+	}
+	certData := certs.GenerateCertificateData("skupper-claim", "skupper-claim", options.Host, caData)
+	cert, err := tls.X509KeyPair(certData["tls.crt"], certData["tls.key"])
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate claim certificate: %w", err)
+	}
+	listener, err := tls.Listen("tcp", ":"+strconv.Itoa(options.Port), &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to start claim endpoint: %w", err)
+	}
+
+	handler := &claimHandler{
+		password: options.Password,
+		token:    token,
+		done:     make(chan error, 1),
+	}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	defer func() {
+		// the claim's response is sent before the server stops
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	ready(types.TokenClaim{
+		URL:      "https://" + net.JoinHostPort(options.Host, strconv.Itoa(port)) + "/" + certFingerprint(cert.Certificate[0]),
+		Password: options.Password,
+	})
+
+	select {
+	case err = <-handler.done:
+	case <-time.After(options.Timeout):
+		err = fmt.Errorf("No site claimed token %s within %s", name, options.Timeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		if revokeErr := revokeIssuedToken(tokensPath, name); revokeErr != nil {
+			return "", fmt.Errorf("%s, and it could not be revoked: %w", err, revokeErr)
+		}
+		return "", err
+	}
+	return name, nil
+}
+
+// certFingerprint is the SHA-256 of the DER encoded certificate in hex
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// claimHandler hands out the token once to a request with the password in
+// its body, it gives up after too many wrong passwords
+type claimHandler struct {
+	mu       sync.Mutex
+	password string
+	token    []byte
+	attempts int
+	claimed  bool
+	done     chan error
+}
+
+func (h *claimHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Claim the token with a POST request", http.StatusMethodNotAllowed)
+		return
+	}
+	password, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1024))
+	if err != nil {
+		http.Error(w, "Invalid claim", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.claimed || h.attempts >= types.ClaimMaxAttempts {
+		http.Error(w, "The token is no longer available", http.StatusGone)
+		return
+	}
+	if subtle.ConstantTimeCompare(password, []byte(h.password)) != 1 {
+		h.attempts++
+		if h.attempts >= types.ClaimMaxAttempts {
+			h.done <- fmt.Errorf("The claim password was wrong %d times", h.attempts)
+		}
+		http.Error(w, "Wrong claim password", http.StatusForbidden)
+		return
+	}
+	h.claimed = true
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(h.token)
+	h.done <- nil
+}
+
+// revokeIssuedToken marks the token revoked in the site's records, its
+// connections are left to the controller
+func revokeIssuedToken(dir string, name string) error {
+	token, err := readIssuedToken(dir, name)
+	if err != nil {
+		return err
+	}
+	token.Revoked = true
+	return writeIssuedToken(dir, token)
+}
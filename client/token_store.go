@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+)
+
+// The site's issued tokens are kept in a dir per token, the token record is
+// written by the client and the redemptions by the controller
+
+// tokenNamePattern is what a token name must look like, it names its dir
+var tokenNamePattern = regexp.MustCompile("^[A-Za-z0-9][A-Za-z0-9._-]*$")
+
+// reservedTokenNames are the subjects of the site's own credentials, the
+// proxies connect with them
+var reservedTokenNames = []string{"skupper-internal", "skupper-messaging"}
+
+func checkTokenName(name string) error {
+	if !tokenNamePattern.MatchString(name) {
+		return fmt.Errorf("Invalid token name %s, use letters, digits, '.', '_' and '-'", name)
+	}
+	for _, reserved := range reservedTokenNames {
+		if name == reserved {
+			return fmt.Errorf("Token name %s is reserved for the site", name)
+		}
+	}
+	return nil
+}
+
+func generateTokenName(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("Could not retrieve issued tokens: %w", err)
+	}
+	max := 1
+	tokenNamePattern := regexp.MustCompile("^token([0-9]+)$")
+	for _, f := range files {
+		count := tokenNamePattern.FindStringSubmatch(f.Name())
+		if len(count) > 1 {
+			v, _ := strconv.Atoi(count[1])
+			if v >= max {
+				max = v + 1
+			}
+		}
+	}
+	return "token" + strconv.Itoa(max), nil
+}
+
+func readIssuedToken(dir string, name string) (*types.IssuedToken, error) {
+	data, err := ioutil.ReadFile(dir + "/" + name + "/token.json")
+	if err != nil {
+		return nil, err
+	}
+	token := &types.IssuedToken{}
+	err = json.Unmarshal(data, token)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse token %s: %w", name, err)
+	}
+	return token, nil
+}
+
+func writeIssuedToken(dir string, token *types.IssuedToken) error {
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir+"/"+token.Name, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"/"+token.Name+"/token.json", encoded, 0644)
+}
+
+// readTokenRedemptions returns the sites that connected with the token,
+// none when it was not used yet
+func readTokenRedemptions(dir string, name string) ([]types.TokenRedemption, error) {
+	redemptions := []types.TokenRedemption{}
+	data, err := ioutil.ReadFile(dir + "/" + name + "/redemptions.json")
+	if os.IsNotExist(err) {
+		return redemptions, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &redemptions)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse redemptions of token %s: %w", name, err)
+	}
+	return redemptions, nil
+}
+
+func writeTokenRedemptions(dir string, name string, redemptions []types.TokenRedemption) error {
+	encoded, err := json.Marshal(redemptions)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dir+"/"+name+"/redemptions.json", encoded, 0644)
+}
+
+// tokenStatus tells whether new sites may still connect with the token
+func tokenStatus(token *types.IssuedToken, redemptions []types.TokenRedemption, now time.Time) string {
+	switch {
+	case token.Revoked:
+		return types.TokenRevoked
+	case token.Uses > 0 && len(redemptions) >= token.Uses:
+		return types.TokenUsed
+	case !token.Expiry.IsZero() && now.After(token.Expiry):
+		return types.TokenExpired
+	default:
+		return types.TokenActive
+	}
+}
+
+// tokenSubject returns the common name of the subject a connection
+// authenticated as
+func tokenSubject(user string) string {
+	for _, part := range strings.Split(user, ",") {
+		if strings.HasPrefix(strings.TrimSpace(part), "CN=") {
+			return strings.TrimPrefix(strings.TrimSpace(part), "CN=")
+		}
+	}
+	return user
+}
+
+// EnforceTokens checks the inter-router and edge connections the router
+// accepted against the tokens issued in the dir. The connections of a
+// revoked token are closed, a site that connects with an expired or used
+// token for the first time is refused and one that connects with an active
+// token is recorded as having used it. Connections of tokens the site has
+// no record of, issued before the records were kept or by another site,
+// are left alone.
+//
+// The router keeps trusting the certificate of a refused token, it is
+// signed by the site's CA, so a site whose connections were closed can
+// connect again and stays connected until the next check closes it again.
+func (cli *VanClient) EnforceTokens(ctx context.Context, dir string, now time.Time) error {
+	connections, err := qdr.GetConnections(ctx, cli.CeDriver)
+	if err != nil {
+		return err
+	}
+	for _, c := range connections {
+		if c.Dir != "in" || (c.Role != string(qdr.RoleInterRouter) && c.Role != qdr.RoleEdge) || c.User == "" {
+			continue
+		}
+		name := tokenSubject(c.User)
+		if checkTokenName(name) != nil {
+			continue
+		}
+		token, err := readIssuedToken(dir, name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		redemptions, err := readTokenRedemptions(dir, name)
+		if err != nil {
+			return err
+		}
+		redeemed := false
+		for _, r := range redemptions {
+			redeemed = redeemed || r.Site == c.Container
+		}
+		status := tokenStatus(token, redemptions, now)
+		if status == types.TokenRevoked || (!redeemed && status != types.TokenActive) {
+			err = qdr.CloseConnection(ctx, cli.CeDriver, c.Identity)
+			if err != nil {
+				return fmt.Errorf("Failed to close connection of %s with %s token %s: %w", c.Container, status, name, err)
+			}
+			continue
+		}
+		if !redeemed {
+			redemptions = append(redemptions, types.TokenRedemption{Site: c.Container, Time: now})
+			err = writeTokenRedemptions(dir, name, redemptions)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"gotest.tools/assert"
+)
+
+func TestTokenLimits(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "token")
+	assert.Check(t, err)
+	os.Setenv("SKUPPER_TMPDIR", tmpDir)
+	defer os.RemoveAll(tmpDir)
+
+	cli, dd := newTestClient(t)
+	scs := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+
+	// the tokens are named for their client certificate's subject
+	name, err := cli.ConnectorTokenCreate(ctx, "", tmpDir+"/single.yaml", types.ConnectorTokenCreateOptions{Uses: 1})
+	assert.Check(t, err)
+	assert.Equal(t, name, "token1")
+	secret, err := certs.GetSecretContent(tmpDir + "/single.yaml")
+	assert.Check(t, err)
+	assert.Equal(t, string(secret[types.TokenUses]), "1")
+	name, err = cli.ConnectorTokenCreate(ctx, "", tmpDir+"/hour.yaml", types.ConnectorTokenCreateOptions{Expiry: time.Hour})
+	assert.Check(t, err)
+	assert.Equal(t, name, "token2")
+	_, err = cli.ConnectorTokenCreate(ctx, "token1", tmpDir+"/again.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Error(t, err, "Token token1 was already issued, choose another client identity")
+	_, err = cli.ConnectorTokenCreate(ctx, "skupper-internal", tmpDir+"/internal.yaml", types.ConnectorTokenCreateOptions{})
+	assert.Error(t, err, "Token name skupper-internal is reserved for the site")
+
+	tokens, err := cli.TokenList(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, len(tokens), 2)
+	assert.Equal(t, tokens[0].Token.Name, "token1")
+	assert.Equal(t, tokens[0].Status, types.TokenActive)
+	assert.Equal(t, tokens[1].Token.Expiry, tokens[1].Token.Created.Add(time.Hour))
+
+	// the first site uses the single use token, the next one is refused
+	// as is a site connecting with the expired token, the proxies and the
+	// site's own connections are left alone
+	dd.SetExecResult([]string{"qdmanage", "query", "--type", "connection"}, 0, `[
+		{"container": "site-b", "role": "inter-router", "dir": "in", "identity": "1", "user": "CN=token1,O=skupper"},
+		{"container": "site-c", "role": "inter-router", "dir": "in", "identity": "2", "user": "CN=token1,O=skupper"},
+		{"container": "site-d", "role": "edge", "dir": "in", "identity": "3", "user": "CN=token2"},
+		{"container": "proxy", "role": "edge", "dir": "in", "identity": "4", "user": "CN=skupper-internal"},
+		{"container": "site-e", "role": "inter-router", "dir": "out", "identity": "5", "user": "CN=token1"}
+	]`, "")
+	closed := func() []string {
+		router, ok := dd.Container(types.TransportDeploymentName)
+		assert.Assert(t, ok)
+		identities := []string{}
+		for _, cmd := range router.ExecCalls {
+			if strings.HasPrefix(strings.Join(cmd, " "), "qdmanage update --type connection") {
+				identities = append(identities, cmd[5])
+			}
+		}
+		return identities
+	}
+	assert.Check(t, cli.EnforceTokens(ctx, types.GetSkupperPath(types.TokensPath), time.Now().Add(2*time.Hour)))
+	assert.DeepEqual(t, closed(), []string{"2", "3"})
+	tokens, err = cli.TokenList(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, tokens[0].Status, types.TokenUsed)
+	assert.Equal(t, len(tokens[0].Redemptions), 1)
+	assert.Equal(t, tokens[0].Redemptions[0].Site, "site-b")
+	assert.Equal(t, tokens[1].Status, types.TokenActive, "it has not expired yet")
+	assert.Equal(t, len(tokens[1].Redemptions), 0)
+
+	// the site that used the token keeps connecting until it is revoked
+	assert.Check(t, cli.EnforceTokens(ctx, types.GetSkupperPath(types.TokensPath), time.Now()))
+	assert.DeepEqual(t, closed(), []string{"2", "3", "2"})
+	assert.Check(t, cli.TokenRevoke(ctx, "token1"))
+	assert.DeepEqual(t, closed(), []string{"2", "3", "2", "1", "2"})
+	tokens, err = cli.TokenList(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, tokens[0].Status, types.TokenRevoked)
+
+	// the router still accepts the revoked token, the site that reconnects
+	// is closed again by the next check
+	dd.SetExecResult([]string{"qdmanage", "query", "--type", "connection"}, 0, `[
+		{"container": "site-b", "role": "inter-router", "dir": "in", "identity": "6", "user": "CN=token1"}
+	]`, "")
+	assert.Check(t, cli.EnforceTokens(ctx, types.GetSkupperPath(types.TokensPath), time.Now()))
+	assert.DeepEqual(t, closed(), []string{"2", "3", "2", "1", "2", "6"})
+	assert.Error(t, cli.TokenRevoke(ctx, "token9"), "No token token9 was issued by this site")
+
+	// a connecting site tells an expired token from a refused connection
+	_, err = cli.ConnectorTokenCreate(ctx, "", tmpDir+"/expired.yaml", types.ConnectorTokenCreateOptions{Expiry: time.Nanosecond})
+	assert.Check(t, err)
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+	assert.Check(t, cli.RouterCreate(ctx, scs))
+	_, err = cli.ConnectorCreate(ctx, tmpDir+"/expired.yaml", types.ConnectorCreateOptions{})
+	assert.ErrorContains(t, err, "Token '"+tmpDir+"/expired.yaml' expired at")
+	assert.Assert(t, len(cli.RouterRemove(ctx)) == 0)
+}
+
+func TestTokenClaim(t *testing.T) {
+	ctx := context.Background()
+	tmpDir, err := ioutil.TempDir("", "token")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+	siteA, siteB := tmpDir+"/a", tmpDir+"/b"
+	defer os.Setenv("SKUPPER_TMPDIR", os.Getenv("SKUPPER_TMPDIR"))
+
+	scs := types.SiteConfigSpec{
+		SkupperName:      "skupper",
+		EnableController: true,
+		AuthMode:         "unsecured",
+	}
+	os.Setenv("SKUPPER_TMPDIR", siteA)
+	cliA, _ := newTestClient(t)
+	assert.Check(t, cliA.RouterCreate(ctx, scs))
+	os.Setenv("SKUPPER_TMPDIR", siteB)
+	cliB, _ := newTestClient(t)
+	assert.Check(t, cliB.RouterCreate(ctx, scs))
+
+	// the sites share the process, site a resolves its files before the
+	// endpoint is up
+	serve := func(options types.TokenServeOptions) (types.TokenClaim, chan error) {
+		os.Setenv("SKUPPER_TMPDIR", siteA)
+		claims := make(chan types.TokenClaim, 1)
+		served := make(chan error, 1)
+		go func() {
+			_, err := cliA.TokenServe(ctx, options, func(claim types.TokenClaim) {
+				claims <- claim
+			})
+			served <- err
+		}()
+		select {
+		case claim := <-claims:
+			os.Setenv("SKUPPER_TMPDIR", siteB)
+			return claim, served
+		case err := <-served:
+			t.Fatalf("token not served: %s", err)
+		}
+		return types.TokenClaim{}, nil
+	}
+
+	claim, served := serve(types.TokenServeOptions{Host: "127.0.0.1", Port: freePort(t), Password: "secret", Timeout: time.Minute})
+	assert.Assert(t, strings.HasPrefix(claim.URL, "https://127.0.0.1:"))
+	assert.Equal(t, claim.Password, "secret")
+
+	// the password is only sent to the endpoint with the certificate of the
+	// URL, the token is still there to claim after
+	endpoint := claim.URL[:strings.LastIndex(claim.URL, "/")]
+	_, err = cliB.ConnectorClaim(ctx, types.TokenClaim{URL: endpoint, Password: claim.Password}, types.ConnectorCreateOptions{})
+	assert.Error(t, err, "Invalid claim URL "+endpoint+", it has no certificate fingerprint")
+	_, err = cliB.ConnectorClaim(ctx, types.TokenClaim{URL: endpoint + "/" + strings.Repeat("0", 64), Password: claim.Password}, types.ConnectorCreateOptions{})
+	assert.ErrorContains(t, err, "the endpoint's certificate does not match the fingerprint of the claim URL")
+
+	// a wrong password is refused, the right one claims the token once
+	_, err = cliB.ConnectorClaim(ctx, types.TokenClaim{URL: claim.URL, Password: "guess"}, types.ConnectorCreateOptions{})
+	assert.Error(t, err, "Token claim refused: Wrong claim password")
+	name, err := cliB.ConnectorClaim(ctx, claim, types.ConnectorCreateOptions{Name: "site-a"})
+	assert.Check(t, err)
+	assert.Equal(t, name, "site-a")
+	assert.Check(t, <-served)
+	_, err = os.Stat(types.GetSkupperPath(types.ConnectionsPath) + "/site-a/tls.crt")
+	assert.Check(t, err)
+	_, err = cliB.ConnectorClaim(ctx, claim, types.ConnectorCreateOptions{})
+	assert.ErrorContains(t, err, "Failed to claim token")
+
+	// the claimed token is for one site, an unclaimed one is revoked
+	claim, served = serve(types.TokenServeOptions{Host: "127.0.0.1", Port: freePort(t), Timeout: 100 * time.Millisecond})
+	assert.Equal(t, len(claim.Password), claimPasswordLength)
+	assert.ErrorContains(t, <-served, "No site claimed token token2 within 100ms")
+	os.Setenv("SKUPPER_TMPDIR", siteA)
+	tokens, err := cliA.TokenList(ctx)
+	assert.Check(t, err)
+	assert.Equal(t, len(tokens), 2)
+	assert.Equal(t, tokens[0].Token.Uses, 1)
+	assert.Equal(t, tokens[0].Status, types.TokenActive)
+	assert.Equal(t, tokens[1].Status, types.TokenRevoked)
+}
+
+// freePort returns a port nothing listens on
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Assert(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -65,6 +67,7 @@ func NewController(cli *client.VanClient, origin string, tlsConfig *tls.Config)
 
 func (c *Controller) Run(stopCh <-chan struct{}) error {
 	log.Println("Starting the Skupper controller")
+	ctx := stopContext(stopCh)
 
 	var imageName string
 	if os.Getenv("QDROUTERD_IMAGE") != "" {
@@ -73,15 +76,22 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 		imageName = types.DefaultTransportImage
 	}
 
+	// the site's registry credentials are provided through REGISTRY_AUTH_FILE
+	auth, err := driver.GetRegistryAuth(imageName, driver.DefaultRegistryAuthFiles())
+	if err != nil {
+		log.Fatal("Failed to read registry credentials: ", err.Error())
+	}
+
 	log.Println("Pulling proxy image", c.vanClient.CeDriver)
-	_, err := c.vanClient.CeDriver.ImagesPull(imageName, driver.ImagePullOptions{})
+	err = driver.PullImage(ctx, c.vanClient.CeDriver, imageName, driver.PullPolicy(os.Getenv("SKUPPER_IMAGE_PULL_POLICY")), auth)
 	if err != nil {
 		log.Fatal("Failed to pull proxy image: ", err.Error())
 	}
 
 	log.Println("Starting workers")
-	go c.runServiceSync() // receives peer updates
-	go c.runServiceDefsWatcher()
+	go c.runServiceSync(ctx) // receives peer updates
+	go c.runServiceDefsWatcher(ctx)
+	go c.runTokenEnforcer(ctx)
 
 	log.Println("Started workers")
 	<-stopCh
@@ -96,7 +106,7 @@ func updateSkupperServices(changed []types.ServiceInterface, deleted []string, o
 	}
 
 	current := make(map[string]types.ServiceInterface)
-	file, err := ioutil.ReadFile("/etc/messaging/services/skupper-services")
+	file, err := ioutil.ReadFile(servicesFile)
 
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve skupper service definitions: %w", err)
@@ -119,7 +129,7 @@ func updateSkupperServices(changed []types.ServiceInterface, deleted []string, o
 		return fmt.Errorf("Failed to encode json for service interface: %w", err)
 	}
 
-	err = ioutil.WriteFile("/etc/messaging/services/skupper-services", encoded, 0755)
+	err = ioutil.WriteFile(servicesFile, encoded, 0755)
 	if err != nil {
 		return fmt.Errorf("Failed to write service file: %w", err)
 	}
@@ -128,7 +138,7 @@ func updateSkupperServices(changed []types.ServiceInterface, deleted []string, o
 
 func getServiceDefinitions() (map[string]types.ServiceInterface, error) {
 	svcDefs := make(map[string]types.ServiceInterface)
-	file, err := ioutil.ReadFile("/etc/messaging/services/skupper-services")
+	file, err := ioutil.ReadFile(servicesFile)
 	if err != nil {
 		return svcDefs, fmt.Errorf("Failed to retrieve skupper service definitions: %w", err)
 	}
@@ -139,16 +149,16 @@ func getServiceDefinitions() (map[string]types.ServiceInterface, error) {
 	return svcDefs, nil
 }
 
-func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
-	proxies := c.getProxies()
+func (c *Controller) ensureProxyFor(ctx context.Context, bindings *ServiceBindings) error {
+	proxies := c.getProxies(ctx)
 	_, exists := proxies[bindings.address]
 	serviceInterface := asServiceInterface(bindings)
 
 	if bindings.origin == "" {
 		attached := make(map[string]bool)
-		sn, err := c.vanClient.CeDriver.NetworkInspect(types.TransportNetworkName)
+		sn, err := c.vanClient.CeDriver.NetworkInspect(ctx, network)
 		if err != nil {
-			return fmt.Errorf("Unable to retrieve skupper-network: %w", err)
+			return fmt.Errorf("Unable to retrieve %s: %w", network, err)
 		}
 		for _, c := range sn.Containers {
 			attached[c.Name] = true
@@ -157,8 +167,19 @@ func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
 		for _, t := range bindings.targets {
 			if t.selector == "internal.skupper.io/container" {
 				if _, ok := attached[t.name]; !ok {
+					target, err := c.vanClient.CeDriver.ContainerInspect(ctx, t.name)
+					if errors.Is(err, driver.ErrNotFound) {
+						log.Printf("Target container %s for service %s is missing: %s\n", t.name, bindings.address, err.Error())
+						continue
+					} else if err != nil {
+						log.Printf("Failed to retrieve target container %s for service %s: %s\n", t.name, bindings.address, err.Error())
+						continue
+					}
+					if target.State != nil && !target.State.Running {
+						log.Printf("Target container %s for service %s is not running\n", t.name, bindings.address)
+					}
 					fmt.Println("Attaching container to skupper network: ", t.service)
-					err := c.vanClient.CeDriver.NetworkConnect(types.TransportNetworkName, t.name, []string{})
+					err = c.vanClient.CeDriver.NetworkConnect(ctx, network, t.name, []string{})
 					if err != nil {
 						log.Println("Failed to attach target container to skupper network: ", err.Error())
 					}
@@ -175,11 +196,11 @@ func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
 
 	if !exists {
 		log.Println("Deploying proxy: ", serviceInterface.Address)
-		// proxyContainer, err := docker.NewProxyContainer(serviceInterface, config, mapToHost, c.vanClient.DockerInterface)
+		// proxyContainer, err := docker.NewProxyContainer(ctx, serviceInterface, config, mapToHost, c.vanClient.CeDriver)
 		// if err != nil {
 		// 	return fmt.Errorf("Failed to create proxy container: %w", err)
 		// }
-		// err = docker.StartContainer(proxyContainer.Name, c.vanClient.DockerInterface)
+		// err = c.vanClient.CeDriver.ContainerStart(ctx, proxyContainer.Name)
 		// if err != nil {
 		// 	return fmt.Errorf("Failed to start proxy container: %w", err)
 		// }
@@ -197,11 +218,11 @@ func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
 		// 	if err != nil {
 		// 		return fmt.Errorf("Failed to delete proxy container: %w", err)
 		// 	}
-		// 	newProxyContainer, err := docker.NewProxyContainer(serviceInterface, config, mapToHost, c.vanClient.DockerInterface)
+		// 	newProxyContainer, err := docker.NewProxyContainer(ctx, serviceInterface, config, mapToHost, c.vanClient.CeDriver)
 		// 	if err != nil {
 		// 		return fmt.Errorf("Failed to re-create proxy container: %w", err)
 		// 	}
-		// 	err = docker.StartContainer(newProxyContainer.Name, c.vanClient.DockerInterface)
+		// 	err = c.vanClient.CeDriver.ContainerStart(ctx, newProxyContainer.Name)
 		// 	if err != nil {
 		// 		return fmt.Errorf("Failed to start proxy container: %w", err)
 		// 	}
@@ -211,43 +232,43 @@ func (c *Controller) ensureProxyFor(bindings *ServiceBindings) error {
 
 }
 
-func (c *Controller) deleteProxy(name string) error {
-	err := c.vanClient.CeDriver.ContainerStop(name)
+func (c *Controller) deleteProxy(ctx context.Context, name string) error {
+	err := c.vanClient.CeDriver.ContainerStop(ctx, name)
 	if err != nil {
 		return err
 	}
-	err = c.vanClient.CeDriver.ContainerRemove(name)
+	err = c.vanClient.CeDriver.ContainerRemove(ctx, name)
 	return err
 }
 
-func (c *Controller) updateProxies() {
+func (c *Controller) updateProxies(ctx context.Context) {
 	for _, v := range c.bindings {
-		err := c.ensureProxyFor(v)
+		err := c.ensureProxyFor(ctx, v)
 		if err != nil {
 			log.Println("Unable to ensure proxy container: ", err.Error())
 		}
 	}
-	proxies := c.getProxies()
+	proxies := c.getProxies(ctx)
 	for _, v := range proxies {
 		proxyContainerName := strings.TrimPrefix(v.Names[0], "/")
 		def, ok := c.bindings[proxyContainerName]
 		if !ok || def == nil {
-			c.deleteProxy(proxyContainerName)
+			c.deleteProxy(ctx, proxyContainerName)
 		}
 	}
 }
 
-func (c *Controller) getProxies() map[string]driver.ContainerSummary {
+func (c *Controller) getProxies(ctx context.Context) map[string]driver.ContainerSummary {
 	proxies := make(map[string]driver.ContainerSummary)
 
 	filters := map[string][]string{
-		"label": {"skuper.io/application"},
+		"label": {types.ComponentLabel + "=" + types.ProxyComponentName},
 	}
 	opts := driver.ContainerListOptions{
 		Filters: filters,
 		All:     true,
 	}
-	containers, err := c.vanClient.CeDriver.ContainerList(opts)
+	containers, err := c.vanClient.CeDriver.ContainerList(ctx, opts)
 	if err == nil {
 		for _, container := range containers {
 			proxyName := strings.TrimPrefix(container.Names[0], "/")
@@ -257,7 +278,7 @@ func (c *Controller) getProxies() map[string]driver.ContainerSummary {
 	return proxies
 }
 
-func (c *Controller) processServiceDefs() {
+func (c *Controller) processServiceDefs(ctx context.Context) {
 	svcDefs, err := getServiceDefinitions()
 	if err != nil {
 		log.Println("Failed to retrieve skupper service definitions: ", err.Error())
@@ -279,23 +300,101 @@ func (c *Controller) processServiceDefs() {
 			delete(c.bindings, k)
 		}
 	}
-	c.updateProxies()
+	c.updateProxies(ctx)
+}
+
+// bindingsForTarget returns the local services that have the named
+// container as a target
+func (c *Controller) bindingsForTarget(name string) []*ServiceBindings {
+	var result []*ServiceBindings
+	for _, b := range c.bindings {
+		if b.origin != "" {
+			continue
+		}
+		for _, t := range b.targets {
+			if t.selector == "internal.skupper.io/container" && t.name == name {
+				result = append(result, b)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (c *Controller) handleEngineEvent(ctx context.Context, event driver.Event) {
+	name := strings.TrimPrefix(event.Name, "/")
+	if event.Type == driver.EventTypeNetwork {
+		// podman does not report the network, the target tells instead
+		if (name != "" && name != network) || event.Action != driver.EventDisconnect {
+			return
+		}
+		// a running target that was disconnected needs to be re-attached
+		target, err := c.vanClient.CeDriver.ContainerInspect(ctx, event.Container)
+		if err != nil || target.State == nil || !target.State.Running {
+			return
+		}
+		if _, ok := target.NetworkSettings.Networks[network]; ok && name == "" {
+			return
+		}
+		name = strings.TrimPrefix(target.Name, "/")
+		for _, b := range c.bindingsForTarget(name) {
+			log.Printf("Target container %s for service %s was disconnected from %s\n", name, b.address, network)
+			if err := c.ensureProxyFor(ctx, b); err != nil {
+				log.Println("Unable to ensure proxy container: ", err.Error())
+			}
+		}
+		return
+	}
+
+	targeted := c.bindingsForTarget(name)
+	for _, b := range targeted {
+		switch event.Action {
+		case driver.EventStart:
+			log.Printf("Target container %s for service %s started\n", name, b.address)
+			if err := c.ensureProxyFor(ctx, b); err != nil {
+				log.Println("Unable to ensure proxy container: ", err.Error())
+			}
+		case driver.EventDie:
+			log.Printf("Target container %s for service %s stopped\n", name, b.address)
+		case driver.EventDestroy:
+			log.Printf("Target container %s for service %s is missing\n", name, b.address)
+		}
+	}
+	if len(targeted) > 0 {
+		return
+	}
+
+	_, isProxy := c.bindings[name]
+	if event.Attributes[types.ComponentLabel] == types.ProxyComponentName {
+		isProxy = true
+	}
+	if isProxy && (event.Action == driver.EventDie || event.Action == driver.EventDestroy) {
+		log.Printf("Proxy container %s went away, reconciling proxies\n", name)
+		c.updateProxies(ctx)
+	}
+}
+
+func (c *Controller) subscribeEngineEvents(ctx context.Context) (<-chan driver.Event, <-chan error) {
+	filters := map[string][]string{
+		"type": {driver.EventTypeContainer, driver.EventTypeNetwork},
+	}
+	return c.vanClient.CeDriver.Events(ctx, filters)
 }
 
-func (c *Controller) runServiceDefsWatcher() {
+func (c *Controller) runServiceDefsWatcher(ctx context.Context) {
 	var watcher *fsnotify.Watcher
 
 	fmt.Println("Inservice defs watcher")
 	watcher, _ = fsnotify.NewWatcher()
 	defer watcher.Close()
 
-	err := watcher.Add("/etc/messaging/services/skupper-services")
+	err := watcher.Add(servicesFile)
 	if err != nil {
 		log.Println("Could not add directory watcher", err.Error())
 		return
 	}
 
-	c.processServiceDefs()
+	c.processServiceDefs(ctx)
 
 	for origin, _ := range c.byOrigin {
 		if origin != c.origin {
@@ -303,6 +402,9 @@ func (c *Controller) runServiceDefsWatcher() {
 		}
 	}
 
+	engineEvents, engineErrors := c.subscribeEngineEvents(ctx)
+	var resubscribe <-chan time.Time
+
 	fmt.Println("about to enter service defs watch loop")
 	for {
 		select {
@@ -311,9 +413,50 @@ func (c *Controller) runServiceDefsWatcher() {
 				return
 			}
 			if event.Op&fsnotify.Write == fsnotify.Write {
-				c.processServiceDefs()
+				c.processServiceDefs(ctx)
+			}
+		case event, ok := <-engineEvents:
+			if !ok {
+				engineEvents, engineErrors = nil, nil
+				resubscribe = time.After(5 * time.Second)
+				continue
 			}
+			c.handleEngineEvent(ctx, event)
+		case err := <-engineErrors:
+			log.Println("Lost container engine event stream: ", err.Error())
+			engineEvents, engineErrors = nil, nil
+			resubscribe = time.After(5 * time.Second)
+		case <-resubscribe:
+			resubscribe = nil
+			engineEvents, engineErrors = c.subscribeEngineEvents(ctx)
+			// catch up on anything missed while the stream was down
+			c.processServiceDefs(ctx)
+		case <-ctx.Done():
+			return
 		}
 	}
 
 }
+
+// tokenCheckInterval is how often the connections made with the site's
+// tokens are checked. It bounds how long a site with a refused token stays
+// connected after it reconnects.
+const tokenCheckInterval = 10 * time.Second
+
+// runTokenEnforcer closes the connections made with tokens the site no
+// longer accepts, the router does not know about the tokens
+func (c *Controller) runTokenEnforcer(ctx context.Context) {
+	ticker := time.NewTicker(tokenCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := c.vanClient.EnforceTokens(ctx, tokensPath, time.Now())
+			if err != nil {
+				log.Println("Failed to check token connections: ", err.Error())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/ajssmith/skupper-exp/api/types"
 	"github.com/ajssmith/skupper-exp/client"
+	"github.com/ajssmith/skupper-exp/driver"
 )
 
 func describe(i interface{}) {
@@ -38,6 +40,17 @@ func SetupSignalHandler() (stopCh <-chan struct{}) {
 	return stop
 }
 
+// stopContext returns a context that is canceled once stopCh is closed, so
+// that a shutdown aborts any in-flight container engine call
+func stopContext(stopCh <-chan struct{}) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	return ctx
+}
+
 func getTlsConfig(verify bool, cert, key, ca string) (*tls.Config, error) {
 	var config tls.Config
 	config.InsecureSkipVerify = true
@@ -66,13 +79,37 @@ func getTlsConfig(verify bool, cert, key, ca string) (*tls.Config, error) {
 	return &config, nil
 }
 
+// getEnv returns the value of the environment variable or the default
+func getEnv(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// The site's files and the router are at well known locations in the
+// controller container, a controller running as a host process is given
+// their host locations
+var (
+	configPath   = getEnv("SKUPPER_CONFIG_PATH", types.ControllerConfigPath)
+	servicesFile = getEnv("SKUPPER_SERVICES_FILE", types.ControllerConfigPath+"services/skupper-services")
+	tokensPath   = getEnv("SKUPPER_TOKENS_PATH", types.ControllerConfigPath+"tokens")
+	routerHost   = getEnv("SKUPPER_ROUTER_HOST", types.TransportDeploymentName)
+	network      = getEnv("SKUPPER_NETWORK", types.TransportNetworkName)
+)
+
 func main() {
+	// in host mode this binary also supervises the site's processes
+	if driver.RunHostSupervisor() {
+		return
+	}
+
 	var ce string
 
 	siteId := os.Getenv("SKUPPER_SITE_ID")
 	if os.Getenv("SKUPPER_CONTAINER_ENGINE") != "" {
 		ce = os.Getenv("SKUPPER_CONTAINER_ENGINE")
-		fmt.Printf("Container engine is: ", ce)
+		fmt.Println("Container engine is: ", ce)
 	} else {
 		ce = "docker"
 	}
@@ -84,15 +121,26 @@ func main() {
 		log.Fatal("Error getting new van client", err.Error())
 	}
 
-	err = cli.Init(ce)
+	engineConfig := driver.EngineConfig{
+		Endpoint:  os.Getenv("SKUPPER_CONTAINER_ENGINE_ENDPOINT"),
+		TLSCACert: os.Getenv("SKUPPER_CONTAINER_ENGINE_TLS_CACERT"),
+		TLSCert:   os.Getenv("SKUPPER_CONTAINER_ENGINE_TLS_CERT"),
+		TLSKey:    os.Getenv("SKUPPER_CONTAINER_ENGINE_TLS_KEY"),
+		PluginDir: os.Getenv("SKUPPER_PLUGIN_PATH"),
+		RPC:       os.Getenv("SKUPPER_DRIVER_RPC"),
+	}
+	err = cli.Init(stopContext(stopCh), ce, engineConfig)
 	if err != nil {
 		log.Fatal("Error van client init", err.Error())
 	}
 
-	tlsConfig, err := getTlsConfig(true, types.ControllerConfigPath+"tls.crt", types.ControllerConfigPath+"tls.key", types.ControllerConfigPath+"ca.crt")
+	tlsConfig, err := getTlsConfig(true, configPath+"tls.crt", configPath+"tls.key", configPath+"ca.crt")
 	if err != nil {
 		log.Fatal("Error getting tls config: ", err.Error())
 	}
+	// the router's certificate is issued for its container name whatever
+	// host it is reached at
+	tlsConfig.ServerName = types.TransportDeploymentName
 
 	controller, err := NewController(cli, siteId, tlsConfig)
 	if err != nil {
@@ -138,17 +138,18 @@ func (c *Controller) ensureServiceInterfaceDefinitions(origin string, serviceInt
 	}
 }
 
-func (c *Controller) syncSender(sendLocal chan bool) {
+func (c *Controller) syncSender(ctx context.Context, sendLocal chan bool) {
 	var request amqp.Message
 	var properties amqp.MessageProperties
 
-	ctx := context.Background()
 	sender, err := c.amqpSession.NewSender(amqp.LinkTargetAddress(types.ServiceSyncAddress))
 	if err != nil {
 		log.Fatal("Failed to create sender: ", err.Error())
 	}
 	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		sender.Close(ctx)
+		cancel()
 	}()
 
 	tickerSend := time.NewTicker(5 * time.Second)
@@ -161,6 +162,8 @@ func (c *Controller) syncSender(sendLocal chan bool) {
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-tickerSend.C:
 			local := make([]types.ServiceInterface, 0)
 
@@ -211,12 +214,11 @@ func (c *Controller) syncSender(sendLocal chan bool) {
 	}
 }
 
-func (c *Controller) runServiceSync() error {
-	ctx := context.Background()
+func (c *Controller) runServiceSync(ctx context.Context) error {
 
 	log.Println("Establishing connection to skupper-messaging service for service sync")
 
-	client, err := amqp.Dial("amqps://skupper-router:5671", amqp.ConnSASLExternal(), amqp.ConnMaxFrameSize(4294967295), amqp.ConnTLSConfig(c.tlsConfig))
+	client, err := amqp.Dial("amqps://"+routerHost+":5671", amqp.ConnSASLExternal(), amqp.ConnMaxFrameSize(4294967295), amqp.ConnTLSConfig(c.tlsConfig))
 	if err != nil {
 		return fmt.Errorf("Failed to create amqp connection: %w", err)
 	}
@@ -237,13 +239,13 @@ func (c *Controller) runServiceSync() error {
 		return fmt.Errorf("Failed to create amqp receiver: %w", err)
 	}
 	defer func() {
-		ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		receiver.Close(ctx)
 		cancel()
 	}()
 
 	sendLocal := make(chan bool)
-	go c.syncSender(sendLocal)
+	go c.syncSender(ctx, sendLocal)
 
 	for {
 		var ok bool
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ajssmith/skupper-exp/api/types"
 	"github.com/ajssmith/skupper-exp/client"
+	"github.com/ajssmith/skupper-exp/driver"
 	"github.com/spf13/cobra"
 )
 
@@ -66,10 +71,10 @@ func parseTargetTypeAndName(args []string) (string, string) {
 	return targetType, targetName
 }
 
-func expose(cli types.VanClientInterface, targetType string, targetName string, options types.ServiceInterfaceCreateOptions) error {
+func expose(ctx context.Context, cli types.VanClientInterface, targetType string, targetName string, options types.ServiceInterfaceCreateOptions) error {
 	serviceName := options.Address
 
-	service, err := cli.ServiceInterfaceInspect(serviceName)
+	service, err := cli.ServiceInterfaceInspect(ctx, serviceName)
 	if err != nil {
 		return err
 	}
@@ -86,7 +91,7 @@ func expose(cli types.VanClientInterface, targetType string, targetName string,
 
 	// service may exist from remote origin
 	service.Origin = ""
-	err = cli.ServiceInterfaceBind(service, targetType, targetName, options.Protocol, options.TargetPort)
+	err = cli.ServiceInterfaceBind(ctx, service, targetType, targetName, options.Protocol, options.TargetPort)
 
 	if err != nil {
 		return fmt.Errorf("Unable to create skupper service: %w", err)
@@ -172,7 +177,14 @@ installation that can then be connected to other skupper installations`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
 
-			err := cli.RouterCreate(routerCreateOpts)
+			if cliMode == driver.HostDriverName {
+				// the router and controller are host processes
+				if routerCreateOpts.ContainerEngineDriver != "" && routerCreateOpts.ContainerEngineDriver != driver.HostDriverName {
+					return fmt.Errorf("--ce-driver is not valid in host mode")
+				}
+				routerCreateOpts.ContainerEngineDriver = driver.HostDriverName
+			}
+			err := cli.RouterCreate(cmd.Context(), routerCreateOpts)
 			if err != nil {
 				return err
 			}
@@ -190,7 +202,23 @@ installation that can then be connected to other skupper installations`,
 	cmd.Flags().StringVarP(&routerCreateOpts.User, "console-user", "", "", "Router console user. Valid only when --console-auth=internal")
 	cmd.Flags().StringVarP(&routerCreateOpts.Password, "console-password", "", "", "Skupper console user. Valid only when --router-console-auth=internal")
 	cmd.Flags().BoolVarP(&routerCreateOpts.MapToHost, "publish-to-host", "", false, "Port map services to host")
-	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineDriver, "ce-driver", "", "docker", "Container Engine driver. One of: 'docker', 'podman'")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineDriver, "ce-driver", "", "", "Container Engine driver. One of: 'docker', 'podman' (default detected from the running engines)")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineEndpoint, "ce-endpoint", "", "", "Container Engine endpoint, e.g. unix:///run/podman/podman.sock or tcp://host:2376 (default detected)")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineTLSCACert, "ce-tls-cacert", "", "", "CA certificate to verify the Container Engine endpoint")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineTLSCert, "ce-tls-cert", "", "", "Client certificate for the Container Engine endpoint")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineTLSKey, "ce-tls-key", "", "", "Client key for the Container Engine endpoint")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEnginePluginDir, "ce-plugin-dir", "", "", "Directory to load the Container Engine driver plugin <ce-driver>.so from (default $SKUPPER_PLUGIN_PATH, or the built-in drivers)")
+	cmd.Flags().StringVarP(&routerCreateOpts.ContainerEngineDriverRPC, "ce-driver-rpc", "", "", "Run the Container Engine driver out of process, either unix://<socket> of a running driver or the command line of a driver executable (default $SKUPPER_DRIVER_RPC)")
+	cmd.Flags().StringVarP(&routerCreateOpts.ImagePullPolicy, "image-pull-policy", "", "IfNotPresent", "Image pull policy for the router, controller and proxies. One of: 'Always', 'IfNotPresent', 'Never'")
+	cmd.Flags().StringVarP(&routerCreateOpts.RegistryAuthFile, "registry-auth-file", "", "", "Registry credentials in docker config.json or containers auth.json format (default searches the standard locations)")
+	cmd.Flags().StringVarP(&routerCreateOpts.RegistryUser, "registry-user", "", "", "Registry user for pulling images")
+	cmd.Flags().StringVarP(&routerCreateOpts.RegistryPassword, "registry-password", "", "", "Registry password for pulling images. Valid only with --registry-user")
+	cmd.Flags().StringVarP(&routerCreateOpts.NetworkName, "network-name", "", types.TransportNetworkName, "The container network of the site")
+	cmd.Flags().StringVarP(&routerCreateOpts.NetworkSubnet, "network-subnet", "", "", "Subnet of the site's network in CIDR notation, e.g. 10.99.0.0/24 (default picked by the container engine)")
+	cmd.Flags().StringSliceVarP(&routerCreateOpts.IngressHosts, "ingress-host", "", []string{}, "Host name or IP address other hosts reach the site at, repeat it for several addresses tried in order. Publishes the inter-router and edge listeners on the host")
+	cmd.Flags().IntVarP(&routerCreateOpts.IngressPort, "ingress-port", "", 0, "Host port the inter-router listener is published on, valid only with --ingress-host (default 55671)")
+	cmd.Flags().BoolVarP(&routerCreateOpts.Force, "force", "", false, "Remove an existing skupper installation and initialise a new one")
+	cmd.Flags().BoolVarP(&routerCreateOpts.Reconcile, "reconcile", "", false, "Update an existing skupper installation to the given options, keeping its identity, certificates, connections and services")
 	cmd.Flags().BoolVarP(&routerCreateOpts.TraceLog, "enable-trace-log", "", false, "Enable router trace log")
 	cmd.Flags().MarkHidden("enable-trace-log")
 
@@ -206,7 +234,7 @@ func NewCmdDelete(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			errors := cli.RouterRemove()
+			errors := cli.RouterRemove(cmd.Context())
 			if len(errors) > 0 {
 				fmt.Println("Error(s) encountered removing skupper resources:")
 				for _, err := range errors {
@@ -223,6 +251,7 @@ func NewCmdDelete(newClient cobraFunc) *cobra.Command {
 }
 
 var clientIdentity string
+var connectorTokenCreateOpts types.ConnectorTokenCreateOptions
 
 func NewCmdConnectionToken(newClient cobraFunc) *cobra.Command {
 	cmd := &cobra.Command{
@@ -232,35 +261,166 @@ func NewCmdConnectionToken(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			err := cli.ConnectorTokenCreate(clientIdentity, args[0])
+			name, err := cli.ConnectorTokenCreate(cmd.Context(), clientIdentity, args[0], connectorTokenCreateOpts)
 			if err != nil {
 				return fmt.Errorf("Failed to create connection token: %w", err)
 			}
+			fmt.Printf("Token %s issued, 'token revoke %s' invalidates it\n", name, name)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&clientIdentity, "client-identity", "i", "", "Provide a specific identity as which connecting skupper installation will be authenticated, it names the token (default a generated name)")
+	cmd.Flags().StringSliceVarP(&connectorTokenCreateOpts.IngressHosts, "ingress-host", "", []string{}, "Host name or IP address the connecting site reaches this site at, repeat it for several addresses tried in order (default the site's ingress)")
+	cmd.Flags().IntVarP(&connectorTokenCreateOpts.IngressPort, "ingress-port", "", 0, "Port the connecting site reaches the inter-router listener at (default the site's ingress port)")
+	cmd.Flags().BoolVarP(&connectorTokenCreateOpts.EdgeOnly, "edge-only", "", false, "Only allow edge sites to connect with the token")
+	cmd.Flags().DurationVarP(&connectorTokenCreateOpts.Expiry, "expiry", "", 0, "Refuse sites that connect with the token for the first time after this long, e.g. 15m or 24h (default never)")
+	cmd.Flags().IntVarP(&connectorTokenCreateOpts.Uses, "uses", "", 0, "Number of sites that can connect with the token (default any number)")
+
+	return cmd
+}
+
+func NewCmdToken() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token list, token revoke <name> or token serve",
+		Short: "Manage the connection tokens issued by this site",
+	}
+	return cmd
+}
+
+func NewCmdListTokens(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "list",
+		Short:  "List the connection tokens issued by this site and the sites that connected with them",
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			tokens, err := cli.TokenList(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("Unable to retrieve tokens: %w", err)
+			}
+			if len(tokens) == 0 {
+				fmt.Println("No tokens were issued.")
+				return nil
+			}
+			fmt.Println("Tokens:")
+			for _, t := range tokens {
+				expiry := "never expires"
+				if !t.Token.Expiry.IsZero() {
+					expiry = "expires " + t.Token.Expiry.Local().Format(time.RFC1123)
+				}
+				uses := "any number of uses"
+				if t.Token.Uses > 0 {
+					uses = fmt.Sprintf("%d of %d uses", len(t.Redemptions), t.Token.Uses)
+				}
+				fmt.Printf("    %s (%s, %s, %s)", t.Token.Name, t.Status, expiry, uses)
+				fmt.Println()
+				for _, r := range t.Redemptions {
+					fmt.Printf("        used by %s at %s", r.Site, r.Time.Local().Format(time.RFC1123))
+					fmt.Println()
+				}
+			}
 			return nil
 		},
 	}
-	cmd.Flags().StringVarP(&clientIdentity, "client-identity", "i", "skupper", "Provide a specific identity as which connecting skupper installation will be authenticated")
+	return cmd
+}
+
+func NewCmdRevokeToken(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke <name>",
+		Short: "Refuse a connection token to all sites and close their connections",
+		Long: `revoke refuses a connection token to all sites and closes their connections.
+A site that connects again with the token is closed by the next check of the
+service controller, every 10 seconds.`,
+		Args:   cobra.ExactArgs(1),
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			err := cli.TokenRevoke(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("Failed to revoke token: %w", err)
+			}
+			fmt.Printf("Token %s revoked\n", args[0])
+			return nil
+		},
+	}
+	return cmd
+}
+
+var tokenServeOpts types.TokenServeOptions
+
+func NewCmdServeToken(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "serve",
+		Short:  "Hand out a connection token to the first site that claims it with a one-time password, instead of copying a token file",
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			name, err := cli.TokenServe(cmd.Context(), tokenServeOpts, func(claim types.TokenClaim) {
+				fmt.Println("Connect another site to this one with:")
+				fmt.Printf("    skupper-exp connect --claim %s --password %s", claim.URL, claim.Password)
+				fmt.Println()
+				fmt.Printf("Waiting up to %s for the token to be claimed", tokenServeOpts.Timeout)
+				fmt.Println()
+			})
+			if err != nil {
+				return fmt.Errorf("Failed to serve connection token: %w", err)
+			}
+			fmt.Printf("Token %s claimed\n", name)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&tokenServeOpts.Host, "host", "", "", "Host name or IP address the claiming site reaches this host at (default the site's first ingress host or the host name)")
+	cmd.Flags().IntVarP(&tokenServeOpts.Port, "port", "", types.ClaimDefaultPort, "Port to serve the claim at")
+	cmd.Flags().StringVarP(&tokenServeOpts.Password, "password", "", "", "Password the token is claimed with (default a generated one)")
+	cmd.Flags().DurationVarP(&tokenServeOpts.Timeout, "timeout", "", types.ClaimDefaultTimeout, "How long to wait for the token to be claimed, it is revoked after")
+	cmd.Flags().BoolVarP(&tokenServeOpts.Token.EdgeOnly, "edge-only", "", false, "Only allow edge sites to connect with the token")
+	cmd.Flags().DurationVarP(&tokenServeOpts.Token.Expiry, "expiry", "", 0, "Refuse the claiming site if it has not connected after this long, e.g. 15m (default never)")
 
 	return cmd
 }
 
 var connectorCreateOpts types.ConnectorCreateOptions
+var tokenClaim types.TokenClaim
+
+func connectArgs(cmd *cobra.Command, args []string) error {
+	if tokenClaim.URL != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("A token file cannot be given with --claim")
+		}
+		if tokenClaim.Password == "" {
+			return fmt.Errorf("--claim requires --password")
+		}
+		return nil
+	}
+	if tokenClaim.Password != "" {
+		return fmt.Errorf("--password only valid with --claim")
+	}
+	return cobra.ExactArgs(1)(cmd, args)
+}
 
 func NewCmdConnect(newClient cobraFunc) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:    "connect <connection-token-file>",
+		Use:    "connect <connection-token-file> or connect --claim <url> --password <password>",
 		Short:  "Connect this skupper installation to that which issued the specified connectionToken",
-		Args:   cobra.ExactArgs(1),
+		Args:   connectArgs,
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
 
-			_, err := cli.SiteConfigInspect(types.DefaultBridgeName)
+			_, err := cli.SiteConfigInspect(cmd.Context(), types.DefaultBridgeName)
 			if err != nil {
 				return fmt.Errorf("Unable to retrieve site config: %w", err)
 			}
 
-			name, err := cli.ConnectorCreate(args[0], connectorCreateOpts)
+			var name string
+			if tokenClaim.URL != "" {
+				name, err = cli.ConnectorClaim(cmd.Context(), tokenClaim, connectorCreateOpts)
+			} else {
+				name, err = cli.ConnectorCreate(cmd.Context(), args[0], connectorCreateOpts)
+			}
 			if err != nil {
 				return fmt.Errorf("Failed to create connection: %w", err)
 			}
@@ -270,6 +430,8 @@ func NewCmdConnect(newClient cobraFunc) *cobra.Command {
 	}
 	cmd.Flags().StringVarP(&connectorCreateOpts.Name, "connection-name", "", "", "Provide a specific name for the connection (used when removing it with disconnect)")
 	cmd.Flags().Int32VarP(&connectorCreateOpts.Cost, "cost", "", 1, "Specify a cost for this connection.")
+	cmd.Flags().StringVarP(&tokenClaim.URL, "claim", "", "", "URL 'token serve' printed, with the fingerprint of the endpoint's certificate, to claim the token from")
+	cmd.Flags().StringVarP(&tokenClaim.Password, "password", "", "", "One-time password of the claim")
 
 	return cmd
 }
@@ -282,7 +444,7 @@ func NewCmdDisconnect(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			err := cli.ConnectorRemove(args[0])
+			err := cli.ConnectorRemove(cmd.Context(), args[0])
 			if err != nil {
 				return fmt.Errorf("Failed to remove connection: %w", err)
 			}
@@ -302,7 +464,7 @@ func NewCmdListConnectors(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			connectors, err := cli.ConnectorList()
+			connectors, err := cli.ConnectorList(cmd.Context())
 			if err == nil {
 				if len(connectors) == 0 {
 					fmt.Println("There are no connectors defined.")
@@ -337,7 +499,7 @@ func NewCmdCheckConnection(newClient cobraFunc) *cobra.Command {
 			connected := 0
 
 			if args[0] == "all" {
-				vcis, err := cli.ConnectorList()
+				vcis, err := cli.ConnectorList(cmd.Context())
 				if err == nil {
 					for _, vci := range vcis {
 						connectors = append(connectors, &types.ConnectorInspectResponse{
@@ -347,7 +509,7 @@ func NewCmdCheckConnection(newClient cobraFunc) *cobra.Command {
 					}
 				}
 			} else {
-				vci, err := cli.ConnectorInspect(args[0])
+				vci, err := cli.ConnectorInspect(cmd.Context(), args[0])
 				if err == nil {
 					connectors = append(connectors, vci)
 					if vci.Connected {
@@ -358,7 +520,7 @@ func NewCmdCheckConnection(newClient cobraFunc) *cobra.Command {
 
 			for i := 0; connected < len(connectors) && i < waitFor; i++ {
 				for _, c := range connectors {
-					vci, err := cli.ConnectorInspect(c.Connector.Name)
+					vci, err := cli.ConnectorInspect(cmd.Context(), c.Connector.Name)
 					if err == nil && vci.Connected && c.Connected == false {
 						c.Connected = true
 						connected++
@@ -401,7 +563,7 @@ func NewCmdStatus(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			vir, err := cli.RouterInspect()
+			vir, err := cli.RouterInspect(cmd.Context())
 			if err == nil {
 				var modedesc string = " in interior mode"
 				if vir.Status.Mode == types.TransportModeEdge {
@@ -410,6 +572,8 @@ func NewCmdStatus(newClient cobraFunc) *cobra.Command {
 				fmt.Printf("Skupper is enabled %s'.", modedesc)
 				if vir.Status.State != "running" {
 					fmt.Printf(" Status %s...", vir.Status.State)
+				} else if vir.Status.Health != "" && vir.Status.Health != driver.HealthHealthy {
+					fmt.Printf(" Status %s, router %s...", vir.Status.State, vir.Status.Health)
 				} else {
 					if len(vir.Status.ConnectedSites.Warnings) > 0 {
 						for _, w := range vir.Status.ConnectedSites.Warnings {
@@ -427,6 +591,14 @@ func NewCmdStatus(newClient cobraFunc) *cobra.Command {
 						fmt.Printf(" It is connected to %d other sites (%d indirectly).", vir.Status.ConnectedSites.Total, vir.Status.ConnectedSites.Indirect)
 					}
 				}
+				if len(vir.VersionSkew) == 1 {
+					fmt.Printf(" 1 component is not running the site's images, see 'skupper-exp version'.")
+				} else if len(vir.VersionSkew) > 1 {
+					fmt.Printf(" %d components are not running the site's images, see 'skupper-exp version'.", len(vir.VersionSkew))
+				}
+				if len(vir.OverdueRotations) > 0 {
+					fmt.Printf(" The rotation of %s is past its overlap, complete it with 'skupper-exp rotate-certs --complete'.", strings.Join(vir.OverdueRotations, ", "))
+				}
 				if vir.ExposedServices == 0 {
 					fmt.Printf(" It has no exposed services.")
 				} else if vir.ExposedServices == 1 {
@@ -436,6 +608,8 @@ func NewCmdStatus(newClient cobraFunc) *cobra.Command {
 				}
 				//TODO: provide console url
 				fmt.Println()
+			} else if errors.Is(err, os.ErrNotExist) || errors.Is(err, driver.ErrNotFound) {
+				fmt.Println("Skupper is not enabled")
 			} else {
 				return fmt.Errorf("Unable to retrieve skupper status: %w", err)
 			}
@@ -465,7 +639,7 @@ func NewCmdExpose(newClient cobraFunc) *cobra.Command {
 				exposeOpts.Address = targetName
 			}
 
-			err := expose(cli, targetType, targetName, exposeOpts)
+			err := expose(cmd.Context(), cli, targetType, targetName, exposeOpts)
 			if err == nil {
 				fmt.Printf("%s %s exposed as %s\n", targetType, targetName, exposeOpts.Address)
 			}
@@ -497,7 +671,7 @@ func NewCmdUnexpose(newClient cobraFunc) *cobra.Command {
 				return fmt.Errorf("Unexpose host-service must specify address, use --address option to provide it")
 			}
 
-			err := cli.ServiceInterfaceUnbind(targetType, targetName, unexposeAddress, true)
+			err := cli.ServiceInterfaceUnbind(cmd.Context(), targetType, targetName, unexposeAddress, true)
 			if err == nil {
 				fmt.Printf("%s %s unexposed\n", targetType, targetName)
 			} else {
@@ -519,7 +693,7 @@ func NewCmdListExposed(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			vsis, err := cli.ServiceInterfaceList()
+			vsis, err := cli.ServiceInterfaceList(cmd.Context())
 			if err == nil {
 				if len(vsis) == 0 {
 					fmt.Println("No service interfaces defined")
@@ -591,7 +765,7 @@ func NewCmdCreateService(newClient cobraFunc) *cobra.Command {
 				return fmt.Errorf("%s is not a valid port", sPort)
 			} else {
 				serviceToCreate.Port = servicePort
-				err = cli.ServiceInterfaceCreate(&serviceToCreate)
+				err = cli.ServiceInterfaceCreate(cmd.Context(), &serviceToCreate)
 				if err != nil {
 					return fmt.Errorf("%w", err)
 				}
@@ -614,7 +788,7 @@ func NewCmdDeleteService(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			err := cli.ServiceInterfaceRemove(args[0])
+			err := cli.ServiceInterfaceRemove(cmd.Context(), args[0])
 			if err != nil {
 				return fmt.Errorf("%w", err)
 			}
@@ -640,14 +814,14 @@ func NewCmdBind(newClient cobraFunc) *cobra.Command {
 			} else {
 				targetType, targetName := parseTargetTypeAndName(args[1:])
 
-				service, err := cli.ServiceInterfaceInspect(args[0])
+				service, err := cli.ServiceInterfaceInspect(cmd.Context(), args[0])
 
 				if err != nil {
 					return fmt.Errorf("%w", err)
 				} else if service == nil {
 					return fmt.Errorf("Service %s not found", args[0])
 				} else {
-					err = cli.ServiceInterfaceBind(service, targetType, targetName, protocol, targetPort)
+					err = cli.ServiceInterfaceBind(cmd.Context(), service, targetType, targetName, protocol, targetPort)
 					if err != nil {
 						return fmt.Errorf("%w", err)
 					}
@@ -673,7 +847,7 @@ func NewCmdUnbind(newClient cobraFunc) *cobra.Command {
 
 			targetType, targetName := parseTargetTypeAndName(args[1:])
 
-			err := cli.ServiceInterfaceUnbind(targetType, targetName, args[0], false)
+			err := cli.ServiceInterfaceUnbind(cmd.Context(), targetType, targetName, args[0], false)
 			if err != nil {
 				return fmt.Errorf("%w", err)
 			}
@@ -683,6 +857,177 @@ func NewCmdUnbind(newClient cobraFunc) *cobra.Command {
 	return cmd
 }
 
+var routerUpdateOpts types.SiteConfigSpec
+
+func NewCmdUpdate(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Change the settings of the skupper installation",
+		Long: `update applies the given settings to the skupper installation, the others
+are kept. Only the router and controller affected by the change are restarted,
+the certificates, connections and services of the installation are kept.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			sc, err := cli.SiteConfigInspect(cmd.Context(), types.DefaultBridgeName)
+			if err != nil {
+				return fmt.Errorf("Unable to retrieve site config (need init?): %w", err)
+			}
+			options := sc.Spec
+			flags := cmd.Flags()
+			if flags.Changed("id") {
+				options.SkupperName = routerUpdateOpts.SkupperName
+			}
+			if flags.Changed("edge") {
+				options.IsEdge = routerUpdateOpts.IsEdge
+			}
+			if flags.Changed("enable-router-console") {
+				options.EnableRouterConsole = routerUpdateOpts.EnableRouterConsole
+			}
+			if flags.Changed("enable-console") {
+				options.EnableConsole = routerUpdateOpts.EnableConsole
+			}
+			if flags.Changed("console-auth") {
+				options.AuthMode = routerUpdateOpts.AuthMode
+				if options.AuthMode != string(types.ConsoleAuthModeInternal) {
+					// the console users only go with internal auth
+					options.User = ""
+					options.Password = ""
+				}
+			}
+			if flags.Changed("console-user") {
+				options.User = routerUpdateOpts.User
+			}
+			if flags.Changed("console-password") {
+				options.Password = routerUpdateOpts.Password
+			}
+			if flags.Changed("publish-to-host") {
+				options.MapToHost = routerUpdateOpts.MapToHost
+			}
+			if flags.Changed("ingress-host") {
+				options.IngressHosts = routerUpdateOpts.IngressHosts
+			}
+			if flags.Changed("ingress-port") {
+				options.IngressPort = routerUpdateOpts.IngressPort
+			}
+			if flags.Changed("image-pull-policy") {
+				options.ImagePullPolicy = routerUpdateOpts.ImagePullPolicy
+			}
+			if flags.Changed("enable-trace-log") {
+				options.TraceLog = routerUpdateOpts.TraceLog
+			}
+			updated, err := cli.RouterUpdate(cmd.Context(), options)
+			if err != nil {
+				return fmt.Errorf("Failed to update skupper: %w", err)
+			}
+			if updated {
+				fmt.Println("Skupper is now updated.  Use 'skupper-exp status' to get more information.")
+			} else {
+				fmt.Println("Skupper already has these settings, nothing to update.")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&routerUpdateOpts.SkupperName, "id", "", "", "Provide a specific identity for the skupper installation")
+	cmd.Flags().BoolVarP(&routerUpdateOpts.IsEdge, "edge", "", false, "Configure as an edge")
+	cmd.Flags().BoolVarP(&routerUpdateOpts.EnableRouterConsole, "enable-router-console", "", false, "Enable router console")
+	cmd.Flags().BoolVarP(&routerUpdateOpts.EnableConsole, "enable-console", "", false, "Enable skupper console")
+	cmd.Flags().StringVarP(&routerUpdateOpts.AuthMode, "console-auth", "", "", "Authentication mode for console(s). One of: 'internal', 'unsecured'")
+	cmd.Flags().StringVarP(&routerUpdateOpts.User, "console-user", "", "", "Router console user. Valid only when --console-auth=internal")
+	cmd.Flags().StringVarP(&routerUpdateOpts.Password, "console-password", "", "", "Skupper console user. Valid only when --router-console-auth=internal")
+	cmd.Flags().BoolVarP(&routerUpdateOpts.MapToHost, "publish-to-host", "", false, "Port map services to host")
+	cmd.Flags().StringSliceVarP(&routerUpdateOpts.IngressHosts, "ingress-host", "", []string{}, "Host name or IP address other hosts reach the site at, repeat it for several addresses tried in order. Publishes the inter-router and edge listeners on the host")
+	cmd.Flags().IntVarP(&routerUpdateOpts.IngressPort, "ingress-port", "", 0, "Host port the inter-router listener is published on, valid only with --ingress-host (default 55671)")
+	cmd.Flags().StringVarP(&routerUpdateOpts.ImagePullPolicy, "image-pull-policy", "", "IfNotPresent", "Image pull policy for the router, controller and proxies. One of: 'Always', 'IfNotPresent', 'Never'")
+	cmd.Flags().BoolVarP(&routerUpdateOpts.TraceLog, "enable-trace-log", "", false, "Enable router trace log")
+	cmd.Flags().MarkHidden("enable-trace-log")
+
+	return cmd
+}
+
+var routerUpgradeOpts types.RouterUpgradeOptions
+
+func NewCmdUpgrade(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade the router, controller and proxies of the skupper installation to new images",
+		Long: `upgrade pulls the router and controller images and recreates the router, the
+controller and the proxies one at a time, keeping the certificates, connections
+and services of the installation`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			err := cli.RouterUpgrade(cmd.Context(), routerUpgradeOpts)
+			if err != nil {
+				return fmt.Errorf("Failed to upgrade skupper: %w", err)
+			}
+			fmt.Println("Skupper is now upgraded.  Use 'skupper-exp version' to get more information.")
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&routerUpgradeOpts.TransportImage, "router-image", "", "", "The router image to upgrade to (default $QDROUTERD_IMAGE or "+types.DefaultTransportImage+")")
+	cmd.Flags().StringVarP(&routerUpgradeOpts.ControllerImage, "controller-image", "", "", "The controller image to upgrade to (default $SKUPPER_CONTROLLER_IMAGE or "+types.DefaultControllerImage+")")
+	cmd.Flags().StringVarP(&routerUpgradeOpts.ImagePullPolicy, "image-pull-policy", "", "Always", "Image pull policy for the new images. One of: 'Always', 'IfNotPresent', 'Never'")
+
+	return cmd
+}
+
+var certRotateOpts types.CertRotateOptions
+
+func NewCmdRotateCerts(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate-certs",
+		Short: "Issue the certificates of the skupper installation again",
+		Long: `rotate-certs issues the selected credentials again, all of them when none is
+selected, and replaces the selected CAs along with the credentials they issued,
+then restarts the router, the controller and the proxies. With --overlap the
+previous CA stays trusted until 'rotate-certs --complete', so the remote sites
+connected with earlier tokens keep connecting until they have new ones. The
+rotation is not completed when the overlap ends, 'status' tells it is overdue.`,
+		Args:   cobra.NoArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			response, err := cli.RotateCerts(cmd.Context(), certRotateOpts)
+			if err != nil {
+				return fmt.Errorf("Failed to rotate certificates: %w", err)
+			}
+			if len(response.Rotated) > 0 {
+				fmt.Printf("Rotated %s", strings.Join(response.Rotated, ", "))
+				fmt.Println()
+			}
+			if !response.OverlapEnds.IsZero() {
+				fmt.Printf("The previous CA stays trusted until you run 'skupper-exp rotate-certs --complete', after %s", response.OverlapEnds.Local().Format(time.RFC1123))
+				fmt.Println()
+			}
+			if len(response.StaleTokens) > 0 || len(response.Sites) > 0 {
+				when := "now"
+				if !response.OverlapEnds.IsZero() {
+					when = "once the rotation is complete"
+				}
+				fmt.Printf("Tokens that stop working %s: %s", when, strings.Join(response.StaleTokens, ", "))
+				fmt.Println()
+				if len(response.Sites) > 0 {
+					fmt.Println("Sites that need a new token:")
+					for _, site := range response.Sites {
+						fmt.Printf("    %s", site)
+						fmt.Println()
+					}
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVarP(&certRotateOpts.Credentials, "credential", "", []string{}, "Credential to issue again, repeat it for several (default all of them without --ca)")
+	cmd.Flags().StringSliceVarP(&certRotateOpts.CAs, "ca", "", []string{}, "CA to replace along with the credentials it issued, repeat it for several")
+	cmd.Flags().DurationVarP(&certRotateOpts.Overlap, "overlap", "", 0, "How long the previous CA should stay trusted, e.g. 72h, 'status' tells when it is over (default replaced right away)")
+	cmd.Flags().BoolVarP(&certRotateOpts.Complete, "complete", "", false, "Stop trusting the CAs replaced with --overlap")
+
+	return cmd
+}
+
 func NewCmdVersion(newClient cobraFunc) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:    "version",
@@ -691,11 +1036,14 @@ func NewCmdVersion(newClient cobraFunc) *cobra.Command {
 		PreRun: newClient,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			silenceCobra(cmd)
-			vir, err := cli.RouterInspect()
+			vir, err := cli.RouterInspect(cmd.Context())
 			fmt.Printf("%-30s %s\n", "client version", version)
 			if err == nil {
 				fmt.Printf("%-30s %s\n", "transport version", vir.TransportVersion)
 				fmt.Printf("%-30s %s\n", "controller version", vir.ControllerVersion)
+				for _, skew := range vir.VersionSkew {
+					fmt.Printf("%-30s %s\n", "version skew", skew)
+				}
 			} else {
 				return fmt.Errorf("Unable to retrieve skupper component versions: %w", err)
 			}
@@ -705,6 +1053,52 @@ func NewCmdVersion(newClient cobraFunc) *cobra.Command {
 	return cmd
 }
 
+func logsArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("component must be specified (e.g. 'skupper-exp logs router')")
+	}
+	if args[0] == types.ProxyComponentName {
+		if len(args) < 2 {
+			return fmt.Errorf("address must be specified for proxy logs (e.g. 'skupper-exp logs proxy <address>')")
+		}
+		if len(args) > 2 {
+			return fmt.Errorf("illegal argument: %s", args[2])
+		}
+	} else if len(args) > 1 {
+		return fmt.Errorf("illegal argument: %s", args[1])
+	}
+	return nil
+}
+
+var logsOpts types.ComponentLogsOptions
+
+func NewCmdLogs(newClient cobraFunc) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "logs [router|controller|proxy <address>]",
+		Short:  "Print the logs of a skupper component",
+		Args:   logsArgs,
+		PreRun: newClient,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			silenceCobra(cmd)
+			address := ""
+			if len(args) > 1 {
+				address = args[1]
+			}
+			err := cli.ComponentLogs(cmd.Context(), args[0], address, logsOpts, os.Stdout, os.Stderr)
+			if err != nil {
+				return fmt.Errorf("Unable to retrieve logs: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&logsOpts.Follow, "follow", "f", false, "Follow log output")
+	cmd.Flags().StringVar(&logsOpts.Since, "since", "", "Show logs since timestamp (e.g. 2013-01-02T13:23:37) or relative (e.g. 42m for 42 minutes)")
+	cmd.Flags().StringVar(&logsOpts.Tail, "tail", "all", "Number of lines to show from the end of the logs")
+	cmd.Flags().BoolVarP(&logsOpts.Timestamps, "timestamps", "t", false, "Show timestamps")
+
+	return cmd
+}
+
 type cobraFunc func(cmd *cobra.Command, args []string)
 
 func newClient(cmd *cobra.Command, args []string) {
@@ -721,6 +1115,12 @@ func init() {
 	rootCmd = &cobra.Command{Use: "skupper-docker"}
 	rootCmd.PersistentFlags().StringVarP(&cliMode, "mode", "m", "container-engine", "Skupper mode one of: host, container-engine")
 	rootCmd.Version = version
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if cliMode != driver.HostDriverName && cliMode != "container-engine" {
+			return fmt.Errorf("%s is not a valid mode. Choose 'host' or 'container-engine'.", cliMode)
+		}
+		return nil
+	}
 
 	cmdInit := NewCmdInit(newClient)
 	cmdDelete := NewCmdDelete(newClient)
@@ -738,14 +1138,24 @@ func init() {
 	cmdBind := NewCmdBind(newClient)
 	cmdUnbind := NewCmdUnbind(newClient)
 	cmdVersion := NewCmdVersion(newClient)
+	cmdUpdate := NewCmdUpdate(newClient)
+	cmdUpgrade := NewCmdUpgrade(newClient)
+	cmdRotateCerts := NewCmdRotateCerts(newClient)
+	cmdLogs := NewCmdLogs(newClient)
 
 	cmdService := NewCmdService()
 	cmdService.AddCommand(cmdCreateService)
 	cmdService.AddCommand(cmdDeleteService)
 
+	cmdToken := NewCmdToken()
+	cmdToken.AddCommand(NewCmdListTokens(newClient))
+	cmdToken.AddCommand(NewCmdRevokeToken(newClient))
+	cmdToken.AddCommand(NewCmdServeToken(newClient))
+
 	rootCmd.AddCommand(cmdInit,
 		cmdDelete,
 		cmdConnectionToken,
+		cmdToken,
 		cmdConnect,
 		cmdDisconnect,
 		cmdListConnectors,
@@ -757,15 +1167,36 @@ func init() {
 		cmdService,
 		cmdBind,
 		cmdUnbind,
-		cmdVersion)
+		cmdVersion,
+		cmdUpdate,
+		cmdUpgrade,
+		cmdRotateCerts,
+		cmdLogs)
 }
 
 func main() {
+	// in host mode this binary also supervises the site's processes
+	if driver.RunHostSupervisor() {
+		return
+	}
+
 	if _, ok := os.LookupEnv("SKUPPER_TMPDIR"); !ok {
 		os.Setenv("SKUPPER_TMPDIR", "/var/tmp")
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	// cancel any in-flight engine call on Ctrl-C, a second signal
+	// terminates the process as usual
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		cancel()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		os.Exit(1)
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -20,6 +21,7 @@ import (
 	"github.com/docker/docker/api/types/network"
 	dockernetworktypes "github.com/docker/docker/api/types/network"
 	dockerapi "github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	dockermessage "github.com/docker/docker/pkg/jsonmessage"
 	dockerstdcopy "github.com/docker/docker/pkg/stdcopy"
 
@@ -52,8 +54,8 @@ type ImageNotFoundError struct {
 
 var DockerDriver dockerClient
 
-func getTimeoutContext(d *dockerClient) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), d.timeout)
+func getTimeoutContext(ctx context.Context, d *dockerClient) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d.timeout)
 }
 
 func newDockerContainerSpec(options ContainerCreateOptions) *dockertypes.ContainerCreateConfig {
@@ -68,31 +70,53 @@ func newDockerContainerSpec(options ContainerCreateOptions) *dockertypes.Contain
 	}
 
 	endpoints := make(map[string]*dockernetworktypes.EndpointSettings)
-	for i := range options.NetworkingConfig.EndpointsConfig {
+	for i, setting := range options.NetworkingConfig.EndpointsConfig {
 		endpoints[i] = &network.EndpointSettings{}
+		if setting != nil {
+			endpoints[i].Aliases = setting.Aliases
+		}
 	}
 
 	envVars := []string{}
 	for key, value := range options.ContainerConfig.Env {
 		envVars = append(envVars, key+"="+value)
 	}
+	var healthcheck *dockercontainer.HealthConfig
+	if options.ContainerConfig.HealthCheck != nil {
+		healthcheck = &dockercontainer.HealthConfig{
+			Test:        options.ContainerConfig.HealthCheck.Test,
+			Interval:    options.ContainerConfig.HealthCheck.Interval,
+			Timeout:     options.ContainerConfig.HealthCheck.Timeout,
+			StartPeriod: options.ContainerConfig.HealthCheck.StartPeriod,
+			Retries:     options.ContainerConfig.HealthCheck.Retries,
+		}
+	}
 	opts := &dockertypes.ContainerCreateConfig{
 		Name: options.Name,
 		Config: &dockercontainer.Config{
-			Hostname: options.ContainerConfig.Hostname,
-			Image:    options.ContainerConfig.Image,
-			Env:      envVars,
-			Cmd:      options.ContainerConfig.Cmd,
-			Healthcheck: &dockercontainer.HealthConfig{
-				Test:        options.ContainerConfig.HealthCheck.Test,
-				StartPeriod: options.ContainerConfig.HealthCheck.StartPeriod,
-			},
+			Hostname:     options.ContainerConfig.Hostname,
+			Image:        options.ContainerConfig.Image,
+			Env:          envVars,
+			Cmd:          options.ContainerConfig.Cmd,
+			Healthcheck:  healthcheck,
 			Labels:       options.ContainerConfig.Labels,
 			ExposedPorts: options.ContainerConfig.ExposedPorts,
+			User:         options.ContainerConfig.User,
 		},
 		HostConfig: &dockercontainer.HostConfig{
-			Mounts:     mounts,
-			Privileged: options.HostConfig.Privileged,
+			Mounts:       mounts,
+			Privileged:   options.HostConfig.Privileged,
+			NetworkMode:  dockercontainer.NetworkMode(options.HostConfig.NetworkMode),
+			PortBindings: options.HostConfig.PortBindings,
+			ExtraHosts:   options.HostConfig.ExtraHosts,
+			RestartPolicy: dockercontainer.RestartPolicy{
+				Name:              string(options.HostConfig.RestartPolicy.Name),
+				MaximumRetryCount: options.HostConfig.RestartPolicy.MaximumRetryCount,
+			},
+			Resources: dockercontainer.Resources{
+				NanoCPUs: options.HostConfig.Resources.NanoCPUs,
+				Memory:   options.HostConfig.Resources.Memory,
+			},
 		},
 		NetworkingConfig: &dockernetworktypes.NetworkingConfig{
 			EndpointsConfig: endpoints,
@@ -101,26 +125,33 @@ func newDockerContainerSpec(options ContainerCreateOptions) *dockertypes.Contain
 	return opts
 }
 
-func (c *dockerClient) New() error {
+func (c *dockerClient) New(ctx context.Context, config EngineConfig) error {
 	fmt.Println("Inside docker plugin new")
-	client, err := dockerapi.NewClientWithOpts(dockerapi.FromEnv, dockerapi.WithAPIVersionNegotiation())
+	opts := []dockerapi.Opt{dockerapi.FromEnv, dockerapi.WithAPIVersionNegotiation()}
+	if config.Endpoint != "" {
+		opts = append(opts, dockerapi.WithHost(config.Endpoint))
+	}
+	if config.HasTLS() {
+		opts = append(opts, dockerapi.WithTLSClientConfig(config.TLSCACert, config.TLSCert, config.TLSKey))
+	}
+	client, err := dockerapi.NewClientWithOpts(opts...)
 	if err != nil {
-		return fmt.Errorf("Couldn't connect to docker: %w", err)
+		return fmt.Errorf("Couldn't connect to docker: %w", WrapError(ErrEngineUnavailable, err))
 	}
 
 	DockerDriver.client = client
 	DockerDriver.timeout = DefaultTimeout
 	DockerDriver.imagePullProgessDeadline = DefaultImagePullingProgressReportInterval
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 	DockerDriver.client.NegotiateAPIVersion(ctx)
 
 	return nil
 }
 
-func getCancelableContext() (context.Context, context.CancelFunc) {
-	return context.WithCancel(context.Background())
+func getCancelableContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(ctx)
 }
 
 func contextError(ctx context.Context) error {
@@ -138,6 +169,27 @@ func (e operationTimeout) Error() string {
 	return fmt.Sprintf("operation timeout: %v", e.err)
 }
 
+func (e operationTimeout) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// dockerError maps the docker engine errors to the driver error kinds
+func dockerError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errdefs.IsNotFound(err):
+		return WrapError(ErrNotFound, err)
+	case errdefs.IsConflict(err):
+		return WrapError(ErrAlreadyExists, err)
+	case errdefs.IsDeadline(err), errors.Is(err, context.DeadlineExceeded):
+		return WrapError(ErrTimeout, err)
+	case dockerapi.IsErrConnectionFailed(err), errdefs.IsUnavailable(err):
+		return WrapError(ErrEngineUnavailable, err)
+	}
+	return err
+}
+
 func base64EncodeAuth(auth dockertypes.AuthConfig) (string, error) {
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(auth); err != nil {
@@ -232,23 +284,29 @@ func (p *progressReporter) stop() {
 	close(p.stopCh)
 }
 
-func (c *dockerClient) ImagesPull(refStr string, options ImagePullOptions) ([]string, error) {
+func (c *dockerClient) ImagesPull(ctx context.Context, refStr string, options ImagePullOptions) ([]string, error) {
 	// TODO: return common []string
 	fmt.Println("In docker pull images")
 	// RegistryAuth is the base64 encoded credentials for the registry
 	auth := dockertypes.AuthConfig{}
+	if options.Auth != nil {
+		auth.Username = options.Auth.Username
+		auth.Password = options.Auth.Password
+		auth.ServerAddress = options.Auth.ServerAddress
+		auth.IdentityToken = options.Auth.IdentityToken
+	}
 	base64Auth, err := base64EncodeAuth(auth)
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 	opts := dockertypes.ImagePullOptions{}
 	opts.RegistryAuth = base64Auth
 
-	ctx, cancel := getCancelableContext()
+	ctx, cancel := getCancelableContext(ctx)
 	defer cancel()
 	resp, err := c.client.ImagePull(ctx, refStr, opts)
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 	defer resp.Close()
 	reporter := newProgressReporter(refStr, cancel, 10*time.Second)
@@ -262,7 +320,7 @@ func (c *dockerClient) ImagesPull(refStr string, options ImagePullOptions) ([]st
 			break
 		}
 		if err != nil {
-			return nil, err
+			return nil, dockerError(err)
 		}
 		if msg.Error != nil {
 			return nil, msg.Error
@@ -272,10 +330,10 @@ func (c *dockerClient) ImagesPull(refStr string, options ImagePullOptions) ([]st
 	return nil, nil
 }
 
-func (c *dockerClient) ImageInspect(id string) (*ImageInspect, error) {
+func (c *dockerClient) ImageInspect(ctx context.Context, id string) (*ImageInspect, error) {
 	fmt.Println("In docker inspect image")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	data, _, err := c.client.ImageInspectWithRaw(ctx, id)
@@ -283,7 +341,7 @@ func (c *dockerClient) ImageInspect(id string) (*ImageInspect, error) {
 		return nil, ctxErr
 	}
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 
 	image := &ImageInspect{
@@ -294,9 +352,9 @@ func (c *dockerClient) ImageInspect(id string) (*ImageInspect, error) {
 	return image, nil
 }
 
-func (c *dockerClient) ImagesList(options ImageListOptions) ([]ImageSummary, error) {
+func (c *dockerClient) ImagesList(ctx context.Context, options ImageListOptions) ([]ImageSummary, error) {
 	fmt.Println("In docker list images")
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	images, err := c.client.ImageList(ctx, dockertypes.ImageListOptions{})
@@ -304,7 +362,7 @@ func (c *dockerClient) ImagesList(options ImageListOptions) ([]ImageSummary, err
 		return nil, ctxErr
 	}
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 	var summary []ImageSummary
 	for _, image := range images {
@@ -318,8 +376,8 @@ func (c *dockerClient) ImagesList(options ImageListOptions) ([]ImageSummary, err
 	return summary, nil
 }
 
-func (c *dockerClient) ImageVersion(id string) (string, error) {
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+func (c *dockerClient) ImageVersion(ctx context.Context, id string) (string, error) {
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	iibd, _, err := c.client.ImageInspectWithRaw(ctx, id)
@@ -330,37 +388,31 @@ func (c *dockerClient) ImageVersion(id string) (string, error) {
 		//		if dockerapi.IsErrNotFound(err) {
 		//			err = ImageNotFoundError{ID: ref}
 		//		}
-		return "", err
+		return "", dockerError(err)
 	}
 
-	digest := iibd.RepoDigests[0]
-	parts := strings.Split(digest, "@")
-	if len(parts) > 1 && len(parts[1]) >= 19 {
-		return fmt.Sprintf("%s (%s)", id, parts[1][:19]), nil
-	} else {
-		return fmt.Sprintf("%s", digest), nil
-	}
+	return ImageVersionString(id, iibd.RepoDigests), nil
 }
 
-func (c *dockerClient) ContainerCreate(options ContainerCreateOptions) (ContainerCreateResponse, error) {
+func (c *dockerClient) ContainerCreate(ctx context.Context, options ContainerCreateOptions) (ContainerCreateResponse, error) {
 	fmt.Println("Inside docker container create")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	opts := newDockerContainerSpec(options)
 
 	ccb, err := c.client.ContainerCreate(ctx, opts.Config, opts.HostConfig, opts.NetworkingConfig, nil, opts.Name)
 	if err != nil {
-		return ContainerCreateResponse{}, err
+		return ContainerCreateResponse{}, dockerError(err)
 	}
 	return ContainerCreateResponse{ID: ccb.ID}, nil
 }
 
-func (c *dockerClient) ContainerStart(id string) error {
+func (c *dockerClient) ContainerStart(ctx context.Context, id string) error {
 	fmt.Println("Inside docker start container")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	err := c.client.ContainerStart(ctx, id, dockertypes.ContainerStartOptions{})
@@ -368,38 +420,35 @@ func (c *dockerClient) ContainerStart(id string) error {
 		return ctxErr
 	}
 
-	return err
+	return dockerError(err)
 }
 
-func (c *dockerClient) ContainerWait(id string, status string, timeout time.Duration, interval time.Duration) error {
+func (c *dockerClient) ContainerWait(ctx context.Context, id string, status string, timeout time.Duration, interval time.Duration) error {
 	fmt.Println("Inside docker container wait")
-	var container dockertypes.ContainerJSON
-	var err error
-
-	ctx, cancel := context.WithTimeout(context.TODO(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	err = skupperutils.RetryWithContext(ctx, interval, func() (bool, error) {
-		container, err = c.client.ContainerInspect(ctx, id)
+	err := skupperutils.RetryWithContext(ctx, interval, func() (bool, error) {
+		container, err := c.ContainerInspect(ctx, id)
 		if err != nil {
 			return false, nil
 		}
-		return container.State.Status == status, nil
+		return ContainerReached(container, status)
 	})
-	return err
+	return dockerError(err)
 }
 
-func (c *dockerClient) ContainerList(opts ContainerListOptions) ([]ContainerSummary, error) {
+func (c *dockerClient) ContainerList(ctx context.Context, opts ContainerListOptions) ([]ContainerSummary, error) {
 	fmt.Println("Inside docker container list")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
-	//TODO is this correct conversion of map[string][]string to filters
 	filters := dockerfilters.NewArgs()
 	for i, j := range opts.Filters {
-		filters.Add(i, j[0])
-		//filters.Add(i, strings.Join(j,","))
+		for _, value := range j {
+			filters.Add(i, value)
+		}
 	}
 
 	containers, err := c.client.ContainerList(ctx, dockertypes.ContainerListOptions{
@@ -411,7 +460,7 @@ func (c *dockerClient) ContainerList(opts ContainerListOptions) ([]ContainerSumm
 		return dc, ctxErr
 	}
 	if err != nil {
-		return dc, err
+		return dc, dockerError(err)
 	}
 	for _, container := range containers {
 		// TODO all fields
@@ -431,10 +480,10 @@ func (c *dockerClient) ContainerList(opts ContainerListOptions) ([]ContainerSumm
 	return dc, nil
 }
 
-func (c *dockerClient) ContainerInspect(id string) (*ContainerInspect, error) {
+func (c *dockerClient) ContainerInspect(ctx context.Context, id string) (*ContainerInspect, error) {
 	fmt.Println("Inside docker container inspect")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	container, err := c.client.ContainerInspect(ctx, id)
@@ -442,7 +491,7 @@ func (c *dockerClient) ContainerInspect(id string) (*ContainerInspect, error) {
 		return nil, ctxErr
 	}
 	if err != nil {
-		return nil, err
+		return nil, dockerError(err)
 	}
 	mounts := []MountPoint{}
 	for _, mount := range container.Mounts {
@@ -471,7 +520,9 @@ func (c *dockerClient) ContainerInspect(id string) (*ContainerInspect, error) {
 		Path: container.Path,
 		Args: container.Args,
 		State: &ContainerState{
-			Status: container.State.Status,
+			Status:  container.State.Status,
+			Running: container.State.Running,
+			Paused:  container.State.Paused,
 		},
 		Image: container.Image,
 		//ImageName: container.ImageName,
@@ -481,15 +532,24 @@ func (c *dockerClient) ContainerInspect(id string) (*ContainerInspect, error) {
 			Hostname:     container.Config.Hostname,
 			ExposedPorts: container.Config.ExposedPorts,
 			Env:          envVars,
-			Healthcheck: &HealthConfig{
-				Test:        container.Config.Healthcheck.Test,
-				Interval:    container.Config.Healthcheck.Interval,
-				Timeout:     container.Config.Healthcheck.Timeout,
-				StartPeriod: container.Config.Healthcheck.StartPeriod,
-				Retries:     container.Config.Healthcheck.Retries,
+			Cmd:          container.Config.Cmd,
+			Image:        container.Config.Image,
+			Labels:       container.Config.Labels,
+			User:         container.Config.User,
+		},
+		HostConfig: ContainerHostConfig{
+			NetworkMode:  string(container.HostConfig.NetworkMode),
+			PortBindings: container.HostConfig.PortBindings,
+			Privileged:   container.HostConfig.Privileged,
+			ExtraHosts:   container.HostConfig.ExtraHosts,
+			RestartPolicy: RestartPolicy{
+				Name:              RestartPolicyName(container.HostConfig.RestartPolicy.Name),
+				MaximumRetryCount: container.HostConfig.RestartPolicy.MaximumRetryCount,
+			},
+			Resources: ContainerResources{
+				NanoCPUs: container.HostConfig.NanoCPUs,
+				Memory:   container.HostConfig.Memory,
 			},
-			Image:  container.Config.Image,
-			Labels: container.Config.Labels,
 		},
 		NetworkSettings: ContainerNetworkConfig{
 			Gateway:     container.NetworkSettings.DefaultNetworkSettings.Gateway,
@@ -497,11 +557,31 @@ func (c *dockerClient) ContainerInspect(id string) (*ContainerInspect, error) {
 			IPPrefixLen: container.NetworkSettings.DefaultNetworkSettings.IPPrefixLen,
 		},
 	}
+	if container.Config.Healthcheck != nil {
+		icd.Config.Healthcheck = &HealthConfig{
+			Test:        container.Config.Healthcheck.Test,
+			Interval:    container.Config.Healthcheck.Interval,
+			Timeout:     container.Config.Healthcheck.Timeout,
+			StartPeriod: container.Config.Healthcheck.StartPeriod,
+			Retries:     container.Config.Healthcheck.Retries,
+		}
+	}
+	if startedAt, err := time.Parse(time.RFC3339Nano, container.State.StartedAt); err == nil {
+		icd.State.StartedAt = startedAt
+	}
+	if container.State.Health != nil {
+		icd.State.Health = &ContainerHealth{
+			Status:        container.State.Health.Status,
+			FailingStreak: container.State.Health.FailingStreak,
+			Runs:          len(container.State.Health.Log),
+		}
+	}
 	if len(container.NetworkSettings.Networks) > 0 {
 		icd.NetworkSettings.Networks = make(map[string]*NetworkEndpointSetting)
 		for net, setting := range container.NetworkSettings.Networks {
 			endpoint := new(NetworkEndpointSetting)
 			endpoint.NetworkID = net
+			endpoint.Aliases = setting.Aliases
 			endpoint.Gateway = setting.Gateway
 			endpoint.IPAddress = setting.IPAddress
 			endpoint.IPPrefixLen = setting.IPPrefixLen
@@ -509,13 +589,13 @@ func (c *dockerClient) ContainerInspect(id string) (*ContainerInspect, error) {
 		}
 	}
 
-	return icd, err
+	return icd, dockerError(err)
 }
 
-func (c *dockerClient) ContainerRestart(id string) error {
+func (c *dockerClient) ContainerRestart(ctx context.Context, id string) error {
 	fmt.Println("Inside docker restart container")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	timeout := 10 * time.Second
@@ -523,94 +603,168 @@ func (c *dockerClient) ContainerRestart(id string) error {
 	if ctxErr := contextError(ctx); ctxErr != nil {
 		return ctxErr
 	}
-	return err
+	return dockerError(err)
 }
 
-func (c *dockerClient) ContainerStop(id string) error {
+func (c *dockerClient) ContainerStop(ctx context.Context, id string) error {
 	fmt.Println("Inside docker stop container")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	err := c.client.ContainerStop(ctx, id, nil)
 	if ctxErr := contextError(ctx); ctxErr != nil {
 		return ctxErr
 	}
-	return err
+	return dockerError(err)
 }
 
-func (c *dockerClient) ContainerRemove(id string) error {
+func (c *dockerClient) ContainerRemove(ctx context.Context, id string) error {
 	fmt.Println("Inside docker container remove")
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	err := c.client.ContainerRemove(ctx, id, dockertypes.ContainerRemoveOptions{})
 	if ctxErr := contextError(ctx); ctxErr != nil {
 		return ctxErr
 	}
-	return err
+	return dockerError(err)
+}
+
+func (c *dockerClient) ContainerRename(ctx context.Context, id string, name string) error {
+	fmt.Println("Inside docker container rename")
+	ctx, cancel := getTimeoutContext(ctx, c)
+	defer cancel()
+
+	err := c.client.ContainerRename(ctx, id, name)
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return ctxErr
+	}
+	return dockerError(err)
 }
 
-func (c *dockerClient) NetworkCreate(name string, options NetworkCreateOptions) (NetworkCreateResponse, error) {
+func (c *dockerClient) NetworkCreate(ctx context.Context, name string, options NetworkCreateOptions) (NetworkCreateResponse, error) {
 	fmt.Println("Inside docker network create")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
+	networkDriver := options.Driver
+	if networkDriver == "" {
+		networkDriver = "bridge"
+	}
+	ipam := &dockernetworktypes.IPAM{
+		Driver:  options.IPAM.Driver,
+		Options: options.IPAM.Options,
+	}
+	for _, config := range options.IPAM.Config {
+		ipam.Config = append(ipam.Config, dockernetworktypes.IPAMConfig{
+			Subnet:  config.Subnet,
+			IPRange: config.IPRange,
+			Gateway: config.Gateway,
+		})
+	}
 	ncr, err := c.client.NetworkCreate(ctx, name, dockertypes.NetworkCreate{
-		CheckDuplicate: true,
-		Driver:         "bridge",
-		Options: map[string]string{
-			"com.docker.network.bridge.name":                 "skupper0",
-			"com.docker.network.bridge.enable_icc":           "true",
-			"com.docker.network.bridge.enable_ip_masquerade": "true",
-		},
+		CheckDuplicate: options.CheckDuplicate,
+		Driver:         networkDriver,
+		Internal:       options.Internal,
+		IPAM:           ipam,
+		Options:        options.Options,
+		Labels:         options.Labels,
 	})
 	if ctxErr := contextError(ctx); ctxErr != nil {
 		return NetworkCreateResponse{}, ctxErr
 	}
-	return NetworkCreateResponse{ID: ncr.ID, Warning: ncr.Warning}, err
+	return NetworkCreateResponse{ID: ncr.ID, Warning: ncr.Warning}, dockerError(err)
 }
 
-func (c *dockerClient) NetworkInspect(id string) (NetworkInspect, error) {
-	var netResource NetworkInspect
-
-	ctx, cancel := getTimeoutContext(&DockerDriver)
-	defer cancel()
-
-	nr, err := c.client.NetworkInspect(ctx, id, dockertypes.NetworkInspectOptions{})
-	if ctxErr := contextError(ctx); ctxErr != nil {
-		return netResource, ctxErr
+// dockerNetwork returns the inspect data of a docker network
+func dockerNetwork(nr dockertypes.NetworkResource) NetworkInspect {
+	n := NetworkInspect{
+		Name:      nr.Name,
+		NetworkID: nr.ID,
+		Driver:    nr.Driver,
+		Internal:  nr.Internal,
+		IPAM: NetworkIPAM{
+			Driver:  nr.IPAM.Driver,
+			Options: nr.IPAM.Options,
+		},
+		Options: nr.Options,
+		Labels:  nr.Labels,
+	}
+	for _, config := range nr.IPAM.Config {
+		n.IPAM.Config = append(n.IPAM.Config, NetworkIPAMConfig{
+			Subnet:  config.Subnet,
+			IPRange: config.IPRange,
+			Gateway: config.Gateway,
+		})
 	}
 	if len(nr.Containers) > 0 {
-		netResource.Containers = make(map[string]EndpointResource)
+		n.Containers = make(map[string]EndpointResource)
 		for container, endPoint := range nr.Containers {
-			netResource.Containers[container] = EndpointResource{
+			n.Containers[container] = EndpointResource{
 				Name:       endPoint.Name,
 				EndpointID: endPoint.EndpointID,
 			}
 		}
 	}
-	return netResource, err
+	return n
 }
 
-func (c *dockerClient) NetworkRemove(id string) error {
+func (c *dockerClient) NetworkInspect(ctx context.Context, id string) (NetworkInspect, error) {
+	ctx, cancel := getTimeoutContext(ctx, c)
+	defer cancel()
+
+	nr, err := c.client.NetworkInspect(ctx, id, dockertypes.NetworkInspectOptions{})
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return NetworkInspect{}, ctxErr
+	}
+	if err != nil {
+		return NetworkInspect{}, dockerError(err)
+	}
+	return dockerNetwork(nr), nil
+}
+
+func (c *dockerClient) NetworkList(ctx context.Context, options NetworkListOptions) ([]NetworkInspect, error) {
+	if err := ValidateNetworkFilters(options.Filters); err != nil {
+		return nil, err
+	}
+	ctx, cancel := getTimeoutContext(ctx, c)
+	defer cancel()
+
+	networks, err := c.client.NetworkList(ctx, dockertypes.NetworkListOptions{
+		Filters: containerFilterArgs(options.Filters),
+	})
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, dockerError(err)
+	}
+	list := []NetworkInspect{}
+	for _, nr := range networks {
+		list = append(list, dockerNetwork(nr))
+	}
+	return list, nil
+}
+
+func (c *dockerClient) NetworkRemove(ctx context.Context, id string) error {
 	//	force := true
 	fmt.Println("Inside docker network remove for: ", id)
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	err := c.client.NetworkRemove(ctx, id)
 	if ctxErr := contextError(ctx); ctxErr != nil {
 		return ctxErr
 	}
-	return err
+	return dockerError(err)
 }
 
-func (c *dockerClient) NetworkConnect(id string, container string, aliases []string) error {
+func (c *dockerClient) NetworkConnect(ctx context.Context, id string, container string, aliases []string) error {
 	fmt.Println("Inside docker network connect: ", id, container)
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	err := c.client.NetworkConnect(ctx, id, container, &dockernetworktypes.EndpointSettings{})
@@ -618,15 +772,15 @@ func (c *dockerClient) NetworkConnect(id string, container string, aliases []str
 		return ctxErr
 	}
 	if err != nil {
-		return err
+		return dockerError(err)
 	}
 	return nil
 }
 
-func (c *dockerClient) NetworkDisconnect(id string, container string, force bool) error {
+func (c *dockerClient) NetworkDisconnect(ctx context.Context, id string, container string, force bool) error {
 	fmt.Println("Inside docker network disconnect: ", id, container)
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	err := c.client.NetworkDisconnect(ctx, id, container, force)
@@ -634,14 +788,14 @@ func (c *dockerClient) NetworkDisconnect(id string, container string, force bool
 		return ctxErr
 	}
 	if err != nil {
-		return err
+		return dockerError(err)
 	}
 	return nil
 }
 
-func (c *dockerClient) ContainerExec(id string, cmd []string) (ExecResult, error) {
+func (c *dockerClient) ContainerExec(ctx context.Context, id string, cmd []string) (ExecResult, error) {
 	fmt.Println("Inside docker container exec")
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	execConfig := dockertypes.ExecConfig{
@@ -652,14 +806,14 @@ func (c *dockerClient) ContainerExec(id string, cmd []string) (ExecResult, error
 
 	createResponse, err := c.client.ContainerExecCreate(ctx, id, execConfig)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, dockerError(err)
 	}
 	execID := createResponse.ID
 
 	// run with stdout and stderr attached
 	attachResponse, err := c.client.ContainerExecAttach(ctx, execID, dockertypes.ExecStartCheck{})
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, dockerError(err)
 	}
 	defer attachResponse.Close()
 
@@ -674,23 +828,104 @@ func (c *dockerClient) ContainerExec(id string, cmd []string) (ExecResult, error
 	select {
 	case err := <-outputDone:
 		if err != nil {
-			return ExecResult{}, err
+			return ExecResult{}, dockerError(err)
 		}
 		break
 	}
 
 	inspectResponse, err := c.client.ContainerExecInspect(ctx, execID)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, dockerError(err)
 	}
 
 	return ExecResult{ExitCode: inspectResponse.ExitCode, OutBuffer: &outBuf, ErrBuffer: &errBuf}, nil
 }
 
-func (c *dockerClient) Info() (Info, error) {
+func (c *dockerClient) ContainerLogs(ctx context.Context, id string, options ContainerLogsOptions, stdout io.Writer, stderr io.Writer) error {
+	fmt.Println("Inside docker container logs")
+
+	var cancel context.CancelFunc
+	if options.Follow {
+		ctx, cancel = getCancelableContext(ctx)
+	} else {
+		ctx, cancel = getTimeoutContext(ctx, c)
+	}
+	defer cancel()
+
+	reader, err := c.client.ContainerLogs(ctx, id, dockertypes.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      options.Since,
+		Timestamps: options.Timestamps,
+		Follow:     options.Follow,
+		Tail:       options.Tail,
+	})
+	if ctxErr := contextError(ctx); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return dockerError(err)
+	}
+	defer reader.Close()
+
+	// skupper containers are not created with a tty so the stream is multiplexed
+	_, err = dockerstdcopy.StdCopy(stdout, stderr, reader)
+	return dockerError(err)
+}
+
+func (c *dockerClient) Events(ctx context.Context, filters map[string][]string) (<-chan Event, <-chan error) {
+	fmt.Println("Inside docker events")
+
+	args := dockerfilters.NewArgs()
+	for key, values := range EventFilters(filters) {
+		for _, value := range values {
+			args.Add(key, value)
+		}
+	}
+	messages, engineErrs := c.client.Events(ctx, dockertypes.EventsOptions{
+		Filters: args,
+	})
+
+	events := make(chan Event)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case msg := <-messages:
+				event := Event{
+					Type:       msg.Type,
+					Action:     msg.Action,
+					ID:         msg.Actor.ID,
+					Name:       msg.Actor.Attributes["name"],
+					Attributes: msg.Actor.Attributes,
+					Time:       time.Unix(0, msg.TimeNano),
+				}
+				if msg.Type == EventTypeNetwork {
+					event.Container = msg.Actor.Attributes["container"]
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			case err := <-engineErrs:
+				if ctx.Err() == nil {
+					errs <- dockerError(err)
+				}
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, errs
+}
+
+func (c *dockerClient) Info(ctx context.Context) (Info, error) {
 	fmt.Println("Inside docker info")
 
-	ctx, cancel := getTimeoutContext(&DockerDriver)
+	ctx, cancel := getTimeoutContext(ctx, c)
 	defer cancel()
 
 	driverInfo := Info{}
@@ -700,7 +935,7 @@ func (c *dockerClient) Info() (Info, error) {
 		return driverInfo, ctxErr
 	}
 	if err != nil {
-		return driverInfo, err
+		return driverInfo, dockerError(err)
 	}
 
 	driverInfo.ID = info.ID
@@ -2,7 +2,11 @@ package driver
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/docker/go-connections/nat"
@@ -24,34 +28,62 @@ const (
 type ContainerStatus int
 
 type Driver interface {
-	New() error
-	ImageInspect(id string) (*ImageInspect, error)
-	ImagesList(options ImageListOptions) ([]ImageSummary, error)
-	ImagesPull(refStr string, options ImagePullOptions) ([]string, error)
-	ImageVersion(id string) (string, error)
-	ContainerCreate(options ContainerCreateOptions) (ContainerCreateResponse, error)
-	ContainerStart(id string) error
-	ContainerWait(id string, state string, timeout time.Duration, interval time.Duration) error
-	ContainerList(options ContainerListOptions) ([]ContainerSummary, error)
-	ContainerInspect(id string) (*ContainerInspect, error)
-	ContainerRestart(id string) error
-	ContainerStop(id string) error
-	ContainerRemove(id string) error
-	ContainerExec(id string, cmd []string) (ExecResult, error)
-	NetworkCreate(name string, options NetworkCreateOptions) (NetworkCreateResponse, error)
-	NetworkInspect(id string) (NetworkInspect, error)
-	NetworkRemove(id string) error
-	NetworkConnect(id string, container string, aliases []string) error
-	NetworkDisconnect(id string, container string, force bool) error
-	Info() (Info, error)
-}
-
-func RecreateContainer(name string, dd Driver) error {
-	current, err := dd.ContainerInspect(name)
-	if err != nil {
-		return err
+	New(ctx context.Context, config EngineConfig) error
+	ImageInspect(ctx context.Context, id string) (*ImageInspect, error)
+	ImagesList(ctx context.Context, options ImageListOptions) ([]ImageSummary, error)
+	ImagesPull(ctx context.Context, refStr string, options ImagePullOptions) ([]string, error)
+	ImageVersion(ctx context.Context, id string) (string, error)
+	ContainerCreate(ctx context.Context, options ContainerCreateOptions) (ContainerCreateResponse, error)
+	ContainerStart(ctx context.Context, id string) error
+	ContainerWait(ctx context.Context, id string, state string, timeout time.Duration, interval time.Duration) error
+	ContainerList(ctx context.Context, options ContainerListOptions) ([]ContainerSummary, error)
+	ContainerInspect(ctx context.Context, id string) (*ContainerInspect, error)
+	ContainerRestart(ctx context.Context, id string) error
+	ContainerStop(ctx context.Context, id string) error
+	ContainerRemove(ctx context.Context, id string) error
+	ContainerRename(ctx context.Context, id string, name string) error
+	ContainerExec(ctx context.Context, id string, cmd []string) (ExecResult, error)
+	ContainerLogs(ctx context.Context, id string, options ContainerLogsOptions, stdout io.Writer, stderr io.Writer) error
+	NetworkCreate(ctx context.Context, name string, options NetworkCreateOptions) (NetworkCreateResponse, error)
+	NetworkInspect(ctx context.Context, id string) (NetworkInspect, error)
+	NetworkList(ctx context.Context, options NetworkListOptions) ([]NetworkInspect, error)
+	NetworkRemove(ctx context.Context, id string) error
+	NetworkConnect(ctx context.Context, id string, container string, aliases []string) error
+	NetworkDisconnect(ctx context.Context, id string, container string, force bool) error
+	Info(ctx context.Context) (Info, error)
+	Events(ctx context.Context, filters map[string][]string) (<-chan Event, <-chan error)
+}
+
+// EventFilters restricts the filters to the event types and actions that
+// are reported through Events unless the caller asked for specific ones
+func EventFilters(filters map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+	for key, values := range filters {
+		result[key] = values
 	}
+	if _, ok := result["type"]; !ok {
+		result["type"] = []string{EventTypeContainer, EventTypeNetwork}
+	}
+	if _, ok := result["event"]; !ok {
+		result["event"] = []string{EventStart, EventDie, EventDestroy, EventConnect, EventDisconnect}
+	}
+	return result
+}
 
+// RecreateTimeout is how long a recreated container may take to run, or to
+// be healthy when it has a health check
+const RecreateTimeout = 2 * time.Minute
+
+// The names of the replacement and of the original while a container is
+// recreated
+const (
+	recreateSuffix = "-recreate"
+	previousSuffix = "-previous"
+)
+
+// ContainerSpec returns the options creating the inspected container again,
+// the alias the engine gives every container, its short id, is left out
+func ContainerSpec(current *ContainerInspect) ContainerCreateOptions {
 	mounts := []MountPoint{}
 	for _, v := range current.Mounts {
 		mounts = append(mounts, MountPoint{
@@ -60,55 +92,197 @@ func RecreateContainer(name string, dd Driver) error {
 			Destination: v.Destination,
 		})
 	}
-
-	hostCfg := &ContainerHostConfig{
-		Mounts:     mounts,
-		Privileged: true,
-	}
+	hostCfg := current.HostConfig
+	hostCfg.Mounts = mounts
 
 	containerCfg := &ContainerBaseConfig{
 		Hostname:     current.Config.Hostname,
 		ExposedPorts: current.Config.ExposedPorts,
 		Env:          current.Config.Env,
+		Cmd:          current.Config.Cmd,
 		HealthCheck:  current.Config.Healthcheck,
 		Image:        current.Config.Image,
 		Labels:       current.Config.Labels,
+		User:         current.Config.User,
 	}
 
 	networkCfg := &ContainerNetworkingConfig{
-		EndpointsConfig: current.NetworkSettings.Networks,
+		EndpointsConfig: map[string]*NetworkEndpointSetting{},
 	}
+	for name, endpoint := range current.NetworkSettings.Networks {
+		setting := &NetworkEndpointSetting{}
+		if endpoint != nil {
+			setting.Links = endpoint.Links
+			for _, alias := range endpoint.Aliases {
+				if len(current.ID) < 12 || alias != current.ID[:12] {
+					setting.Aliases = append(setting.Aliases, alias)
+				}
+			}
+		}
+		networkCfg.EndpointsConfig[name] = setting
+	}
+
+	return ContainerCreateOptions{
+		Name:             strings.TrimPrefix(current.Name, "/"),
+		ContainerConfig:  containerCfg,
+		HostConfig:       &hostCfg,
+		NetworkingConfig: networkCfg,
+	}
+}
 
-	// remote current and create new container
-	err = dd.ContainerStop(name)
+// waitRecreated waits for a recreated container to run, or to be healthy
+// when it has a health check
+func waitRecreated(ctx context.Context, dd Driver, id string, opts ContainerCreateOptions) error {
+	state := "running"
+	if HasHealthCheck(opts.ContainerConfig.HealthCheck) {
+		state = HealthyState
+	}
+	return dd.ContainerWait(ctx, id, state, RecreateTimeout, time.Second)
+}
+
+// RecreateContainer replaces a container with one created from its
+// complete spec, e.g. for it to read its mounted config again. The
+// replacement is created under a temporary name before the container is
+// stopped, so a spec the engine rejects leaves the container as it was,
+// and the original is restarted when the replacement fails to start or
+// to become healthy.
+func RecreateContainer(ctx context.Context, name string, dd Driver) error {
+	current, err := dd.ContainerInspect(ctx, name)
 	if err != nil {
-		return fmt.Errorf("Failed to stop container: %w", err)
+		return err
 	}
+	return ReplaceContainer(ctx, dd, current, ContainerSpec(current))
+}
 
-	err = dd.ContainerRemove(name)
+// ReplaceContainer replaces the inspected container with one created from
+// opts, under the same name, the same way RecreateContainer does
+func ReplaceContainer(ctx context.Context, dd Driver, current *ContainerInspect, opts ContainerCreateOptions) error {
+	return ReplaceContainerWith(ctx, dd, current, opts, nil)
+}
+
+// ReplaceContainerWith replaces the container as ReplaceContainer does and,
+// when the replacement fails, calls undo before the original container is
+// started again, e.g. to restore the files it mounts
+func ReplaceContainerWith(ctx context.Context, dd Driver, current *ContainerInspect, opts ContainerCreateOptions, undo func() error) error {
+	name := strings.TrimPrefix(current.Name, "/")
+
+	// a replacement left by an earlier attempt is stale
+	dd.ContainerRemove(ctx, name+recreateSuffix)
+	opts.Name = name + recreateSuffix
+	resp, err := dd.ContainerCreate(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("Failed to remove container: %w", err)
+		return fmt.Errorf("Failed to re-create container %s: %w", name, err)
 	}
 
-	opts := ContainerCreateOptions{
-		Name:             name,
-		ContainerConfig:  containerCfg,
-		HostConfig:       hostCfg,
-		NetworkingConfig: networkCfg,
+	err = dd.ContainerStop(ctx, current.ID)
+	if err != nil {
+		dd.ContainerRemove(ctx, resp.ID)
+		return fmt.Errorf("Failed to stop container %s: %w", name, err)
 	}
 
-	resp, err := dd.ContainerCreate(opts)
+	err = dd.ContainerRename(ctx, current.ID, name+previousSuffix)
+	if errors.Is(err, ErrNotSupported) {
+		// the replacement cannot take over the name, it proved the spec
+		// can be created and is created again under the name instead
+		dd.ContainerRemove(ctx, resp.ID)
+		return recreateInPlace(ctx, dd, current, opts, name, undo)
+	}
+	renamed := err == nil
+	if err == nil {
+		err = dd.ContainerRename(ctx, resp.ID, name)
+		if err != nil {
+			err = fmt.Errorf("Failed to rename container %s: %w", name, err)
+		}
+	}
+	if err == nil {
+		err = dd.ContainerStart(ctx, resp.ID)
+		if err != nil {
+			err = fmt.Errorf("Failed to re-start container %s: %w", name, err)
+		}
+	}
+	if err == nil {
+		err = waitRecreated(ctx, dd, resp.ID, opts)
+	}
 	if err != nil {
-		return fmt.Errorf("Failed to re-create container %w", err)
+		return restoreContainer(dd, current.ID, resp.ID, name, renamed, err, undo)
 	}
 
-	err = dd.ContainerStart(resp.ID)
+	err = dd.ContainerRemove(ctx, current.ID)
 	if err != nil {
-		return fmt.Errorf("Failed to re-start container %w", err)
+		return fmt.Errorf("Failed to remove previous container %s: %w", name, err)
 	}
 	return nil
 }
 
+// restoreContainer removes a failed replacement and brings the original
+// back under its name once undone, it proceeds even though the caller's
+// context may be what made the replacement fail
+func restoreContainer(dd Driver, originalID string, replacementID string, name string, renamed bool, cause error, undo func() error) error {
+	ctx := context.Background()
+	dd.ContainerStop(ctx, replacementID)
+	dd.ContainerRemove(ctx, replacementID)
+	var err error
+	if undo != nil {
+		err = undo()
+	}
+	if err == nil && renamed {
+		err = dd.ContainerRename(ctx, originalID, name)
+	}
+	if err == nil {
+		err = dd.ContainerStart(ctx, originalID)
+	}
+	if err != nil {
+		return fmt.Errorf("%w, restoring the original container failed: %v", cause, err)
+	}
+	return cause
+}
+
+// recreateInPlace replaces a stopped container whose engine cannot rename
+// containers, it is created again from its spec once undone when the
+// replacement fails
+func recreateInPlace(ctx context.Context, dd Driver, current *ContainerInspect, opts ContainerCreateOptions, name string, undo func() error) error {
+	err := dd.ContainerRemove(ctx, current.ID)
+	if err != nil {
+		if undo == nil || undo() == nil {
+			dd.ContainerStart(ctx, current.ID)
+		}
+		return fmt.Errorf("Failed to remove container %s: %w", name, err)
+	}
+	opts.Name = name
+	resp, err := dd.ContainerCreate(ctx, opts)
+	if err != nil {
+		err = fmt.Errorf("Failed to re-create container %s: %w", name, err)
+	} else if err = dd.ContainerStart(ctx, resp.ID); err != nil {
+		err = fmt.Errorf("Failed to re-start container %s: %w", name, err)
+	} else {
+		err = waitRecreated(ctx, dd, resp.ID, opts)
+	}
+	if err == nil {
+		return nil
+	}
+
+	restoreCtx := context.Background()
+	if resp.ID != "" {
+		dd.ContainerStop(restoreCtx, resp.ID)
+		dd.ContainerRemove(restoreCtx, resp.ID)
+	}
+	var restoreErr error
+	if undo != nil {
+		restoreErr = undo()
+	}
+	var restored ContainerCreateResponse
+	if restoreErr == nil {
+		restored, restoreErr = dd.ContainerCreate(restoreCtx, ContainerSpec(current))
+	}
+	if restoreErr == nil {
+		restoreErr = dd.ContainerStart(restoreCtx, restored.ID)
+	}
+	if restoreErr != nil {
+		return fmt.Errorf("%w, restoring the original container failed: %v", err, restoreErr)
+	}
+	return err
+}
+
 type ImageInspect struct {
 	ID       string   `json:"Id"`
 	Created  int64    `json:"Created"`
@@ -119,6 +293,7 @@ type ImageInspect struct {
 type ImagePullOptions struct {
 	Filters map[string][]string
 	All     bool
+	Auth    *RegistryAuth
 }
 
 type ImageListOptions struct {
@@ -156,13 +331,45 @@ type ContainerBaseConfig struct {
 	HealthCheck  *HealthConfig
 	Labels       map[string]string
 	ExposedPorts nat.PortSet
+	// User is the user or user:group the command runs as
+	User string
+}
+
+type RestartPolicyName string
+
+const (
+	RestartPolicyNo            RestartPolicyName = "no"
+	RestartPolicyAlways        RestartPolicyName = "always"
+	RestartPolicyOnFailure     RestartPolicyName = "on-failure"
+	RestartPolicyUnlessStopped RestartPolicyName = "unless-stopped"
+)
+
+// RestartPolicy tells the engine when to restart the container, the
+// retries only apply to on-failure
+type RestartPolicy struct {
+	Name              RestartPolicyName
+	MaximumRetryCount int
+}
+
+// ContainerResources limits the resources of a container, zero is no limit
+type ContainerResources struct {
+	// NanoCPUs is the CPU quota in units of 1e-9 CPUs
+	NanoCPUs int64
+	// Memory is the memory limit in bytes
+	Memory int64
 }
 
 type ContainerHostConfig struct {
+	// NetworkMode is "bridge", "host", "none", "container:<name|id>" or
+	// the name of a network
 	NetworkMode  string
 	PortBindings nat.PortMap
 	Mounts       []MountPoint
 	Privileged   bool
+	// ExtraHosts are added to the container's /etc/hosts as "host:ip"
+	ExtraHosts    []string
+	RestartPolicy RestartPolicy
+	Resources     ContainerResources
 }
 
 type ContainerNetworkingConfig struct {
@@ -195,6 +402,16 @@ type ContainerSummary struct {
 	Mounts  []MountPoint
 }
 
+// ContainerLogsOptions follow the docker engine semantics, Since is
+// either a timestamp or a relative duration and Tail is a line count
+// or "all"
+type ContainerLogsOptions struct {
+	Follow     bool
+	Since      string
+	Tail       string
+	Timestamps bool
+}
+
 type ContainerNetworkConfig struct {
 	Gateway              string   `json:"Gateway"`
 	IPAddress            string   `json:"IPAddress"`
@@ -207,26 +424,31 @@ type ContainerConfig struct {
 	Hostname     string
 	ExposedPorts nat.PortSet
 	Env          map[string]string
+	Cmd          []string
 	Healthcheck  *HealthConfig
 	Image        string
 	Labels       map[string]string
+	User         string
 }
 
 // NOTE: ContainerJSONBase    for docker
-//       InspectContainerData for podman
+//
+//	InspectContainerData for podman
 type ContainerInspect struct {
 	// Base
-	ID              string          `json:"Id"`
-	Created         time.Time       `json:"Created"`
-	Path            string          `json:"Path"`
-	Args            []string        `json:"Args"`
-	State           *ContainerState `json:"State"`
-	Image           string          `json:"Image"`
-	ImageName       string          `json:"ImageName"`
-	Name            string          `json:"Name"`
-	Mounts          []MountPoint
-	Config          ContainerConfig        `json:"Config"`
-	NetworkSettings ContainerNetworkConfig `json:"NetworkSettings`
+	ID        string          `json:"Id"`
+	Created   time.Time       `json:"Created"`
+	Path      string          `json:"Path"`
+	Args      []string        `json:"Args"`
+	State     *ContainerState `json:"State"`
+	Image     string          `json:"Image"`
+	ImageName string          `json:"ImageName"`
+	Name      string          `json:"Name"`
+	Mounts    []MountPoint
+	Config    ContainerConfig `json:"Config"`
+	// HostConfig has the container's settings, but for its mounts
+	HostConfig      ContainerHostConfig    `json:"HostConfig"`
+	NetworkSettings ContainerNetworkConfig `json:"NetworkSettings"`
 }
 
 type MountPoint struct {
@@ -260,16 +482,89 @@ const (
 )
 
 type Port struct {
-	IP            string `json: "IP,omitempty"`
+	IP            string `json:"IP,omitempty"`
 	ContainerPort uint16 `json:"ContainerPort"`
 	HostPort      uint16 `json:"HostPort,omitempty"`
 	Type          string `json:"Type"`
 }
 
 type ContainerState struct {
-	Status  string
-	Running bool
-	Paused  bool
+	Status    string
+	Running   bool
+	Paused    bool
+	StartedAt time.Time
+	// Health is nil for containers without a health check
+	Health *ContainerHealth
+}
+
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// ContainerHealth is the outcome of the container's health check, Runs is
+// how many results of it the engine reports, none while it never ran
+type ContainerHealth struct {
+	Status        string
+	FailingStreak int
+	Runs          int
+}
+
+// HealthyState is the ContainerWait state reached once the health check of
+// a running container passes, a container without one is healthy as soon
+// as it runs
+const HealthyState = "healthy"
+
+// HealthCheckGrace is how long the health check of a running container may
+// take to run for the first time. Podman only runs the checks with systemd
+// timers, a container whose check never ran is healthy once it ran that
+// long, as the engine does not run its check.
+var HealthCheckGrace = 30 * time.Second
+
+// HealthCheckNeverRan tells whether the container has been running for
+// longer than HealthCheckGrace without its health check running
+func HealthCheckNeverRan(current *ContainerInspect) bool {
+	state := current.State
+	return state != nil && state.Running && state.Health != nil && state.Health.Runs == 0 &&
+		!state.StartedAt.IsZero() && time.Since(state.StartedAt) > HealthCheckGrace
+}
+
+// ContainerReached tells whether the container is in the state ContainerWait
+// waits for. A container that stops while waiting for it to be healthy
+// never will be, which is an error.
+func ContainerReached(current *ContainerInspect, state string) (bool, error) {
+	if current.State == nil {
+		return false, nil
+	}
+	if state != HealthyState {
+		return current.State.Status == state, nil
+	}
+	switch current.State.Status {
+	case "running":
+		return current.State.Health == nil || current.State.Health.Status == HealthHealthy || HealthCheckNeverRan(current), nil
+	case "exited", "dead":
+		return false, fmt.Errorf("Container %s %s before being healthy", strings.TrimPrefix(current.Name, "/"), current.State.Status)
+	}
+	return false, nil
+}
+
+// ImageVersionString describes an image by its name and the start of its
+// digest, only by its name when it was not pulled from a registry
+func ImageVersionString(id string, repoDigests []string) string {
+	if len(repoDigests) > 0 {
+		parts := strings.Split(repoDigests[0], "@")
+		if len(parts) > 1 && len(parts[1]) >= 19 {
+			return fmt.Sprintf("%s (%s)", id, parts[1][:19])
+		}
+		return repoDigests[0]
+	}
+	return id
+}
+
+// HasHealthCheck tells whether the health config runs a check
+func HasHealthCheck(config *HealthConfig) bool {
+	return config != nil && len(config.Test) > 0 && config.Test[0] != "NONE"
 }
 
 // corresponds to containers on a network
@@ -281,6 +576,11 @@ type EndpointResource struct {
 type NetworkInspect struct {
 	Name       string
 	NetworkID  string
+	Driver     string
+	Internal   bool
+	IPAM       NetworkIPAM
+	Options    map[string]string
+	Labels     map[string]string
 	Containers map[string]EndpointResource
 }
 
@@ -293,11 +593,32 @@ type NetworkEndpointSetting struct {
 	IPAddress   string
 	IPPrefixLen int
 }
+
+// NetworkIPAMConfig is a subnet of a network, IPRange restricts the
+// addresses given to containers and Gateway defaults to the first address
+type NetworkIPAMConfig struct {
+	Subnet  string `json:",omitempty"`
+	IPRange string `json:",omitempty"`
+	Gateway string `json:",omitempty"`
+}
+
+// NetworkIPAM is the address management of a network, the engine picks a
+// free subnet when there is no config
+type NetworkIPAM struct {
+	Driver  string            `json:",omitempty"`
+	Options map[string]string `json:",omitempty"`
+	Config  []NetworkIPAMConfig
+}
+
 type NetworkCreateOptions struct {
 	CheckDuplicate bool
-	Driver         string
-	Options        map[string]string
-	Labels         map[string]string
+	// Driver is "bridge" when empty
+	Driver string
+	// Internal networks are not routed outside of the host
+	Internal bool
+	IPAM     NetworkIPAM
+	Options  map[string]string
+	Labels   map[string]string
 }
 
 type NetworkCreateResponse struct {
@@ -305,9 +626,10 @@ type NetworkCreateResponse struct {
 	Warning string
 }
 
+// NetworkListOptions filters networks by id, name, label and driver with
+// the docker engine semantics
 type NetworkListOptions struct {
 	Filters map[string][]string
-	All     bool
 }
 
 type ExecResult struct {
@@ -324,6 +646,33 @@ func (res *ExecResult) Stdout() string {
 	return res.OutBuffer.String()
 }
 
+const (
+	EventTypeContainer string = "container"
+	EventTypeNetwork   string = "network"
+)
+
+// Event actions use the docker engine names, other engines translate to them
+const (
+	EventStart      string = "start"
+	EventDie        string = "die"
+	EventDestroy    string = "destroy"
+	EventConnect    string = "connect"
+	EventDisconnect string = "disconnect"
+)
+
+// Event is a container or network lifecycle event. For network events ID
+// and Name refer to the network and Container holds the container id,
+// podman does not report the network so they are empty.
+type Event struct {
+	Type       string
+	Action     string
+	ID         string
+	Name       string
+	Container  string
+	Attributes map[string]string
+	Time       time.Time
+}
+
 type Info struct {
 	ID              string
 	Name            string
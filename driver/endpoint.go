@@ -0,0 +1,70 @@
+package driver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DockerDriverName = "docker"
+	PodmanDriverName = "podman"
+	HostDriverName   = "host"
+)
+
+// EngineConfig describes how a driver connects to its container engine,
+// an empty Endpoint selects the engine's default. When PluginDir is set the
+// driver is loaded from <PluginDir>/<driver>.so instead of being built in,
+// when RPC is set the driver runs out of process and RPC is either its
+// unix:// socket or its command line.
+type EngineConfig struct {
+	Endpoint  string
+	TLSCACert string
+	TLSCert   string
+	TLSKey    string
+	PluginDir string
+	RPC       string
+}
+
+// HasTLS tells if TLS material was provided for the endpoint
+func (e EngineConfig) HasTLS() bool {
+	return e.TLSCACert != "" || e.TLSCert != "" || e.TLSKey != ""
+}
+
+// EngineEndpoints returns the well known endpoints of a container engine,
+// in the order they should be probed
+func EngineEndpoints(ced string) []string {
+	endpoints := []string{}
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	switch ced {
+	case DockerDriverName:
+		if host := os.Getenv("DOCKER_HOST"); host != "" {
+			endpoints = append(endpoints, host)
+		}
+		endpoints = append(endpoints, "unix:///var/run/docker.sock")
+		if runtimeDir != "" {
+			endpoints = append(endpoints, "unix://"+filepath.Join(runtimeDir, "docker.sock"))
+		}
+	case PodmanDriverName:
+		if host := os.Getenv("CONTAINER_HOST"); host != "" {
+			endpoints = append(endpoints, host)
+		}
+		if runtimeDir != "" {
+			endpoints = append(endpoints, "unix://"+filepath.Join(runtimeDir, "podman", "podman.sock"))
+		}
+		endpoints = append(endpoints, "unix:///run/podman/podman.sock")
+	case HostDriverName:
+		// the directory the host processes are managed from
+		endpoints = append(endpoints, hostDefaultDir())
+	}
+	return endpoints
+}
+
+// UnixSocketPath returns the socket path of a unix endpoint or an empty
+// string for any other kind of endpoint
+func UnixSocketPath(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "unix:") {
+		return ""
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(endpoint, "unix:"), "//")
+}
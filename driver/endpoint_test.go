@@ -0,0 +1,43 @@
+package driver
+
+import (
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestEngineEndpoints(t *testing.T) {
+	for _, name := range []string{"DOCKER_HOST", "CONTAINER_HOST", "XDG_RUNTIME_DIR"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+
+	assert.DeepEqual(t, EngineEndpoints(DockerDriverName), []string{"unix:///var/run/docker.sock"})
+	assert.DeepEqual(t, EngineEndpoints(PodmanDriverName), []string{"unix:///run/podman/podman.sock"})
+	assert.Equal(t, len(EngineEndpoints("containerd")), 0)
+
+	os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	os.Setenv("DOCKER_HOST", "tcp://engine.example.com:2376")
+	assert.DeepEqual(t, EngineEndpoints(DockerDriverName), []string{
+		"tcp://engine.example.com:2376",
+		"unix:///var/run/docker.sock",
+		"unix:///run/user/1000/docker.sock",
+	})
+	assert.DeepEqual(t, EngineEndpoints(PodmanDriverName), []string{
+		"unix:///run/user/1000/podman/podman.sock",
+		"unix:///run/podman/podman.sock",
+	})
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	testCases := map[string]string{
+		"unix:///run/podman/podman.sock":  "/run/podman/podman.sock",
+		"unix:/var/run/docker.sock":       "/var/run/docker.sock",
+		"tcp://engine.example.com:2376":   "",
+		"ssh://core@host/run/podman.sock": "",
+	}
+	for endpoint, expected := range testCases {
+		assert.Equal(t, UnixSocketPath(endpoint), expected, endpoint)
+	}
+}
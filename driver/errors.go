@@ -0,0 +1,41 @@
+package driver
+
+import (
+	"errors"
+)
+
+// The drivers wrap the engine errors so callers can tell the common
+// failures apart with errors.Is, the engine message is kept as is
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrAlreadyExists     = errors.New("already exists")
+	ErrTimeout           = errors.New("timeout")
+	ErrEngineUnavailable = errors.New("container engine unavailable")
+	ErrNotSupported      = errors.New("not supported")
+)
+
+// Error associates an engine error with one of the driver error kinds
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// WrapError marks err as being of the given kind, nil stays nil
+func WrapError(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
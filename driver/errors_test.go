@@ -0,0 +1,24 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	assert.Assert(t, WrapError(ErrNotFound, nil) == nil)
+
+	engineErr := fmt.Errorf("No such container: skupper-router")
+	err := fmt.Errorf("Failed to retrieve transport container: %w", WrapError(ErrNotFound, engineErr))
+	assert.Assert(t, errors.Is(err, ErrNotFound))
+	assert.Assert(t, errors.Is(err, engineErr))
+	assert.Assert(t, !errors.Is(err, ErrEngineUnavailable))
+	assert.Error(t, err, "Failed to retrieve transport container: No such container: skupper-router")
+
+	var driverErr *Error
+	assert.Assert(t, errors.As(err, &driverErr))
+	assert.Equal(t, driverErr.Kind, ErrNotFound)
+}
@@ -0,0 +1,985 @@
+// Package fake provides an in-memory implementation of driver.Driver so that
+// the client and controller can be exercised without a container engine.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+// ExecHandler computes the result of a ContainerExec call against a container
+type ExecHandler func(container *Container, cmd []string) (driver.ExecResult, error)
+
+type Container struct {
+	ID        string
+	Name      string
+	Created   time.Time
+	Status    string
+	StartedAt time.Time
+	Options   driver.ContainerCreateOptions
+	Networks  map[string]*driver.NetworkEndpointSetting
+	Restarts  int
+	ExecCalls [][]string
+	Stdout    string
+	Stderr    string
+	// Health is the health check status, empty without a health check
+	Health string
+	// ImageID is the id of the image the container was created from
+	ImageID string
+}
+
+type subscriber struct {
+	filters map[string][]string
+	events  chan driver.Event
+}
+
+// eventBacklog is how many events a subscriber may fall behind by before
+// further events are dropped
+const eventBacklog = 100
+
+type Network struct {
+	ID         string
+	Name       string
+	Options    driver.NetworkCreateOptions
+	Containers map[string]bool
+	nextHost   int
+	subnet     int
+}
+
+// Driver is a fake container engine. The zero value is not usable, use
+// NewDriver to construct one.
+type Driver struct {
+	mu          sync.Mutex
+	containers  map[string]*Container
+	networks    map[string]*Network
+	images      map[string]*driver.ImageInspect
+	execResults map[string]driver.ExecResult
+	failures    map[string]error
+	failOnce    map[string]error
+	nextSubnet  int
+	calls       []string
+	subscribers map[int]*subscriber
+	nextSub     int
+
+	// ExecHandler, when set, takes precedence over the scripted exec results
+	ExecHandler ExecHandler
+	// PullAllowed decides if an image can be pulled with the given options,
+	// all images can be pulled when it is nil
+	PullAllowed func(ref string, options driver.ImagePullOptions) bool
+	// StartError, when set, returns the error starting the container fails
+	// with, nil to start it. It must not call the driver.
+	StartError func(container *Container) error
+	// NoHealthChecks keeps the health checks from running, the containers
+	// with one stay starting as with podman without systemd
+	NoHealthChecks bool
+	EngineInfo     driver.Info
+	// EngineConfig is the configuration the driver was last created with
+	EngineConfig driver.EngineConfig
+}
+
+func NewDriver() *Driver {
+	return &Driver{
+		containers:  map[string]*Container{},
+		networks:    map[string]*Network{},
+		images:      map[string]*driver.ImageInspect{},
+		execResults: map[string]driver.ExecResult{},
+		failures:    map[string]error{},
+		failOnce:    map[string]error{},
+		subscribers: map[int]*subscriber{},
+		nextSubnet:  18,
+		EngineInfo: driver.Info{
+			ID:              "fake",
+			Name:            "fake",
+			OperatingSystem: "fake",
+			OSType:          "linux",
+			Architecture:    "x86_64",
+			ServerVersion:   "0.0.0",
+		},
+	}
+}
+
+func newID() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func execKey(cmd []string) string {
+	return strings.Join(cmd, " ")
+}
+
+// FailOn makes every subsequent call to the named driver method (e.g.
+// "ContainerStart") return err. A nil err clears the failure.
+func (d *Driver) FailOn(method string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err == nil {
+		delete(d.failures, method)
+	} else {
+		d.failures[method] = err
+	}
+}
+
+// SetExecResult scripts the result returned when cmd is executed in any
+// container
+func (d *Driver) SetExecResult(cmd []string, exitCode int, stdout string, stderr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.execResults[execKey(cmd)] = driver.ExecResult{
+		ExitCode:  exitCode,
+		OutBuffer: bytes.NewBufferString(stdout),
+		ErrBuffer: bytes.NewBufferString(stderr),
+	}
+}
+
+// SetQueryResult scripts the json returned by a "qdmanage query --type
+// <typename>" call, as issued by the qdr package
+func (d *Driver) SetQueryResult(typename string, result interface{}) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	d.SetExecResult([]string{"qdmanage", "query", "--type", typename}, 0, string(encoded), "")
+	return nil
+}
+
+// AddImage makes an image available locally without a pull
+func (d *Driver) AddImage(ref string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addImage(ref)
+}
+
+func (d *Driver) addImage(ref string) {
+	if _, ok := d.images[ref]; !ok {
+		d.images[ref] = &driver.ImageInspect{
+			ID:       "sha256:" + newID(),
+			Created:  time.Now().Unix(),
+			RepoTags: []string{ref},
+		}
+	}
+}
+
+// UpdateImage gives the image a new id, as if a newer image was pushed
+// under its name and pulled
+func (d *Driver) UpdateImage(ref string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addImage(ref)
+	d.images[ref].ID = "sha256:" + newID()
+}
+
+// Calls returns the driver methods invoked so far, in order
+func (d *Driver) Calls() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.calls...)
+}
+
+// Container returns the fake container with the given name or id
+func (d *Driver) Container(id string) (*Container, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.lookupContainer(id)
+	return c, c != nil
+}
+
+// Network returns the fake network with the given name or id
+func (d *Driver) Network(id string) (*Network, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := d.lookupNetwork(id)
+	return n, n != nil
+}
+
+// SetContainerLogs sets the output returned by ContainerLogs
+func (d *Driver) SetContainerLogs(id string, stdout string, stderr string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	c.Stdout = stdout
+	c.Stderr = stderr
+	return nil
+}
+
+// SetContainerStatus forces a container into the given status, e.g. to
+// simulate a crash with "exited"
+func (d *Driver) SetContainerStatus(id string, status string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	previous := c.Status
+	c.Status = status
+	if previous != "running" && status == "running" {
+		d.publishContainer(c, driver.EventStart)
+	} else if previous == "running" && status != "running" {
+		d.publishContainer(c, driver.EventDie)
+	}
+	return nil
+}
+
+// SetContainerHealth forces the health check status of a container, e.g.
+// to simulate a router that never becomes healthy with "unhealthy"
+func (d *Driver) SetContainerHealth(id string, status string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	c.Health = status
+	return nil
+}
+
+// started marks the container running, its health check, if any, passes
+// straight away
+func (d *Driver) started(c *Container) {
+	c.Status = "running"
+	c.StartedAt = time.Now()
+	if driver.HasHealthCheck(c.Options.ContainerConfig.HealthCheck) {
+		c.Health = driver.HealthHealthy
+		if d.NoHealthChecks {
+			c.Health = driver.HealthStarting
+		}
+	}
+}
+
+// FailOnce makes the next call to the named driver method return err, the
+// calls after it succeed again
+func (d *Driver) FailOnce(method string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failOnce[method] = err
+}
+
+func (d *Driver) record(ctx context.Context, method string) error {
+	d.calls = append(d.calls, method)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err, ok := d.failOnce[method]; ok {
+		delete(d.failOnce, method)
+		return err
+	}
+	return d.failures[method]
+}
+
+func (s *subscriber) wants(event driver.Event, labels map[string]string) bool {
+	for key, values := range s.filters {
+		matched := false
+		for _, value := range values {
+			switch key {
+			case "type":
+				matched = matched || event.Type == value
+			case "event":
+				matched = matched || event.Action == value
+			case "container":
+				matched = matched || event.Name == value || event.ID == value || event.Container == value
+			case "label":
+				parts := strings.SplitN(value, "=", 2)
+				actual, ok := labels[parts[0]]
+				matched = matched || (ok && (len(parts) == 1 || actual == parts[1]))
+			default:
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Driver) publishContainer(c *Container, action string) {
+	d.publish(driver.Event{
+		Type:       driver.EventTypeContainer,
+		Action:     action,
+		ID:         c.ID,
+		Name:       c.Name,
+		Attributes: map[string]string{"name": c.Name, "image": c.Options.ContainerConfig.Image},
+		Time:       time.Now(),
+	}, c.Options.ContainerConfig.Labels)
+}
+
+func (d *Driver) publishNetwork(n *Network, c *Container, action string) {
+	d.publish(driver.Event{
+		Type:       driver.EventTypeNetwork,
+		Action:     action,
+		ID:         n.ID,
+		Name:       n.Name,
+		Container:  c.ID,
+		Attributes: map[string]string{"name": n.Name, "container": c.ID},
+		Time:       time.Now(),
+	}, n.Options.Labels)
+}
+
+func (d *Driver) publish(event driver.Event, labels map[string]string) {
+	for _, s := range d.subscribers {
+		if s.wants(event, labels) {
+			select {
+			case s.events <- event:
+			default:
+			}
+		}
+	}
+}
+
+func notFound(kind string, id string) error {
+	return driver.WrapError(driver.ErrNotFound, fmt.Errorf("No such %s: %s", kind, id))
+}
+
+func (d *Driver) lookupContainer(id string) *Container {
+	id = strings.TrimPrefix(id, "/")
+	if c, ok := d.containers[id]; ok {
+		return c
+	}
+	for _, c := range d.containers {
+		if c.Name == id || (len(id) >= 12 && strings.HasPrefix(c.ID, id)) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (d *Driver) lookupNetwork(id string) *Network {
+	if n, ok := d.networks[id]; ok {
+		return n
+	}
+	for _, n := range d.networks {
+		if n.Name == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// connect gives the container the next address of the network's subnet,
+// the first one being the gateway's
+func (d *Driver) connect(n *Network, c *Container, aliases []string) {
+	n.nextHost++
+	n.Containers[c.ID] = true
+	config := n.inspect().IPAM.Config[0]
+	_, subnet, _ := net.ParseCIDR(config.Subnet)
+	prefixLen, _ := subnet.Mask.Size()
+	ip := subnet.IP.To4()
+	host := int(ip[3]) + n.nextHost + 1
+	c.Networks[n.Name] = &driver.NetworkEndpointSetting{
+		Aliases:     aliases,
+		NetworkID:   n.ID,
+		EndpointID:  newID(),
+		Gateway:     config.Gateway,
+		IPAddress:   net.IPv4(ip[0], ip[1], ip[2]+byte(host/256), byte(host%256)).String(),
+		IPPrefixLen: prefixLen,
+	}
+	if c.Networks[n.Name].Gateway == "" {
+		c.Networks[n.Name].Gateway = net.IPv4(ip[0], ip[1], ip[2], ip[3]+1).String()
+	}
+}
+
+func (d *Driver) New(ctx context.Context, config driver.EngineConfig) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "New"); err != nil {
+		return err
+	}
+	d.EngineConfig = config
+	return nil
+}
+
+func (d *Driver) ImageInspect(ctx context.Context, id string) (*driver.ImageInspect, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ImageInspect"); err != nil {
+		return nil, err
+	}
+	image, ok := d.images[id]
+	if !ok {
+		return nil, notFound("image", id)
+	}
+	inspect := *image
+	return &inspect, nil
+}
+
+func (d *Driver) ImagesList(ctx context.Context, options driver.ImageListOptions) ([]driver.ImageSummary, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ImagesList"); err != nil {
+		return nil, err
+	}
+	var summary []driver.ImageSummary
+	for _, image := range d.images {
+		summary = append(summary, driver.ImageSummary{
+			ID:       image.ID,
+			Created:  image.Created,
+			RepoTags: image.RepoTags,
+			Size:     image.Size,
+		})
+	}
+	return summary, nil
+}
+
+func (d *Driver) ImagesPull(ctx context.Context, refStr string, options driver.ImagePullOptions) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ImagesPull"); err != nil {
+		return nil, err
+	}
+	if d.PullAllowed != nil && !d.PullAllowed(refStr, options) {
+		return nil, fmt.Errorf("pull access denied for %s", refStr)
+	}
+	d.addImage(refStr)
+	return []string{d.images[refStr].ID}, nil
+}
+
+func (d *Driver) ImageVersion(ctx context.Context, id string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ImageVersion"); err != nil {
+		return "", err
+	}
+	image, ok := d.images[id]
+	if !ok {
+		return "", notFound("image", id)
+	}
+	return fmt.Sprintf("%s (%s)", id, image.ID[:19]), nil
+}
+
+func (d *Driver) ContainerCreate(ctx context.Context, options driver.ContainerCreateOptions) (driver.ContainerCreateResponse, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerCreate"); err != nil {
+		return driver.ContainerCreateResponse{}, err
+	}
+	if options.ContainerConfig == nil {
+		return driver.ContainerCreateResponse{}, fmt.Errorf("Container config is required")
+	}
+	if options.Name != "" && d.lookupContainer(options.Name) != nil {
+		return driver.ContainerCreateResponse{}, driver.WrapError(driver.ErrAlreadyExists, fmt.Errorf("Conflict. The container name %q is already in use", "/"+options.Name))
+	}
+	image, ok := d.images[options.ContainerConfig.Image]
+	if !ok {
+		return driver.ContainerCreateResponse{}, notFound("image", options.ContainerConfig.Image)
+	}
+	c := &Container{
+		ID:       newID(),
+		Name:     options.Name,
+		Created:  time.Now(),
+		Status:   "created",
+		Options:  options,
+		Networks: map[string]*driver.NetworkEndpointSetting{},
+		ImageID:  image.ID,
+	}
+	if c.Name == "" {
+		c.Name = c.ID[:12]
+	}
+	if options.NetworkingConfig != nil {
+		for name, endpoint := range options.NetworkingConfig.EndpointsConfig {
+			n := d.lookupNetwork(name)
+			if n == nil {
+				return driver.ContainerCreateResponse{}, notFound("network", name)
+			}
+			var aliases []string
+			if endpoint != nil {
+				aliases = endpoint.Aliases
+			}
+			d.connect(n, c, aliases)
+		}
+	}
+	d.containers[c.ID] = c
+	return driver.ContainerCreateResponse{ID: c.ID}, nil
+}
+
+func (d *Driver) ContainerStart(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerStart"); err != nil {
+		return err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	if d.StartError != nil {
+		if err := d.StartError(c); err != nil {
+			return err
+		}
+	}
+	d.started(c)
+	d.publishContainer(c, driver.EventStart)
+	return nil
+}
+
+func (d *Driver) ContainerWait(ctx context.Context, id string, state string, timeout time.Duration, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		d.mu.Lock()
+		err := d.record(ctx, "ContainerWait")
+		reached := false
+		if c := d.lookupContainer(id); c != nil && err == nil {
+			reached, err = driver.ContainerReached(d.inspect(c), state)
+		}
+		d.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if reached {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out waiting for container %s to be %s", id, state))
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *Driver) ContainerList(ctx context.Context, options driver.ContainerListOptions) ([]driver.ContainerSummary, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerList"); err != nil {
+		return nil, err
+	}
+	var list []driver.ContainerSummary
+	for _, c := range d.containers {
+		summary := driver.ContainerSummary{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Image:   c.Options.ContainerConfig.Image,
+			Command: strings.Join(c.Options.ContainerConfig.Cmd, " "),
+			Created: c.Created.Unix(),
+			Labels:  c.Options.ContainerConfig.Labels,
+			State:   c.Status,
+			Status:  c.Status,
+			ImageID: c.ImageID,
+		}
+		list = append(list, summary)
+	}
+	return driver.FilterContainers(options, list)
+}
+
+func (d *Driver) ContainerInspect(ctx context.Context, id string) (*driver.ContainerInspect, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerInspect"); err != nil {
+		return nil, err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		return nil, notFound("container", id)
+	}
+	return d.inspect(c), nil
+}
+
+func (d *Driver) inspect(c *Container) *driver.ContainerInspect {
+	config := c.Options.ContainerConfig
+	inspect := &driver.ContainerInspect{
+		ID:      c.ID,
+		Created: c.Created,
+		Args:    config.Cmd,
+		State: &driver.ContainerState{
+			Status:    c.Status,
+			Running:   c.Status == "running",
+			Paused:    c.Status == "paused",
+			StartedAt: c.StartedAt,
+		},
+		Image:     c.ImageID,
+		ImageName: config.Image,
+		Name:      "/" + c.Name,
+		Config: driver.ContainerConfig{
+			Hostname:     config.Hostname,
+			ExposedPorts: config.ExposedPorts,
+			Env:          config.Env,
+			Cmd:          config.Cmd,
+			Healthcheck:  config.HealthCheck,
+			Image:        config.Image,
+			Labels:       config.Labels,
+			User:         config.User,
+		},
+	}
+	if c.Health != "" {
+		inspect.State.Health = &driver.ContainerHealth{Status: c.Health}
+		if c.Health != driver.HealthStarting {
+			inspect.State.Health.Runs = 1
+		}
+		if c.Health == driver.HealthUnhealthy {
+			inspect.State.Health.FailingStreak = 1
+		}
+	}
+	if c.Options.HostConfig != nil {
+		inspect.Mounts = c.Options.HostConfig.Mounts
+		inspect.HostConfig = *c.Options.HostConfig
+		inspect.HostConfig.Mounts = nil
+	}
+	if len(c.Networks) > 0 {
+		inspect.NetworkSettings.Networks = map[string]*driver.NetworkEndpointSetting{}
+		for name, endpoint := range c.Networks {
+			setting := *endpoint
+			inspect.NetworkSettings.Networks[name] = &setting
+			// mimic docker, which reports the first network as the default
+			if inspect.NetworkSettings.IPAddress == "" {
+				inspect.NetworkSettings.Gateway = endpoint.Gateway
+				inspect.NetworkSettings.IPAddress = endpoint.IPAddress
+				inspect.NetworkSettings.IPPrefixLen = endpoint.IPPrefixLen
+			}
+		}
+	}
+	return inspect
+}
+
+func (d *Driver) ContainerRestart(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerRestart"); err != nil {
+		return err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	d.started(c)
+	c.Restarts++
+	d.publishContainer(c, driver.EventDie)
+	d.publishContainer(c, driver.EventStart)
+	return nil
+}
+
+func (d *Driver) ContainerStop(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerStop"); err != nil {
+		return err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	if c.Status == "running" || c.Status == "paused" {
+		c.Status = "exited"
+		d.publishContainer(c, driver.EventDie)
+	}
+	return nil
+}
+
+func (d *Driver) ContainerRemove(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerRemove"); err != nil {
+		return err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	if c.Status == "running" {
+		return fmt.Errorf("You cannot remove a running container %s. Stop the container before attempting removal", c.ID)
+	}
+	for _, n := range d.networks {
+		if n.Containers[c.ID] {
+			delete(n.Containers, c.ID)
+			d.publishNetwork(n, c, driver.EventDisconnect)
+		}
+	}
+	delete(d.containers, c.ID)
+	d.publishContainer(c, driver.EventDestroy)
+	return nil
+}
+
+func (d *Driver) ContainerRename(ctx context.Context, id string, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "ContainerRename"); err != nil {
+		return err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		return notFound("container", id)
+	}
+	if other := d.lookupContainer(name); other != nil {
+		return driver.WrapError(driver.ErrAlreadyExists, fmt.Errorf("Conflict. The container name %q is already in use", "/"+name))
+	}
+	c.Name = name
+	c.Options.Name = name
+	return nil
+}
+
+func (d *Driver) ContainerExec(ctx context.Context, id string, cmd []string) (driver.ExecResult, error) {
+	d.mu.Lock()
+	if err := d.record(ctx, "ContainerExec"); err != nil {
+		d.mu.Unlock()
+		return driver.ExecResult{}, err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		d.mu.Unlock()
+		return driver.ExecResult{}, notFound("container", id)
+	}
+	if c.Status != "running" {
+		d.mu.Unlock()
+		return driver.ExecResult{}, fmt.Errorf("Container %s is not running", id)
+	}
+	c.ExecCalls = append(c.ExecCalls, cmd)
+	handler := d.ExecHandler
+	scripted, ok := d.execResults[execKey(cmd)]
+	d.mu.Unlock()
+
+	if handler != nil {
+		return handler(c, cmd)
+	}
+	result := driver.ExecResult{
+		OutBuffer: &bytes.Buffer{},
+		ErrBuffer: &bytes.Buffer{},
+	}
+	if ok {
+		result.ExitCode = scripted.ExitCode
+		result.OutBuffer.Write(scripted.OutBuffer.Bytes())
+		result.ErrBuffer.Write(scripted.ErrBuffer.Bytes())
+	} else if len(cmd) > 1 && cmd[0] == "qdmanage" && cmd[1] == "query" {
+		// an unconfigured router has nothing to report
+		result.OutBuffer.WriteString("[]")
+	}
+	return result, nil
+}
+
+func tailLines(output string, tail string) string {
+	n, err := strconv.Atoi(tail)
+	if err != nil || n < 0 {
+		return output
+	}
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "")
+}
+
+func (d *Driver) ContainerLogs(ctx context.Context, id string, options driver.ContainerLogsOptions, stdout io.Writer, stderr io.Writer) error {
+	d.mu.Lock()
+	if err := d.record(ctx, "ContainerLogs"); err != nil {
+		d.mu.Unlock()
+		return err
+	}
+	c := d.lookupContainer(id)
+	if c == nil {
+		d.mu.Unlock()
+		return notFound("container", id)
+	}
+	outLog, errLog := c.Stdout, c.Stderr
+	d.mu.Unlock()
+
+	if _, err := io.WriteString(stdout, tailLines(outLog, options.Tail)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(stderr, tailLines(errLog, options.Tail))
+	return err
+}
+
+func (d *Driver) NetworkCreate(ctx context.Context, name string, options driver.NetworkCreateOptions) (driver.NetworkCreateResponse, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "NetworkCreate"); err != nil {
+		return driver.NetworkCreateResponse{}, err
+	}
+	if d.lookupNetwork(name) != nil {
+		return driver.NetworkCreateResponse{}, driver.WrapError(driver.ErrAlreadyExists, fmt.Errorf("network with name %s already exists", name))
+	}
+	for _, config := range options.IPAM.Config {
+		if _, subnet, err := net.ParseCIDR(config.Subnet); err != nil || subnet.IP.To4() == nil {
+			return driver.NetworkCreateResponse{}, fmt.Errorf("invalid subnet %s: only IPv4 subnets are supported", config.Subnet)
+		}
+	}
+	n := &Network{
+		ID:         newID(),
+		Name:       name,
+		Options:    options,
+		Containers: map[string]bool{},
+		subnet:     d.nextSubnet,
+	}
+	d.nextSubnet++
+	d.networks[n.ID] = n
+	return driver.NetworkCreateResponse{ID: n.ID}, nil
+}
+
+func (d *Driver) NetworkInspect(ctx context.Context, id string) (driver.NetworkInspect, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "NetworkInspect"); err != nil {
+		return driver.NetworkInspect{}, err
+	}
+	n := d.lookupNetwork(id)
+	if n == nil {
+		return driver.NetworkInspect{}, notFound("network", id)
+	}
+	inspect := n.inspect()
+	inspect.Containers = map[string]driver.EndpointResource{}
+	for cid := range n.Containers {
+		c := d.containers[cid]
+		inspect.Containers[cid] = driver.EndpointResource{
+			Name:       c.Name,
+			EndpointID: c.Networks[n.Name].EndpointID,
+		}
+	}
+	return inspect, nil
+}
+
+func (n *Network) inspect() driver.NetworkInspect {
+	inspect := driver.NetworkInspect{
+		Name:      n.Name,
+		NetworkID: n.ID,
+		Driver:    n.Options.Driver,
+		Internal:  n.Options.Internal,
+		IPAM:      n.Options.IPAM,
+		Options:   n.Options.Options,
+		Labels:    n.Options.Labels,
+	}
+	if inspect.Driver == "" {
+		inspect.Driver = "bridge"
+	}
+	if len(inspect.IPAM.Config) == 0 {
+		inspect.IPAM.Config = []driver.NetworkIPAMConfig{{
+			Subnet:  fmt.Sprintf("172.%d.0.0/16", n.subnet),
+			Gateway: fmt.Sprintf("172.%d.0.1", n.subnet),
+		}}
+	}
+	return inspect
+}
+
+func (d *Driver) NetworkList(ctx context.Context, options driver.NetworkListOptions) ([]driver.NetworkInspect, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "NetworkList"); err != nil {
+		return nil, err
+	}
+	var networks []driver.NetworkInspect
+	for _, n := range d.networks {
+		networks = append(networks, n.inspect())
+	}
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+	return driver.FilterNetworks(options, networks)
+}
+
+func (d *Driver) NetworkRemove(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "NetworkRemove"); err != nil {
+		return err
+	}
+	n := d.lookupNetwork(id)
+	if n == nil {
+		return notFound("network", id)
+	}
+	if len(n.Containers) > 0 {
+		return fmt.Errorf("error while removing network: network %s has active endpoints", n.Name)
+	}
+	delete(d.networks, n.ID)
+	return nil
+}
+
+func (d *Driver) NetworkConnect(ctx context.Context, id string, container string, aliases []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "NetworkConnect"); err != nil {
+		return err
+	}
+	n := d.lookupNetwork(id)
+	if n == nil {
+		return notFound("network", id)
+	}
+	c := d.lookupContainer(container)
+	if c == nil {
+		return notFound("container", container)
+	}
+	if n.Containers[c.ID] {
+		return driver.WrapError(driver.ErrAlreadyExists, fmt.Errorf("endpoint with name %s already exists in network %s", c.Name, n.Name))
+	}
+	d.connect(n, c, aliases)
+	d.publishNetwork(n, c, driver.EventConnect)
+	return nil
+}
+
+func (d *Driver) NetworkDisconnect(ctx context.Context, id string, container string, force bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "NetworkDisconnect"); err != nil {
+		return err
+	}
+	n := d.lookupNetwork(id)
+	if n == nil {
+		return notFound("network", id)
+	}
+	c := d.lookupContainer(container)
+	if c == nil {
+		if force {
+			return nil
+		}
+		return notFound("container", container)
+	}
+	if !n.Containers[c.ID] {
+		return fmt.Errorf("container %s is not connected to network %s", c.Name, n.Name)
+	}
+	delete(n.Containers, c.ID)
+	delete(c.Networks, n.Name)
+	d.publishNetwork(n, c, driver.EventDisconnect)
+	return nil
+}
+
+func (d *Driver) Info(ctx context.Context) (driver.Info, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.record(ctx, "Info"); err != nil {
+		return driver.Info{}, err
+	}
+	return d.EngineInfo, nil
+}
+
+func (d *Driver) Events(ctx context.Context, filters map[string][]string) (<-chan driver.Event, <-chan error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	errs := make(chan error, 1)
+	events := make(chan driver.Event, eventBacklog)
+	if err := d.record(ctx, "Events"); err != nil {
+		errs <- err
+		close(events)
+		return events, errs
+	}
+	id := d.nextSub
+	d.nextSub++
+	d.subscribers[id] = &subscriber{
+		filters: driver.EventFilters(filters),
+		events:  events,
+	}
+	go func() {
+		<-ctx.Done()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.subscribers, id)
+		close(events)
+	}()
+	return events, errs
+}
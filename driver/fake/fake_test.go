@@ -0,0 +1,345 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+	"github.com/docker/go-connections/nat"
+	"gotest.tools/assert"
+)
+
+func TestContainerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	dd := NewDriver()
+
+	_, err := dd.ContainerCreate(ctx, driver.ContainerCreateOptions{
+		Name:            "missing-image",
+		ContainerConfig: &driver.ContainerBaseConfig{Image: "nope"},
+	})
+	assert.ErrorContains(t, err, "No such image")
+
+	id := CreateRouter(t, dd)
+	current, err := dd.ContainerInspect(ctx, "skupper-router")
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, id)
+	assert.Equal(t, current.State.Status, "created")
+	assert.Equal(t, current.NetworkSettings.Networks["skupper-network"].IPAddress, "172.18.0.2")
+
+	list, err := dd.ContainerList(ctx, driver.ContainerListOptions{})
+	assert.Check(t, err)
+	assert.Equal(t, len(list), 0)
+
+	assert.Check(t, dd.ContainerStart(ctx, "skupper-router"))
+	list, err = dd.ContainerList(ctx, driver.ContainerListOptions{
+		Filters: map[string][]string{"label": {"skupper.io/component=router"}},
+	})
+	assert.Check(t, err)
+	assert.Equal(t, len(list), 1)
+	assert.Equal(t, list[0].Names[0], "/skupper-router")
+
+	assert.ErrorContains(t, dd.ContainerRemove(ctx, id), "cannot remove a running container")
+	assert.ErrorContains(t, dd.NetworkRemove(ctx, "skupper-network"), "active endpoints")
+	assert.Check(t, dd.ContainerStop(ctx, id))
+	assert.Check(t, dd.ContainerRemove(ctx, id))
+	assert.Check(t, dd.NetworkRemove(ctx, "skupper-network"))
+
+	_, err = dd.ContainerInspect(ctx, "skupper-router")
+	assert.ErrorContains(t, err, "No such container")
+}
+
+func TestContainerWaitHealthy(t *testing.T) {
+	ctx := context.Background()
+	dd := NewDriver()
+	id := CreateRouter(t, dd)
+	c, _ := dd.Container(id)
+	c.Options.ContainerConfig.HealthCheck = &driver.HealthConfig{Test: []string{"CMD", "true"}}
+
+	assert.Check(t, dd.ContainerStart(ctx, id))
+	assert.Check(t, dd.ContainerWait(ctx, id, driver.HealthyState, time.Second, time.Millisecond))
+	current, err := dd.ContainerInspect(ctx, id)
+	assert.Check(t, err)
+	assert.Equal(t, current.State.Health.Status, driver.HealthHealthy)
+
+	assert.Check(t, dd.SetContainerHealth(id, driver.HealthUnhealthy))
+	err = dd.ContainerWait(ctx, id, driver.HealthyState, 10*time.Millisecond, time.Millisecond)
+	assert.Assert(t, errors.Is(err, driver.ErrTimeout))
+
+	assert.Check(t, dd.SetContainerStatus(id, "exited"))
+	err = dd.ContainerWait(ctx, id, driver.HealthyState, time.Second, time.Millisecond)
+	assert.ErrorContains(t, err, "Container skupper-router exited before being healthy")
+}
+
+func TestNetworkOptions(t *testing.T) {
+	ctx := context.Background()
+	dd := NewDriver()
+	CreateRouter(t, dd)
+
+	_, err := dd.NetworkCreate(ctx, "site-network", driver.NetworkCreateOptions{
+		Internal: true,
+		IPAM:     driver.NetworkIPAM{Config: []driver.NetworkIPAMConfig{{Subnet: "10.99.0.0/24"}}},
+		Labels:   map[string]string{"skupper.io/site-id": "site-1"},
+	})
+	assert.Check(t, err)
+	_, err = dd.NetworkCreate(ctx, "bad-network", driver.NetworkCreateOptions{
+		IPAM: driver.NetworkIPAM{Config: []driver.NetworkIPAMConfig{{Subnet: "10.99.0.0"}}},
+	})
+	assert.ErrorContains(t, err, "invalid subnet 10.99.0.0")
+
+	assert.Check(t, dd.NetworkConnect(ctx, "site-network", "skupper-router", nil))
+	current, err := dd.ContainerInspect(ctx, "skupper-router")
+	assert.Check(t, err)
+	endpoint := current.NetworkSettings.Networks["site-network"]
+	assert.Equal(t, endpoint.IPAddress, "10.99.0.2")
+	assert.Equal(t, endpoint.Gateway, "10.99.0.1")
+	assert.Equal(t, endpoint.IPPrefixLen, 24)
+
+	networks, err := dd.NetworkList(ctx, driver.NetworkListOptions{
+		Filters: map[string][]string{"label": {"skupper.io/site-id=site-1"}},
+	})
+	assert.Check(t, err)
+	assert.Equal(t, len(networks), 1)
+	assert.Equal(t, networks[0].Name, "site-network")
+	assert.Assert(t, networks[0].Internal)
+	assert.Equal(t, networks[0].IPAM.Config[0].Subnet, "10.99.0.0/24")
+
+	networks, err = dd.NetworkList(ctx, driver.NetworkListOptions{})
+	assert.Check(t, err)
+	assert.Equal(t, len(networks), 2)
+	assert.Equal(t, networks[1].Name, "skupper-network")
+	assert.Equal(t, networks[1].Driver, "bridge")
+}
+
+func createProxy(t *testing.T, dd *Driver, hostConfig driver.ContainerHostConfig) string {
+	ctx := context.Background()
+	_, err := dd.ImagesPull(ctx, "router:latest", driver.ImagePullOptions{})
+	assert.Check(t, err)
+	_, err = dd.NetworkCreate(ctx, "skupper-network", driver.NetworkCreateOptions{})
+	assert.Check(t, err)
+	resp, err := dd.ContainerCreate(ctx, driver.ContainerCreateOptions{
+		Name: "proxy",
+		ContainerConfig: &driver.ContainerBaseConfig{
+			Image:       "router:latest",
+			User:        "1000",
+			Cmd:         []string{"qdrouterd", "-c", "/etc/config/qdrouterd.json"},
+			HealthCheck: &driver.HealthConfig{Test: []string{"CMD", "true"}},
+		},
+		HostConfig: &hostConfig,
+		NetworkingConfig: &driver.ContainerNetworkingConfig{
+			EndpointsConfig: map[string]*driver.NetworkEndpointSetting{
+				"skupper-network": {Aliases: []string{"web"}},
+			},
+		},
+	})
+	assert.Check(t, err)
+	assert.Check(t, dd.ContainerStart(ctx, "proxy"))
+	return resp.ID
+}
+
+func proxyHostConfig() driver.ContainerHostConfig {
+	return driver.ContainerHostConfig{
+		Mounts:       []driver.MountPoint{{Type: driver.TypeBind, Source: "/tmp/config", Destination: "/etc/config"}},
+		PortBindings: nat.PortMap{"8080/tcp": {{HostPort: "8080"}}},
+		ExtraHosts:   []string{"db:172.17.0.1"},
+		Privileged:   true,
+		RestartPolicy: driver.RestartPolicy{
+			Name: driver.RestartPolicyUnlessStopped,
+		},
+		Resources: driver.ContainerResources{Memory: 1024 * 1024},
+	}
+}
+
+// onlyProxy checks the proxy runs under its name and nothing is left of
+// the recreation
+func onlyProxy(t *testing.T, dd *Driver, id string) {
+	ctx := context.Background()
+	list, err := dd.ContainerList(ctx, driver.ContainerListOptions{All: true})
+	assert.Check(t, err)
+	assert.Equal(t, len(list), 1)
+	assert.DeepEqual(t, list[0].Names, []string{"/proxy"})
+	assert.Equal(t, list[0].State, "running")
+	if id != "" {
+		assert.Equal(t, list[0].ID, id)
+	}
+}
+
+func TestRecreateContainer(t *testing.T) {
+	ctx := context.Background()
+	dd := NewDriver()
+	hostConfig := proxyHostConfig()
+	id := createProxy(t, dd, hostConfig)
+
+	assert.Check(t, driver.RecreateContainer(ctx, "proxy", dd))
+	onlyProxy(t, dd, "")
+	current, ok := dd.Container("proxy")
+	assert.Assert(t, ok)
+	assert.Assert(t, current.ID != id)
+	assert.Equal(t, current.Options.ContainerConfig.User, "1000")
+	assert.DeepEqual(t, current.Options.ContainerConfig.Cmd, []string{"qdrouterd", "-c", "/etc/config/qdrouterd.json"})
+	assert.DeepEqual(t, *current.Options.HostConfig, hostConfig)
+	assert.DeepEqual(t, current.Networks["skupper-network"].Aliases, []string{"web"})
+}
+
+func TestRecreateContainerRollback(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		doc      string
+		method   string
+		err      error
+		expected string
+	}{
+		{"the replacement is rejected", "ContainerCreate", fmt.Errorf("invalid spec"), "Failed to re-create container proxy: invalid spec"},
+		{"the replacement fails to start", "ContainerStart", fmt.Errorf("port is already allocated"), "Failed to re-start container proxy: port is already allocated"},
+		{"the replacement is not healthy", "ContainerWait", driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out")), "timed out"},
+	}
+	for _, c := range testCases {
+		dd := NewDriver()
+		id := createProxy(t, dd, proxyHostConfig())
+		dd.FailOnce(c.method, c.err)
+		err := driver.RecreateContainer(ctx, "proxy", dd)
+		assert.Error(t, err, c.expected, c.doc)
+		onlyProxy(t, dd, id)
+	}
+}
+
+func TestRecreateContainerInPlace(t *testing.T) {
+	ctx := context.Background()
+	notSupported := driver.WrapError(driver.ErrNotSupported, fmt.Errorf("Podman does not support renaming container"))
+
+	dd := NewDriver()
+	dd.FailOn("ContainerRename", notSupported)
+	id := createProxy(t, dd, proxyHostConfig())
+	assert.Check(t, driver.RecreateContainer(ctx, "proxy", dd))
+	onlyProxy(t, dd, "")
+	current, _ := dd.Container("proxy")
+	assert.Assert(t, current.ID != id)
+	assert.DeepEqual(t, current.Networks["skupper-network"].Aliases, []string{"web"})
+
+	// the original spec is created again when the replacement fails
+	dd.FailOnce("ContainerWait", driver.WrapError(driver.ErrTimeout, fmt.Errorf("timed out")))
+	err := driver.RecreateContainer(ctx, "proxy", dd)
+	assert.Error(t, err, "timed out")
+	onlyProxy(t, dd, "")
+}
+
+func TestReplaceContainerUndo(t *testing.T) {
+	ctx := context.Background()
+	notSupported := driver.WrapError(driver.ErrNotSupported, fmt.Errorf("Podman does not support renaming container"))
+	for _, rename := range []error{nil, notSupported} {
+		dd := NewDriver()
+		dd.FailOn("ContainerRename", rename)
+		id := createProxy(t, dd, proxyHostConfig())
+		current, err := dd.ContainerInspect(ctx, "proxy")
+		assert.Check(t, err)
+
+		// the original starts again once undone
+		steps := []string{}
+		dd.StartError = func(c *Container) error {
+			if c.Options.ContainerConfig.Labels["replacement"] == "true" {
+				return fmt.Errorf("port is already allocated")
+			}
+			steps = append(steps, "start")
+			return nil
+		}
+		opts := driver.ContainerSpec(current)
+		opts.ContainerConfig.Labels = map[string]string{"replacement": "true"}
+		err = driver.ReplaceContainerWith(ctx, dd, current, opts, func() error {
+			steps = append(steps, "undo")
+			return nil
+		})
+		assert.ErrorContains(t, err, "port is already allocated")
+		assert.DeepEqual(t, steps, []string{"undo", "start"})
+		if rename == nil {
+			onlyProxy(t, dd, id)
+		} else {
+			onlyProxy(t, dd, "")
+		}
+	}
+}
+
+func TestContainerExecQuery(t *testing.T) {
+	ctx := context.Background()
+	dd := NewDriver()
+	CreateRouter(t, dd)
+	assert.Check(t, dd.ContainerStart(ctx, "skupper-router"))
+
+	nodes, err := qdr.GetNodes(ctx, dd)
+	assert.Check(t, err)
+	assert.Equal(t, len(nodes), 0)
+
+	assert.Check(t, dd.SetQueryResult("node", []qdr.RouterNode{
+		{Id: "a", NextHop: "(self)"},
+		{Id: "b"},
+		{Id: "c", NextHop: "b"},
+	}))
+	sites, err := qdr.GetConnectedSites(ctx, dd)
+	assert.Check(t, err)
+	assert.Equal(t, sites.Direct, 1)
+	assert.Equal(t, sites.Indirect, 1)
+	assert.Equal(t, sites.Total, 2)
+}
+
+func TestFailOn(t *testing.T) {
+	ctx := context.Background()
+	dd := NewDriver()
+	CreateRouter(t, dd)
+
+	dd.FailOn("ContainerStart", fmt.Errorf("engine on fire"))
+	assert.Error(t, dd.ContainerStart(ctx, "skupper-router"), "engine on fire")
+	dd.FailOn("ContainerStart", nil)
+	assert.Check(t, dd.ContainerStart(ctx, "skupper-router"))
+}
+
+func TestEvents(t *testing.T) {
+	dd := NewDriver()
+	CreateRouter(t, dd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := dd.Events(ctx, map[string][]string{
+		"label": {"skupper.io/component=router"},
+	})
+
+	assert.Check(t, dd.ContainerStart(ctx, "skupper-router"))
+	assert.Check(t, dd.NetworkDisconnect(ctx, "skupper-network", "skupper-router", false))
+	assert.Check(t, dd.ContainerStop(ctx, "skupper-router"))
+	assert.Check(t, dd.ContainerRemove(ctx, "skupper-router"))
+
+	expected := []string{driver.EventStart, driver.EventDie, driver.EventDestroy}
+	for _, action := range expected {
+		event := <-events
+		assert.Equal(t, event.Type, driver.EventTypeContainer)
+		assert.Equal(t, event.Action, action)
+		assert.Equal(t, event.Name, "skupper-router")
+	}
+
+	cancel()
+	_, ok := <-events
+	assert.Assert(t, !ok, "events channel should be closed once the context is done")
+	select {
+	case err := <-errs:
+		t.Fatalf("unexpected error: %s", err)
+	default:
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	dd := NewDriver()
+	CreateRouter(t, dd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err := dd.ContainerWait(ctx, "skupper-router", "running", time.Minute, 10*time.Millisecond)
+	assert.Equal(t, err, context.Canceled)
+
+	assert.Equal(t, dd.ContainerStart(ctx, "skupper-router"), context.Canceled)
+	current, err := dd.ContainerInspect(context.Background(), "skupper-router")
+	assert.Check(t, err)
+	assert.Equal(t, current.State.Status, "created")
+}
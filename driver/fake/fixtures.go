@@ -0,0 +1,43 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ajssmith/skupper-exp/driver"
+	"gotest.tools/assert"
+)
+
+// CreateContainer pulls the image and creates the container with the labels
+// on the network through the driver, creating the network when it does not
+// exist yet. It returns the container's ID.
+func CreateContainer(t *testing.T, dd driver.Driver, name string, image string, labels map[string]string, network string, aliases ...string) string {
+	ctx := context.Background()
+	_, err := dd.ImagesPull(ctx, image, driver.ImagePullOptions{})
+	assert.Check(t, err)
+	_, err = dd.NetworkCreate(ctx, network, driver.NetworkCreateOptions{})
+	if !errors.Is(err, driver.ErrAlreadyExists) {
+		assert.Check(t, err)
+	}
+	resp, err := dd.ContainerCreate(ctx, driver.ContainerCreateOptions{
+		Name: name,
+		ContainerConfig: &driver.ContainerBaseConfig{
+			Image:  image,
+			Labels: labels,
+		},
+		NetworkingConfig: &driver.ContainerNetworkingConfig{
+			EndpointsConfig: map[string]*driver.NetworkEndpointSetting{
+				network: {Aliases: aliases},
+			},
+		},
+	})
+	assert.Check(t, err)
+	return resp.ID
+}
+
+// CreateRouter creates a skupper-router container on skupper-network
+// through the driver and returns its ID
+func CreateRouter(t *testing.T, dd driver.Driver) string {
+	return CreateContainer(t, dd, "skupper-router", "router:latest", map[string]string{"application": "skupper", "skupper.io/component": "router"}, "skupper-network", "skupper-router")
+}
@@ -0,0 +1,146 @@
+package driver
+
+import (
+	"strings"
+
+	dockerfilters "github.com/docker/docker/api/types/filters"
+)
+
+// The container filters every driver supports, drivers that cannot pass
+// them to their engine list all containers and use FilterContainers
+var containerFilterKeys = map[string]bool{
+	"id":     true,
+	"name":   true,
+	"label":  true,
+	"status": true,
+}
+
+func containerFilterArgs(filters map[string][]string) dockerfilters.Args {
+	args := dockerfilters.NewArgs()
+	for key, values := range filters {
+		for _, value := range values {
+			args.Add(key, value)
+		}
+	}
+	return args
+}
+
+// ValidateContainerFilters rejects the filters a driver does not support
+func ValidateContainerFilters(filters map[string][]string) error {
+	return containerFilterArgs(filters).Validate(containerFilterKeys)
+}
+
+// MatchContainer tells whether ContainerList lists the container for the
+// options, the filters have the docker engine semantics:
+//   - every label filter must match, "key" matches any value and
+//     "key=value" that value only
+//   - id and name match when any of their values is the container's or a
+//     regular expression matching it, names start with a "/"
+//   - status matches when any of its values is the container's state
+//   - only running containers are listed unless All is set or the
+//     containers are filtered by status
+func MatchContainer(options ContainerListOptions, c ContainerSummary) bool {
+	args := containerFilterArgs(options.Filters)
+	if !options.All && !args.Contains("status") && c.State != "running" {
+		return false
+	}
+	if !args.MatchKVList("label", c.Labels) {
+		return false
+	}
+	if !args.Match("id", c.ID) {
+		return false
+	}
+	if args.Contains("name") {
+		matched := false
+		for _, name := range c.Names {
+			matched = matched || args.Match("name", name)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return args.ExactMatch("status", c.State)
+}
+
+// FilterContainers returns the containers ContainerList lists for the
+// options
+func FilterContainers(options ContainerListOptions, containers []ContainerSummary) ([]ContainerSummary, error) {
+	if err := ValidateContainerFilters(options.Filters); err != nil {
+		return nil, err
+	}
+	var listed []ContainerSummary
+	for _, c := range containers {
+		if MatchContainer(options, c) {
+			listed = append(listed, c)
+		}
+	}
+	return listed, nil
+}
+
+// The network filters every driver supports
+var networkFilterKeys = map[string]bool{
+	"id":     true,
+	"name":   true,
+	"label":  true,
+	"driver": true,
+}
+
+// ValidateNetworkFilters rejects the network filters a driver does not
+// support
+func ValidateNetworkFilters(filters map[string][]string) error {
+	return containerFilterArgs(filters).Validate(networkFilterKeys)
+}
+
+// MatchNetwork tells whether NetworkList lists the network for the
+// options, every label filter must match and id, name and driver match
+// when any of their values does, as regular expressions for id and name
+func MatchNetwork(options NetworkListOptions, n NetworkInspect) bool {
+	args := containerFilterArgs(options.Filters)
+	return args.MatchKVList("label", n.Labels) &&
+		args.Match("id", n.NetworkID) &&
+		args.Match("name", n.Name) &&
+		args.ExactMatch("driver", n.Driver)
+}
+
+// FilterNetworks returns the networks NetworkList lists for the options
+func FilterNetworks(options NetworkListOptions, networks []NetworkInspect) ([]NetworkInspect, error) {
+	if err := ValidateNetworkFilters(options.Filters); err != nil {
+		return nil, err
+	}
+	listed := []NetworkInspect{}
+	for _, n := range networks {
+		if MatchNetwork(options, n) {
+			listed = append(listed, n)
+		}
+	}
+	return listed, nil
+}
+
+// MatchEvent tells whether Events reports the event for the filters, with
+// the docker engine semantics every filter must match and any of its values
+// does, the labels are the container's or the network's
+func MatchEvent(filters map[string][]string, event Event, labels map[string]string) bool {
+	for key, values := range filters {
+		matched := false
+		for _, value := range values {
+			switch key {
+			case "type":
+				matched = matched || event.Type == value
+			case "event":
+				matched = matched || event.Action == value
+			case "container":
+				matched = matched || event.Name == value || event.ID == value || event.Container == value
+			case "label":
+				parts := strings.SplitN(value, "=", 2)
+				actual, ok := labels[parts[0]]
+				matched = matched || (ok && (len(parts) == 1 || actual == parts[1]))
+			default:
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
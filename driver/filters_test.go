@@ -0,0 +1,262 @@
+package driver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containers/podman/v2/pkg/domain/entities"
+	dockerevents "github.com/docker/docker/api/types/events"
+	"gotest.tools/assert"
+)
+
+// the containers as the docker engine lists them
+var filterTestContainers = []ContainerSummary{
+	{
+		ID:     "a1b2c3",
+		Names:  []string{"/skupper-router"},
+		Labels: map[string]string{"application": "skupper-router", "skupper.io/component": "router"},
+		State:  "running",
+	},
+	{
+		ID:     "d4e5f6",
+		Names:  []string{"/skupper-service-controller"},
+		Labels: map[string]string{"application": "skupper-service-controller", "skupper.io/component": "controller"},
+		State:  "running",
+	},
+	{
+		ID:     "0a0b0c",
+		Names:  []string{"/web"},
+		Labels: map[string]string{"application": "skupper-proxy", "skupper.io/component": "proxy"},
+		State:  "exited",
+	},
+	{
+		ID:    "f0f1f2",
+		Names: []string{"/nginx"},
+		State: "created",
+	},
+}
+
+// and as podman lists them
+var filterTestPodmanContainers = []entities.ListContainer{
+	{ID: "a1b2c3", Names: []string{"skupper-router"}, Labels: filterTestContainers[0].Labels, State: "running"},
+	{ID: "d4e5f6", Names: []string{"skupper-service-controller"}, Labels: filterTestContainers[1].Labels, State: "running"},
+	{ID: "0a0b0c", Names: []string{"web"}, Labels: filterTestContainers[2].Labels, State: "stopped"},
+	{ID: "f0f1f2", Names: []string{"nginx"}, State: "configured"},
+}
+
+var filterTestCases = []struct {
+	doc      string
+	options  ContainerListOptions
+	expected []string
+}{
+	{
+		doc:      "running containers only by default",
+		options:  ContainerListOptions{},
+		expected: []string{"skupper-router", "skupper-service-controller"},
+	},
+	{
+		doc:      "all containers",
+		options:  ContainerListOptions{All: true},
+		expected: []string{"skupper-router", "skupper-service-controller", "web", "nginx"},
+	},
+	{
+		doc:      "label value",
+		options:  ContainerListOptions{All: true, Filters: map[string][]string{"label": {"skupper.io/component=proxy"}}},
+		expected: []string{"web"},
+	},
+	{
+		doc:      "label value of stopped containers needs all",
+		options:  ContainerListOptions{Filters: map[string][]string{"label": {"skupper.io/component=proxy"}}},
+		expected: []string{},
+	},
+	{
+		doc:      "label key",
+		options:  ContainerListOptions{All: true, Filters: map[string][]string{"label": {"skupper.io/component"}}},
+		expected: []string{"skupper-router", "skupper-service-controller", "web"},
+	},
+	{
+		doc:      "every label must match",
+		options:  ContainerListOptions{Filters: map[string][]string{"label": {"application=skupper-router", "skupper.io/component=router"}}},
+		expected: []string{"skupper-router"},
+	},
+	{
+		doc:      "every label must match, none does",
+		options:  ContainerListOptions{Filters: map[string][]string{"label": {"application=skupper-router", "skupper.io/component=controller"}}},
+		expected: []string{},
+	},
+	{
+		doc:      "name is a regular expression",
+		options:  ContainerListOptions{Filters: map[string][]string{"name": {"skupper"}}},
+		expected: []string{"skupper-router", "skupper-service-controller"},
+	},
+	{
+		doc:      "names start with a slash",
+		options:  ContainerListOptions{All: true, Filters: map[string][]string{"name": {"^/web$"}}},
+		expected: []string{"web"},
+	},
+	{
+		doc:      "any name may match",
+		options:  ContainerListOptions{All: true, Filters: map[string][]string{"name": {"router", "nginx"}}},
+		expected: []string{"skupper-router", "nginx"},
+	},
+	{
+		doc:      "status lists stopped containers",
+		options:  ContainerListOptions{Filters: map[string][]string{"status": {"exited"}}},
+		expected: []string{"web"},
+	},
+	{
+		doc:      "any status may match",
+		options:  ContainerListOptions{Filters: map[string][]string{"status": {"created", "exited"}}},
+		expected: []string{"web", "nginx"},
+	},
+	{
+		doc:      "id",
+		options:  ContainerListOptions{Filters: map[string][]string{"id": {"a1b2"}}},
+		expected: []string{"skupper-router"},
+	},
+	{
+		doc:      "every filter must match",
+		options:  ContainerListOptions{Filters: map[string][]string{"name": {"skupper"}, "label": {"skupper.io/component=controller"}}},
+		expected: []string{"skupper-service-controller"},
+	},
+}
+
+func containerNames(containers []ContainerSummary) []string {
+	names := []string{}
+	for _, c := range containers {
+		names = append(names, strings.TrimPrefix(c.Names[0], "/"))
+	}
+	return names
+}
+
+func TestFilterContainers(t *testing.T) {
+	podmanContainers := []ContainerSummary{}
+	for _, c := range filterTestPodmanContainers {
+		podmanContainers = append(podmanContainers, podmanContainerSummary(c))
+	}
+	for _, c := range filterTestCases {
+		listed, err := FilterContainers(c.options, filterTestContainers)
+		assert.Check(t, err, c.doc)
+		assert.DeepEqual(t, containerNames(listed), c.expected)
+
+		// podman lists the same containers for the same filters
+		listed, err = FilterContainers(c.options, podmanContainers)
+		assert.Check(t, err, c.doc)
+		assert.DeepEqual(t, containerNames(listed), c.expected)
+	}
+}
+
+func TestFilterContainersInvalid(t *testing.T) {
+	_, err := FilterContainers(ContainerListOptions{
+		Filters: map[string][]string{"ancestor": {"qdrouterd"}},
+	}, filterTestContainers)
+	assert.Error(t, err, "Invalid filter 'ancestor'")
+}
+
+// the networks as the docker engine inspects them
+var filterTestNetworks = []NetworkInspect{
+	{
+		Name:      "skupper-network",
+		NetworkID: "n1n2n3",
+		Driver:    "bridge",
+		IPAM:      NetworkIPAM{Config: []NetworkIPAMConfig{{Subnet: "10.99.0.0/24", Gateway: "10.99.0.1"}}},
+		Labels:    map[string]string{"skupper.io/site-id": "site-1"},
+	},
+	{
+		Name:      "bridge",
+		NetworkID: "b1b2b3",
+		Driver:    "bridge",
+		IPAM:      NetworkIPAM{Config: []NetworkIPAMConfig{{Subnet: "172.17.0.0/16", Gateway: "172.17.0.1"}}},
+	},
+	{
+		Name:      "host",
+		NetworkID: "h1h2h3",
+		Driver:    "host",
+	},
+}
+
+// and the CNI config lists of the same podman networks
+var filterTestPodmanNetworks = []string{
+	`{"cniVersion": "0.4.0", "name": "skupper-network", "plugins": [
+		{"type": "bridge", "bridge": "cni-podman1", "isGateway": true, "ipMasq": true,
+		 "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.99.0.0/24", "gateway": "10.99.0.1"}]]}},
+		{"type": "portmap"}]}`,
+	`{"cniVersion": "0.4.0", "name": "internal", "plugins": [
+		{"type": "bridge", "bridge": "cni-podman2", "isGateway": false,
+		 "ipam": {"type": "host-local", "ranges": [[{"subnet": "10.98.0.0/24", "gateway": "10.98.0.1"}]]}}]}`,
+}
+
+func networkNames(networks []NetworkInspect) []string {
+	names := []string{}
+	for _, n := range networks {
+		names = append(names, n.Name)
+	}
+	return names
+}
+
+func TestFilterNetworks(t *testing.T) {
+	testCases := []struct {
+		doc      string
+		filters  map[string][]string
+		expected []string
+	}{
+		{"all networks", nil, []string{"skupper-network", "bridge", "host"}},
+		{"name is a regular expression", map[string][]string{"name": {"^skupper"}}, []string{"skupper-network"}},
+		{"label key", map[string][]string{"label": {"skupper.io/site-id"}}, []string{"skupper-network"}},
+		{"label value", map[string][]string{"label": {"skupper.io/site-id=site-2"}}, []string{}},
+		{"driver", map[string][]string{"driver": {"bridge"}}, []string{"skupper-network", "bridge"}},
+		{"id", map[string][]string{"id": {"h1h2"}}, []string{"host"}},
+	}
+	for _, c := range testCases {
+		listed, err := FilterNetworks(NetworkListOptions{Filters: c.filters}, filterTestNetworks)
+		assert.Check(t, err, c.doc)
+		assert.DeepEqual(t, networkNames(listed), c.expected)
+	}
+
+	_, err := FilterNetworks(NetworkListOptions{Filters: map[string][]string{"scope": {"local"}}}, filterTestNetworks)
+	assert.Error(t, err, "Invalid filter 'scope'")
+}
+
+func TestPodmanNetwork(t *testing.T) {
+	n, err := podmanNetwork([]byte(filterTestPodmanNetworks[0]))
+	assert.Check(t, err)
+	assert.Equal(t, n.Name, "skupper-network")
+	assert.Equal(t, n.NetworkID, "skupper-network")
+	assert.Equal(t, n.Driver, "bridge")
+	assert.Assert(t, !n.Internal)
+	assert.Equal(t, n.IPAM.Driver, "host-local")
+	assert.DeepEqual(t, n.IPAM.Config, filterTestNetworks[0].IPAM.Config)
+
+	n, err = podmanNetwork([]byte(filterTestPodmanNetworks[1]))
+	assert.Check(t, err)
+	assert.Equal(t, n.Name, "internal")
+	assert.Assert(t, n.Internal)
+}
+
+func TestPodmanEvent(t *testing.T) {
+	event := podmanEvent(entities.Event{Message: dockerevents.Message{
+		Type:   "container",
+		Action: "died",
+		Actor:  dockerevents.Actor{ID: "a1b2c3", Attributes: map[string]string{"name": "skupper-router"}},
+	}})
+	assert.Equal(t, event.Action, EventDie)
+	assert.Equal(t, event.Name, "skupper-router")
+
+	// the network is not reported, only the container
+	event = podmanEvent(entities.Event{Message: dockerevents.Message{
+		Type:   "network",
+		Action: "disconnect",
+		Actor:  dockerevents.Actor{ID: "a1b2c3", Attributes: map[string]string{"name": "skupper-router"}},
+	}})
+	assert.Equal(t, event.Type, EventTypeNetwork)
+	assert.Equal(t, event.Action, EventDisconnect)
+	assert.Equal(t, event.Container, "a1b2c3")
+	assert.Equal(t, event.Name, "")
+
+	filters := EventFilters(nil)
+	assert.Assert(t, MatchEvent(filters, event, nil))
+	assert.Assert(t, MatchEvent(filters, Event{Type: EventTypeContainer, Action: EventDestroy}, nil))
+	assert.Assert(t, !MatchEvent(filters, Event{Type: "image", Action: "pull"}, nil))
+	assert.Assert(t, !MatchEvent(filters, Event{Type: EventTypeContainer, Action: "create"}, nil))
+	assert.Assert(t, MatchEvent(map[string][]string{"container": {"a1b2c3"}}, event, nil))
+}
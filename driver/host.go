@@ -0,0 +1,1248 @@
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// hostSuperviseEnv names the container directory a supervisor runs
+	hostSuperviseEnv = "SKUPPER_HOST_SUPERVISE"
+
+	// hostStopTimeout is how long a process may take to exit once asked
+	hostStopTimeout = 10 * time.Second
+
+	// hostPollInterval is how often the state of the processes is checked
+	hostPollInterval = 250 * time.Millisecond
+
+	// a process that exits is restarted after a backoff that doubles up
+	// to the maximum, it is reset once the process ran for a while
+	hostRestartBackoff    = time.Second
+	hostRestartBackoffMax = 30 * time.Second
+	hostRestartReset      = 10 * time.Second
+
+	// the health check defaults, as docker's
+	hostHealthInterval = 30 * time.Second
+	hostHealthTimeout  = 30 * time.Second
+	hostHealthRetries  = 3
+)
+
+const (
+	hostStatusCreated    = "created"
+	hostStatusRunning    = "running"
+	hostStatusRestarting = "restarting"
+	hostStatusExited     = "exited"
+)
+
+// hostDriver runs containers as processes of the local host, each under a
+// supervisor that restarts it when it exits. There are no images, the
+// command of a container must be installed on the host. Bind mounts are
+// emulated by translating the paths found in the command, environment and
+// exec arguments, and every network is the host's network.
+type hostDriver struct {
+	dir string
+}
+
+var HostDriver hostDriver
+
+// hostContainer is the definition of a process, written by the driver
+type hostContainer struct {
+	ID       string
+	Name     string
+	Created  time.Time
+	Options  ContainerCreateOptions
+	Networks map[string][]string
+}
+
+// hostState is the state of a process, written by its supervisor
+type hostState struct {
+	Status     string
+	Pid        int
+	ProcessPid int
+	ExitCode   int
+	Restarts   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// hostHealth is the health of a process, written by the health check of
+// its supervisor for the process run it checks
+type hostHealth struct {
+	Status        string
+	FailingStreak int
+	Runs          int
+	ProcessPid    int
+}
+
+type hostNetwork struct {
+	ID      string
+	Name    string
+	Created time.Time
+	Options NetworkCreateOptions
+}
+
+func hostDefaultDir() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "skupper-host")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("skupper-host-%d", os.Getuid()))
+}
+
+func hostNotFound(kind string, id string) error {
+	return WrapError(ErrNotFound, fmt.Errorf("No such %s: %s", kind, id))
+}
+
+func newHostID() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// HostPath returns where a path of a container is found on the host given
+// the container's bind mounts, paths outside of the mounts are unchanged
+func HostPath(mounts []MountPoint, path string) string {
+	var source, rel string
+	matched := -1
+	for _, mount := range mounts {
+		dest := strings.TrimSuffix(mount.Destination, "/")
+		if dest == "" || len(dest) <= matched {
+			continue
+		}
+		if path == dest || strings.HasPrefix(path, dest+"/") {
+			source, rel, matched = mount.Source, strings.TrimPrefix(path, dest), len(dest)
+		}
+	}
+	if matched < 0 {
+		return path
+	}
+	return strings.TrimSuffix(source, "/") + rel
+}
+
+// hostArg translates a path argument, alone or as the value of an option
+func hostArg(mounts []MountPoint, arg string) string {
+	if strings.HasPrefix(arg, "/") {
+		return HostPath(mounts, arg)
+	}
+	if i := strings.Index(arg, "="); i >= 0 && strings.HasPrefix(arg[i+1:], "/") {
+		return arg[:i+1] + HostPath(mounts, arg[i+1:])
+	}
+	return arg
+}
+
+func hostArgs(mounts []MountPoint, args []string) []string {
+	translated := []string{}
+	for _, arg := range args {
+		translated = append(translated, hostArg(mounts, arg))
+	}
+	return translated
+}
+
+func (c *hostContainer) mounts() []MountPoint {
+	if c.Options.HostConfig == nil {
+		return nil
+	}
+	return c.Options.HostConfig.Mounts
+}
+
+func (c *hostContainer) config() *ContainerBaseConfig {
+	if c.Options.ContainerConfig == nil {
+		return &ContainerBaseConfig{}
+	}
+	return c.Options.ContainerConfig
+}
+
+// command returns the process command and environment as seen on the host
+func (c *hostContainer) command() ([]string, []string) {
+	config := c.config()
+	env := os.Environ()
+	if config.Hostname != "" {
+		env = append(env, "HOSTNAME="+config.Hostname)
+	}
+	for key, value := range config.Env {
+		env = append(env, key+"="+hostArg(c.mounts(), value))
+	}
+	return hostArgs(c.mounts(), config.Cmd), env
+}
+
+// healthCommand returns the health check command as seen on the host, nil
+// when there is no check to run
+func (c *hostContainer) healthCommand() []string {
+	config := c.config()
+	if !HasHealthCheck(config.HealthCheck) {
+		return nil
+	}
+	test := config.HealthCheck.Test
+	switch test[0] {
+	case "CMD":
+		if len(test) > 1 {
+			return hostArgs(c.mounts(), test[1:])
+		}
+	case "CMD-SHELL":
+		if len(test) > 1 {
+			// the paths are translated word by word
+			words := strings.Fields(strings.Join(test[1:], " "))
+			return []string{"sh", "-c", strings.Join(hostArgs(c.mounts(), words), " ")}
+		}
+	}
+	return nil
+}
+
+func (d *hostDriver) containersDir() string {
+	return filepath.Join(d.dir, "containers")
+}
+
+func (d *hostDriver) networksDir() string {
+	return filepath.Join(d.dir, "networks")
+}
+
+func (d *hostDriver) containerDir(name string) string {
+	return filepath.Join(d.containersDir(), name)
+}
+
+// writeJSON replaces a file atomically, the supervisors read the files
+// the driver writes and the other way around
+func writeJSON(file string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func readJSON(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (d *hostDriver) loadContainers() ([]*hostContainer, error) {
+	entries, err := ioutil.ReadDir(d.containersDir())
+	if err != nil {
+		return nil, WrapError(ErrEngineUnavailable, fmt.Errorf("Failed to read host processes: %w", err))
+	}
+	list := []*hostContainer{}
+	for _, entry := range entries {
+		c := &hostContainer{}
+		if err := readJSON(filepath.Join(d.containersDir(), entry.Name(), "container.json"), c); err != nil {
+			// removed concurrently or still being created
+			continue
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+func (d *hostDriver) lookupContainer(id string) (*hostContainer, error) {
+	id = strings.TrimPrefix(id, "/")
+	c := &hostContainer{}
+	if err := readJSON(filepath.Join(d.containerDir(id), "container.json"), c); err == nil {
+		return c, nil
+	}
+	list, err := d.loadContainers()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range list {
+		if c.ID == id || (len(id) >= 12 && strings.HasPrefix(c.ID, id)) {
+			return c, nil
+		}
+	}
+	return nil, hostNotFound("container", id)
+}
+
+func (d *hostDriver) saveContainer(c *hostContainer) error {
+	return writeJSON(filepath.Join(d.containerDir(c.Name), "container.json"), c)
+}
+
+// processAlive tells if a pid still runs, signal 0 only checks for it
+func processAlive(pid int) bool {
+	return pid > 0 && syscall.Kill(pid, 0) == nil
+}
+
+// state returns the state of a process, a supervisor that is gone without
+// recording it means the process is no longer running
+func (d *hostDriver) state(c *hostContainer) hostState {
+	state := hostState{Status: hostStatusCreated}
+	if err := readJSON(filepath.Join(d.containerDir(c.Name), "state.json"), &state); err != nil {
+		return state
+	}
+	if (state.Status == hostStatusRunning || state.Status == hostStatusRestarting) && !processAlive(state.Pid) {
+		state.Status = hostStatusExited
+	}
+	return state
+}
+
+func (d *hostDriver) lookupNetwork(id string) (*hostNetwork, error) {
+	n := &hostNetwork{}
+	if err := readJSON(filepath.Join(d.networksDir(), id+".json"), n); err == nil {
+		return n, nil
+	}
+	entries, err := ioutil.ReadDir(d.networksDir())
+	if err != nil {
+		return nil, WrapError(ErrEngineUnavailable, fmt.Errorf("Failed to read host networks: %w", err))
+	}
+	for _, entry := range entries {
+		n := &hostNetwork{}
+		if err := readJSON(filepath.Join(d.networksDir(), entry.Name()), n); err == nil && strings.HasPrefix(n.ID, id) && len(id) >= 12 {
+			return n, nil
+		}
+	}
+	return nil, hostNotFound("network", id)
+}
+
+// hostIPAddress returns the first address other hosts may reach this one
+// at, it stands for the address of every process
+func hostIPAddress() string {
+	interfaces, err := net.Interfaces()
+	if err == nil {
+		for _, itf := range interfaces {
+			if itf.Flags&net.FlagUp == 0 || itf.Flags&net.FlagLoopback != 0 {
+				continue
+			}
+			addrs, _ := itf.Addrs()
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil && !ipnet.IP.IsLoopback() {
+					return ipnet.IP.String()
+				}
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+func (d *hostDriver) New(ctx context.Context, config EngineConfig) error {
+	d.dir = config.Endpoint
+	if d.dir == "" {
+		d.dir = hostDefaultDir()
+	}
+	for _, dir := range []string{d.containersDir(), d.networksDir()} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return WrapError(ErrEngineUnavailable, fmt.Errorf("Failed to create host process directory: %w", err))
+		}
+	}
+	return nil
+}
+
+// ImageInspect reports every image as present, the commands of the host
+// are checked when a process starts
+func (d *hostDriver) ImageInspect(ctx context.Context, id string) (*ImageInspect, error) {
+	return &ImageInspect{
+		ID:       id,
+		RepoTags: []string{id},
+	}, nil
+}
+
+func (d *hostDriver) ImagesList(ctx context.Context, options ImageListOptions) ([]ImageSummary, error) {
+	return []ImageSummary{}, nil
+}
+
+func (d *hostDriver) ImagesPull(ctx context.Context, refStr string, options ImagePullOptions) ([]string, error) {
+	return []string{}, nil
+}
+
+func (d *hostDriver) ImageVersion(ctx context.Context, id string) (string, error) {
+	return HostDriverName, nil
+}
+
+func (d *hostDriver) ContainerCreate(ctx context.Context, options ContainerCreateOptions) (ContainerCreateResponse, error) {
+	if options.Name == "" {
+		return ContainerCreateResponse{}, fmt.Errorf("Host processes must be named")
+	}
+	if options.ContainerConfig == nil || len(options.ContainerConfig.Cmd) == 0 {
+		return ContainerCreateResponse{}, fmt.Errorf("Host process %s has no command", options.Name)
+	}
+	if err := os.Mkdir(d.containerDir(options.Name), 0755); os.IsExist(err) {
+		return ContainerCreateResponse{}, WrapError(ErrAlreadyExists, fmt.Errorf("Host process %s already exists", options.Name))
+	} else if err != nil {
+		return ContainerCreateResponse{}, WrapError(ErrEngineUnavailable, fmt.Errorf("Failed to create host process %s: %w", options.Name, err))
+	}
+	c := &hostContainer{
+		ID:       newHostID(),
+		Name:     options.Name,
+		Created:  time.Now(),
+		Options:  options,
+		Networks: map[string][]string{},
+	}
+	if options.NetworkingConfig != nil {
+		for network, setting := range options.NetworkingConfig.EndpointsConfig {
+			if _, err := d.lookupNetwork(network); err != nil {
+				os.RemoveAll(d.containerDir(options.Name))
+				return ContainerCreateResponse{}, err
+			}
+			aliases := []string{}
+			if setting != nil {
+				aliases = setting.Aliases
+			}
+			c.Networks[network] = aliases
+		}
+	}
+	if err := d.saveContainer(c); err != nil {
+		os.RemoveAll(d.containerDir(options.Name))
+		return ContainerCreateResponse{}, err
+	}
+	return ContainerCreateResponse{ID: c.ID}, nil
+}
+
+func (d *hostDriver) ContainerStart(ctx context.Context, id string) error {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return err
+	}
+	state := d.state(c)
+	if state.Status == hostStatusRunning || state.Status == hostStatusRestarting {
+		return nil
+	}
+	cmd, _ := c.command()
+	if _, err := exec.LookPath(cmd[0]); err != nil {
+		return fmt.Errorf("Failed to start host process %s: %w", c.Name, err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir := d.containerDir(c.Name)
+	logFile, err := os.OpenFile(filepath.Join(dir, "supervisor.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	supervisor := exec.Command(exe)
+	supervisor.Env = append(os.Environ(), hostSuperviseEnv+"="+dir)
+	supervisor.Dir = dir
+	supervisor.Stdout = logFile
+	supervisor.Stderr = logFile
+	// the supervisor outlives the caller and its session
+	supervisor.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := supervisor.Start(); err != nil {
+		return fmt.Errorf("Failed to start supervisor for host process %s: %w", c.Name, err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		supervisor.Wait()
+		close(exited)
+	}()
+
+	// wait for the supervisor to take over so the process is seen running
+	ticker := time.NewTicker(hostPollInterval / 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			state := hostState{}
+			if readJSON(filepath.Join(dir, "state.json"), &state) == nil && state.Pid == supervisor.Process.Pid && state.Status != hostStatusCreated {
+				return nil
+			}
+		case <-exited:
+			output, _ := ioutil.ReadFile(filepath.Join(dir, "supervisor.log"))
+			return fmt.Errorf("Supervisor for host process %s exited: %s", c.Name, strings.TrimSpace(string(output)))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (d *hostDriver) ContainerWait(ctx context.Context, id string, state string, timeout time.Duration, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		c, err := d.lookupContainer(id)
+		if err != nil {
+			return err
+		}
+		inspect, err := d.inspect(c)
+		if err != nil {
+			return err
+		}
+		reached, err := ContainerReached(inspect, state)
+		if err != nil {
+			return err
+		}
+		if reached {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return WrapError(ErrTimeout, fmt.Errorf("timed out waiting for host process %s to be %s", id, state))
+		}
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func hostStatusText(state hostState) string {
+	switch state.Status {
+	case hostStatusRunning:
+		return "Up since " + state.StartedAt.Format(time.RFC3339)
+	case hostStatusRestarting:
+		return fmt.Sprintf("Restarting (%d)", state.ExitCode)
+	case hostStatusExited:
+		return fmt.Sprintf("Exited (%d)", state.ExitCode)
+	default:
+		return "Created"
+	}
+}
+
+func (d *hostDriver) ContainerList(ctx context.Context, options ContainerListOptions) ([]ContainerSummary, error) {
+	containers, err := d.loadContainers()
+	if err != nil {
+		return nil, err
+	}
+	list := []ContainerSummary{}
+	for _, c := range containers {
+		state := d.state(c)
+		config := c.config()
+		summary := ContainerSummary{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Image:   config.Image,
+			ImageID: config.Image,
+			Command: strings.Join(config.Cmd, " "),
+			Created: c.Created.Unix(),
+			Labels:  config.Labels,
+			State:   state.Status,
+			Status:  hostStatusText(state),
+			Mounts:  c.mounts(),
+		}
+		list = append(list, summary)
+	}
+	return FilterContainers(options, list)
+}
+
+func (d *hostDriver) ContainerInspect(ctx context.Context, id string) (*ContainerInspect, error) {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	return d.inspect(c)
+}
+
+func (d *hostDriver) inspect(c *hostContainer) (*ContainerInspect, error) {
+	state := d.state(c)
+	config := c.config()
+	ipAddress := hostIPAddress()
+	inspect := &ContainerInspect{
+		ID:      c.ID,
+		Created: c.Created,
+		Path:    config.Cmd[0],
+		Args:    config.Cmd[1:],
+		State: &ContainerState{
+			Status:    state.Status,
+			Running:   state.Status == hostStatusRunning,
+			StartedAt: state.StartedAt,
+		},
+		Image:     config.Image,
+		ImageName: config.Image,
+		Name:      "/" + c.Name,
+		Mounts:    c.mounts(),
+		Config: ContainerConfig{
+			Hostname:     config.Hostname,
+			ExposedPorts: config.ExposedPorts,
+			Env:          config.Env,
+			Cmd:          config.Cmd,
+			Healthcheck:  config.HealthCheck,
+			Image:        config.Image,
+			Labels:       config.Labels,
+			User:         config.User,
+		},
+		NetworkSettings: ContainerNetworkConfig{
+			IPAddress: ipAddress,
+		},
+	}
+	if state.Status == hostStatusRunning && c.healthCommand() != nil {
+		// the check of an earlier run of the process does not count
+		health := hostHealth{}
+		readJSON(filepath.Join(d.containerDir(c.Name), "health.json"), &health)
+		if health.ProcessPid != state.ProcessPid || health.Status == "" {
+			health = hostHealth{Status: HealthStarting}
+		}
+		inspect.State.Health = &ContainerHealth{
+			Status:        health.Status,
+			FailingStreak: health.FailingStreak,
+			Runs:          health.Runs,
+		}
+	}
+	if c.Options.HostConfig != nil {
+		inspect.HostConfig = *c.Options.HostConfig
+		inspect.HostConfig.Mounts = nil
+	}
+	if len(c.Networks) > 0 {
+		inspect.NetworkSettings.Networks = map[string]*NetworkEndpointSetting{}
+		for name, aliases := range c.Networks {
+			endpoint := &NetworkEndpointSetting{
+				Aliases:   aliases,
+				IPAddress: ipAddress,
+			}
+			if n, err := d.lookupNetwork(name); err == nil {
+				endpoint.NetworkID = n.ID
+			}
+			inspect.NetworkSettings.Networks[name] = endpoint
+		}
+	}
+	return inspect, nil
+}
+
+func (d *hostDriver) ContainerRestart(ctx context.Context, id string) error {
+	if err := d.ContainerStop(ctx, id); err != nil {
+		return err
+	}
+	return d.ContainerStart(ctx, id)
+}
+
+// ContainerStop asks the supervisor to stop the process, it is killed
+// along with the supervisor when it does not exit in time
+func (d *hostDriver) ContainerStop(ctx context.Context, id string) error {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return err
+	}
+	state := d.state(c)
+	if !processAlive(state.Pid) {
+		return nil
+	}
+	if err := syscall.Kill(state.Pid, syscall.SIGTERM); err != nil {
+		return fmt.Errorf("Failed to stop host process %s: %w", c.Name, err)
+	}
+	deadline := time.Now().Add(hostStopTimeout + 2*time.Second)
+	for processAlive(state.Pid) {
+		if time.Now().After(deadline) {
+			killGroup(state.ProcessPid, syscall.SIGKILL)
+			syscall.Kill(state.Pid, syscall.SIGKILL)
+			break
+		}
+		select {
+		case <-time.After(hostPollInterval / 5):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (d *hostDriver) ContainerRemove(ctx context.Context, id string) error {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return err
+	}
+	if err := d.ContainerStop(ctx, c.Name); err != nil {
+		return err
+	}
+	return os.RemoveAll(d.containerDir(c.Name))
+}
+
+// ContainerRename renames a stopped process only, the supervisor of a
+// running one works in its directory
+func (d *hostDriver) ContainerRename(ctx context.Context, id string, name string) error {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(d.containerDir(name)); err == nil {
+		return WrapError(ErrAlreadyExists, fmt.Errorf("Host process %s already exists", name))
+	}
+	if status := d.state(c).Status; status == hostStatusRunning || status == hostStatusRestarting {
+		return fmt.Errorf("Cannot rename running host process %s", c.Name)
+	}
+	if err := os.Rename(d.containerDir(c.Name), d.containerDir(name)); err != nil {
+		return err
+	}
+	c.Name = name
+	c.Options.Name = name
+	return d.saveContainer(c)
+}
+
+func (d *hostDriver) ContainerExec(ctx context.Context, id string, cmd []string) (ExecResult, error) {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if state := d.state(c); state.Status != hostStatusRunning {
+		return ExecResult{}, fmt.Errorf("Host process %s is not running", c.Name)
+	}
+	if len(cmd) == 0 {
+		return ExecResult{}, fmt.Errorf("No command to run in host process %s", c.Name)
+	}
+	_, env := c.command()
+	args := hostArgs(c.mounts(), cmd)
+	result := ExecResult{
+		OutBuffer: &bytes.Buffer{},
+		ErrBuffer: &bytes.Buffer{},
+	}
+	command := exec.CommandContext(ctx, args[0], args[1:]...)
+	command.Env = env
+	command.Dir = d.containerDir(c.Name)
+	command.Stdout = result.OutBuffer
+	command.Stderr = result.ErrBuffer
+	err = command.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	return result, err
+}
+
+// logTail returns the offset of the last lines of a log, or 0 for all
+func logTail(file string, tail string) int64 {
+	var n int
+	if _, err := fmt.Sscanf(tail, "%d", &n); err != nil || n < 0 {
+		return 0
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	offsets := []int64{}
+	var offset int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			offsets = append(offsets, offset)
+			offset += int64(len(line))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if n >= len(offsets) {
+		return 0
+	}
+	if n == 0 {
+		return offset
+	}
+	return offsets[len(offsets)-n]
+}
+
+// copyLog writes what was appended to a log since offset
+func copyLog(file string, offset int64, w io.Writer) (int64, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return offset, nil
+	} else if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(w, f)
+	return offset + n, err
+}
+
+// ContainerLogs returns the output of the process across its restarts,
+// Since and Timestamps are not supported
+func (d *hostDriver) ContainerLogs(ctx context.Context, id string, options ContainerLogsOptions, stdout io.Writer, stderr io.Writer) error {
+	c, err := d.lookupContainer(id)
+	if err != nil {
+		return err
+	}
+	dir := d.containerDir(c.Name)
+	logs := []struct {
+		file   string
+		w      io.Writer
+		offset int64
+	}{
+		{file: filepath.Join(dir, "stdout.log"), w: stdout},
+		{file: filepath.Join(dir, "stderr.log"), w: stderr},
+	}
+	for i := range logs {
+		logs[i].offset = logTail(logs[i].file, options.Tail)
+	}
+	for {
+		for i := range logs {
+			offset, err := copyLog(logs[i].file, logs[i].offset, logs[i].w)
+			if err != nil {
+				return err
+			}
+			logs[i].offset = offset
+		}
+		if !options.Follow {
+			return nil
+		}
+		if _, err := d.lookupContainer(c.Name); err != nil {
+			return nil
+		}
+		select {
+		case <-time.After(hostPollInterval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (d *hostDriver) NetworkCreate(ctx context.Context, name string, options NetworkCreateOptions) (NetworkCreateResponse, error) {
+	file := filepath.Join(d.networksDir(), name+".json")
+	if _, err := os.Stat(file); err == nil {
+		return NetworkCreateResponse{}, WrapError(ErrAlreadyExists, fmt.Errorf("Network %s already exists", name))
+	}
+	n := &hostNetwork{
+		ID:      newHostID(),
+		Name:    name,
+		Created: time.Now(),
+		Options: options,
+	}
+	if err := writeJSON(file, n); err != nil {
+		return NetworkCreateResponse{}, err
+	}
+	return NetworkCreateResponse{ID: n.ID}, nil
+}
+
+func (d *hostDriver) NetworkInspect(ctx context.Context, id string) (NetworkInspect, error) {
+	n, err := d.lookupNetwork(id)
+	if err != nil {
+		return NetworkInspect{}, err
+	}
+	containers, err := d.loadContainers()
+	if err != nil {
+		return NetworkInspect{}, err
+	}
+	inspect := n.inspect()
+	inspect.Containers = map[string]EndpointResource{}
+	for _, c := range containers {
+		if _, ok := c.Networks[n.Name]; ok {
+			inspect.Containers[c.ID] = EndpointResource{
+				Name:       c.Name,
+				EndpointID: c.ID,
+			}
+		}
+	}
+	return inspect, nil
+}
+
+// inspect returns the settings of a network, every network being the
+// host's the driver is "host" and the addressing is the host's
+func (n *hostNetwork) inspect() NetworkInspect {
+	return NetworkInspect{
+		Name:      n.Name,
+		NetworkID: n.ID,
+		Driver:    "host",
+		Internal:  n.Options.Internal,
+		IPAM:      n.Options.IPAM,
+		Options:   n.Options.Options,
+		Labels:    n.Options.Labels,
+	}
+}
+
+func (d *hostDriver) NetworkList(ctx context.Context, options NetworkListOptions) ([]NetworkInspect, error) {
+	entries, err := ioutil.ReadDir(d.networksDir())
+	if err != nil {
+		return nil, WrapError(ErrEngineUnavailable, fmt.Errorf("Failed to read host networks: %w", err))
+	}
+	var networks []NetworkInspect
+	for _, entry := range entries {
+		n := &hostNetwork{}
+		if filepath.Ext(entry.Name()) != ".json" || readJSON(filepath.Join(d.networksDir(), entry.Name()), n) != nil {
+			continue
+		}
+		networks = append(networks, n.inspect())
+	}
+	return FilterNetworks(options, networks)
+}
+
+func (d *hostDriver) NetworkRemove(ctx context.Context, id string) error {
+	n, err := d.lookupNetwork(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(d.networksDir(), n.Name+".json"))
+}
+
+func (d *hostDriver) NetworkConnect(ctx context.Context, id string, container string, aliases []string) error {
+	n, err := d.lookupNetwork(id)
+	if err != nil {
+		return err
+	}
+	c, err := d.lookupContainer(container)
+	if err != nil {
+		return err
+	}
+	if c.Networks == nil {
+		c.Networks = map[string][]string{}
+	}
+	c.Networks[n.Name] = aliases
+	return d.saveContainer(c)
+}
+
+func (d *hostDriver) NetworkDisconnect(ctx context.Context, id string, container string, force bool) error {
+	n, err := d.lookupNetwork(id)
+	if err != nil {
+		return err
+	}
+	c, err := d.lookupContainer(container)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.Networks[n.Name]; !ok {
+		return fmt.Errorf("Host process %s is not connected to network %s", c.Name, n.Name)
+	}
+	delete(c.Networks, n.Name)
+	return d.saveContainer(c)
+}
+
+func (d *hostDriver) Info(ctx context.Context) (Info, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{
+		ID:              HostDriverName,
+		Name:            hostname,
+		OperatingSystem: runtime.GOOS,
+		OSType:          runtime.GOOS,
+		Architecture:    runtime.GOARCH,
+		ServerVersion:   runtime.Version(),
+	}, nil
+}
+
+// hostSnapshot is what the event poller compares between two polls
+type hostSnapshot struct {
+	container *hostContainer
+	status    string
+}
+
+func (d *hostDriver) snapshot() map[string]hostSnapshot {
+	snapshot := map[string]hostSnapshot{}
+	containers, err := d.loadContainers()
+	if err != nil {
+		return snapshot
+	}
+	for _, c := range containers {
+		snapshot[c.ID] = hostSnapshot{container: c, status: d.state(c).Status}
+	}
+	return snapshot
+}
+
+// diffEvents returns the events that explain the change between two
+// snapshots, in the order the engines would report them
+func (d *hostDriver) diffEvents(before map[string]hostSnapshot, after map[string]hostSnapshot) []Event {
+	events := []Event{}
+	now := time.Now()
+	container := func(c *hostContainer, action string) Event {
+		return Event{
+			Type:       EventTypeContainer,
+			Action:     action,
+			ID:         c.ID,
+			Name:       c.Name,
+			Attributes: map[string]string{"name": c.Name, "image": c.config().Image},
+			Time:       now,
+		}
+	}
+	network := func(c *hostContainer, name string, action string) Event {
+		id := name
+		if n, err := d.lookupNetwork(name); err == nil {
+			id = n.ID
+		}
+		return Event{
+			Type:       EventTypeNetwork,
+			Action:     action,
+			ID:         id,
+			Name:       name,
+			Container:  c.ID,
+			Attributes: map[string]string{"name": name, "container": c.ID},
+			Time:       now,
+		}
+	}
+	ids := []string{}
+	for id := range before {
+		ids = append(ids, id)
+	}
+	for id := range after {
+		if _, ok := before[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		old, existed := before[id]
+		current, exists := after[id]
+		wasRunning := existed && old.status == hostStatusRunning
+		running := exists && current.status == hostStatusRunning
+		if exists {
+			for name := range current.container.Networks {
+				if _, ok := old.container.networkAliases(name); !existed || !ok {
+					events = append(events, network(current.container, name, EventConnect))
+				}
+			}
+		}
+		if running && !wasRunning {
+			events = append(events, container(current.container, EventStart))
+		}
+		if wasRunning && !running {
+			events = append(events, container(old.container, EventDie))
+		}
+		if existed {
+			for name := range old.container.Networks {
+				if _, ok := current.container.networkAliases(name); !exists || !ok {
+					events = append(events, network(old.container, name, EventDisconnect))
+				}
+			}
+		}
+		if existed && !exists {
+			events = append(events, container(old.container, EventDestroy))
+		}
+	}
+	return events
+}
+
+func (c *hostContainer) networkAliases(name string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	aliases, ok := c.Networks[name]
+	return aliases, ok
+}
+
+// Events polls the processes and reports the changes between two polls
+func (d *hostDriver) Events(ctx context.Context, filters map[string][]string) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+	filters = EventFilters(filters)
+	go func() {
+		defer close(events)
+		before := d.snapshot()
+		ticker := time.NewTicker(hostPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			after := d.snapshot()
+			for _, event := range d.diffEvents(before, after) {
+				labels := map[string]string{}
+				if s, ok := after[event.ID]; ok {
+					labels = s.container.config().Labels
+				} else if s, ok := before[event.ID]; ok {
+					labels = s.container.config().Labels
+				}
+				if event.Type == EventTypeNetwork {
+					labels = nil
+					if n, err := d.lookupNetwork(event.Name); err == nil {
+						labels = n.Options.Labels
+					}
+				}
+				if !MatchEvent(filters, event, labels) {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			before = after
+		}
+	}()
+	return events, errs
+}
+
+// RunHostSupervisor supervises a host process when the program was started
+// as a supervisor by the host driver. Programs using the host driver must
+// call it first thing in main and exit when it returns true.
+func RunHostSupervisor() bool {
+	dir := os.Getenv(hostSuperviseEnv)
+	if dir == "" {
+		return false
+	}
+	os.Unsetenv(hostSuperviseEnv)
+	if err := supervise(dir); err != nil {
+		fmt.Fprintln(os.Stderr, "Host process supervisor failed:", err.Error())
+		os.Exit(1)
+	}
+	return true
+}
+
+// supervise runs the process of a container directory until the
+// supervisor is asked to stop, restarting it whenever it exits
+func supervise(dir string) error {
+	c := &hostContainer{}
+	if err := readJSON(filepath.Join(dir, "container.json"), c); err != nil {
+		return err
+	}
+	stdout, err := os.OpenFile(filepath.Join(dir, "stdout.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := os.OpenFile(filepath.Join(dir, "stderr.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer stderr.Close()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	stateFile := filepath.Join(dir, "state.json")
+	state := hostState{Pid: os.Getpid()}
+	backoff := hostRestartBackoff
+	for {
+		args, env := c.command()
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Env = env
+		cmd.Dir = dir
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		// the process gets its own group so its children are stopped too
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		exited := make(chan error, 1)
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintln(stderr, "Failed to start process:", err.Error())
+			exited <- err
+			state.ProcessPid = 0
+		} else {
+			state.ProcessPid = cmd.Process.Pid
+			go func() {
+				exited <- cmd.Wait()
+			}()
+		}
+		state.Status = hostStatusRunning
+		state.StartedAt = time.Now()
+		if err := writeJSON(stateFile, state); err != nil {
+			return err
+		}
+		checked := make(chan struct{})
+		if state.ProcessPid != 0 {
+			go checkHealth(c, dir, state.ProcessPid, env, checked)
+		}
+
+		select {
+		case err := <-exited:
+			close(checked)
+			state.ExitCode = exitCode(cmd, err)
+		case <-stop:
+			close(checked)
+			killGroup(state.ProcessPid, syscall.SIGTERM)
+			select {
+			case err := <-exited:
+				state.ExitCode = exitCode(cmd, err)
+			case <-time.After(hostStopTimeout):
+				killGroup(state.ProcessPid, syscall.SIGKILL)
+				state.ExitCode = exitCode(cmd, <-exited)
+			}
+			state.Status = hostStatusExited
+			state.FinishedAt = time.Now()
+			return writeJSON(stateFile, state)
+		}
+
+		state.Status = hostStatusRestarting
+		state.FinishedAt = time.Now()
+		state.Restarts++
+		if err := writeJSON(stateFile, state); err != nil {
+			return err
+		}
+		if state.FinishedAt.Sub(state.StartedAt) > hostRestartReset {
+			backoff = hostRestartBackoff
+		}
+		fmt.Fprintf(stderr, "Process exited with code %d, restarting in %s\n", state.ExitCode, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			state.Status = hostStatusExited
+			return writeJSON(stateFile, state)
+		}
+		if backoff *= 2; backoff > hostRestartBackoffMax {
+			backoff = hostRestartBackoffMax
+		}
+	}
+}
+
+// checkHealth runs the health check of a process run until it is closed,
+// failures do not count while the process starts and it is unhealthy once
+// they reach the retries
+func checkHealth(c *hostContainer, dir string, pid int, env []string, closed chan struct{}) {
+	test := c.healthCommand()
+	if test == nil {
+		return
+	}
+	config := c.config().HealthCheck
+	interval, timeout, retries := config.Interval, config.Timeout, config.Retries
+	if interval <= 0 {
+		interval = hostHealthInterval
+	}
+	if timeout <= 0 {
+		timeout = hostHealthTimeout
+	}
+	if retries <= 0 {
+		retries = hostHealthRetries
+	}
+	healthFile := filepath.Join(dir, "health.json")
+	health := hostHealth{Status: HealthStarting, ProcessPid: pid}
+	writeJSON(healthFile, health)
+	started := time.Now()
+	for {
+		select {
+		case <-time.After(interval):
+		case <-closed:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		cmd := exec.CommandContext(ctx, test[0], test[1:]...)
+		cmd.Env = env
+		cmd.Dir = dir
+		err := cmd.Run()
+		cancel()
+		health.Runs++
+		switch {
+		case err == nil:
+			health.Status = HealthHealthy
+			health.FailingStreak = 0
+		case time.Since(started) < config.StartPeriod:
+		default:
+			health.FailingStreak++
+			if health.FailingStreak >= retries {
+				health.Status = HealthUnhealthy
+			}
+		}
+		writeJSON(healthFile, health)
+	}
+}
+
+// killGroup signals the process group of a supervised process, a process
+// that could not be started has no group
+func killGroup(pid int, sig syscall.Signal) {
+	if pid > 0 {
+		syscall.Kill(-pid, sig)
+	}
+}
+
+func exitCode(cmd *exec.Cmd, err error) int {
+	if cmd.ProcessState != nil {
+		if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		// the command could not be run at all
+		return 127
+	}
+	return 0
+}
@@ -0,0 +1,271 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestMain(m *testing.M) {
+	// the host driver starts its supervisors from the test binary
+	if RunHostSupervisor() {
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestHostPath(t *testing.T) {
+	mounts := []MountPoint{
+		{Source: "/home/user/skupper/certs/skupper", Destination: "/etc/messaging"},
+		{Source: "/home/user/skupper/services", Destination: "/etc/messaging/services"},
+		{Source: "/home/user/skupper/users", Destination: "/etc/qpid-dispatch/sasl-users/"},
+	}
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/etc/messaging/tls.crt", "/home/user/skupper/certs/skupper/tls.crt"},
+		{"/etc/messaging", "/home/user/skupper/certs/skupper"},
+		{"/etc/messaging/services/skupper-services", "/home/user/skupper/services/skupper-services"},
+		{"/etc/qpid-dispatch/sasl-users/", "/home/user/skupper/users/"},
+		{"/etc/messaging-other/file", "/etc/messaging-other/file"},
+		{"/tmp/qdrouterd.sasldb", "/tmp/qdrouterd.sasldb"},
+	}
+	for _, c := range testCases {
+		assert.Equal(t, HostPath(mounts, c.path), c.expected, c.path)
+	}
+	assert.Equal(t, hostArg(mounts, "certFile=/etc/messaging/tls.crt"), "certFile=/home/user/skupper/certs/skupper/tls.crt")
+	assert.Equal(t, hostArg(mounts, "--type=sslProfile"), "--type=sslProfile")
+}
+
+// newTestHostDriver returns a driver managing its processes from a temp
+// dir and a func that removes them along with the dir
+func newTestHostDriver(t *testing.T) (*hostDriver, string, func()) {
+	tmpDir, err := ioutil.TempDir("", "host-driver")
+	assert.Assert(t, err)
+	d := &hostDriver{}
+	assert.Assert(t, d.New(context.Background(), EngineConfig{Endpoint: filepath.Join(tmpDir, "engine")}))
+	return d, tmpDir, func() {
+		containers, _ := d.loadContainers()
+		for _, c := range containers {
+			d.ContainerRemove(context.Background(), c.Name)
+		}
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func hostProcessOptions(name string, cmd []string, mounts []MountPoint, env map[string]string) ContainerCreateOptions {
+	return ContainerCreateOptions{
+		Name: name,
+		ContainerConfig: &ContainerBaseConfig{
+			Hostname: name,
+			Image:    "test:latest",
+			Cmd:      cmd,
+			Env:      env,
+			Labels:   map[string]string{"application": "test"},
+		},
+		HostConfig: &ContainerHostConfig{
+			Mounts: mounts,
+		},
+		NetworkingConfig: &ContainerNetworkingConfig{
+			EndpointsConfig: map[string]*NetworkEndpointSetting{
+				"test-network": {},
+			},
+		},
+	}
+}
+
+func waitForLogs(t *testing.T, d *hostDriver, name string, expected string) string {
+	ctx := context.Background()
+	var stdout, stderr bytes.Buffer
+	for i := 0; i < 100; i++ {
+		stdout.Reset()
+		stderr.Reset()
+		assert.Check(t, d.ContainerLogs(ctx, name, ContainerLogsOptions{}, &stdout, &stderr))
+		if strings.Count(stdout.String(), expected) > 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return stdout.String()
+}
+
+func TestHostProcessLifecycle(t *testing.T) {
+	ctx := context.Background()
+	d, tmpDir, cleanup := newTestHostDriver(t)
+	defer cleanup()
+
+	dataDir := filepath.Join(tmpDir, "data")
+	assert.Assert(t, os.Mkdir(dataDir, 0755))
+	assert.Assert(t, ioutil.WriteFile(filepath.Join(dataDir, "greeting"), []byte("hello"), 0644))
+
+	_, err := d.NetworkCreate(ctx, "test-network", NetworkCreateOptions{})
+	assert.Check(t, err)
+	options := hostProcessOptions("test-process",
+		[]string{"sh", "-c", "echo conf=$CONF host=$HOSTNAME; cat $0; echo; exec sleep 60", "/etc/test/greeting"},
+		[]MountPoint{{Type: TypeBind, Source: dataDir, Destination: "/etc/test"}},
+		map[string]string{"CONF": "/etc/test/conf.json"})
+	resp, err := d.ContainerCreate(ctx, options)
+	assert.Check(t, err)
+	_, err = d.ContainerCreate(ctx, options)
+	assert.Assert(t, errors.Is(err, ErrAlreadyExists))
+
+	current, err := d.ContainerInspect(ctx, "test-process")
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, resp.ID)
+	assert.Equal(t, current.State.Status, "created")
+	assert.DeepEqual(t, current.Config.Cmd, options.ContainerConfig.Cmd)
+
+	assert.Check(t, d.ContainerStart(ctx, "test-process"))
+	assert.Check(t, d.ContainerWait(ctx, "test-process", "running", 5*time.Second, 50*time.Millisecond))
+	output := waitForLogs(t, d, "test-process", "hello")
+	assert.Assert(t, strings.Contains(output, "conf="+dataDir+"/conf.json host=test-process"), output)
+	assert.Assert(t, strings.Contains(output, "hello"), output)
+
+	result, err := d.ContainerExec(ctx, "test-process", []string{"cat", "/etc/test/greeting"})
+	assert.Check(t, err)
+	assert.Equal(t, result.ExitCode, 0)
+	assert.Equal(t, result.Stdout(), "hello")
+	result, err = d.ContainerExec(ctx, "test-process", []string{"sh", "-c", "exit 4"})
+	assert.Check(t, err)
+	assert.Equal(t, result.ExitCode, 4)
+
+	containers, err := d.ContainerList(ctx, ContainerListOptions{
+		Filters: map[string][]string{"label": {"application=test"}},
+	})
+	assert.Check(t, err)
+	assert.Equal(t, len(containers), 1)
+	assert.Equal(t, containers[0].Names[0], "/test-process")
+	network, err := d.NetworkInspect(ctx, "test-network")
+	assert.Check(t, err)
+	assert.Equal(t, network.Containers[resp.ID].Name, "test-process")
+
+	assert.Check(t, d.ContainerStop(ctx, "test-process"))
+	current, err = d.ContainerInspect(ctx, resp.ID)
+	assert.Check(t, err)
+	assert.Equal(t, current.State.Status, "exited")
+	containers, err = d.ContainerList(ctx, ContainerListOptions{})
+	assert.Check(t, err)
+	assert.Equal(t, len(containers), 0)
+
+	assert.Check(t, d.ContainerRemove(ctx, "test-process"))
+	_, err = d.ContainerInspect(ctx, "test-process")
+	assert.Assert(t, errors.Is(err, ErrNotFound))
+	assert.Check(t, d.NetworkRemove(ctx, "test-network"))
+}
+
+func TestHostProcessRestart(t *testing.T) {
+	ctx := context.Background()
+	d, _, cleanup := newTestHostDriver(t)
+	defer cleanup()
+
+	_, err := d.NetworkCreate(ctx, "test-network", NetworkCreateOptions{})
+	assert.Check(t, err)
+	_, err = d.ContainerCreate(ctx, hostProcessOptions("crashing", []string{"sh", "-c", "echo run; exit 3"}, nil, nil))
+	assert.Check(t, err)
+	assert.Check(t, d.ContainerStart(ctx, "crashing"))
+
+	var state hostState
+	for i := 0; i < 100; i++ {
+		c, err := d.lookupContainer("crashing")
+		assert.Assert(t, err)
+		if state = d.state(c); state.Restarts >= 2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Assert(t, state.Restarts >= 2, "the process should be restarted")
+	assert.Equal(t, state.ExitCode, 3)
+	assert.Assert(t, strings.Count(waitForLogs(t, d, "crashing", "run"), "run") >= 2)
+
+	assert.Check(t, d.ContainerRemove(ctx, "crashing"))
+}
+
+func TestHostHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	d, tmpDir, cleanup := newTestHostDriver(t)
+	defer cleanup()
+
+	dataDir := filepath.Join(tmpDir, "data")
+	assert.Assert(t, os.Mkdir(dataDir, 0755))
+	_, err := d.NetworkCreate(ctx, "test-network", NetworkCreateOptions{})
+	assert.Check(t, err)
+	options := hostProcessOptions("checked", []string{"sleep", "60"},
+		[]MountPoint{{Type: TypeBind, Source: dataDir, Destination: "/etc/test"}}, nil)
+	options.ContainerConfig.HealthCheck = &HealthConfig{
+		Test:     []string{"CMD-SHELL", "test -f /etc/test/ready"},
+		Interval: 50 * time.Millisecond,
+		Retries:  100,
+	}
+	_, err = d.ContainerCreate(ctx, options)
+	assert.Check(t, err)
+	assert.Check(t, d.ContainerStart(ctx, "checked"))
+
+	current, err := d.ContainerInspect(ctx, "checked")
+	assert.Check(t, err)
+	assert.Equal(t, current.State.Health.Status, HealthStarting)
+	err = d.ContainerWait(ctx, "checked", HealthyState, 300*time.Millisecond, 50*time.Millisecond)
+	assert.Assert(t, errors.Is(err, ErrTimeout))
+
+	assert.Assert(t, ioutil.WriteFile(filepath.Join(dataDir, "ready"), nil, 0644))
+	assert.Check(t, d.ContainerWait(ctx, "checked", HealthyState, 5*time.Second, 50*time.Millisecond))
+	current, err = d.ContainerInspect(ctx, "checked")
+	assert.Check(t, err)
+	assert.Equal(t, current.State.Health.Status, HealthHealthy)
+
+	assert.Check(t, d.ContainerRemove(ctx, "checked"))
+}
+
+func TestHostStartMissingCommand(t *testing.T) {
+	ctx := context.Background()
+	d, _, cleanup := newTestHostDriver(t)
+	defer cleanup()
+
+	_, err := d.NetworkCreate(ctx, "test-network", NetworkCreateOptions{})
+	assert.Check(t, err)
+	_, err = d.ContainerCreate(ctx, hostProcessOptions("missing", []string{"skupper-test-no-such-command"}, nil, nil))
+	assert.Check(t, err)
+	assert.ErrorContains(t, d.ContainerStart(ctx, "missing"), "executable file not found")
+}
+
+func TestHostEvents(t *testing.T) {
+	d, _, cleanup := newTestHostDriver(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := d.NetworkCreate(ctx, "test-network", NetworkCreateOptions{})
+	assert.Check(t, err)
+	events, errs := d.Events(ctx, map[string][]string{
+		"type":  {EventTypeContainer},
+		"label": {"application=test"},
+	})
+
+	_, err = d.ContainerCreate(ctx, hostProcessOptions("test-process", []string{"sleep", "60"}, nil, nil))
+	assert.Check(t, err)
+	assert.Check(t, d.ContainerStart(ctx, "test-process"))
+	time.Sleep(2 * hostPollInterval)
+	assert.Check(t, d.ContainerRemove(ctx, "test-process"))
+
+	expected := []string{EventStart, EventDie, EventDestroy}
+	for _, action := range expected {
+		select {
+		case event := <-events:
+			assert.Equal(t, event.Type, EventTypeContainer)
+			assert.Equal(t, event.Action, action)
+			assert.Equal(t, event.Name, "test-process")
+		case err := <-errs:
+			t.Fatalf("unexpected error: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", action)
+		}
+	}
+}
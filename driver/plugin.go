@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+)
+
+// PluginABIVersion is the version of the Driver interface, it must be
+// bumped whenever the interface or the types it uses change
+const PluginABIVersion = 3
+
+// The symbols a driver plugin exports, Driver is either a Driver or a
+// pointer to one
+const (
+	PluginMetadataSymbol = "Metadata"
+	PluginDriverSymbol   = "Driver"
+)
+
+var (
+	ErrPluginNotFound = errors.New("driver plugin not found")
+	ErrPluginMismatch = errors.New("driver plugin mismatch")
+)
+
+// PluginMetadata describes a driver plugin, it is checked before the
+// plugin's driver is used
+type PluginMetadata struct {
+	Name       string
+	ABIVersion int
+	Version    string
+}
+
+// PluginFile returns the path of the plugin for a container engine driver
+func PluginFile(dir string, ced string) string {
+	return filepath.Join(dir, ced+".so")
+}
+
+// LoadPlugin opens the plugin for a container engine driver found in dir
+// and returns its driver once the metadata is verified
+func LoadPlugin(dir string, ced string) (Driver, *PluginMetadata, error) {
+	file := PluginFile(dir, ced)
+	if _, err := os.Stat(file); err != nil {
+		return nil, nil, WrapError(ErrPluginNotFound, fmt.Errorf("No driver plugin for %s found in %s: %w", ced, dir, err))
+	}
+	p, err := plugin.Open(file)
+	if err != nil {
+		// the go runtime refuses plugins built from other package versions
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Failed to open driver plugin %s, it must be built with the same version of skupper-exp: %w", file, err))
+	}
+	symMetadata, err := p.Lookup(PluginMetadataSymbol)
+	if err != nil {
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s has no %s: %w", file, PluginMetadataSymbol, err))
+	}
+	symDriver, err := p.Lookup(PluginDriverSymbol)
+	if err != nil {
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s has no %s: %w", file, PluginDriverSymbol, err))
+	}
+	return checkPlugin(file, ced, symMetadata, symDriver)
+}
+
+func checkPlugin(file string, ced string, symMetadata interface{}, symDriver interface{}) (Driver, *PluginMetadata, error) {
+	metadata, ok := symMetadata.(*PluginMetadata)
+	if !ok {
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s metadata is a %T, not a driver.PluginMetadata", file, symMetadata))
+	}
+	if metadata.ABIVersion != PluginABIVersion {
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s implements driver ABI version %d, version %d is required", file, metadata.ABIVersion, PluginABIVersion))
+	}
+	if metadata.Name != ced {
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s provides the %s driver, not %s", file, metadata.Name, ced))
+	}
+	switch drv := symDriver.(type) {
+	case *Driver:
+		if *drv == nil {
+			return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s does not set its driver", file))
+		}
+		return *drv, metadata, nil
+	case Driver:
+		return drv, metadata, nil
+	default:
+		return nil, nil, WrapError(ErrPluginMismatch, fmt.Errorf("Driver plugin %s driver is a %T, not a driver.Driver", file, symDriver))
+	}
+}
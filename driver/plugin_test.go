@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestLoadPluginNotFound(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "plugins")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	_, _, err = LoadPlugin(tmpDir, "docker")
+	assert.Assert(t, errors.Is(err, ErrPluginNotFound))
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+	assert.ErrorContains(t, err, "No driver plugin for docker found in "+tmpDir)
+}
+
+func TestCheckPlugin(t *testing.T) {
+	var builtin Driver = &DockerDriver
+	var unset Driver
+
+	testCases := []struct {
+		doc           string
+		metadata      interface{}
+		driver        interface{}
+		expectedError string
+	}{
+		{
+			doc:      "driver variable",
+			metadata: &PluginMetadata{Name: "docker", ABIVersion: PluginABIVersion},
+			driver:   &builtin,
+		},
+		{
+			doc:      "driver value",
+			metadata: &PluginMetadata{Name: "docker", ABIVersion: PluginABIVersion},
+			driver:   &DockerDriver,
+		},
+		{
+			doc:           "abi mismatch",
+			metadata:      &PluginMetadata{Name: "docker", ABIVersion: PluginABIVersion + 1},
+			driver:        &builtin,
+			expectedError: "implements driver ABI version",
+		},
+		{
+			doc:           "other driver",
+			metadata:      &PluginMetadata{Name: "podman", ABIVersion: PluginABIVersion},
+			driver:        &builtin,
+			expectedError: "provides the podman driver, not docker",
+		},
+		{
+			doc:           "bad metadata",
+			metadata:      &struct{ Name string }{Name: "docker"},
+			driver:        &builtin,
+			expectedError: "not a driver.PluginMetadata",
+		},
+		{
+			doc:           "unset driver",
+			metadata:      &PluginMetadata{Name: "docker", ABIVersion: PluginABIVersion},
+			driver:        &unset,
+			expectedError: "does not set its driver",
+		},
+		{
+			doc:           "not a driver",
+			metadata:      &PluginMetadata{Name: "docker", ABIVersion: PluginABIVersion},
+			driver:        new(string),
+			expectedError: "not a driver.Driver",
+		},
+	}
+
+	for _, c := range testCases {
+		drv, metadata, err := checkPlugin("docker.so", "docker", c.metadata, c.driver)
+		if c.expectedError == "" {
+			assert.Check(t, err, c.doc)
+			assert.Equal(t, drv, Driver(&DockerDriver), c.doc)
+			assert.Equal(t, metadata.Name, "docker", c.doc)
+		} else {
+			assert.ErrorContains(t, err, c.expectedError, c.doc)
+			assert.Assert(t, errors.Is(err, ErrPluginMismatch), c.doc)
+		}
+	}
+}
@@ -4,21 +4,32 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/podman/v2/libpod/define"
 	"github.com/containers/podman/v2/pkg/api/handlers"
 	"github.com/containers/podman/v2/pkg/bindings"
 	"github.com/containers/podman/v2/pkg/bindings/containers"
 	"github.com/containers/podman/v2/pkg/bindings/images"
 	"github.com/containers/podman/v2/pkg/bindings/network"
+	"github.com/containers/podman/v2/pkg/bindings/system"
 	"github.com/containers/podman/v2/pkg/domain/entities"
 	"github.com/containers/podman/v2/pkg/specgen"
 
+	"github.com/docker/go-connections/nat"
 	spec "github.com/opencontainers/runtime-spec/specs-go"
+	skupperutils "github.com/skupperproject/skupper/pkg/utils"
 	//	"github.com/ajssmith/skupper-exp/driver"
 )
 
@@ -30,7 +41,53 @@ type podmanClient struct {
 
 var PodmanDriver podmanClient
 
-func newPodmanContainerSpec(options ContainerCreateOptions) *specgen.SpecGenerator {
+// podmanPortMappings translates the docker port bindings, a binding
+// without a host port gets a random one
+func podmanPortMappings(bindings nat.PortMap) ([]specgen.PortMapping, error) {
+	var mappings []specgen.PortMapping
+	for port, hostBindings := range bindings {
+		for _, binding := range hostBindings {
+			mapping := specgen.PortMapping{
+				HostIP:        binding.HostIP,
+				ContainerPort: uint16(port.Int()),
+				Protocol:      port.Proto(),
+			}
+			if binding.HostPort != "" {
+				hostPort, err := strconv.ParseUint(binding.HostPort, 10, 16)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid host port %s for %s: %w", binding.HostPort, port, err)
+				}
+				mapping.HostPort = uint16(hostPort)
+			}
+			mappings = append(mappings, mapping)
+		}
+	}
+	return mappings, nil
+}
+
+// podmanResources translates the limits, the CPU quota is for the default
+// 100ms period
+func podmanResources(resources ContainerResources) *spec.LinuxResources {
+	if resources.NanoCPUs == 0 && resources.Memory == 0 {
+		return nil
+	}
+	limits := &spec.LinuxResources{}
+	if resources.NanoCPUs != 0 {
+		period := uint64(100000)
+		quota := resources.NanoCPUs * int64(period) / 1e9
+		limits.CPU = &spec.LinuxCPU{Period: &period, Quota: &quota}
+	}
+	if resources.Memory != 0 {
+		memory := resources.Memory
+		limits.Memory = &spec.LinuxMemory{Limit: &memory}
+	}
+	return limits
+}
+
+// podmanExposedPortsAnnotation keeps the exposed ports of a podman container
+const podmanExposedPortsAnnotation = "skupper.io/exposed-ports"
+
+func newPodmanContainerSpec(options ContainerCreateOptions) (*specgen.SpecGenerator, error) {
 	//	sg := specgen.NewSpecGenerator("", true)
 	sg := specgen.NewSpecGenerator(options.ContainerConfig.Image, false)
 
@@ -45,41 +102,153 @@ func newPodmanContainerSpec(options ContainerCreateOptions) *specgen.SpecGenerat
 
 	// Basic
 	sg.ContainerBasicConfig.Name = options.Name
+	sg.ContainerBasicConfig.Hostname = options.ContainerConfig.Hostname
 	sg.ContainerBasicConfig.Command = options.ContainerConfig.Cmd
 	sg.ContainerBasicConfig.Env = options.ContainerConfig.Env
+	sg.ContainerBasicConfig.Labels = options.ContainerConfig.Labels
+	if policy := options.HostConfig.RestartPolicy; policy.Name != "" {
+		sg.ContainerBasicConfig.RestartPolicy = string(policy.Name)
+		if policy.Name == RestartPolicyOnFailure && policy.MaximumRetryCount > 0 {
+			retries := uint(policy.MaximumRetryCount)
+			sg.ContainerBasicConfig.RestartRetries = &retries
+		}
+	}
 
 	// storage
 	sg.ContainerStorageConfig.Mounts = mounts
 	sg.ContainerStorageConfig.Image = options.ContainerConfig.Image
 
 	// Security
-	sg.ContainerSecurityConfig.Privileged = true
+	sg.ContainerSecurityConfig.Privileged = options.HostConfig.Privileged
+	sg.ContainerSecurityConfig.User = options.ContainerConfig.User
+
+	// Health
+	if hc := options.ContainerConfig.HealthCheck; hc != nil {
+		sg.ContainerHealthCheckConfig.HealthConfig = &manifest.Schema2HealthConfig{
+			Test:        hc.Test,
+			Interval:    hc.Interval,
+			Timeout:     hc.Timeout,
+			StartPeriod: hc.StartPeriod,
+			Retries:     hc.Retries,
+		}
+	}
+
+	// Resources
+	sg.ContainerResourceConfig.ResourceLimits = podmanResources(options.HostConfig.Resources)
 
 	// Neworking
 	cniNetworks := make([]string, 0, len(options.NetworkingConfig.EndpointsConfig))
-	for netName, _ := range options.NetworkingConfig.EndpointsConfig {
+	aliases := make(map[string][]string)
+	for netName, setting := range options.NetworkingConfig.EndpointsConfig {
 		cniNetworks = append(cniNetworks, netName)
+		if setting != nil && len(setting.Aliases) > 0 {
+			aliases[netName] = setting.Aliases
+		}
 	}
-	//var networks []string
-	//networks = append(networks, "skupper-network")
-	//	sg.ContainerNetworkConfig.NetNS.NSMode = "Bridge"
+	switch mode := options.HostConfig.NetworkMode; {
+	case mode == "" || mode == "default" || mode == "bridge":
+	case mode == "host":
+		sg.ContainerNetworkConfig.NetNS = specgen.Namespace{NSMode: specgen.Host}
+	case mode == "none":
+		sg.ContainerNetworkConfig.NetNS = specgen.Namespace{NSMode: specgen.NoNetwork}
+	case strings.HasPrefix(mode, "container:"):
+		sg.ContainerNetworkConfig.NetNS = specgen.Namespace{NSMode: specgen.FromContainer, Value: strings.TrimPrefix(mode, "container:")}
+	default:
+		// a network, which the endpoints may name as well
+		if _, ok := options.NetworkingConfig.EndpointsConfig[mode]; !ok {
+			cniNetworks = append(cniNetworks, mode)
+		}
+	}
+	if sg.ContainerNetworkConfig.NetNS.NSMode == "" {
+		sg.ContainerNetworkConfig.CNINetworks = cniNetworks
+		if len(aliases) > 0 {
+			sg.ContainerNetworkConfig.Aliases = aliases
+		}
+	}
+	sg.ContainerNetworkConfig.HostAdd = options.HostConfig.ExtraHosts
+	if len(options.ContainerConfig.ExposedPorts) > 0 {
+		sg.ContainerNetworkConfig.Expose = make(map[uint16]string)
+		exposed := []string{}
+		for port := range options.ContainerConfig.ExposedPorts {
+			sg.ContainerNetworkConfig.Expose[uint16(port.Int())] = port.Proto()
+			exposed = append(exposed, string(port))
+		}
+		// podman does not report the exposed ports, they are kept for
+		// the container to be created again
+		sort.Strings(exposed)
+		sg.ContainerBasicConfig.Annotations = map[string]string{
+			podmanExposedPortsAnnotation: strings.Join(exposed, ","),
+		}
+	}
+	portMappings, err := podmanPortMappings(options.HostConfig.PortBindings)
+	if err != nil {
+		return nil, err
+	}
+	sg.ContainerNetworkConfig.PortMappings = portMappings
+	return sg, nil
+}
 
-	sg.ContainerNetworkConfig.CNINetworks = cniNetworks
-	return sg
+// bindingsContext carries the podman connection stored by New along with
+// the deadline and cancellation of the caller's context
+type bindingsContext struct {
+	context.Context
+	conn context.Context
 }
 
-func (c *podmanClient) New() error {
+func (b bindingsContext) Value(key interface{}) interface{} {
+	if value := b.conn.Value(key); value != nil {
+		return value
+	}
+	return b.Context.Value(key)
+}
+
+func (c *podmanClient) connContext(ctx context.Context) context.Context {
+	return bindingsContext{Context: ctx, conn: c.ctx}
+}
+
+// podmanError maps the podman service errors to the driver error kinds
+func podmanError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var model entities.ErrorModel
+	if errors.As(err, &model) {
+		switch {
+		case model.Code() == http.StatusNotFound:
+			return WrapError(ErrNotFound, err)
+		case model.Code() == http.StatusConflict, strings.Contains(model.Error(), "already in use"),
+			strings.Contains(model.Error(), "already exists"):
+			return WrapError(ErrAlreadyExists, err)
+		}
+		return err
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return WrapError(ErrTimeout, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return WrapError(ErrTimeout, err)
+	case errors.As(err, &netErr):
+		return WrapError(ErrEngineUnavailable, err)
+	}
+	return err
+}
+
+func (c *podmanClient) New(ctx context.Context, config EngineConfig) error {
 	fmt.Println("Inside podman plugin new")
 
-	//sock_dir := os.Getenv("XDG_RUNTIME_DIR")
-	//	socket := "unix:" + sock_dir + "/podman/podman.sock"
-	//	socket := "unix:/run/user/1000/podman/podman.sock"
-	socket := "unix:/var/run/podman/podman.sock"
+	if config.HasTLS() {
+		return fmt.Errorf("TLS is not supported by the podman driver, use a unix or ssh endpoint")
+	}
+	socket := config.Endpoint
+	if socket == "" {
+		socket = "unix:/var/run/podman/podman.sock"
+	}
 
 	fmt.Println("Let's connect to podman")
-	ctx, err := bindings.NewConnection(context.Background(), socket)
+	ctx, err := bindings.NewConnection(ctx, socket)
 	if err != nil {
-		return fmt.Errorf("Coudnt's connect to podman: %w", err)
+		return fmt.Errorf("Coudnt's connect to podman: %w", WrapError(ErrEngineUnavailable, err))
 	}
 	PodmanDriver.ctx = ctx
 	PodmanDriver.timeout = DefaultTimeout
@@ -88,12 +257,12 @@ func (c *podmanClient) New() error {
 	return nil
 }
 
-func (c *podmanClient) ImageInspect(id string) (*ImageInspect, error) {
+func (c *podmanClient) ImageInspect(ctx context.Context, id string) (*ImageInspect, error) {
 	fmt.Println("In podman inspect image")
 
-	data, err := images.GetImage(c.ctx, id, nil)
+	data, err := images.GetImage(c.connContext(ctx), id, nil)
 	if err != nil {
-		return &ImageInspect{}, err
+		return &ImageInspect{}, podmanError(err)
 	}
 	image := &ImageInspect{
 		ID:       data.ID,
@@ -103,21 +272,40 @@ func (c *podmanClient) ImageInspect(id string) (*ImageInspect, error) {
 	return image, nil
 }
 
-func (c *podmanClient) ImagesPull(refStr string, options ImagePullOptions) ([]string, error) {
+func (c *podmanClient) ImagesPull(ctx context.Context, refStr string, options ImagePullOptions) ([]string, error) {
 	fmt.Println("In podman pull images")
-	strSlice, err := images.Pull(c.ctx, refStr, entities.ImagePullOptions{})
+	opts := entities.ImagePullOptions{}
+	if options.Auth != nil {
+		opts.Username = options.Auth.Username
+		opts.Password = options.Auth.Password
+	}
+	// the bindings do not cancel requests, stop waiting for the pull
+	// when the context is done
+	var strSlice []string
+	pulled := make(chan error, 1)
+	go func() {
+		var err error
+		strSlice, err = images.Pull(c.connContext(ctx), refStr, opts)
+		pulled <- err
+	}()
+	var err error
+	select {
+	case err = <-pulled:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("Could not pull image: %w", err)
+		return nil, fmt.Errorf("Could not pull image: %w", podmanError(err))
 	}
 	return strSlice, nil
 }
 
-func (c *podmanClient) ImagesList(options ImageListOptions) ([]ImageSummary, error) {
+func (c *podmanClient) ImagesList(ctx context.Context, options ImageListOptions) ([]ImageSummary, error) {
 	fmt.Println("In podman list images")
 
-	images, err := images.List(c.ctx, nil, nil)
+	images, err := images.List(c.connContext(ctx), nil, nil)
 	if err != nil {
-		return nil, err
+		return nil, podmanError(err)
 	}
 	var summary []ImageSummary
 	for _, image := range images {
@@ -132,79 +320,153 @@ func (c *podmanClient) ImagesList(options ImageListOptions) ([]ImageSummary, err
 	return summary, nil
 }
 
-func (c *podmanClient) ImageVersion(id string) (string, error) {
-	return "no-image", nil
+func (c *podmanClient) ImageVersion(ctx context.Context, id string) (string, error) {
+	data, err := images.GetImage(c.connContext(ctx), id, nil)
+	if err != nil {
+		return "", podmanError(err)
+	}
+	return ImageVersionString(id, data.RepoDigests), nil
 }
 
-func (c *podmanClient) ContainerCreate(options ContainerCreateOptions) (ContainerCreateResponse, error) {
+func (c *podmanClient) ContainerCreate(ctx context.Context, options ContainerCreateOptions) (ContainerCreateResponse, error) {
 	fmt.Println("Inside podman container create")
 	//	s := specgen.NewSpecGenerator(image, false)
-	spec := newPodmanContainerSpec(options)
-	r, err := containers.CreateWithSpec(c.ctx, spec)
+	spec, err := newPodmanContainerSpec(options)
 	if err != nil {
 		return ContainerCreateResponse{}, err
 	}
+	r, err := containers.CreateWithSpec(c.connContext(ctx), spec)
+	if err != nil {
+		return ContainerCreateResponse{}, podmanError(err)
+	}
 
 	return ContainerCreateResponse{ID: r.ID}, nil
 }
 
-func (c *podmanClient) ContainerStart(id string) error {
+func (c *podmanClient) ContainerStart(ctx context.Context, id string) error {
 	fmt.Println("Inside podman start container")
-	err := containers.Start(c.ctx, id, nil)
-	return err
+	err := containers.Start(c.connContext(ctx), id, nil)
+	return podmanError(err)
 }
 
-func (c *podmanClient) ContainerWait(id string, status string, timeout time.Duration, interval time.Duration) error {
+func (c *podmanClient) ContainerWait(ctx context.Context, id string, status string, timeout time.Duration, interval time.Duration) error {
 	fmt.Println("Inside podman container wait")
-	// TODO: Should we have retry with context here?
-	waitState := define.ContainerStateRunning
-	_, err := containers.Wait(c.ctx, id, &waitState)
-	return err
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := skupperutils.RetryWithContext(ctx, interval, func() (bool, error) {
+		container, err := c.ContainerInspect(ctx, id)
+		if err != nil {
+			return false, nil
+		}
+		return ContainerReached(container, status)
+	})
+	return podmanError(err)
+}
+
+// podmanState returns the docker state for a podman container state
+func podmanState(state string) string {
+	switch state {
+	case "configured":
+		return "created"
+	case "stopped":
+		return "exited"
+	default:
+		return state
+	}
+}
+
+// podmanContainerSummary returns the container as the docker engine lists
+// it, with the names starting with a "/" and the docker states
+func podmanContainerSummary(container entities.ListContainer) ContainerSummary {
+	names := []string{}
+	for _, name := range container.Names {
+		names = append(names, "/"+name)
+	}
+	// TODO all fields
+	return ContainerSummary{
+		ID:      container.ID,
+		Names:   names,
+		Image:   container.Image,
+		ImageID: container.ImageID,
+		Command: strings.Join(container.Command, " "),
+		Created: container.Created,
+		//Ports:   container.Ports,
+		Labels: container.Labels,
+		State:  podmanState(container.State),
+		Status: container.Status,
+		//Mounts:  container.Mounts,
+	}
 }
 
-func (c *podmanClient) ContainerList(ContainerListOptions) ([]ContainerSummary, error) {
+func (c *podmanClient) ContainerList(ctx context.Context, options ContainerListOptions) ([]ContainerSummary, error) {
 	fmt.Println("Inside podman container list")
-	// TODO convert options
-	var latestContainers = 1
-	cl, err := containers.List(c.ctx, nil, nil, &latestContainers, nil, nil, nil)
+	// podman's filters differ from docker's, all the containers are listed
+	// and filtered here
+	if err := ValidateContainerFilters(options.Filters); err != nil {
+		return nil, err
+	}
+	all := true
+	cl, err := containers.List(c.connContext(ctx), nil, &all, nil, nil, nil, nil)
+	if err != nil {
+		return nil, podmanError(err)
+	}
 	var dc []ContainerSummary
 	for _, container := range cl {
-		// TODO all fields
-		//fmt.Println("Container list name, id", container.Names[0], container.ID)
-		if container.Names[0] != "skupper-service-controller" {
-			dc = append(dc, ContainerSummary{
-				ID:      container.ID,
-				Names:   container.Names,
-				Image:   container.Image,
-				ImageID: container.ImageID,
-				//Command: container.Command,
-				//Ports:   container.Ports,
-				Labels: container.Labels,
-				State:  container.State,
-				Status: container.Status,
-				//Mounts:  container.Mounts,
-			})
-		}
+		dc = append(dc, podmanContainerSummary(container))
 	}
-	return dc, err
+	return FilterContainers(options, dc)
 }
 
-func (c *podmanClient) ContainerInspect(id string) (*ContainerInspect, error) {
-	fmt.Println("Inside podman container inspect")
-	container, err := containers.Inspect(c.ctx, id, nil)
-	if err != nil {
-		return &ContainerInspect{}, err
+// podmanHostConfig returns the settings podman reports for a container
+func podmanHostConfig(hc *define.InspectContainerHostConfig) ContainerHostConfig {
+	config := ContainerHostConfig{}
+	if hc == nil {
+		return config
+	}
+	config.NetworkMode = hc.NetworkMode
+	config.Privileged = hc.Privileged
+	config.ExtraHosts = hc.ExtraHosts
+	config.Resources = ContainerResources{
+		NanoCPUs: hc.NanoCpus,
+		Memory:   hc.Memory,
+	}
+	if hc.RestartPolicy != nil {
+		config.RestartPolicy = RestartPolicy{
+			Name:              RestartPolicyName(hc.RestartPolicy.Name),
+			MaximumRetryCount: int(hc.RestartPolicy.MaximumRetryCount),
+		}
 	}
+	if len(hc.PortBindings) > 0 {
+		config.PortBindings = nat.PortMap{}
+		for port, hostPorts := range hc.PortBindings {
+			for _, hostPort := range hostPorts {
+				config.PortBindings[nat.Port(port)] = append(config.PortBindings[nat.Port(port)], nat.PortBinding{
+					HostIP:   hostPort.HostIP,
+					HostPort: hostPort.HostPort,
+				})
+			}
+		}
+	}
+	return config
+}
+
+// podmanContainer returns what podman reports of a container as docker
+// would. Podman keeps no exposed ports, they are read back from the
+// annotation they are created with, and the published ports are exposed as
+// well.
+func podmanContainer(container *define.InspectContainerData) *ContainerInspect {
 	icd := &ContainerInspect{
 		ID:      container.ID,
 		Created: container.Created,
 		Path:    container.Path,
 		Args:    container.Args,
 		//		State: cd.State,
-		Image:     container.Image,
-		ImageName: container.ImageName,
-		Name:      container.Name,
-		//		Mounts: cd.Mounts,
+		Image:      container.Image,
+		ImageName:  container.ImageName,
+		Name:       container.Name,
+		HostConfig: podmanHostConfig(container.HostConfig),
 		NetworkSettings: ContainerNetworkConfig{
 			Gateway:              container.NetworkSettings.Gateway,
 			IPAddress:            container.NetworkSettings.IPAddress,
@@ -212,93 +474,278 @@ func (c *podmanClient) ContainerInspect(id string) (*ContainerInspect, error) {
 			SecondaryIPAddresses: container.NetworkSettings.SecondaryIPAddresses,
 		},
 	}
+	if container.State != nil {
+		icd.State = &ContainerState{
+			Status:    podmanState(container.State.Status),
+			Running:   container.State.Running,
+			Paused:    container.State.Paused,
+			StartedAt: container.State.StartedAt,
+		}
+		// podman reports no status until the first check of a container
+		// with one has run
+		health := container.State.Healthcheck
+		if health.Status != "" || (container.Config != nil && container.Config.Healthcheck != nil) {
+			status := health.Status
+			if status == "" {
+				status = HealthStarting
+			}
+			icd.State.Health = &ContainerHealth{
+				Status:        status,
+				FailingStreak: health.FailingStreak,
+				Runs:          len(health.Log),
+			}
+		}
+	}
+	for _, mount := range container.Mounts {
+		icd.Mounts = append(icd.Mounts, MountPoint{
+			Type:        MountType(mount.Type),
+			Name:        mount.Name,
+			Source:      mount.Source,
+			Destination: mount.Destination,
+			Driver:      mount.Driver,
+			Mode:        mount.Mode,
+			RW:          mount.RW,
+		})
+	}
+	if container.Config != nil {
+		envVars := make(map[string]string)
+		for _, env := range container.Config.Env {
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) == 2 && parts[1] != "" {
+				envVars[parts[0]] = parts[1]
+			}
+		}
+		icd.Config = ContainerConfig{
+			Hostname: container.Config.Hostname,
+			Env:      envVars,
+			Cmd:      container.Config.Cmd,
+			Image:    container.Config.Image,
+			Labels:   container.Config.Labels,
+			User:     container.Config.User,
+		}
+		if exposed := container.Config.Annotations[podmanExposedPortsAnnotation]; exposed != "" {
+			icd.Config.ExposedPorts = nat.PortSet{}
+			for _, port := range strings.Split(exposed, ",") {
+				icd.Config.ExposedPorts[nat.Port(port)] = struct{}{}
+			}
+		}
+		if hc := container.Config.Healthcheck; hc != nil {
+			icd.Config.Healthcheck = &HealthConfig{
+				Test:        hc.Test,
+				Interval:    hc.Interval,
+				Timeout:     hc.Timeout,
+				StartPeriod: hc.StartPeriod,
+				Retries:     hc.Retries,
+			}
+		}
+	}
+	for port := range icd.HostConfig.PortBindings {
+		if icd.Config.ExposedPorts == nil {
+			icd.Config.ExposedPorts = nat.PortSet{}
+		}
+		icd.Config.ExposedPorts[port] = struct{}{}
+	}
 	if len(container.NetworkSettings.Networks) > 0 {
 		icd.NetworkSettings.Networks = make(map[string]*NetworkEndpointSetting)
 		for net, setting := range container.NetworkSettings.Networks {
 			endpoint := new(NetworkEndpointSetting)
 			endpoint.NetworkID = net
+			endpoint.Aliases = setting.Aliases
+			endpoint.Links = setting.Links
 			endpoint.Gateway = setting.Gateway
 			endpoint.IPAddress = setting.IPAddress
 			endpoint.IPPrefixLen = setting.IPPrefixLen
 			icd.NetworkSettings.Networks[net] = endpoint
 		}
 	}
-	return icd, err
+	return icd
+}
+
+func (c *podmanClient) ContainerInspect(ctx context.Context, id string) (*ContainerInspect, error) {
+	fmt.Println("Inside podman container inspect")
+	container, err := containers.Inspect(c.connContext(ctx), id, nil)
+	if err != nil {
+		return &ContainerInspect{}, podmanError(err)
+	}
+	return podmanContainer(container), nil
 }
 
-func (c *podmanClient) ContainerRestart(id string) error {
+func (c *podmanClient) ContainerRestart(ctx context.Context, id string) error {
 	fmt.Println("Inside podman restart container")
-	err := containers.Restart(c.ctx, id, nil)
-	return err
+	err := containers.Restart(c.connContext(ctx), id, nil)
+	return podmanError(err)
 }
 
-func (c *podmanClient) ContainerStop(id string) error {
+func (c *podmanClient) ContainerStop(ctx context.Context, id string) error {
 	fmt.Println("Inside podman stop container")
-	err := containers.Stop(c.ctx, id, nil)
-	return err
+	err := containers.Stop(c.connContext(ctx), id, nil)
+	return podmanError(err)
 }
 
-func (c *podmanClient) ContainerRemove(id string) error {
+func (c *podmanClient) ContainerRemove(ctx context.Context, id string) error {
 	force := true
 	fmt.Println("Inside podman container remove")
-	return containers.Remove(c.ctx, id, &force, &force)
+	return podmanError(containers.Remove(c.connContext(ctx), id, &force, &force))
+}
+
+// ContainerRename is not supported, podman 2 has no rename
+func (c *podmanClient) ContainerRename(ctx context.Context, id string, name string) error {
+	return WrapError(ErrNotSupported, fmt.Errorf("Podman does not support renaming container %s", id))
 }
 
-func (c *podmanClient) NetworkCreate(name string, options NetworkCreateOptions) (NetworkCreateResponse, error) {
+func (c *podmanClient) NetworkCreate(ctx context.Context, name string, options NetworkCreateOptions) (NetworkCreateResponse, error) {
 	fmt.Println("Inside podman network create")
 	nco := entities.NetworkCreateOptions{
-		Driver: options.Driver,
-		//		Options: options.Options,
-		//		Labels:  options.Labels,
+		Driver:   options.Driver,
+		Internal: options.Internal,
+	}
+	switch len(options.IPAM.Config) {
+	case 0:
+	case 1:
+		config := options.IPAM.Config[0]
+		if config.Subnet != "" {
+			_, subnet, err := net.ParseCIDR(config.Subnet)
+			if err != nil {
+				return NetworkCreateResponse{}, fmt.Errorf("Invalid subnet %s: %w", config.Subnet, err)
+			}
+			nco.Subnet = *subnet
+		}
+		if config.IPRange != "" {
+			_, ipRange, err := net.ParseCIDR(config.IPRange)
+			if err != nil {
+				return NetworkCreateResponse{}, fmt.Errorf("Invalid ip range %s: %w", config.IPRange, err)
+			}
+			nco.Range = *ipRange
+		}
+		if config.Gateway != "" {
+			if nco.Gateway = net.ParseIP(config.Gateway); nco.Gateway == nil {
+				return NetworkCreateResponse{}, fmt.Errorf("Invalid gateway %s", config.Gateway)
+			}
+		}
+	default:
+		return NetworkCreateResponse{}, fmt.Errorf("Podman networks have a single subnet")
+	}
+	// podman networks carry no driver options, they are ignored, the
+	// labels identify a network and cannot be
+	if len(options.Labels) > 0 {
+		return NetworkCreateResponse{}, WrapError(ErrNotSupported, fmt.Errorf("Podman networks carry no labels"))
 	}
-	resp, err := network.Create(c.ctx, nco, &name)
+	_, err := network.Create(c.connContext(ctx), nco, &name)
 	if err != nil {
-		return NetworkCreateResponse{}, err
+		return NetworkCreateResponse{}, podmanError(err)
 	}
-	fmt.Printf("Network create response %+v\n", resp)
-	return NetworkCreateResponse{}, err
+	// podman networks are known by their name only
+	return NetworkCreateResponse{ID: name}, nil
 }
 
-func (c *podmanClient) NetworkInspect(id string) (NetworkInspect, error) {
+// podmanNetworkConfig is the part of a podman network's CNI config list
+// that maps to the docker network settings
+type podmanNetworkConfig struct {
+	Name    string `json:"name"`
+	Plugins []struct {
+		Type      string `json:"type"`
+		IsGateway bool   `json:"isGateway"`
+		IPAM      struct {
+			Type   string `json:"type"`
+			Ranges [][]struct {
+				Subnet  string `json:"subnet"`
+				Gateway string `json:"gateway"`
+			} `json:"ranges"`
+		} `json:"ipam"`
+	} `json:"plugins"`
+}
+
+// podmanNetwork returns the inspect data of a podman network from its CNI
+// config list, the first plugin is the network's driver
+func podmanNetwork(conflist []byte) (NetworkInspect, error) {
+	config := podmanNetworkConfig{}
+	if err := json.Unmarshal(conflist, &config); err != nil {
+		return NetworkInspect{}, fmt.Errorf("Failed to decode podman network config: %w", err)
+	}
+	n := NetworkInspect{
+		Name:      config.Name,
+		NetworkID: config.Name,
+	}
+	if len(config.Plugins) > 0 {
+		plugin := config.Plugins[0]
+		n.Driver = plugin.Type
+		n.Internal = plugin.Type == "bridge" && !plugin.IsGateway
+		n.IPAM.Driver = plugin.IPAM.Type
+		for _, ranges := range plugin.IPAM.Ranges {
+			for _, r := range ranges {
+				n.IPAM.Config = append(n.IPAM.Config, NetworkIPAMConfig{
+					Subnet:  r.Subnet,
+					Gateway: r.Gateway,
+				})
+			}
+		}
+	}
+	return n, nil
+}
+
+func (c *podmanClient) NetworkInspect(ctx context.Context, id string) (NetworkInspect, error) {
 	fmt.Println("Inside podman network inspect")
-	// nir is map[string]interface
-	nir, err := network.Inspect(c.ctx, id)
-	//	fmt.Println("nir name: ", nir[0]["name"])
-	name := fmt.Sprintf("%v", nir[0]["name"])
-	//	fmt.Println("nir cniversion: ", nir[0]["cniVersion"])
-	//	fmt.Println("nir plugins: ", nir[0]["plugins"])
-
-	//	fmt.Println("NIR is:", nir)
-	//	var dnr driver.NetworkResource
-	//	if _, ok := nir["name"]; ok {
-	//		dnr.Name = nir["name"]
-	//	}
-	return NetworkInspect{Name: name}, err
-}
-
-func (c *podmanClient) NetworkRemove(id string) error {
+	nir, err := network.Inspect(c.connContext(ctx), id)
+	if err != nil {
+		return NetworkInspect{}, podmanError(err)
+	}
+	if len(nir) == 0 {
+		return NetworkInspect{}, WrapError(ErrNotFound, fmt.Errorf("No such network: %s", id))
+	}
+	// the report is the network's CNI config list
+	conflist, err := json.Marshal(nir[0])
+	if err != nil {
+		return NetworkInspect{}, err
+	}
+	return podmanNetwork(conflist)
+}
+
+func (c *podmanClient) NetworkList(ctx context.Context, options NetworkListOptions) ([]NetworkInspect, error) {
+	fmt.Println("Inside podman network list")
+	if err := ValidateNetworkFilters(options.Filters); err != nil {
+		return nil, err
+	}
+	reports, err := network.List(c.connContext(ctx), entities.NetworkListOptions{})
+	if err != nil {
+		return nil, podmanError(err)
+	}
+	var networks []NetworkInspect
+	for _, report := range reports {
+		if report.NetworkConfigList == nil {
+			continue
+		}
+		n, err := podmanNetwork(report.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, n)
+	}
+	return FilterNetworks(options, networks)
+}
+
+func (c *podmanClient) NetworkRemove(ctx context.Context, id string) error {
 	force := true
 	fmt.Println("Inside podman network remove for: ", id)
-	_, err := network.Remove(c.ctx, id, &force)
-	return err
+	_, err := network.Remove(c.connContext(ctx), id, &force)
+	return podmanError(err)
 }
 
-func (c *podmanClient) NetworkConnect(id string, container string, aliases []string) error {
+func (c *podmanClient) NetworkConnect(ctx context.Context, id string, container string, aliases []string) error {
 	fmt.Println("Inside podman network connect: ", id, container)
-	err := network.Connect(c.ctx, id, entities.NetworkConnectOptions{
+	err := network.Connect(c.connContext(ctx), id, entities.NetworkConnectOptions{
 		Container: container,
 		Aliases:   aliases,
 	})
-	return err
+	return podmanError(err)
 }
 
-func (c *podmanClient) NetworkDisconnect(id string, container string, force bool) error {
+func (c *podmanClient) NetworkDisconnect(ctx context.Context, id string, container string, force bool) error {
 	fmt.Println("Inside podman network disconnect: ", id, container)
-	err := network.Disconnect(c.ctx, id, entities.NetworkDisconnectOptions{
+	err := network.Disconnect(c.connContext(ctx), id, entities.NetworkDisconnectOptions{
 		Container: container,
 		Force:     force,
 	})
-	return err
+	return podmanError(err)
 }
 
 type PmWriteCloser struct {
@@ -324,7 +771,7 @@ func (c *podmanClient) ContainerExecKeeper(id string, cmd []string) (ExecResult,
 
 	execID, err := containers.ExecCreate(c.ctx, id, execConfig)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, podmanError(err)
 	}
 
 	streams := new(define.AttachStreams)
@@ -335,7 +782,7 @@ func (c *podmanClient) ContainerExecKeeper(id string, cmd []string) (ExecResult,
 
 	err = containers.ExecStartAndAttach(c.ctx, execID, streams)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, podmanError(err)
 	}
 
 	//TODO: channel behaviors
@@ -356,12 +803,12 @@ func (c *podmanClient) ContainerExecKeeper(id string, cmd []string) (ExecResult,
 
 	inspectOut, err := containers.ExecInspect(c.ctx, execID)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, podmanError(err)
 	}
 	return ExecResult{ExitCode: inspectOut.ExitCode, OutBuffer: &outBuf, ErrBuffer: nil}, nil
 }
 
-func (c *podmanClient) ContainerExec(id string, cmd []string) (ExecResult, error) {
+func (c *podmanClient) ContainerExec(ctx context.Context, id string, cmd []string) (ExecResult, error) {
 	fmt.Println("Inside docker container exec")
 
 	//TODO: there may be a better way to capture, stderr too?
@@ -374,9 +821,9 @@ func (c *podmanClient) ContainerExec(id string, cmd []string) (ExecResult, error
 	execConfig.AttachStderr = true
 	execConfig.Cmd = cmd
 
-	execID, err := containers.ExecCreate(c.ctx, id, execConfig)
+	execID, err := containers.ExecCreate(c.connContext(ctx), id, execConfig)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, podmanError(err)
 	}
 
 	streams := new(define.AttachStreams)
@@ -385,9 +832,9 @@ func (c *podmanClient) ContainerExec(id string, cmd []string) (ExecResult, error
 	streams.AttachOutput = true
 	streams.AttachError = true
 
-	err = containers.ExecStartAndAttach(c.ctx, execID, streams)
+	err = containers.ExecStartAndAttach(c.connContext(ctx), execID, streams)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, podmanError(err)
 	}
 
 	var outBuf, errBuf bytes.Buffer
@@ -405,13 +852,141 @@ func (c *podmanClient) ContainerExec(id string, cmd []string) (ExecResult, error
 		<-copyDone
 	}()
 
-	inspectOut, err := containers.ExecInspect(c.ctx, execID)
+	inspectOut, err := containers.ExecInspect(c.connContext(ctx), execID)
 	if err != nil {
-		return ExecResult{}, err
+		return ExecResult{}, podmanError(err)
 	}
 	return ExecResult{ExitCode: inspectOut.ExitCode, OutBuffer: &outBuf, ErrBuffer: &errBuf}, nil
 }
 
-func (c *podmanClient) Info() (Info, error) {
+func (c *podmanClient) ContainerLogs(ctx context.Context, id string, options ContainerLogsOptions, stdout io.Writer, stderr io.Writer) error {
+	fmt.Println("Inside podman container logs")
+
+	if !options.Follow {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	showStream := true
+	logOpts := containers.LogOptions{
+		Follow:     &options.Follow,
+		Stderr:     &showStream,
+		Stdout:     &showStream,
+		Timestamps: &options.Timestamps,
+	}
+	if options.Since != "" {
+		logOpts.Since = &options.Since
+	}
+	if options.Tail != "" {
+		logOpts.Tail = &options.Tail
+	}
+
+	// the bindings deliver each frame on a channel and return once the
+	// stream is exhausted
+	stdoutChan := make(chan string)
+	stderrChan := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		done <- containers.Logs(c.connContext(ctx), id, logOpts, stdoutChan, stderrChan)
+	}()
+
+	for {
+		select {
+		case line := <-stdoutChan:
+			io.WriteString(stdout, line)
+		case line := <-stderrChan:
+			io.WriteString(stderr, line)
+		case err := <-done:
+			return podmanError(err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// podmanEventActions has the event actions podman names differently
+var podmanEventActions = map[string]string{
+	"died":   EventDie,
+	"remove": EventDestroy,
+}
+
+// podmanEvent translates an event podman reports, podman only reports the
+// container of network events and not the network
+func podmanEvent(e entities.Event) Event {
+	event := Event{
+		Type:       e.Type,
+		Action:     e.Action,
+		ID:         e.Actor.ID,
+		Name:       e.Actor.Attributes["name"],
+		Attributes: e.Actor.Attributes,
+		Time:       time.Unix(0, e.TimeNano),
+	}
+	if action, ok := podmanEventActions[e.Action]; ok {
+		event.Action = action
+	}
+	if e.Type == EventTypeNetwork {
+		event.ID = ""
+		event.Name = ""
+		event.Container = e.Actor.ID
+	}
+	return event
+}
+
+func (c *podmanClient) Events(ctx context.Context, filters map[string][]string) (<-chan Event, <-chan error) {
+	fmt.Println("Inside podman events")
+
+	// podman requires every value of the filters to match, it is given the
+	// labels, which all have to match anyway, and the others are matched
+	// here
+	filters = EventFilters(filters)
+	pmFilters := make(map[string][]string)
+	if labels, ok := filters["label"]; ok {
+		pmFilters["label"] = labels
+		delete(filters, "label")
+	}
+
+	events := make(chan Event)
+	errs := make(chan error, 1)
+	pmEvents := make(chan entities.Event)
+	cancelChan := make(chan bool)
+	stream := true
+
+	go func() {
+		err := system.Events(c.connContext(ctx), pmEvents, cancelChan, nil, nil, pmFilters, &stream)
+		if err != nil && ctx.Err() == nil {
+			errs <- podmanError(err)
+		}
+	}()
+
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case e, ok := <-pmEvents:
+				if !ok {
+					return
+				}
+				event := podmanEvent(e)
+				if !MatchEvent(filters, event, nil) {
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+				}
+			case <-ctx.Done():
+				// closing the response makes the bindings close pmEvents
+				close(cancelChan)
+				for range pmEvents {
+				}
+				return
+			}
+		}
+	}()
+	return events, errs
+}
+
+func (c *podmanClient) Info(ctx context.Context) (Info, error) {
 	return Info{}, nil
 }
@@ -0,0 +1,203 @@
+package driver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type PullPolicy string
+
+const (
+	PullAlways       PullPolicy = "Always"
+	PullIfNotPresent PullPolicy = "IfNotPresent"
+	PullNever        PullPolicy = "Never"
+
+	// DefaultRegistry is the registry images without a domain are pulled from
+	DefaultRegistry = "docker.io"
+)
+
+// RegistryAuth holds the credentials used to pull from a registry
+type RegistryAuth struct {
+	Username      string
+	Password      string
+	ServerAddress string
+	IdentityToken string
+}
+
+// ParsePullPolicy validates a pull policy, an empty value selects
+// IfNotPresent
+func ParsePullPolicy(policy string) (PullPolicy, error) {
+	switch PullPolicy(policy) {
+	case "":
+		return PullIfNotPresent, nil
+	case PullAlways, PullIfNotPresent, PullNever:
+		return PullPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("Image pull policy %s not recognized, must be one of: %s, %s, %s", policy,
+			PullAlways, PullIfNotPresent, PullNever)
+	}
+}
+
+// PullImage makes the image available to the engine according to the
+// pull policy
+func PullImage(ctx context.Context, dd Driver, refStr string, policy PullPolicy, auth *RegistryAuth) error {
+	policy, err := ParsePullPolicy(string(policy))
+	if err != nil {
+		return err
+	}
+	if policy != PullAlways {
+		if _, err := dd.ImageInspect(ctx, refStr); err == nil {
+			return nil
+		} else if policy == PullNever {
+			return fmt.Errorf("Image %s is not present and the pull policy is %s: %w", refStr, policy, err)
+		}
+	}
+	_, err = dd.ImagesPull(ctx, refStr, ImagePullOptions{
+		Auth: auth,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to pull image %s: %w", refStr, err)
+	}
+	return nil
+}
+
+// RegistryHost returns the registry domain of an image reference using the
+// same rules as the docker and podman engines
+func RegistryHost(refStr string) string {
+	i := strings.IndexRune(refStr, '/')
+	if i == -1 {
+		return DefaultRegistry
+	}
+	domain := refStr[:i]
+	if domain != "localhost" && !strings.ContainsAny(domain, ".:") {
+		return DefaultRegistry
+	}
+	if domain == "index.docker.io" || domain == "registry-1.docker.io" {
+		return DefaultRegistry
+	}
+	return domain
+}
+
+// normalizeRegistryKey strips the scheme and path from the keys found in
+// auth files, e.g. https://index.docker.io/v1/
+func normalizeRegistryKey(key string) string {
+	key = strings.TrimPrefix(key, "https://")
+	key = strings.TrimPrefix(key, "http://")
+	if i := strings.IndexRune(key, '/'); i != -1 {
+		key = key[:i]
+	}
+	if key == "index.docker.io" || key == "registry-1.docker.io" {
+		return DefaultRegistry
+	}
+	return key
+}
+
+// authFileEntry is the per registry entry of both the docker config.json
+// and the containers auth.json formats
+type authFileEntry struct {
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+type authFile struct {
+	Auths map[string]authFileEntry `json:"auths"`
+}
+
+// DefaultRegistryAuthFiles returns the auth files searched for credentials,
+// in order of precedence
+func DefaultRegistryAuthFiles() []string {
+	files := []string{}
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		files = append(files, path)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		files = append(files, filepath.Join(dir, "containers", "auth.json"))
+	}
+	home, _ := os.UserHomeDir()
+	if home != "" {
+		files = append(files, filepath.Join(home, ".config", "containers", "auth.json"))
+	}
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		files = append(files, filepath.Join(dir, "config.json"))
+	} else if home != "" {
+		files = append(files, filepath.Join(home, ".docker", "config.json"))
+	}
+	return files
+}
+
+// GetRegistryAuth looks up the credentials for the registry of the image
+// in the given auth files, the first match wins. Missing files are skipped
+// and nil is returned when no credentials are found.
+func GetRegistryAuth(refStr string, files []string) (*RegistryAuth, error) {
+	host := RegistryHost(refStr)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to read registry auth file %s: %w", file, err)
+		}
+		af := authFile{}
+		if err := json.Unmarshal(data, &af); err != nil {
+			return nil, fmt.Errorf("Failed to parse registry auth file %s: %w", file, err)
+		}
+		for key, entry := range af.Auths {
+			if normalizeRegistryKey(key) != host {
+				continue
+			}
+			auth := &RegistryAuth{
+				Username:      entry.Username,
+				Password:      entry.Password,
+				ServerAddress: host,
+				IdentityToken: entry.IdentityToken,
+			}
+			if entry.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+				if err != nil {
+					return nil, fmt.Errorf("Invalid auth for %s in %s: %w", key, file, err)
+				}
+				parts := strings.SplitN(string(decoded), ":", 2)
+				if len(parts) != 2 {
+					return nil, fmt.Errorf("Invalid auth for %s in %s", key, file)
+				}
+				auth.Username = parts[0]
+				auth.Password = parts[1]
+			}
+			return auth, nil
+		}
+	}
+	return nil, nil
+}
+
+// WriteRegistryAuthFile stores the credentials in the containers auth.json
+// format so they can be handed to the controller
+func WriteRegistryAuthFile(path string, auths []*RegistryAuth) error {
+	af := authFile{
+		Auths: map[string]authFileEntry{},
+	}
+	for _, auth := range auths {
+		if auth == nil {
+			continue
+		}
+		entry := authFileEntry{
+			IdentityToken: auth.IdentityToken,
+		}
+		if auth.Username != "" || auth.Password != "" {
+			entry.Auth = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		}
+		af.Auths[auth.ServerAddress] = entry
+	}
+	encoded, err := json.MarshalIndent(af, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0600)
+}
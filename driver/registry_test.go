@@ -0,0 +1,75 @@
+package driver
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestRegistryHost(t *testing.T) {
+	testCases := map[string]string{
+		"qdrouterd":                             DefaultRegistry,
+		"skupper/qdrouterd:0.4":                 DefaultRegistry,
+		"index.docker.io/skupper/qdrouterd":     DefaultRegistry,
+		"quay.io/skupper/qdrouterd:0.4":         "quay.io",
+		"localhost/skupper-exp-controller":      "localhost",
+		"localhost:5000/skupper-exp-controller": "localhost:5000",
+	}
+	for image, expected := range testCases {
+		assert.Equal(t, RegistryHost(image), expected, image)
+	}
+}
+
+func TestGetRegistryAuth(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "registry")
+	assert.Check(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	dockerConfig := filepath.Join(tmpDir, "config.json")
+	assert.Check(t, ioutil.WriteFile(dockerConfig, []byte(`{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "ZnJlZDpmbGludHN0b25l"},
+			"registry.example.com": {"identitytoken": "token"}
+		},
+		"credsStore": "desktop"
+	}`), 0600))
+	containersAuth := filepath.Join(tmpDir, "auth.json")
+	assert.Check(t, ioutil.WriteFile(containersAuth, []byte(`{
+		"auths": {
+			"quay.io": {"auth": "YmFybmV5OnJ1YmJsZQ=="}
+		}
+	}`), 0600))
+	files := []string{filepath.Join(tmpDir, "missing.json"), containersAuth, dockerConfig}
+
+	auth, err := GetRegistryAuth("skupper/qdrouterd", files)
+	assert.Check(t, err)
+	assert.DeepEqual(t, auth, &RegistryAuth{Username: "fred", Password: "flintstone", ServerAddress: DefaultRegistry})
+
+	auth, err = GetRegistryAuth("quay.io/skupper/qdrouterd:0.4", files)
+	assert.Check(t, err)
+	assert.DeepEqual(t, auth, &RegistryAuth{Username: "barney", Password: "rubble", ServerAddress: "quay.io"})
+
+	auth, err = GetRegistryAuth("registry.example.com/controller", files)
+	assert.Check(t, err)
+	assert.DeepEqual(t, auth, &RegistryAuth{ServerAddress: "registry.example.com", IdentityToken: "token"})
+
+	auth, err = GetRegistryAuth("localhost:5000/controller", files)
+	assert.Check(t, err)
+	assert.Assert(t, auth == nil)
+
+	written := filepath.Join(tmpDir, "written.json")
+	assert.Check(t, WriteRegistryAuthFile(written, []*RegistryAuth{
+		{Username: "barney", Password: "rubble", ServerAddress: "quay.io"},
+		nil,
+	}))
+	auth, err = GetRegistryAuth("quay.io/skupper/qdrouterd:0.4", []string{written})
+	assert.Check(t, err)
+	assert.DeepEqual(t, auth, &RegistryAuth{Username: "barney", Password: "rubble", ServerAddress: "quay.io"})
+
+	assert.Check(t, ioutil.WriteFile(written, []byte("not json"), 0600))
+	_, err = GetRegistryAuth("quay.io/skupper/qdrouterd:0.4", []string{written})
+	assert.ErrorContains(t, err, "Failed to parse registry auth file")
+}
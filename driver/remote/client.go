@@ -0,0 +1,383 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+// streamWait is how long each StreamNext call may wait for a chunk
+const streamWait = 5 * time.Second
+
+// Driver implements driver.Driver by calling a driver served with this
+// package's protocol. The connection is made by New using the RPC target
+// of the engine config, or given to NewDriver.
+type Driver struct {
+	mu     sync.Mutex
+	client *rpc.Client
+	nextID uint64
+}
+
+// NewDriver returns a driver using an established connection
+func NewDriver(conn io.ReadWriteCloser) *Driver {
+	return &Driver{
+		client: rpc.NewClientWithCodec(jsonrpc.NewClientCodec(conn)),
+	}
+}
+
+// process is the connection to a driver started as a child process
+type process struct {
+	io.ReadCloser
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func (p *process) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// Close ends the driver's input, the driver is expected to exit then
+func (p *process) Close() error {
+	p.stdin.Close()
+	return p.cmd.Wait()
+}
+
+// Dial connects to a driver, the target is either a unix:// socket or the
+// command line of a driver executable that serves on its stdin and stdout
+func Dial(ctx context.Context, target string) (io.ReadWriteCloser, error) {
+	if socket := driver.UnixSocketPath(target); socket != "" {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "unix", socket)
+		if err != nil {
+			return nil, driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("Failed to connect to driver at %s: %w", target, err))
+		}
+		return conn, nil
+	}
+	args := strings.Fields(target)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("No remote driver given")
+	}
+	// the process outlives the call that starts it, it is not tied to ctx
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("Failed to start driver %s: %w", args[0], err))
+	}
+	return &process{ReadCloser: stdout, stdin: stdin, cmd: cmd}, nil
+}
+
+// Close disconnects from the driver
+func (d *Driver) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+func (d *Driver) rpcClient() *rpc.Client {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.client
+}
+
+func (d *Driver) newCall(ctx context.Context) Call {
+	call := Call{
+		ID: atomic.AddUint64(&d.nextID, 1),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		call.Deadline = deadline
+	}
+	return call
+}
+
+// call invokes a method and waits for the reply or for ctx to be done, in
+// which case the driver is asked to cancel the call
+func (d *Driver) call(ctx context.Context, call Call, method string, args interface{}, reply interface{}) error {
+	client := d.rpcClient()
+	if client == nil {
+		return driver.WrapError(driver.ErrEngineUnavailable, errors.New("Remote driver is not connected"))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pending := client.Go(ServiceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-pending.Done:
+		return callError(pending.Error)
+	case <-ctx.Done():
+		client.Go(ServiceName+".Cancel", CancelArgs{ID: call.ID}, &Empty{}, make(chan *rpc.Call, 1))
+		return ctx.Err()
+	}
+}
+
+// New connects to the driver named by config.RPC unless a connection was
+// given to NewDriver, the rest of the config is passed on to the driver
+func (d *Driver) New(ctx context.Context, config driver.EngineConfig) error {
+	if d.rpcClient() == nil {
+		conn, err := Dial(ctx, config.RPC)
+		if err != nil {
+			return err
+		}
+		d.mu.Lock()
+		d.client = rpc.NewClientWithCodec(jsonrpc.NewClientCodec(conn))
+		d.mu.Unlock()
+	}
+	config.RPC = ""
+	config.PluginDir = ""
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "New", NewArgs{Call: call, Config: config}, &Empty{})
+}
+
+func (d *Driver) ImageInspect(ctx context.Context, id string) (*driver.ImageInspect, error) {
+	call := d.newCall(ctx)
+	reply := &driver.ImageInspect{}
+	if err := d.call(ctx, call, "ImageInspect", IDArgs{Call: call, ID: id}, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (d *Driver) ImagesList(ctx context.Context, options driver.ImageListOptions) ([]driver.ImageSummary, error) {
+	call := d.newCall(ctx)
+	var reply []driver.ImageSummary
+	err := d.call(ctx, call, "ImagesList", ImagesListArgs{Call: call, Options: options}, &reply)
+	return reply, err
+}
+
+func (d *Driver) ImagesPull(ctx context.Context, refStr string, options driver.ImagePullOptions) ([]string, error) {
+	call := d.newCall(ctx)
+	var reply []string
+	err := d.call(ctx, call, "ImagesPull", ImagesPullArgs{Call: call, Ref: refStr, Options: options}, &reply)
+	return reply, err
+}
+
+func (d *Driver) ImageVersion(ctx context.Context, id string) (string, error) {
+	call := d.newCall(ctx)
+	var reply string
+	err := d.call(ctx, call, "ImageVersion", IDArgs{Call: call, ID: id}, &reply)
+	return reply, err
+}
+
+func (d *Driver) ContainerCreate(ctx context.Context, options driver.ContainerCreateOptions) (driver.ContainerCreateResponse, error) {
+	call := d.newCall(ctx)
+	var reply driver.ContainerCreateResponse
+	err := d.call(ctx, call, "ContainerCreate", ContainerCreateArgs{Call: call, Options: options}, &reply)
+	return reply, err
+}
+
+func (d *Driver) ContainerStart(ctx context.Context, id string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "ContainerStart", IDArgs{Call: call, ID: id}, &Empty{})
+}
+
+func (d *Driver) ContainerWait(ctx context.Context, id string, state string, timeout time.Duration, interval time.Duration) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "ContainerWait", ContainerWaitArgs{Call: call, ID: id, State: state, Timeout: timeout, Interval: interval}, &Empty{})
+}
+
+func (d *Driver) ContainerList(ctx context.Context, options driver.ContainerListOptions) ([]driver.ContainerSummary, error) {
+	call := d.newCall(ctx)
+	var reply []driver.ContainerSummary
+	err := d.call(ctx, call, "ContainerList", ContainerListArgs{Call: call, Options: options}, &reply)
+	return reply, err
+}
+
+func (d *Driver) ContainerInspect(ctx context.Context, id string) (*driver.ContainerInspect, error) {
+	call := d.newCall(ctx)
+	reply := &driver.ContainerInspect{}
+	if err := d.call(ctx, call, "ContainerInspect", IDArgs{Call: call, ID: id}, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (d *Driver) ContainerRestart(ctx context.Context, id string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "ContainerRestart", IDArgs{Call: call, ID: id}, &Empty{})
+}
+
+func (d *Driver) ContainerStop(ctx context.Context, id string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "ContainerStop", IDArgs{Call: call, ID: id}, &Empty{})
+}
+
+func (d *Driver) ContainerRemove(ctx context.Context, id string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "ContainerRemove", IDArgs{Call: call, ID: id}, &Empty{})
+}
+
+func (d *Driver) ContainerRename(ctx context.Context, id string, name string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "ContainerRename", ContainerRenameArgs{Call: call, ID: id, Name: name}, &Empty{})
+}
+
+func (d *Driver) ContainerExec(ctx context.Context, id string, cmd []string) (driver.ExecResult, error) {
+	call := d.newCall(ctx)
+	var reply ContainerExecReply
+	if err := d.call(ctx, call, "ContainerExec", ContainerExecArgs{Call: call, ID: id, Cmd: cmd}, &reply); err != nil {
+		return driver.ExecResult{}, err
+	}
+	return driver.ExecResult{
+		ExitCode:  reply.ExitCode,
+		OutBuffer: bytes.NewBufferString(reply.Stdout),
+		ErrBuffer: bytes.NewBufferString(reply.Stderr),
+	}, nil
+}
+
+// next returns the next chunks of a stream, the stream is closed on the
+// driver side when ctx is done
+func (d *Driver) next(ctx context.Context, stream uint64) (*StreamNextReply, error) {
+	call := d.newCall(ctx)
+	reply := &StreamNextReply{}
+	err := d.call(ctx, call, "StreamNext", StreamNextArgs{Call: call, Stream: stream, Wait: streamWait}, reply)
+	if err != nil {
+		if ctx.Err() != nil {
+			d.closeStream(stream)
+		}
+		return nil, err
+	}
+	return reply, nil
+}
+
+func (d *Driver) ContainerLogs(ctx context.Context, id string, options driver.ContainerLogsOptions, stdout io.Writer, stderr io.Writer) error {
+	call := d.newCall(ctx)
+	var stream StreamReply
+	if err := d.call(ctx, call, "ContainerLogs", ContainerLogsArgs{Call: call, ID: id, Options: options}, &stream); err != nil {
+		return err
+	}
+	for {
+		reply, err := d.next(ctx, stream.Stream)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range reply.Chunks {
+			if _, err := io.WriteString(stdout, chunk.Stdout); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(stderr, chunk.Stderr); err != nil {
+				return err
+			}
+		}
+		if reply.Done {
+			return decodeError(reply.Error)
+		}
+	}
+}
+
+func (d *Driver) NetworkCreate(ctx context.Context, name string, options driver.NetworkCreateOptions) (driver.NetworkCreateResponse, error) {
+	call := d.newCall(ctx)
+	var reply driver.NetworkCreateResponse
+	err := d.call(ctx, call, "NetworkCreate", NetworkCreateArgs{Call: call, Name: name, Options: options}, &reply)
+	return reply, err
+}
+
+func (d *Driver) NetworkInspect(ctx context.Context, id string) (driver.NetworkInspect, error) {
+	call := d.newCall(ctx)
+	var reply driver.NetworkInspect
+	err := d.call(ctx, call, "NetworkInspect", IDArgs{Call: call, ID: id}, &reply)
+	return reply, err
+}
+
+func (d *Driver) NetworkList(ctx context.Context, options driver.NetworkListOptions) ([]driver.NetworkInspect, error) {
+	call := d.newCall(ctx)
+	var reply []driver.NetworkInspect
+	err := d.call(ctx, call, "NetworkList", NetworkListArgs{Call: call, Options: options}, &reply)
+	return reply, err
+}
+
+func (d *Driver) NetworkRemove(ctx context.Context, id string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "NetworkRemove", IDArgs{Call: call, ID: id}, &Empty{})
+}
+
+func (d *Driver) NetworkConnect(ctx context.Context, id string, container string, aliases []string) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "NetworkConnect", NetworkConnectArgs{Call: call, ID: id, Container: container, Aliases: aliases}, &Empty{})
+}
+
+func (d *Driver) NetworkDisconnect(ctx context.Context, id string, container string, force bool) error {
+	call := d.newCall(ctx)
+	return d.call(ctx, call, "NetworkDisconnect", NetworkDisconnectArgs{Call: call, ID: id, Container: container, Force: force}, &Empty{})
+}
+
+func (d *Driver) Info(ctx context.Context) (driver.Info, error) {
+	call := d.newCall(ctx)
+	var reply driver.Info
+	err := d.call(ctx, call, "Info", CallArgs{Call: call}, &reply)
+	return reply, err
+}
+
+func (d *Driver) Events(ctx context.Context, filters map[string][]string) (<-chan driver.Event, <-chan error) {
+	events := make(chan driver.Event)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(events)
+		call := d.newCall(ctx)
+		var stream StreamReply
+		if err := d.call(ctx, call, "Events", EventsArgs{Call: call, Filters: filters}, &stream); err != nil {
+			if ctx.Err() == nil {
+				errs <- err
+			}
+			return
+		}
+		for {
+			reply, err := d.next(ctx, stream.Stream)
+			if err != nil {
+				if ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+			for _, chunk := range reply.Chunks {
+				if chunk.Event == nil {
+					continue
+				}
+				select {
+				case events <- *chunk.Event:
+				case <-ctx.Done():
+					d.closeStream(stream.Stream)
+					return
+				}
+			}
+			if reply.Done {
+				if err := decodeError(reply.Error); err != nil && ctx.Err() == nil {
+					errs <- err
+				}
+				return
+			}
+		}
+	}()
+	return events, errs
+}
+
+// closeStream stops a stream the caller no longer reads
+func (d *Driver) closeStream(stream uint64) {
+	if client := d.rpcClient(); client != nil {
+		client.Go(ServiceName+".StreamClose", StreamReply{Stream: stream}, &Empty{}, make(chan *rpc.Call, 1))
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Package remote runs container engine drivers out of process.
+
+A driver executable serves the driver.Driver methods with JSON-RPC 1.0, as
+implemented by net/rpc/jsonrpc, either on its stdin and stdout or on a unix
+socket. The Driver type in this package is the client side adapter, it
+implements driver.Driver by forwarding every call to the executable, so an
+engine driver does not have to be built with the same toolchain and
+dependencies as skupper-exp.
+
+Every driver method is exposed as "Driver.<Method>" and takes a single
+parameter object, e.g.
+
+	{"method": "Driver.ContainerInspect", "params": [{"Call": {"ID": 7}, "ID": "skupper-router"}], "id": 3}
+
+The parameter and result objects are the args and reply types below, their
+fields carry the driver package types as JSON. Every parameter object holds
+a Call with an ID unique to the connection and the caller's deadline, if
+any. "Driver.Cancel" with {"ID": <call id>} aborts a call still in progress.
+
+Errors are returned as "<kind>: <message>" where kind is one of not-found,
+already-exists, timeout, engine-unavailable, not-supported, canceled or
+deadline-exceeded,
+any other error is returned as is.
+
+ContainerLogs and Events are streamed. They return {"Stream": <id>} and the
+client then calls "Driver.StreamNext" with {"Stream": <id>, "Wait": <ns>}
+until the reply is Done, each reply holding the chunks produced in the
+meantime. "Driver.StreamClose" stops a stream early.
+
+A driver is served with Serve, ServeStdio or ServeUnix:
+
+	func main() {
+		remote.ServeStdio(&myDriver{})
+	}
+*/
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"strings"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+const (
+	// ServiceName prefixes the method names of the protocol
+	ServiceName = "Driver"
+
+	// DriverName is used for the site's driver when none is given
+	DriverName = "remote"
+)
+
+// Call identifies a request so it can be canceled, a zero Deadline means
+// no deadline
+type Call struct {
+	ID       uint64
+	Deadline time.Time
+}
+
+type Empty struct{}
+
+// CallArgs are the args of the methods without parameters
+type CallArgs struct {
+	Call Call
+}
+
+type NewArgs struct {
+	Call   Call
+	Config driver.EngineConfig
+}
+
+// IDArgs are the args of the methods that only take an image, container
+// or network id
+type IDArgs struct {
+	Call Call
+	ID   string
+}
+
+type ImagesListArgs struct {
+	Call    Call
+	Options driver.ImageListOptions
+}
+
+type ImagesPullArgs struct {
+	Call    Call
+	Ref     string
+	Options driver.ImagePullOptions
+}
+
+type ContainerCreateArgs struct {
+	Call    Call
+	Options driver.ContainerCreateOptions
+}
+
+type ContainerWaitArgs struct {
+	Call     Call
+	ID       string
+	State    string
+	Timeout  time.Duration
+	Interval time.Duration
+}
+
+type ContainerListArgs struct {
+	Call    Call
+	Options driver.ContainerListOptions
+}
+
+type ContainerExecArgs struct {
+	Call Call
+	ID   string
+	Cmd  []string
+}
+
+type ContainerExecReply struct {
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+type ContainerLogsArgs struct {
+	Call    Call
+	ID      string
+	Options driver.ContainerLogsOptions
+}
+
+type ContainerRenameArgs struct {
+	Call Call
+	ID   string
+	Name string
+}
+
+type NetworkCreateArgs struct {
+	Call    Call
+	Name    string
+	Options driver.NetworkCreateOptions
+}
+
+type NetworkListArgs struct {
+	Call    Call
+	Options driver.NetworkListOptions
+}
+
+type NetworkConnectArgs struct {
+	Call      Call
+	ID        string
+	Container string
+	Aliases   []string
+}
+
+type NetworkDisconnectArgs struct {
+	Call      Call
+	ID        string
+	Container string
+	Force     bool
+}
+
+type EventsArgs struct {
+	Call    Call
+	Filters map[string][]string
+}
+
+type CancelArgs struct {
+	ID uint64
+}
+
+type StreamReply struct {
+	Stream uint64
+}
+
+type StreamNextArgs struct {
+	Call   Call
+	Stream uint64
+	Wait   time.Duration
+}
+
+// Chunk is a piece of a stream, either log output or an event
+type Chunk struct {
+	Stdout string        `json:",omitempty"`
+	Stderr string        `json:",omitempty"`
+	Event  *driver.Event `json:",omitempty"`
+}
+
+// StreamNextReply is Done once the stream has ended, Error then tells why
+type StreamNextReply struct {
+	Chunks []Chunk
+	Done   bool
+	Error  string `json:",omitempty"`
+}
+
+var errorKinds = []struct {
+	code string
+	kind error
+}{
+	{"not-found", driver.ErrNotFound},
+	{"already-exists", driver.ErrAlreadyExists},
+	{"timeout", driver.ErrTimeout},
+	{"engine-unavailable", driver.ErrEngineUnavailable},
+	{"not-supported", driver.ErrNotSupported},
+	{"canceled", context.Canceled},
+	{"deadline-exceeded", context.DeadlineExceeded},
+}
+
+// encodeError prefixes the message with the kind of a driver error
+func encodeError(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, k := range errorKinds {
+		if errors.Is(err, k.kind) {
+			return k.code + ": " + err.Error()
+		}
+	}
+	return err.Error()
+}
+
+// decodeError restores the kind of an error sent by encodeError
+func decodeError(message string) error {
+	if message == "" {
+		return nil
+	}
+	for _, k := range errorKinds {
+		if strings.HasPrefix(message, k.code+": ") {
+			return driver.WrapError(k.kind, errors.New(strings.TrimPrefix(message, k.code+": ")))
+		}
+	}
+	return errors.New(message)
+}
+
+// callError translates the error of an rpc call, anything but an error
+// returned by the driver means the driver process is gone
+func callError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if serverErr, ok := err.(rpc.ServerError); ok {
+		return decodeError(string(serverErr))
+	}
+	return driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("Remote driver connection failed: %w", err))
+}
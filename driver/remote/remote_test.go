@@ -0,0 +1,169 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/driver"
+	"github.com/ajssmith/skupper-exp/driver/fake"
+	"github.com/ajssmith/skupper-exp/pkg/qdr"
+	"gotest.tools/assert"
+)
+
+// newTestDriver serves a fake driver and returns a remote driver for it
+func newTestDriver(t *testing.T) (*Driver, *fake.Driver) {
+	dd := fake.NewDriver()
+	serverConn, clientConn := net.Pipe()
+	go Serve(dd, serverConn)
+	rd := NewDriver(clientConn)
+	assert.Check(t, rd.New(context.Background(), driver.EngineConfig{Endpoint: "unix:///run/engine.sock"}))
+	return rd, dd
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	ctx := context.Background()
+	rd, dd := newTestDriver(t)
+	defer rd.Close()
+
+	id := fake.CreateRouter(t, rd)
+	_, ok := dd.Container(id)
+	assert.Assert(t, ok, "container should be created by the served driver")
+
+	assert.Check(t, rd.ContainerStart(ctx, "skupper-router"))
+	assert.Check(t, rd.ContainerWait(ctx, "skupper-router", "running", time.Second, 10*time.Millisecond))
+	current, err := rd.ContainerInspect(ctx, "skupper-router")
+	assert.Check(t, err)
+	assert.Equal(t, current.ID, id)
+	assert.Equal(t, current.State.Status, "running")
+	assert.Equal(t, current.Config.Labels["skupper.io/component"], "router")
+
+	containers, err := rd.ContainerList(ctx, driver.ContainerListOptions{
+		Filters: map[string][]string{"label": {"application=skupper"}},
+	})
+	assert.Check(t, err)
+	assert.Equal(t, len(containers), 1)
+
+	assert.Check(t, rd.ContainerStop(ctx, "skupper-router"))
+	assert.Check(t, rd.ContainerRemove(ctx, "skupper-router"))
+	_, err = rd.ContainerInspect(ctx, "skupper-router")
+	assert.Assert(t, errors.Is(err, driver.ErrNotFound))
+}
+
+func TestErrorKinds(t *testing.T) {
+	ctx := context.Background()
+	rd, dd := newTestDriver(t)
+	defer rd.Close()
+	fake.CreateRouter(t, rd)
+
+	_, err := rd.NetworkCreate(ctx, "skupper-network", driver.NetworkCreateOptions{})
+	assert.Assert(t, errors.Is(err, driver.ErrAlreadyExists))
+
+	dd.FailOn("ContainerStart", driver.WrapError(driver.ErrEngineUnavailable, fmt.Errorf("engine on fire")))
+	err = rd.ContainerStart(ctx, "skupper-router")
+	assert.Assert(t, errors.Is(err, driver.ErrEngineUnavailable))
+	assert.ErrorContains(t, err, "engine on fire")
+
+	dd.FailOn("ContainerStart", fmt.Errorf("plain failure"))
+	err = rd.ContainerStart(ctx, "skupper-router")
+	assert.Error(t, err, "plain failure")
+}
+
+func TestContainerExecQuery(t *testing.T) {
+	ctx := context.Background()
+	rd, dd := newTestDriver(t)
+	defer rd.Close()
+	fake.CreateRouter(t, rd)
+	assert.Check(t, rd.ContainerStart(ctx, "skupper-router"))
+
+	assert.Check(t, dd.SetQueryResult("node", []qdr.RouterNode{
+		{Id: "a", NextHop: "(self)"},
+		{Id: "b"},
+	}))
+	sites, err := qdr.GetConnectedSites(ctx, rd)
+	assert.Check(t, err)
+	assert.Equal(t, sites.Direct, 1)
+}
+
+func TestContainerLogs(t *testing.T) {
+	ctx := context.Background()
+	rd, dd := newTestDriver(t)
+	defer rd.Close()
+	id := fake.CreateRouter(t, rd)
+	assert.Check(t, dd.SetContainerLogs(id, "one\ntwo\nthree\n", "oops\n"))
+
+	var stdout, stderr bytes.Buffer
+	err := rd.ContainerLogs(ctx, "skupper-router", driver.ContainerLogsOptions{Tail: "2"}, &stdout, &stderr)
+	assert.Check(t, err)
+	assert.Equal(t, stdout.String(), "two\nthree\n")
+	assert.Equal(t, stderr.String(), "oops\n")
+
+	err = rd.ContainerLogs(ctx, "missing", driver.ContainerLogsOptions{}, &stdout, &stderr)
+	assert.Assert(t, errors.Is(err, driver.ErrNotFound))
+}
+
+func TestEvents(t *testing.T) {
+	rd, _ := newTestDriver(t)
+	defer rd.Close()
+	fake.CreateRouter(t, rd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := rd.Events(ctx, map[string][]string{
+		"label": {"skupper.io/component=router"},
+	})
+	// the subscription is made by the first call of the stream
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Check(t, rd.ContainerStart(ctx, "skupper-router"))
+	assert.Check(t, rd.ContainerStop(ctx, "skupper-router"))
+
+	expected := []string{driver.EventStart, driver.EventDie}
+	for _, action := range expected {
+		event := <-events
+		assert.Equal(t, event.Type, driver.EventTypeContainer)
+		assert.Equal(t, event.Action, action)
+		assert.Equal(t, event.Name, "skupper-router")
+	}
+
+	cancel()
+	_, ok := <-events
+	assert.Assert(t, !ok, "events channel should be closed once the context is done")
+	select {
+	case err := <-errs:
+		t.Fatalf("unexpected error: %s", err)
+	default:
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	rd, dd := newTestDriver(t)
+	defer rd.Close()
+	fake.CreateRouter(t, rd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err := rd.ContainerWait(ctx, "skupper-router", "running", time.Minute, 10*time.Millisecond)
+	assert.Equal(t, err, context.Canceled)
+
+	// the served call is canceled as well, the driver stays usable
+	assert.Check(t, rd.ContainerStart(context.Background(), "skupper-router"))
+	current, ok := dd.Container("skupper-router")
+	assert.Assert(t, ok)
+	assert.Equal(t, current.Status, "running")
+}
+
+func TestConnectionLost(t *testing.T) {
+	ctx := context.Background()
+	rd, _ := newTestDriver(t)
+	rd.Close()
+
+	_, err := rd.Info(ctx)
+	assert.Assert(t, errors.Is(err, driver.ErrEngineUnavailable))
+}
@@ -0,0 +1,484 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ajssmith/skupper-exp/driver"
+)
+
+const (
+	// defaultStreamWait bounds how long StreamNext waits for a chunk
+	defaultStreamWait = 10 * time.Second
+
+	// maxStreamChunks bounds the chunks returned by a StreamNext call
+	maxStreamChunks = 256
+)
+
+// service exposes a driver to one connection, the rpc package only
+// registers its exported methods
+type service struct {
+	drv driver.Driver
+
+	mu         sync.Mutex
+	calls      map[uint64]context.CancelFunc
+	streams    map[uint64]*stream
+	nextStream uint64
+}
+
+type stream struct {
+	chunks chan Chunk
+	done   chan struct{}
+	err    error
+	cancel context.CancelFunc
+}
+
+// finish ends the stream, err is reported once the pending chunks are read
+func (st *stream) finish(err error) {
+	st.err = err
+	close(st.done)
+}
+
+func (st *stream) send(ctx context.Context, chunk Chunk) error {
+	select {
+	case st.chunks <- chunk:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type streamWriter struct {
+	ctx    context.Context
+	st     *stream
+	stderr bool
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	chunk := Chunk{}
+	if w.stderr {
+		chunk.Stderr = string(p)
+	} else {
+		chunk.Stdout = string(p)
+	}
+	if err := w.st.send(w.ctx, chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newService(drv driver.Driver) *service {
+	return &service{
+		drv:     drv,
+		calls:   map[uint64]context.CancelFunc{},
+		streams: map[uint64]*stream{},
+	}
+}
+
+// context returns the context of a call, it is canceled by Driver.Cancel
+// or when the caller's deadline passes
+func (s *service) context(call Call) (context.Context, func()) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if call.Deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), call.Deadline)
+	}
+	if call.ID == 0 {
+		return ctx, cancel
+	}
+	s.mu.Lock()
+	s.calls[call.ID] = cancel
+	s.mu.Unlock()
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.calls, call.ID)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+func (s *service) newStream() (context.Context, uint64, *stream) {
+	ctx, cancel := context.WithCancel(context.Background())
+	st := &stream{
+		chunks: make(chan Chunk, maxStreamChunks),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	s.mu.Lock()
+	s.nextStream++
+	id := s.nextStream
+	s.streams[id] = st
+	s.mu.Unlock()
+	return ctx, id, st
+}
+
+func (s *service) removeStream(id uint64) *stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.streams[id]
+	if ok {
+		delete(s.streams, id)
+		st.cancel()
+	}
+	return st
+}
+
+// close aborts everything still running once the connection is gone
+func (s *service) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, cancel := range s.calls {
+		cancel()
+		delete(s.calls, id)
+	}
+	for id, st := range s.streams {
+		st.cancel()
+		delete(s.streams, id)
+	}
+}
+
+func serverError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.New(encodeError(err))
+}
+
+func (s *service) Cancel(args CancelArgs, reply *Empty) error {
+	s.mu.Lock()
+	cancel, ok := s.calls[args.ID]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return nil
+}
+
+func (s *service) New(args NewArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.New(ctx, args.Config))
+}
+
+func (s *service) ImageInspect(args IDArgs, reply *driver.ImageInspect) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ImageInspect(ctx, args.ID)
+	if err != nil {
+		return serverError(err)
+	}
+	if result != nil {
+		*reply = *result
+	}
+	return nil
+}
+
+func (s *service) ImagesList(args ImagesListArgs, reply *[]driver.ImageSummary) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ImagesList(ctx, args.Options)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) ImagesPull(args ImagesPullArgs, reply *[]string) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ImagesPull(ctx, args.Ref, args.Options)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) ImageVersion(args IDArgs, reply *string) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ImageVersion(ctx, args.ID)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) ContainerCreate(args ContainerCreateArgs, reply *driver.ContainerCreateResponse) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ContainerCreate(ctx, args.Options)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) ContainerStart(args IDArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.ContainerStart(ctx, args.ID))
+}
+
+func (s *service) ContainerWait(args ContainerWaitArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.ContainerWait(ctx, args.ID, args.State, args.Timeout, args.Interval))
+}
+
+func (s *service) ContainerList(args ContainerListArgs, reply *[]driver.ContainerSummary) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ContainerList(ctx, args.Options)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) ContainerInspect(args IDArgs, reply *driver.ContainerInspect) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ContainerInspect(ctx, args.ID)
+	if err != nil {
+		return serverError(err)
+	}
+	if result != nil {
+		*reply = *result
+	}
+	return nil
+}
+
+func (s *service) ContainerRestart(args IDArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.ContainerRestart(ctx, args.ID))
+}
+
+func (s *service) ContainerStop(args IDArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.ContainerStop(ctx, args.ID))
+}
+
+func (s *service) ContainerRemove(args IDArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.ContainerRemove(ctx, args.ID))
+}
+
+func (s *service) ContainerRename(args ContainerRenameArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.ContainerRename(ctx, args.ID, args.Name))
+}
+
+func (s *service) ContainerExec(args ContainerExecArgs, reply *ContainerExecReply) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.ContainerExec(ctx, args.ID, args.Cmd)
+	if err != nil {
+		return serverError(err)
+	}
+	reply.ExitCode = result.ExitCode
+	if result.OutBuffer != nil {
+		reply.Stdout = result.OutBuffer.String()
+	}
+	if result.ErrBuffer != nil {
+		reply.Stderr = result.ErrBuffer.String()
+	}
+	return nil
+}
+
+func (s *service) ContainerLogs(args ContainerLogsArgs, reply *StreamReply) error {
+	ctx, id, st := s.newStream()
+	go func() {
+		stdout := &streamWriter{ctx: ctx, st: st}
+		stderr := &streamWriter{ctx: ctx, st: st, stderr: true}
+		st.finish(s.drv.ContainerLogs(ctx, args.ID, args.Options, stdout, stderr))
+	}()
+	reply.Stream = id
+	return nil
+}
+
+func (s *service) NetworkCreate(args NetworkCreateArgs, reply *driver.NetworkCreateResponse) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.NetworkCreate(ctx, args.Name, args.Options)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) NetworkInspect(args IDArgs, reply *driver.NetworkInspect) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.NetworkInspect(ctx, args.ID)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) NetworkList(args NetworkListArgs, reply *[]driver.NetworkInspect) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.NetworkList(ctx, args.Options)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) NetworkRemove(args IDArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.NetworkRemove(ctx, args.ID))
+}
+
+func (s *service) NetworkConnect(args NetworkConnectArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.NetworkConnect(ctx, args.ID, args.Container, args.Aliases))
+}
+
+func (s *service) NetworkDisconnect(args NetworkDisconnectArgs, reply *Empty) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	return serverError(s.drv.NetworkDisconnect(ctx, args.ID, args.Container, args.Force))
+}
+
+func (s *service) Info(args CallArgs, reply *driver.Info) error {
+	ctx, done := s.context(args.Call)
+	defer done()
+	result, err := s.drv.Info(ctx)
+	*reply = result
+	return serverError(err)
+}
+
+func (s *service) Events(args EventsArgs, reply *StreamReply) error {
+	ctx, id, st := s.newStream()
+	events, errs := s.drv.Events(ctx, args.Filters)
+	go func() {
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					st.finish(ctx.Err())
+					return
+				}
+				if err := st.send(ctx, Chunk{Event: &event}); err != nil {
+					st.finish(err)
+					return
+				}
+			case err := <-errs:
+				st.finish(err)
+				return
+			}
+		}
+	}()
+	reply.Stream = id
+	return nil
+}
+
+func (s *service) StreamNext(args StreamNextArgs, reply *StreamNextReply) error {
+	s.mu.Lock()
+	st, ok := s.streams[args.Stream]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("Stream %d not found", args.Stream)
+	}
+	ctx, done := s.context(args.Call)
+	defer done()
+
+	wait := args.Wait
+	if wait <= 0 {
+		wait = defaultStreamWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case chunk := <-st.chunks:
+		reply.Chunks = append(reply.Chunks, chunk)
+	case <-st.done:
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return serverError(ctx.Err())
+	}
+drain:
+	for len(reply.Chunks) < maxStreamChunks {
+		select {
+		case chunk := <-st.chunks:
+			reply.Chunks = append(reply.Chunks, chunk)
+		default:
+			break drain
+		}
+	}
+	// the producer is finished before done is closed, so an empty channel
+	// at that point means everything was read
+	select {
+	case <-st.done:
+		if len(st.chunks) == 0 {
+			reply.Done = true
+			reply.Error = encodeError(st.err)
+			s.removeStream(args.Stream)
+		}
+	default:
+	}
+	return nil
+}
+
+func (s *service) StreamClose(args StreamReply, reply *Empty) error {
+	s.removeStream(args.Stream)
+	return nil
+}
+
+// Serve serves drv on conn until the connection is closed
+func Serve(drv driver.Driver, conn io.ReadWriteCloser) error {
+	svc := newService(drv)
+	defer svc.close()
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, svc); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+type stdio struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// ServeStdio serves drv on stdin and stdout, for drivers started by the
+// client. Anything the driver prints to stdout goes to stderr instead so
+// it cannot corrupt the protocol.
+func ServeStdio(drv driver.Driver) error {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	return Serve(drv, stdio{Reader: os.Stdin, WriteCloser: out})
+}
+
+// ServeUnix serves drv to every connection made to the unix socket at
+// path until ctx is done
+func ServeUnix(ctx context.Context, drv driver.Driver, path string) error {
+	_ = os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			if err := Serve(drv, conn); err != nil {
+				log.Println("Failed to serve driver connection: ", err.Error())
+			}
+		}()
+	}
+}
@@ -0,0 +1,240 @@
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/containers/podman/v2/libpod/define"
+	"github.com/containers/podman/v2/pkg/specgen"
+	"github.com/docker/go-connections/nat"
+	"gotest.tools/assert"
+)
+
+// proxyCreateOptions uses every setting of the create options
+func proxyCreateOptions() ContainerCreateOptions {
+	return ContainerCreateOptions{
+		Name: "web",
+		ContainerConfig: &ContainerBaseConfig{
+			Hostname:     "web",
+			Image:        "quay.io/skupper/qdrouterd:0.4",
+			Env:          map[string]string{"QDROUTERD_CONF_TYPE": "json"},
+			Labels:       map[string]string{"skupper.io/component": "proxy"},
+			ExposedPorts: nat.PortSet{"8080/tcp": {}},
+			User:         "1000:1000",
+		},
+		HostConfig: &ContainerHostConfig{
+			Mounts:       []MountPoint{{Type: TypeBind, Source: "/tmp/certs", Destination: "/etc/certs"}},
+			NetworkMode:  "skupper-network",
+			PortBindings: nat.PortMap{"8080/tcp": {{HostIP: "127.0.0.1", HostPort: "9080"}}},
+			ExtraHosts:   []string{"db:172.17.0.1"},
+			Privileged:   true,
+			RestartPolicy: RestartPolicy{
+				Name:              RestartPolicyOnFailure,
+				MaximumRetryCount: 3,
+			},
+			Resources: ContainerResources{
+				NanoCPUs: 500000000,
+				Memory:   64 * 1024 * 1024,
+			},
+		},
+		NetworkingConfig: &ContainerNetworkingConfig{
+			EndpointsConfig: map[string]*NetworkEndpointSetting{
+				"skupper-network": {Aliases: []string{"web-proxy"}},
+			},
+		},
+	}
+}
+
+func TestDockerContainerSpec(t *testing.T) {
+	opts := newDockerContainerSpec(proxyCreateOptions())
+
+	assert.Equal(t, opts.Config.User, "1000:1000")
+	assert.Assert(t, opts.Config.Healthcheck == nil)
+	assert.DeepEqual(t, opts.Config.Env, []string{"QDROUTERD_CONF_TYPE=json"})
+	assert.Equal(t, string(opts.HostConfig.NetworkMode), "skupper-network")
+	assert.DeepEqual(t, opts.HostConfig.PortBindings, nat.PortMap{"8080/tcp": {{HostIP: "127.0.0.1", HostPort: "9080"}}})
+	assert.DeepEqual(t, opts.HostConfig.ExtraHosts, []string{"db:172.17.0.1"})
+	assert.Equal(t, opts.HostConfig.RestartPolicy.Name, "on-failure")
+	assert.Equal(t, opts.HostConfig.RestartPolicy.MaximumRetryCount, 3)
+	assert.Equal(t, opts.HostConfig.NanoCPUs, int64(500000000))
+	assert.Equal(t, opts.HostConfig.Memory, int64(64*1024*1024))
+	assert.Assert(t, opts.HostConfig.Privileged)
+	assert.DeepEqual(t, opts.NetworkingConfig.EndpointsConfig["skupper-network"].Aliases, []string{"web-proxy"})
+}
+
+func TestPodmanContainerSpec(t *testing.T) {
+	sg, err := newPodmanContainerSpec(proxyCreateOptions())
+	assert.Check(t, err)
+
+	assert.Equal(t, sg.Hostname, "web")
+	assert.Equal(t, sg.User, "1000:1000")
+	assert.DeepEqual(t, sg.Labels, map[string]string{"skupper.io/component": "proxy"})
+	assert.Equal(t, sg.RestartPolicy, "on-failure")
+	assert.Equal(t, *sg.RestartRetries, uint(3))
+	assert.Equal(t, *sg.ResourceLimits.CPU.Quota, int64(50000))
+	assert.Equal(t, *sg.ResourceLimits.CPU.Period, uint64(100000))
+	assert.Equal(t, *sg.ResourceLimits.Memory.Limit, int64(64*1024*1024))
+	assert.Assert(t, sg.Privileged)
+	assert.DeepEqual(t, sg.CNINetworks, []string{"skupper-network"})
+	assert.DeepEqual(t, sg.Aliases, map[string][]string{"skupper-network": {"web-proxy"}})
+	assert.DeepEqual(t, sg.HostAdd, []string{"db:172.17.0.1"})
+	assert.DeepEqual(t, sg.Expose, map[uint16]string{8080: "tcp"})
+	assert.DeepEqual(t, sg.PortMappings, []specgen.PortMapping{
+		{HostIP: "127.0.0.1", ContainerPort: 8080, HostPort: 9080, Protocol: "tcp"},
+	})
+
+	options := proxyCreateOptions()
+	options.HostConfig.NetworkMode = "host"
+	sg, err = newPodmanContainerSpec(options)
+	assert.Check(t, err)
+	assert.Equal(t, sg.NetNS.NSMode, specgen.Host)
+	assert.Assert(t, sg.CNINetworks == nil)
+
+	options.HostConfig.PortBindings = nat.PortMap{"8080/tcp": {{HostPort: "http"}}}
+	_, err = newPodmanContainerSpec(options)
+	assert.ErrorContains(t, err, "Invalid host port http for 8080/tcp")
+}
+
+// podmanInspect returns what podman reports of a container created from the
+// spec, which keeps no exposed ports
+func podmanInspect(sg *specgen.SpecGenerator) *define.InspectContainerData {
+	env := []string{}
+	for k, v := range sg.Env {
+		env = append(env, k+"="+v)
+	}
+	annotations := map[string]string{"io.container.manager": "libpod"}
+	for k, v := range sg.Annotations {
+		annotations[k] = v
+	}
+	bindings := map[string][]define.InspectHostPort{}
+	for _, mapping := range sg.PortMappings {
+		port := fmt.Sprintf("%d/%s", mapping.ContainerPort, mapping.Protocol)
+		bindings[port] = append(bindings[port], define.InspectHostPort{HostIP: mapping.HostIP, HostPort: strconv.Itoa(int(mapping.HostPort))})
+	}
+	networks := map[string]*define.InspectAdditionalNetwork{}
+	for _, name := range sg.CNINetworks {
+		networks[name] = &define.InspectAdditionalNetwork{NetworkID: name, Aliases: sg.Aliases[name]}
+	}
+	return &define.InspectContainerData{
+		ID:    "0123456789abcdef",
+		Name:  sg.Name,
+		State: &define.InspectContainerState{Status: "running", Running: true},
+		Config: &define.InspectContainerConfig{
+			Hostname:    sg.Hostname,
+			Env:         env,
+			Cmd:         sg.Command,
+			Image:       sg.Image,
+			Labels:      sg.Labels,
+			Annotations: annotations,
+			User:        sg.User,
+		},
+		HostConfig: &define.InspectContainerHostConfig{
+			Privileged:   sg.Privileged,
+			ExtraHosts:   sg.HostAdd,
+			PortBindings: bindings,
+		},
+		NetworkSettings: &define.InspectNetworkSettings{Networks: networks},
+	}
+}
+
+func TestPodmanContainerSpecRoundTrip(t *testing.T) {
+	options := proxyCreateOptions()
+	options.ContainerConfig.ExposedPorts = nat.PortSet{"8080/tcp": {}, "5672/tcp": {}}
+	sg, err := newPodmanContainerSpec(options)
+	assert.Check(t, err)
+	assert.Equal(t, sg.Annotations[podmanExposedPortsAnnotation], "5672/tcp,8080/tcp")
+
+	current := podmanContainer(podmanInspect(sg))
+	spec := ContainerSpec(current)
+	assert.DeepEqual(t, spec.ContainerConfig.ExposedPorts, options.ContainerConfig.ExposedPorts)
+	assert.DeepEqual(t, spec.HostConfig.PortBindings, options.HostConfig.PortBindings)
+	assert.DeepEqual(t, spec.HostConfig.ExtraHosts, options.HostConfig.ExtraHosts)
+	assert.DeepEqual(t, spec.ContainerConfig.Labels, options.ContainerConfig.Labels)
+	assert.DeepEqual(t, spec.ContainerConfig.Env, options.ContainerConfig.Env)
+	assert.DeepEqual(t, spec.NetworkingConfig.EndpointsConfig, options.NetworkingConfig.EndpointsConfig)
+
+	// the published ports are exposed without the annotation, as docker
+	// reports them
+	options.ContainerConfig.ExposedPorts = nil
+	sg, err = newPodmanContainerSpec(options)
+	assert.Check(t, err)
+	_, ok := sg.Annotations[podmanExposedPortsAnnotation]
+	assert.Assert(t, !ok)
+	spec = ContainerSpec(podmanContainer(podmanInspect(sg)))
+	assert.DeepEqual(t, spec.ContainerConfig.ExposedPorts, nat.PortSet{"8080/tcp": {}})
+
+	// and the links of the endpoints are kept
+	data := podmanInspect(sg)
+	data.NetworkSettings.Networks["skupper-network"].Links = []string{"db"}
+	spec = ContainerSpec(podmanContainer(data))
+	assert.DeepEqual(t, spec.NetworkingConfig.EndpointsConfig["skupper-network"].Links, []string{"db"})
+}
+
+func TestHealthCheckSpec(t *testing.T) {
+	options := proxyCreateOptions()
+	options.ContainerConfig.HealthCheck = &HealthConfig{
+		Test:        []string{"CMD-SHELL", "curl --fail -s http://localhost:9090/healthz || exit 1"},
+		Interval:    5 * time.Second,
+		Timeout:     3 * time.Second,
+		StartPeriod: time.Minute,
+		Retries:     3,
+	}
+
+	opts := newDockerContainerSpec(options)
+	assert.DeepEqual(t, opts.Config.Healthcheck.Test, options.ContainerConfig.HealthCheck.Test)
+	assert.Equal(t, opts.Config.Healthcheck.Interval, 5*time.Second)
+	assert.Equal(t, opts.Config.Healthcheck.Timeout, 3*time.Second)
+	assert.Equal(t, opts.Config.Healthcheck.StartPeriod, time.Minute)
+	assert.Equal(t, opts.Config.Healthcheck.Retries, 3)
+
+	sg, err := newPodmanContainerSpec(options)
+	assert.Check(t, err)
+	assert.DeepEqual(t, sg.HealthConfig.Test, options.ContainerConfig.HealthCheck.Test)
+	assert.Equal(t, sg.HealthConfig.Interval, 5*time.Second)
+	assert.Equal(t, sg.HealthConfig.Timeout, 3*time.Second)
+	assert.Equal(t, sg.HealthConfig.StartPeriod, time.Minute)
+	assert.Equal(t, sg.HealthConfig.Retries, 3)
+}
+
+func TestContainerReached(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   string
+		status  string
+		health  *ContainerHealth
+		running time.Duration
+		reached bool
+		err     string
+	}{
+		{"running", "running", "running", nil, 0, true, ""},
+		{"created", "running", "created", nil, 0, false, ""},
+		{"healthy-without-check", HealthyState, "running", nil, 0, true, ""},
+		{"healthy", HealthyState, "running", &ContainerHealth{Status: HealthHealthy, Runs: 1}, 0, true, ""},
+		{"starting", HealthyState, "running", &ContainerHealth{Status: HealthStarting}, time.Second, false, ""},
+		{"check-not-run", HealthyState, "running", &ContainerHealth{Status: HealthStarting}, time.Hour, true, ""},
+		{"check-failing", HealthyState, "running", &ContainerHealth{Status: HealthStarting, FailingStreak: 1, Runs: 1}, time.Hour, false, ""},
+		{"unhealthy", HealthyState, "running", &ContainerHealth{Status: HealthUnhealthy, FailingStreak: 3, Runs: 3}, 0, false, ""},
+		{"not-started", HealthyState, "created", nil, 0, false, ""},
+		{"exited", HealthyState, "exited", nil, 0, false, "Container skupper-router exited before being healthy"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := &ContainerInspect{
+				Name:  "/skupper-router",
+				State: &ContainerState{Status: test.status, Running: test.status == "running", Health: test.health},
+			}
+			if test.running > 0 {
+				current.State.StartedAt = time.Now().Add(-test.running)
+			}
+			reached, err := ContainerReached(current, test.state)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+			} else {
+				assert.Check(t, err)
+			}
+			assert.Equal(t, reached, test.reached)
+		})
+	}
+}
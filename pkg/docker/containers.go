@@ -17,6 +17,7 @@ import (
 	"github.com/docker/go-connections/nat"
 
 	"github.com/ajssmith/skupper-exp/api/types"
+	"github.com/ajssmith/skupper-exp/driver"
 	"github.com/ajssmith/skupper-exp/pkg/docker/libdocker"
 	skupperutils "github.com/skupperproject/skupper/pkg/utils"
 )
@@ -85,7 +86,7 @@ func getLabels(service types.ServiceInterface, isLocal bool) map[string]string {
 	}
 }
 
-func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig string, mapToHost bool, osType string) *dockertypes.ContainerCreateConfig {
+func getProxyContainerCreateOptions(service types.ServiceInterface, qdrConfig string, mapToHost bool, osType string) *driver.ContainerCreateOptions {
 	var imageName string
 	if os.Getenv("QDROUTERD_IMAGE") != "" {
 		imageName = os.Getenv("QDROUTERD_IMAGE")
@@ -94,13 +95,14 @@ func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig str
 	}
 
 	labels := getLabels(service, true)
-	envVars := []string{}
-	envVars = append(envVars, os.Getenv("SKUPPER_TMPDIR"))
-	envVars = append(envVars, "QDROUTERD_CONF="+qdrConfig)
-	envVars = append(envVars, "QDROUTERD_CONF_TYPE=json")
-	envVars = append(envVars, "NAMESPACE=skupper")
+	envVars := map[string]string{
+		"SKUPPER_TMPDIR":      os.Getenv("SKUPPER_TMPDIR"),
+		"QDROUTERD_CONF":      qdrConfig,
+		"QDROUTERD_CONF_TYPE": "json",
+		"NAMESPACE":           "skupper",
+	}
 	if os.Getenv("PN_TRACE_FRM") != "" {
-		envVars = append(envVars, "PN_TRACE_FRM=1")
+		envVars["PN_TRACE_FRM"] = "1"
 	}
 
 	var host string
@@ -111,6 +113,11 @@ func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig str
 		host = "172.17.0.1"
 	}
 
+	network := types.TransportNetworkName
+	if os.Getenv("SKUPPER_NETWORK") != "" {
+		network = os.Getenv("SKUPPER_NETWORK")
+	}
+
 	extraHosts := []string{}
 	for _, t := range service.Targets {
 		if t.Selector == "internal.skupper.io/host-service" {
@@ -124,31 +131,31 @@ func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig str
 		}
 	}
 
-	containerCfg := &dockercontainer.Config{
+	containerCfg := &driver.ContainerBaseConfig{
 		Hostname: service.Address,
 		Image:    imageName,
 		Env:      envVars,
 		Labels:   labels,
 	}
 	if mapToHost {
-		containerCfg.ExposedPorts = make(map[nat.Port]struct{})
+		containerCfg.ExposedPorts = nat.PortSet{}
 		containerCfg.ExposedPorts[nat.Port(strconv.Itoa(service.Port)+"/"+service.Protocol)] = struct{}{}
 	}
 
-	hostCfg := &dockercontainer.HostConfig{
-		Mounts: []dockermounttypes.Mount{
+	hostCfg := &driver.ContainerHostConfig{
+		Mounts: []driver.MountPoint{
 			{
-				Type:   dockermounttypes.TypeBind,
-				Source: types.GetSkupperPath(types.CertsPath) + "/" + "skupper-internal",
-				Target: "/etc/qpid-dispatch-certs/skupper-internal/",
+				Type:        driver.TypeBind,
+				Source:      types.GetSkupperPath(types.CertsPath) + "/" + "skupper-internal",
+				Destination: "/etc/qpid-dispatch-certs/skupper-internal/",
 			},
 		},
-		NetworkMode: "skupper-network",
+		NetworkMode: network,
 		ExtraHosts:  extraHosts,
 		Privileged:  true,
 	}
 	if mapToHost {
-		hostCfg.PortBindings = make(map[nat.Port][]nat.PortBinding)
+		hostCfg.PortBindings = nat.PortMap{}
 		hostCfg.PortBindings[nat.Port(strconv.Itoa(service.Port)+"/"+service.Protocol)] = []nat.PortBinding{
 			{
 				HostPort: strconv.Itoa(service.Port),
@@ -156,30 +163,28 @@ func getProxyContainerCreateConfig(service types.ServiceInterface, qdrConfig str
 		}
 	}
 
-	networkCfg := &dockernetworktypes.NetworkingConfig{
-		EndpointsConfig: map[string]*dockernetworktypes.EndpointSettings{
-			types.TransportNetworkName: {},
+	networkCfg := &driver.ContainerNetworkingConfig{
+		EndpointsConfig: map[string]*driver.NetworkEndpointSetting{
+			network: {},
 		},
 	}
 
-	opts := &dockertypes.ContainerCreateConfig{
+	return &driver.ContainerCreateOptions{
 		Name:             service.Address,
-		Config:           containerCfg,
+		ContainerConfig:  containerCfg,
 		HostConfig:       hostCfg,
 		NetworkingConfig: networkCfg,
 	}
-
-	return opts
 }
 
-func NewProxyContainer(svcDef types.ServiceInterface, qdrConfig string, mapToHost bool, dd libdocker.Interface) (*dockertypes.ContainerCreateConfig, error) {
-	version, err := dd.ServerVersion()
+func NewProxyContainer(ctx context.Context, svcDef types.ServiceInterface, qdrConfig string, mapToHost bool, dd driver.Driver) (*driver.ContainerCreateOptions, error) {
+	info, err := dd.Info(ctx)
 	if err != nil {
 		return nil, err
 	}
-	opts := getProxyContainerCreateConfig(svcDef, qdrConfig, mapToHost, version.Os)
+	opts := getProxyContainerCreateOptions(svcDef, qdrConfig, mapToHost, info.OSType)
 
-	_, err = dd.CreateContainer(*opts)
+	_, err = dd.ContainerCreate(ctx, *opts)
 	if err != nil {
 		return nil, err
 	} else {
@@ -15,8 +15,11 @@ limitations under the License.
 package qdr
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ajssmith/skupper-exp/api/types"
 	"github.com/ajssmith/skupper-exp/driver"
@@ -41,6 +44,8 @@ type Connection struct {
 	Role       string `json:"role"`
 	Active     bool   `json:"active"`
 	Dir        string `json:"dir"`
+	Identity   string `json:"identity"`
+	User       string `json:"user"`
 }
 
 func getQuery(typename string) []string {
@@ -52,9 +57,108 @@ func getQuery(typename string) []string {
 	}
 }
 
-func GetConnectedSites(dd driver.Driver) (types.TransportConnectedSites, error) {
+func getCreate(typename string, name string, attributes map[string]interface{}) []string {
+	command := []string{
+		"qdmanage",
+		"create",
+		"--type",
+		typename,
+		"--name",
+		name,
+	}
+	keys := []string{}
+	for k := range attributes {
+		if k != "name" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		command = append(command, fmt.Sprintf("%s=%v", k, attributes[k]))
+	}
+	return command
+}
+
+func getDelete(typename string, name string) []string {
+	return []string{
+		"qdmanage",
+		"delete",
+		"--type",
+		typename,
+		"--name",
+		name,
+	}
+}
+
+// manage runs a management command against the running router, a command
+// the router refuses is an error
+func manage(ctx context.Context, dd driver.Driver, command []string) error {
+	current, err := dd.ContainerInspect(ctx, "skupper-router")
+	if err != nil {
+		return fmt.Errorf("Error retrieving skupper router container: %w", err)
+	}
+	execResult, err := dd.ContainerExec(ctx, current.ID, command)
+	if err != nil {
+		return err
+	}
+	if execResult.ExitCode != 0 {
+		return fmt.Errorf("%s failed: %s", strings.Join(command[:4], " "), strings.TrimSpace(execResult.Stderr()))
+	}
+	return nil
+}
+
+// createEntity creates the entity in the running router with the
+// attributes it has in the router config
+func createEntity(ctx context.Context, dd driver.Driver, typename string, name string, entity interface{}) error {
+	attributes := map[string]interface{}{}
+	err := convert(entity, &attributes)
+	if err != nil {
+		return err
+	}
+	return manage(ctx, dd, getCreate(typename, name, attributes))
+}
+
+// CreateSslProfile adds the sslProfile to the running router, its files
+// must be in place
+func CreateSslProfile(ctx context.Context, dd driver.Driver, profile SslProfile) error {
+	return createEntity(ctx, dd, "sslProfile", profile.Name, profile)
+}
+
+// DeleteSslProfile removes the sslProfile from the running router, no
+// connector may use it
+func DeleteSslProfile(ctx context.Context, dd driver.Driver, name string) error {
+	return manage(ctx, dd, getDelete("sslProfile", name))
+}
+
+// CreateConnector adds the connector to the running router, which
+// connects right away, its sslProfile must exist
+func CreateConnector(ctx context.Context, dd driver.Driver, connector Connector) error {
+	return createEntity(ctx, dd, "connector", connector.Name, connector)
+}
+
+// DeleteConnector removes the connector from the running router, which
+// closes its connection
+func DeleteConnector(ctx context.Context, dd driver.Driver, name string) error {
+	return manage(ctx, dd, getDelete("connector", name))
+}
+
+// CloseConnection closes the connection in the running router, a
+// connector opens it again
+func CloseConnection(ctx context.Context, dd driver.Driver, identity string) error {
+	return manage(ctx, dd, []string{
+		"qdmanage",
+		"update",
+		"--type",
+		"connection",
+		"--identity",
+		identity,
+		"adminStatus=deleted",
+	})
+}
+
+func GetConnectedSites(ctx context.Context, dd driver.Driver) (types.TransportConnectedSites, error) {
 	result := types.TransportConnectedSites{}
-	nodes, err := GetNodes(dd)
+	nodes, err := GetNodes(ctx, dd)
 	if err == nil {
 		for _, n := range nodes {
 			if n.NextHop == "" {
@@ -69,15 +173,15 @@ func GetConnectedSites(dd driver.Driver) (types.TransportConnectedSites, error)
 	return result, err
 }
 
-func GetNodes(dd driver.Driver) ([]RouterNode, error) {
+func GetNodes(ctx context.Context, dd driver.Driver) ([]RouterNode, error) {
 	command := getQuery("node")
 	results := []RouterNode{}
 
-	current, err := dd.ContainerInspect("skupper-router")
+	current, err := dd.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
 		return results, fmt.Errorf("Error retrieving skupper router contairne: %w", err)
 	}
-	execResult, err := dd.ContainerExec(current.ID, command)
+	execResult, err := dd.ContainerExec(ctx, current.ID, command)
 
 	if err != nil {
 		return nil, err
@@ -102,15 +206,15 @@ func GetInterRouterOrEdgeConnection(host string, connections []Connection) *Conn
 	return nil
 }
 
-func GetConnections(dd driver.Driver) ([]Connection, error) {
+func GetConnections(ctx context.Context, dd driver.Driver) ([]Connection, error) {
 	command := getQuery("connection")
 	results := []Connection{}
 
-	current, err := dd.ContainerInspect("skupper-router")
+	current, err := dd.ContainerInspect(ctx, "skupper-router")
 	if err != nil {
 		return results, fmt.Errorf("Error retrieving skupper router contairne: %w", err)
 	}
-	execResult, err := dd.ContainerExec(current.ID, command)
+	execResult, err := dd.ContainerExec(ctx, current.ID, command)
 	if err != nil {
 		return nil, err
 	} else {